@@ -1,6 +1,9 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,20 +25,318 @@ type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 }
 
-// Session represents a user session
+// RefreshRequest represents the token refresh request payload
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ForgotPasswordRequest represents the password reset request payload
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the password reset completion payload
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// VerifyEmailRequest represents the email verification payload
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest represents the verification email resend payload
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// TwoFactorCodeRequest represents a payload carrying a TOTP code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorChallengeRequest represents the second login step payload. Exactly
+// one of Code and RecoveryCode is expected when completing a login.
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// PasskeyRegistrationRequest represents the payload completing a passkey registration
+type PasskeyRegistrationRequest struct {
+	CeremonyID uuid.UUID `json:"ceremony_id" binding:"required"`
+	Name       string    `json:"name" binding:"max=100"`
+	// Credential is the PublicKeyCredential returned by navigator.credentials.create()
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// PasskeyLoginRequest represents the payload completing a passkey login
+type PasskeyLoginRequest struct {
+	CeremonyID uuid.UUID `json:"ceremony_id" binding:"required"`
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get()
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// CreatePersonalAccessTokenRequest represents the personal access token creation payload.
+// A token without ExpiresAt does not expire.
+type CreatePersonalAccessTokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Session represents a user session. A session is also a refresh token family:
+// TokenHash holds the digest of the family's current refresh token.
 type Session struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	TokenHash  string    `json:"-" gorm:"uniqueIndex"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Device     string    `json:"device"`
+	Browser    string    `json:"browser"`
+	Location   string    `json:"location"` // placeholder until a geo-IP provider is wired in
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ExpiresAt is the idle deadline, pushed forward on activity up to AbsoluteExpiresAt
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Scopes of personal access tokens and service account API keys. A scope
+// grants read (GET) or write (any other method) access to one resource; write
+// does not imply read.
+const (
+	ScopeUsersRead        = "users:read"
+	ScopeUsersWrite       = "users:write"
+	ScopeSessionsRead     = "sessions:read"
+	ScopeSessionsWrite    = "sessions:write"
+	ScopeMaintenanceRead  = "maintenance:read"
+	ScopeMaintenanceWrite = "maintenance:write"
+)
+
+// TokenScopes lists the scopes a personal access token or API key can be granted
+var TokenScopes = []string{
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopeSessionsRead, ScopeSessionsWrite,
+	ScopeMaintenanceRead, ScopeMaintenanceWrite,
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, so that
+// tokens are recognizable in logs and by secret scanners
+const PersonalAccessTokenPrefix = "pat_"
+
+// PersonalAccessToken represents a long-lived token a user issues to a
+// script or other machine client. Only the token's digest is stored; Prefix
+// holds its first characters so the token can be identified in listings and
+// logs.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedPersonalAccessToken is returned when a personal access token is
+// created. Token is shown once and cannot be retrieved again.
+type CreatedPersonalAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// ClientInfo describes the client a session is created from
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// RefreshToken represents a refresh token that has already been rotated out of
+// its session's family. Presenting one again is treated as token reuse.
+type RefreshToken struct {
 	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
-	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
-	Token     string    `json:"token"`
+	SessionID uuid.UUID `json:"session_id" gorm:"type:uuid;not null;index"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	RotatedAt time.Time `json:"rotated_at"`
 	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// LoginResponse represents the login response payload
+// SessionResponse represents a session in session listings
+type SessionResponse struct {
+	Session
+	Current bool `json:"current"`
+}
+
+// LoginAttempt tracks recent failed logins for a throttling key, such as an
+// email address or a source IP address
+type LoginAttempt struct {
+	Key           string    `json:"key" gorm:"primaryKey"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	BlockedUntil  time.Time `json:"blocked_until"`
+}
+
+// PasswordResetToken represents a single-use password reset token. Only the
+// token's digest is stored; UsedAt is set when the token is redeemed.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TOTPCredential holds a user's TOTP enrollment. Secret is encrypted at rest;
+// the credential only protects logins once ConfirmedAt is set.
+type TOTPCredential struct {
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Secret      string     `json:"-" gorm:"not null"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	// LastUsedStep is the time step of the last accepted code, to reject replays
+	LastUsedStep int64     `json:"-" gorm:"not null;default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RecoveryCode represents a one-time two-factor recovery code. Only a keyed
+// digest of the code is stored; UsedAt is set when the code is redeemed.
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// WebAuthnCredential represents a passkey registered to a user. SignCount is
+// the last signature counter the authenticator reported, used to detect
+// cloned authenticators.
+type WebAuthnCredential struct {
+	ID              uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID          uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name            string    `json:"name"`
+	CredentialID    []byte    `json:"-" gorm:"uniqueIndex;not null"`
+	PublicKey       []byte    `json:"-" gorm:"not null"`
+	AttestationType string    `json:"-"`
+	AAGUID          []byte    `json:"-"`
+	// Transports is a comma-separated list of the transports the authenticator supports
+	Transports     string     `json:"transports"`
+	SignCount      int64      `json:"sign_count" gorm:"not null;default:0"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackupState    bool       `json:"backup_state"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebAuthnCeremony holds the server side state of a passkey registration or
+// login between its begin and finish steps. A ceremony can be finished once.
+type WebAuthnCeremony struct {
+	ID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	// UserID is set for registrations and nil for logins, where the user is not known up front
+	UserID    *uuid.UUID `gorm:"type:uuid"`
+	Kind      string     `gorm:"not null"`
+	Data      []byte     `gorm:"not null"` // JSON encoded webauthn.SessionData
+	ExpiresAt time.Time  `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// PasskeyCeremony is returned by the begin step of a passkey registration or
+// login. Options is passed to navigator.credentials.create() or .get() as is.
+type PasskeyCeremony struct {
+	CeremonyID uuid.UUID   `json:"ceremony_id"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+	Options    interface{} `json:"options"`
+}
+
+// Identity links an account at an external OpenID Connect provider to a
+// user. Subject is the provider's stable identifier for the account.
+type Identity struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Provider    string     `json:"provider" gorm:"not null;uniqueIndex:idx_identities_provider_subject"`
+	Subject     string     `json:"subject" gorm:"not null;uniqueIndex:idx_identities_provider_subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// OIDCLoginState holds a started external login until the provider redirects
+// back. Only the digest of the state parameter is stored; the nonce and PKCE
+// verifier never leave the server.
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"primaryKey"`
+	Provider     string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+// OIDCAuthorization is a started external login: the user agent is sent to
+// URL, and State must come back with the provider's redirect
+type OIDCAuthorization struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+// TwoFactorChallenge is returned by the first login step when the account
+// needs a second factor. EnrollmentRequired is set when the user's role
+// requires two-factor authentication but the user has not enrolled yet.
+type TwoFactorChallenge struct {
+	TwoFactorRequired  bool      `json:"two_factor_required"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ChallengeToken     string    `json:"challenge_token"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// TwoFactorEnrollment represents a pending TOTP enrollment
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatus represents a user's two-factor authentication state
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// RecoveryCodesResponse represents newly generated recovery codes. They are
+// shown once and cannot be retrieved again.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginResponse represents the login and refresh response payload
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  domain.User `json:"user"`
+	Token            string      `json:"token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresAt        time.Time   `json:"expires_at"`
+	RefreshToken     string      `json:"refresh_token"`
+	RefreshExpiresAt time.Time   `json:"refresh_expires_at"`
+	User             domain.User `json:"user"`
+	// RecoveryCodes is only set when a login completes two-factor enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// HashToken returns the SHA-256 digest under which an opaque token is stored.
+// Tokens are 256-bit random values, so an unsalted digest is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // BeforeCreate hook runs before creating a new session
@@ -53,3 +354,123 @@ func (s *Session) BeforeUpdate(tx *gorm.DB) (err error) {
 	s.UpdatedAt = time.Now()
 	return
 }
+
+// TableName returns the table name for the RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// BeforeCreate hook runs before creating a new refresh token record
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return
+}
+
+// TableName returns the table name for the LoginAttempt model
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
+
+// TableName returns the table name for the PasswordResetToken model
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// BeforeCreate hook runs before creating a new password reset token
+func (t *PasswordResetToken) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	t.CreatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the TOTPCredential model
+func (TOTPCredential) TableName() string {
+	return "totp_credentials"
+}
+
+// TableName returns the table name for the RecoveryCode model
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// BeforeCreate hook runs before creating a new recovery code
+func (r *RecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	r.CreatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the WebAuthnCredential model
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// BeforeCreate hook runs before creating a new WebAuthn credential
+func (w *WebAuthnCredential) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = time.Now()
+	return
+}
+
+// BeforeUpdate hook runs before updating a WebAuthn credential
+func (w *WebAuthnCredential) BeforeUpdate(tx *gorm.DB) (err error) {
+	w.UpdatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the WebAuthnCeremony model
+func (WebAuthnCeremony) TableName() string {
+	return "webauthn_ceremonies"
+}
+
+// BeforeCreate hook runs before creating a new WebAuthn ceremony
+func (w *WebAuthnCeremony) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	w.CreatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the Identity model
+func (Identity) TableName() string {
+	return "identities"
+}
+
+// BeforeCreate hook runs before creating a new identity
+func (i *Identity) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	i.CreatedAt = time.Now()
+	i.UpdatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the OIDCLoginState model
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// TableName returns the table name for the PersonalAccessToken model
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// BeforeCreate hook runs before creating a new personal access token
+func (t *PersonalAccessToken) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	t.CreatedAt = time.Now()
+	return
+}
@@ -0,0 +1,73 @@
+package principal
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+// contextKey is the gin context key the auth middleware stores the principal under
+const contextKey = "principal"
+
+// Type identifies what kind of account a principal is
+type Type string
+
+const (
+	TypeUser           Type = "user"
+	TypeServiceAccount Type = "service_account"
+)
+
+// Principal is the authenticated caller of a request: a user, or a service
+// account acting for automation. Users authenticate with a session or a
+// personal access token, service accounts with an API key or the client
+// credentials grant.
+type Principal struct {
+	Type  Type                `json:"type"`
+	ID    uuid.UUID           `json:"id"`
+	Name  string              `json:"name"`
+	Email string              `json:"email,omitempty"` // users only
+	Role  userDomain.UserRole `json:"role"`
+	// SessionID is the session a user logged in with; it is nil for requests
+	// authenticated with a token or key
+	SessionID uuid.UUID `json:"-"`
+	// CredentialID and CredentialPrefix identify the personal access token or
+	// API key a request was authenticated with
+	CredentialID     uuid.UUID `json:"-"`
+	CredentialPrefix string    `json:"-"`
+	// Scopes limit what a token or key can do; a session is not limited
+	Scopes []string `json:"-"`
+}
+
+// IsUser reports whether the principal is a user
+func (p *Principal) IsUser() bool {
+	return p.Type == TypeUser
+}
+
+// HasSession reports whether the principal logged in interactively
+func (p *Principal) HasSession() bool {
+	return p.SessionID != uuid.Nil
+}
+
+// HasScope reports whether the principal may act within scope. Sessions may
+// do anything their role allows.
+func (p *Principal) HasScope(scope string) bool {
+	return p.HasSession() || slices.Contains(p.Scopes, scope)
+}
+
+// Set stores the principal of a request in its context
+func Set(c *gin.Context, p *Principal) {
+	c.Set(contextKey, p)
+}
+
+// FromContext returns the principal the auth middleware stored in a request's context
+func FromContext(c *gin.Context) (*Principal, bool) {
+	value, exists := c.Get(contextKey)
+	if !exists {
+		return nil, false
+	}
+	p, ok := value.(*Principal)
+	return p, ok
+}
@@ -0,0 +1,47 @@
+package principal
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+func TestPrincipal(t *testing.T) {
+	t.Run("Sessions Are Not Limited By Scope", func(t *testing.T) {
+		p := &Principal{Type: TypeUser, ID: uuid.New(), SessionID: uuid.New()}
+		assert.True(t, p.HasSession())
+		assert.True(t, p.HasScope("users:write"))
+	})
+
+	t.Run("Credentials Are Limited By Scope", func(t *testing.T) {
+		p := &Principal{
+			Type:         TypeServiceAccount,
+			ID:           uuid.New(),
+			Role:         userDomain.RoleAdmin,
+			CredentialID: uuid.New(),
+			Scopes:       []string{"users:read"},
+		}
+		assert.False(t, p.HasSession())
+		assert.False(t, p.IsUser())
+		assert.True(t, p.HasScope("users:read"))
+		assert.False(t, p.HasScope("users:write"))
+	})
+
+	t.Run("Context Round Trip", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		_, ok := FromContext(c)
+		assert.False(t, ok)
+
+		p := &Principal{Type: TypeUser, ID: uuid.New()}
+		Set(c, p)
+		got, ok := FromContext(c)
+		require.True(t, ok)
+		assert.Same(t, p, got)
+	})
+}
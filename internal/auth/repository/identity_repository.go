@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// IdentityRepository handles external identity and OIDC login state database operations
+type IdentityRepository struct {
+	db *database.Database
+}
+
+// NewIdentityRepository creates a new identity repository
+func NewIdentityRepository(db *database.Database) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// Create links a new external identity to a user
+func (r *IdentityRepository) Create(ctx context.Context, identity *domain.Identity) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(identity).Error
+}
+
+// GetByProviderSubject retrieves the identity a provider knows by subject
+func (r *IdentityRepository) GetByProviderSubject(
+	ctx context.Context, provider, subject string,
+) (*domain.Identity, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var identity domain.Identity
+	err := db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &identity, err
+}
+
+// RecordLogin stores the email the provider last reported and the login time
+func (r *IdentityRepository) RecordLogin(
+	ctx context.Context, identity *domain.Identity, email string, at time.Time,
+) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	identity.Email = email
+	identity.LastLoginAt = &at
+	identity.UpdatedAt = at
+	return db.Model(identity).Updates(map[string]interface{}{
+		"email":         email,
+		"last_login_at": at,
+		"updated_at":    at,
+	}).Error
+}
+
+// DeleteByUserID unlinks all of a user's external identities
+func (r *IdentityRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Where("user_id = ?", userID).Delete(&domain.Identity{}).Error
+}
+
+// CreateLoginState stores a started login
+func (r *IdentityRepository) CreateLoginState(ctx context.Context, state *domain.OIDCLoginState) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(state).Error
+}
+
+// DeleteExpiredLoginStates deletes up to limit expired login states,
+// returning how many were deleted
+func (r *IdentityRepository) DeleteExpiredLoginStates(ctx context.Context, limit int) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	expired := db.Model(&domain.OIDCLoginState{}).Select("state_hash").Where("expires_at < ?", time.Now()).Limit(limit)
+	result := db.Where("state_hash IN (?)", expired).Delete(&domain.OIDCLoginState{})
+	return result.RowsAffected, result.Error
+}
+
+// ConsumeLoginState atomically deletes an unexpired login state of a provider
+// and returns it. It returns nil if the state is unknown, expired or was
+// already used, so that each authorization response is accepted at most once.
+func (r *IdentityRepository) ConsumeLoginState(
+	ctx context.Context, provider, state string, at time.Time,
+) (*domain.OIDCLoginState, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var consumed []domain.OIDCLoginState
+	err := db.Clauses(clause.Returning{}).
+		Where("state_hash = ? AND provider = ? AND expires_at > ?", domain.HashToken(state), provider, at).
+		Delete(&consumed).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(consumed) == 0 {
+		return nil, nil
+	}
+	return &consumed[0], nil
+}
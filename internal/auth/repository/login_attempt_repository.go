@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// LoginAttemptRepository handles failed login tracking database operations
+type LoginAttemptRepository struct {
+	db *database.Database
+}
+
+// NewLoginAttemptRepository creates a new login attempt repository
+func NewLoginAttemptRepository(db *database.Database) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// GetByKeys retrieves the attempt records that exist for the given keys
+func (r *LoginAttemptRepository) GetByKeys(ctx context.Context, keys []string) ([]domain.LoginAttempt, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var attempts []domain.LoginAttempt
+	err := db.Where("key IN ?", keys).Find(&attempts).Error
+	return attempts, err
+}
+
+// RecordFailure atomically counts a failed login for key and returns the updated record.
+// Failures recorded before resetBefore are forgotten and counting starts over.
+func (r *LoginAttemptRepository) RecordFailure(
+	ctx context.Context, key string, at, resetBefore time.Time,
+) (*domain.LoginAttempt, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var attempt domain.LoginAttempt
+	err := db.Raw(`
+		INSERT INTO login_attempts (key, failures, last_failure_at, blocked_until)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < ? THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING key, failures, last_failure_at, blocked_until`,
+		key, at, at, resetBefore,
+	).Scan(&attempt).Error
+	return &attempt, err
+}
+
+// SetBlockedUntil blocks further login attempts for key until the given time
+func (r *LoginAttemptRepository) SetBlockedUntil(ctx context.Context, key string, until time.Time) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Model(&domain.LoginAttempt{}).
+		Where("key = ?", key).
+		Update("blocked_until", until).Error
+}
+
+// DeleteByKey clears the failure history for key
+func (r *LoginAttemptRepository) DeleteByKey(ctx context.Context, key string) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Where("key = ?", key).Delete(&domain.LoginAttempt{}).Error
+}
+
+// DeleteExpired deletes up to limit records whose last failure was before
+// forgetBefore and that no longer block logins, returning how many were
+// deleted. Callers purge a backlog by calling it until the count falls below
+// limit.
+func (r *LoginAttemptRepository) DeleteExpired(ctx context.Context, forgetBefore time.Time, limit int) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	expired := db.Model(&domain.LoginAttempt{}).Select("key").
+		Where("last_failure_at < ? AND blocked_until < ?", forgetBefore, time.Now()).
+		Limit(limit)
+	result := db.Where("key IN (?)", expired).Delete(&domain.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// MemoryLoginAttemptStore keeps failed login counts in process memory. It is
+// meant for tests and does not persist anything.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]domain.LoginAttempt
+}
+
+// NewMemoryLoginAttemptStore creates a new in-memory login attempt store
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]domain.LoginAttempt)}
+}
+
+// GetByKeys retrieves the attempt records that exist for the given keys
+func (s *MemoryLoginAttemptStore) GetByKeys(ctx context.Context, keys []string) ([]domain.LoginAttempt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attempts []domain.LoginAttempt
+	for _, key := range keys {
+		if attempt, ok := s.attempts[key]; ok {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+// RecordFailure counts a failed login for key and returns the updated record.
+// Failures recorded before resetBefore are forgotten and counting starts over.
+func (s *MemoryLoginAttemptStore) RecordFailure(
+	ctx context.Context, key string, at, resetBefore time.Time,
+) (*domain.LoginAttempt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	switch {
+	case !ok:
+		attempt = domain.LoginAttempt{Key: key, Failures: 1, BlockedUntil: at}
+	case attempt.LastFailureAt.Before(resetBefore):
+		attempt.Failures = 1
+	default:
+		attempt.Failures++
+	}
+	attempt.LastFailureAt = at
+	s.attempts[key] = attempt
+	return &attempt, nil
+}
+
+// SetBlockedUntil blocks further login attempts for key until the given time
+func (s *MemoryLoginAttemptStore) SetBlockedUntil(ctx context.Context, key string, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.BlockedUntil = until
+		s.attempts[key] = attempt
+	}
+	return nil
+}
+
+// DeleteByKey clears the failure history for key
+func (s *MemoryLoginAttemptStore) DeleteByKey(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// DeleteExpired deletes up to limit records whose last failure was before
+// forgetBefore and that no longer block logins, returning how many were deleted
+func (s *MemoryLoginAttemptStore) DeleteExpired(
+	ctx context.Context, forgetBefore time.Time, limit int,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for key, attempt := range s.attempts {
+		if deleted < int64(limit) && attempt.LastFailureAt.Before(forgetBefore) && attempt.BlockedUntil.Before(now) {
+			delete(s.attempts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Snapshot records the attempt records in the store and returns a function
+// that puts them back, undoing every change made in between
+func (s *MemoryLoginAttemptStore) Snapshot() (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := maps.Clone(s.attempts)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.attempts = attempts
+	}
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// MemoryPasskeyStore keeps WebAuthn credentials and ceremonies in process
+// memory. It is meant for tests and does not persist anything.
+type MemoryPasskeyStore struct {
+	mu          sync.Mutex
+	credentials map[uuid.UUID]domain.WebAuthnCredential
+	ceremonies  map[uuid.UUID]domain.WebAuthnCeremony
+}
+
+// NewMemoryPasskeyStore creates a new in-memory passkey store
+func NewMemoryPasskeyStore() *MemoryPasskeyStore {
+	return &MemoryPasskeyStore{
+		credentials: make(map[uuid.UUID]domain.WebAuthnCredential),
+		ceremonies:  make(map[uuid.UUID]domain.WebAuthnCeremony),
+	}
+}
+
+// Create stores a newly registered credential
+func (s *MemoryPasskeyStore) Create(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = credential.BeforeCreate(nil)
+	if _, exists := s.credentials[credential.ID]; exists {
+		return errors.New("duplicate passkey id")
+	}
+	for _, stored := range s.credentials {
+		if bytes.Equal(stored.CredentialID, credential.CredentialID) {
+			return errors.New("duplicate credential id")
+		}
+	}
+	s.credentials[credential.ID] = *credential
+	return nil
+}
+
+// GetByUserID retrieves all credentials registered to a user, oldest first
+func (s *MemoryPasskeyStore) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var credentials []domain.WebAuthnCredential
+	for _, credential := range s.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool { return credentials[i].CreatedAt.Before(credentials[j].CreatedAt) })
+	return credentials, nil
+}
+
+// RecordUse stores the signature counter and backup state reported by a
+// successful login. It reports false if the stored counter has meanwhile
+// reached signCount.
+func (s *MemoryPasskeyStore) RecordUse(
+	ctx context.Context, id uuid.UUID, signCount int64, backupState bool, at time.Time,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, ok := s.credentials[id]
+	if !ok || !(credential.SignCount < signCount || (credential.SignCount == 0 && signCount == 0)) {
+		return false, nil
+	}
+	credential.SignCount = signCount
+	credential.BackupState = backupState
+	credential.LastUsedAt = &at
+	credential.UpdatedAt = at
+	s.credentials[id] = credential
+	return true, nil
+}
+
+// DeleteByID deletes one of a user's credentials and reports whether it existed
+func (s *MemoryPasskeyStore) DeleteByID(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if credential, ok := s.credentials[id]; !ok || credential.UserID != userID {
+		return false, nil
+	}
+	delete(s.credentials, id)
+	return true, nil
+}
+
+// CreateCeremony stores the state of a started ceremony
+func (s *MemoryPasskeyStore) CreateCeremony(ctx context.Context, ceremony *domain.WebAuthnCeremony) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = ceremony.BeforeCreate(nil)
+	if _, exists := s.ceremonies[ceremony.ID]; exists {
+		return errors.New("duplicate ceremony id")
+	}
+	s.ceremonies[ceremony.ID] = *ceremony
+	return nil
+}
+
+// ConsumeCeremony deletes an unexpired ceremony of the given kind and returns
+// it. It returns nil if the ceremony is unknown, expired or was already
+// finished.
+func (s *MemoryPasskeyStore) ConsumeCeremony(
+	ctx context.Context, id uuid.UUID, kind string, at time.Time,
+) (*domain.WebAuthnCeremony, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony, ok := s.ceremonies[id]
+	if !ok || ceremony.Kind != kind || !ceremony.ExpiresAt.After(at) {
+		return nil, nil
+	}
+	delete(s.ceremonies, id)
+	return &ceremony, nil
+}
+
+// DeleteExpired deletes up to limit expired ceremonies, returning how many
+// were deleted
+func (s *MemoryPasskeyStore) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for id, ceremony := range s.ceremonies {
+		if deleted < int64(limit) && ceremony.ExpiresAt.Before(now) {
+			delete(s.ceremonies, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// MemoryPasswordResetStore keeps password reset tokens in process memory. It
+// is meant for tests and does not persist anything.
+type MemoryPasswordResetStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]domain.PasswordResetToken
+}
+
+// NewMemoryPasswordResetStore creates a new in-memory password reset token store
+func NewMemoryPasswordResetStore() *MemoryPasswordResetStore {
+	return &MemoryPasswordResetStore{tokens: make(map[uuid.UUID]domain.PasswordResetToken)}
+}
+
+// Create stores a new password reset token
+func (s *MemoryPasswordResetStore) Create(ctx context.Context, resetToken *domain.PasswordResetToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = resetToken.BeforeCreate(nil)
+	if _, exists := s.tokens[resetToken.ID]; exists {
+		return errors.New("duplicate password reset token id")
+	}
+	for _, stored := range s.tokens {
+		if stored.TokenHash == resetToken.TokenHash {
+			return ErrDuplicateToken
+		}
+	}
+	s.tokens[resetToken.ID] = *resetToken
+	return nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it. It returns
+// nil if the token is unknown, expired or already used.
+func (s *MemoryPasswordResetStore) Consume(
+	ctx context.Context, token string, at time.Time,
+) (*domain.PasswordResetToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := domain.HashToken(token)
+	for id, stored := range s.tokens {
+		if stored.TokenHash != hash || stored.UsedAt != nil || !stored.ExpiresAt.After(at) {
+			continue
+		}
+		stored.UsedAt = &at
+		s.tokens[id] = stored
+		return &stored, nil
+	}
+	return nil, nil
+}
+
+// DeleteByUserID deletes all of a user's password reset tokens
+func (s *MemoryPasswordResetStore) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maps.DeleteFunc(s.tokens, func(_ uuid.UUID, stored domain.PasswordResetToken) bool {
+		return stored.UserID == userID
+	})
+	return nil
+}
+
+// Snapshot records the tokens in the store and returns a function that puts
+// them back, undoing every change made in between
+func (s *MemoryPasswordResetStore) Snapshot() (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := maps.Clone(s.tokens)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.tokens = tokens
+	}
+}
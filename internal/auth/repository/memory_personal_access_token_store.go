@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// MemoryPersonalAccessTokenStore keeps personal access tokens in process
+// memory. It is meant for tests and does not persist anything.
+type MemoryPersonalAccessTokenStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]domain.PersonalAccessToken
+}
+
+// NewMemoryPersonalAccessTokenStore creates a new in-memory personal access token store
+func NewMemoryPersonalAccessTokenStore() *MemoryPersonalAccessTokenStore {
+	return &MemoryPersonalAccessTokenStore{tokens: make(map[uuid.UUID]domain.PersonalAccessToken)}
+}
+
+// Create stores a new personal access token
+func (s *MemoryPersonalAccessTokenStore) Create(ctx context.Context, accessToken *domain.PersonalAccessToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = accessToken.BeforeCreate(nil)
+	if _, exists := s.tokens[accessToken.ID]; exists {
+		return errors.New("duplicate personal access token id")
+	}
+	for _, stored := range s.tokens {
+		if stored.TokenHash == accessToken.TokenHash {
+			return ErrDuplicateToken
+		}
+	}
+	s.tokens[accessToken.ID] = *accessToken
+	return nil
+}
+
+// GetByToken retrieves the unexpired personal access token matching a raw token
+func (s *MemoryPersonalAccessTokenStore) GetByToken(
+	ctx context.Context, rawToken string, at time.Time,
+) (*domain.PersonalAccessToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := domain.HashToken(rawToken)
+	for _, accessToken := range s.tokens {
+		if accessToken.TokenHash == hash && (accessToken.ExpiresAt == nil || accessToken.ExpiresAt.After(at)) {
+			return &accessToken, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetByUserID retrieves all personal access tokens of a user, including
+// expired ones, oldest first
+func (s *MemoryPersonalAccessTokenStore) GetByUserID(
+	ctx context.Context, userID uuid.UUID,
+) ([]domain.PersonalAccessToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var accessTokens []domain.PersonalAccessToken
+	for _, accessToken := range s.tokens {
+		if accessToken.UserID == userID {
+			accessTokens = append(accessTokens, accessToken)
+		}
+	}
+	sort.Slice(accessTokens, func(i, j int) bool { return accessTokens[i].CreatedAt.Before(accessTokens[j].CreatedAt) })
+	return accessTokens, nil
+}
+
+// RecordUse stores when and from where a token was last used, unless that was
+// already recorded after staleBefore
+func (s *MemoryPersonalAccessTokenStore) RecordUse(
+	ctx context.Context, id uuid.UUID, ipAddress string, at, staleBefore time.Time,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accessToken, ok := s.tokens[id]
+	if !ok || (accessToken.LastUsedAt != nil && !accessToken.LastUsedAt.Before(staleBefore)) {
+		return nil
+	}
+	accessToken.LastUsedAt = &at
+	accessToken.LastUsedIP = ipAddress
+	s.tokens[id] = accessToken
+	return nil
+}
+
+// DeleteByID deletes one of a user's personal access tokens and reports whether it existed
+func (s *MemoryPersonalAccessTokenStore) DeleteByID(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if accessToken, ok := s.tokens[id]; !ok || accessToken.UserID != userID {
+		return false, nil
+	}
+	delete(s.tokens, id)
+	return true, nil
+}
@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// ErrDuplicateToken is returned by the memory stores for a token another
+// session, spent refresh token, reset token or personal access token has,
+// where Postgres would report a unique constraint violation
+var ErrDuplicateToken = errors.New("duplicate token")
+
+// MemorySessionStore keeps sessions in process memory. It is meant for tests
+// and does not persist anything.
+type MemorySessionStore struct {
+	mu            sync.Mutex
+	sessions      map[uuid.UUID]domain.Session
+	refreshTokens map[uuid.UUID]domain.RefreshToken
+}
+
+// NewMemorySessionStore creates a new in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:      make(map[uuid.UUID]domain.Session),
+		refreshTokens: make(map[uuid.UUID]domain.RefreshToken),
+	}
+}
+
+// Create creates a new session
+func (s *MemorySessionStore) Create(ctx context.Context, session *domain.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = session.BeforeCreate(nil)
+	if _, exists := s.sessions[session.ID]; exists {
+		return errors.New("duplicate session id")
+	}
+	if s.findByHash(session.TokenHash) != nil {
+		return ErrDuplicateToken
+	}
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+// GetByToken retrieves an unexpired session by the digest of its token
+func (s *MemorySessionStore) GetByToken(ctx context.Context, token string) (*domain.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.findByHash(domain.HashToken(token))
+	if session == nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// GetByID retrieves an unexpired session by ID
+func (s *MemorySessionStore) GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// GetByUserID retrieves all unexpired sessions of a user, most recent first
+func (s *MemorySessionStore) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var sessions []domain.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// DeleteByToken deletes a session by the digest of its token
+func (s *MemorySessionStore) DeleteByToken(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session := s.findByHash(domain.HashToken(token)); session != nil {
+		delete(s.sessions, session.ID)
+	}
+	return nil
+}
+
+// DeleteByID deletes a session and its refresh token family by ID
+func (s *MemorySessionStore) DeleteByID(ctx context.Context, id uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteSession(id)
+	return nil
+}
+
+// DeleteByUserID deletes all sessions and refresh token families of a user
+func (s *MemorySessionStore) DeleteByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			s.deleteSession(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// RotateToken replaces a session's current refresh token and records the old
+// one as spent until the session's absolute expiry. It returns false if the
+// session no longer holds oldToken, which means another request already
+// rotated it.
+func (s *MemorySessionStore) RotateToken(
+	ctx context.Context, session *domain.Session, oldToken, newToken string, expiresAt time.Time,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[session.ID]
+	if !ok || stored.TokenHash != domain.HashToken(oldToken) {
+		return false, nil
+	}
+	if s.findByHash(domain.HashToken(newToken)) != nil || s.findRotated(domain.HashToken(oldToken)) != nil {
+		return false, ErrDuplicateToken
+	}
+
+	now := time.Now()
+	spent := domain.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: domain.HashToken(oldToken),
+		RotatedAt: now,
+		ExpiresAt: spentExpiry(session, expiresAt),
+	}
+	_ = spent.BeforeCreate(nil)
+	s.refreshTokens[spent.ID] = spent
+
+	stored.TokenHash = domain.HashToken(newToken)
+	stored.ExpiresAt = expiresAt
+	stored.LastSeenAt = now
+	stored.UpdatedAt = now
+	s.sessions[session.ID] = stored
+
+	session.TokenHash = stored.TokenHash
+	session.ExpiresAt = expiresAt
+	session.LastSeenAt = now
+	return true, nil
+}
+
+// RecordActivity sets a session's last-seen time and idle expiry unless activity
+// was already recorded after since
+func (s *MemorySessionStore) RecordActivity(
+	ctx context.Context, id uuid.UUID, seenAt, expiresAt, since time.Time,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || !session.LastSeenAt.Before(since) {
+		return nil
+	}
+	session.LastSeenAt = seenAt
+	session.ExpiresAt = expiresAt
+	s.sessions[id] = session
+	return nil
+}
+
+// GetRotatedToken retrieves a spent refresh token by the digest of its token
+func (s *MemorySessionStore) GetRotatedToken(ctx context.Context, token string) (*domain.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findRotated(domain.HashToken(token)), nil
+}
+
+// DeleteExpired deletes up to limit expired sessions and up to limit expired
+// spent refresh tokens, returning how many of each were deleted
+func (s *MemorySessionStore) DeleteExpired(
+	ctx context.Context, limit int,
+) (sessions, refreshTokens int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, refreshToken := range s.refreshTokens {
+		if refreshTokens < int64(limit) && refreshToken.ExpiresAt.Before(now) {
+			delete(s.refreshTokens, id)
+			refreshTokens++
+		}
+	}
+	for id, session := range s.sessions {
+		if sessions < int64(limit) && session.ExpiresAt.Before(now) {
+			delete(s.sessions, id)
+			sessions++
+		}
+	}
+	return sessions, refreshTokens, nil
+}
+
+// Snapshot records the sessions and spent refresh tokens in the store and
+// returns a function that puts them back, undoing every change made in between
+func (s *MemorySessionStore) Snapshot() (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, refreshTokens := maps.Clone(s.sessions), maps.Clone(s.refreshTokens)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.sessions, s.refreshTokens = sessions, refreshTokens
+	}
+}
+
+// findByHash returns a copy of the session holding the token digest hash
+func (s *MemorySessionStore) findByHash(hash string) *domain.Session {
+	for _, session := range s.sessions {
+		if session.TokenHash == hash {
+			return &session
+		}
+	}
+	return nil
+}
+
+// findRotated returns a copy of the spent refresh token with the digest hash
+func (s *MemorySessionStore) findRotated(hash string) *domain.RefreshToken {
+	for _, refreshToken := range s.refreshTokens {
+		if refreshToken.TokenHash == hash {
+			return &refreshToken
+		}
+	}
+	return nil
+}
+
+// deleteSession deletes a session and its refresh token family
+func (s *MemorySessionStore) deleteSession(id uuid.UUID) {
+	for tokenID, refreshToken := range s.refreshTokens {
+		if refreshToken.SessionID == id {
+			delete(s.refreshTokens, tokenID)
+		}
+	}
+	delete(s.sessions, id)
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// MemoryTwoFactorStore keeps TOTP credentials and recovery codes in process
+// memory. It is meant for tests and does not persist anything.
+type MemoryTwoFactorStore struct {
+	mu          sync.Mutex
+	credentials map[uuid.UUID]domain.TOTPCredential // user ID -> credential
+	codes       map[uuid.UUID]domain.RecoveryCode
+}
+
+// NewMemoryTwoFactorStore creates a new in-memory two-factor store
+func NewMemoryTwoFactorStore() *MemoryTwoFactorStore {
+	return &MemoryTwoFactorStore{
+		credentials: make(map[uuid.UUID]domain.TOTPCredential),
+		codes:       make(map[uuid.UUID]domain.RecoveryCode),
+	}
+}
+
+// GetCredential retrieves a user's TOTP credential, confirmed or not
+func (s *MemoryTwoFactorStore) GetCredential(ctx context.Context, userID uuid.UUID) (*domain.TOTPCredential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, ok := s.credentials[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &credential, nil
+}
+
+// SavePendingCredential stores a new unconfirmed credential, replacing any
+// earlier unconfirmed one. It reports false if the user already has a
+// confirmed credential, which is left untouched.
+func (s *MemoryTwoFactorStore) SavePendingCredential(
+	ctx context.Context, credential *domain.TOTPCredential,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.credentials[credential.UserID]; ok && existing.ConfirmedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	s.credentials[credential.UserID] = domain.TOTPCredential{
+		UserID:    credential.UserID,
+		Secret:    credential.Secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return true, nil
+}
+
+// UseStep records step as the last accepted time step of a confirmed
+// credential, confirming a pending one if confirm is set. It reports false if
+// a code for the same or a later step was already accepted.
+func (s *MemoryTwoFactorStore) UseStep(ctx context.Context, userID uuid.UUID, step int64, confirm bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, ok := s.credentials[userID]
+	if !ok || credential.LastUsedStep >= step || (credential.ConfirmedAt == nil) != confirm {
+		return false, nil
+	}
+	now := time.Now()
+	credential.LastUsedStep = step
+	credential.UpdatedAt = now
+	if confirm {
+		credential.ConfirmedAt = &now
+	}
+	s.credentials[userID] = credential
+	return true, nil
+}
+
+// DeleteByUserID removes a user's TOTP credential and recovery codes
+func (s *MemoryTwoFactorStore) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteCodes(userID)
+	delete(s.credentials, userID)
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces all of a user's recovery codes with new ones
+func (s *MemoryTwoFactorStore) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteCodes(userID)
+	for _, hash := range codeHashes {
+		code := domain.RecoveryCode{UserID: userID, CodeHash: hash}
+		_ = code.BeforeCreate(nil)
+		s.codes[code.ID] = code
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used and reports
+// whether it was available
+func (s *MemoryTwoFactorStore) ConsumeRecoveryCode(
+	ctx context.Context, userID uuid.UUID, codeHash string, at time.Time,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, code := range s.codes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &at
+			s.codes[id] = code
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CountUnusedRecoveryCodes counts a user's remaining recovery codes
+func (s *MemoryTwoFactorStore) CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for _, code := range s.codes {
+		if code.UserID == userID && code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// deleteCodes removes a user's recovery codes. The caller must hold s.mu.
+func (s *MemoryTwoFactorStore) deleteCodes(userID uuid.UUID) {
+	maps.DeleteFunc(s.codes, func(_ uuid.UUID, code domain.RecoveryCode) bool {
+		return code.UserID == userID
+	})
+}
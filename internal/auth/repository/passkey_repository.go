@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// PasskeyRepository handles WebAuthn credential and ceremony database operations
+type PasskeyRepository struct {
+	db *database.Database
+}
+
+// NewPasskeyRepository creates a new passkey repository
+func NewPasskeyRepository(db *database.Database) *PasskeyRepository {
+	return &PasskeyRepository{db: db}
+}
+
+// Create stores a newly registered credential
+func (r *PasskeyRepository) Create(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(credential).Error
+}
+
+// GetByUserID retrieves all credentials registered to a user, oldest first
+func (r *PasskeyRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var credentials []domain.WebAuthnCredential
+	err := db.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+// RecordUse stores the signature counter and backup state reported by a
+// successful login. It reports false if the stored counter has meanwhile
+// reached signCount, so that a concurrent login cannot roll the counter back.
+func (r *PasskeyRepository) RecordUse(
+	ctx context.Context, id uuid.UUID, signCount int64, backupState bool, at time.Time,
+) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	result := db.Model(&domain.WebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))", id, signCount, signCount).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": at,
+			"updated_at":   at,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteByID deletes one of a user's credentials and reports whether it existed
+func (r *PasskeyRepository) DeleteByID(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&domain.WebAuthnCredential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteByUserID deletes all of a user's credentials and unfinished ceremonies
+func (r *PasskeyRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.WebAuthnCeremony{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&domain.WebAuthnCredential{}).Error
+	})
+}
+
+// CreateCeremony stores the state of a started ceremony
+func (r *PasskeyRepository) CreateCeremony(ctx context.Context, ceremony *domain.WebAuthnCeremony) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(ceremony).Error
+}
+
+// DeleteExpired deletes up to limit expired ceremonies, returning how many
+// were deleted. Callers purge a backlog by calling it until the count falls
+// below limit.
+func (r *PasskeyRepository) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	expired := db.Model(&domain.WebAuthnCeremony{}).Select("id").Where("expires_at < ?", time.Now()).Limit(limit)
+	result := db.Where("id IN (?)", expired).Delete(&domain.WebAuthnCeremony{})
+	return result.RowsAffected, result.Error
+}
+
+// ConsumeCeremony atomically deletes an unexpired ceremony of the given kind
+// and returns it. It returns nil if the ceremony is unknown, expired or was
+// already finished, so that each challenge is answered at most once.
+func (r *PasskeyRepository) ConsumeCeremony(
+	ctx context.Context, id uuid.UUID, kind string, at time.Time,
+) (*domain.WebAuthnCeremony, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var consumed []domain.WebAuthnCeremony
+	err := db.Clauses(clause.Returning{}).
+		Where("id = ? AND kind = ? AND expires_at > ?", id, kind, at).
+		Delete(&consumed).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(consumed) == 0 {
+		return nil, nil
+	}
+	return &consumed[0], nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// PasswordResetRepository handles password reset token database operations
+type PasswordResetRepository struct {
+	db *database.Database
+}
+
+// NewPasswordResetRepository creates a new password reset repository
+func NewPasswordResetRepository(db *database.Database) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// Create stores a new password reset token
+func (r *PasswordResetRepository) Create(ctx context.Context, resetToken *domain.PasswordResetToken) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(resetToken).Error
+}
+
+// Consume atomically marks an unused, unexpired token as used and returns it.
+// It returns nil if the token is unknown, expired or already used, so that
+// concurrent redemptions of the same token cannot both succeed.
+func (r *PasswordResetRepository) Consume(
+	ctx context.Context, token string, at time.Time,
+) (*domain.PasswordResetToken, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var consumed []domain.PasswordResetToken
+	err := db.Model(&consumed).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", domain.HashToken(token), at).
+		Update("used_at", at).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(consumed) == 0 {
+		return nil, nil
+	}
+	return &consumed[0], nil
+}
+
+// DeleteByUserID deletes all of a user's password reset tokens. Issuing a new
+// token or completing a reset clears the older ones, so each user keeps at
+// most one outstanding token.
+func (r *PasswordResetRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Where("user_id = ?", userID).Delete(&domain.PasswordResetToken{}).Error
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// PersonalAccessTokenRepository handles personal access token database operations
+type PersonalAccessTokenRepository struct {
+	db *database.Database
+}
+
+// NewPersonalAccessTokenRepository creates a new personal access token repository
+func NewPersonalAccessTokenRepository(db *database.Database) *PersonalAccessTokenRepository {
+	return &PersonalAccessTokenRepository{db: db}
+}
+
+// Create stores a new personal access token
+func (r *PersonalAccessTokenRepository) Create(ctx context.Context, accessToken *domain.PersonalAccessToken) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(accessToken).Error
+}
+
+// GetByToken retrieves the unexpired personal access token matching a raw token
+func (r *PersonalAccessTokenRepository) GetByToken(
+	ctx context.Context, rawToken string, at time.Time,
+) (*domain.PersonalAccessToken, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var accessToken domain.PersonalAccessToken
+	err := db.Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", domain.HashToken(rawToken), at).
+		First(&accessToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &accessToken, err
+}
+
+// GetByUserID retrieves all personal access tokens of a user, including
+// expired ones, oldest first
+func (r *PersonalAccessTokenRepository) GetByUserID(
+	ctx context.Context, userID uuid.UUID,
+) ([]domain.PersonalAccessToken, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var accessTokens []domain.PersonalAccessToken
+	err := db.Where("user_id = ?", userID).Order("created_at").Find(&accessTokens).Error
+	return accessTokens, err
+}
+
+// RecordUse stores when and from where a token was last used, unless that was
+// already recorded after staleBefore
+func (r *PersonalAccessTokenRepository) RecordUse(
+	ctx context.Context, id uuid.UUID, ipAddress string, at, staleBefore time.Time,
+) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Model(&domain.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, staleBefore).
+		Updates(map[string]interface{}{
+			"last_used_at": at,
+			"last_used_ip": ipAddress,
+		}).Error
+}
+
+// DeleteByID deletes one of a user's personal access tokens and reports whether it existed
+func (r *PersonalAccessTokenRepository) DeleteByID(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&domain.PersonalAccessToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteByUserID deletes all of a user's tokens
+func (r *PersonalAccessTokenRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Where("user_id = ?", userID).Delete(&domain.PersonalAccessToken{}).Error
+}
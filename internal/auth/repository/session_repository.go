@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"github.com/acheevo/test/internal/auth/domain"
@@ -21,26 +23,201 @@ func NewSessionRepository(db *database.Database) *SessionRepository {
 }
 
 // Create creates a new session
-func (r *SessionRepository) Create(session *domain.Session) error {
-	return r.db.DB.Create(session).Error
+func (r *SessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(session).Error
 }
 
-// GetByToken retrieves a session by token
-func (r *SessionRepository) GetByToken(token string) (*domain.Session, error) {
+// GetByToken retrieves a session by the digest of its token
+func (r *SessionRepository) GetByToken(ctx context.Context, token string) (*domain.Session, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
 	var session domain.Session
-	err := r.db.DB.Where("token = ? AND expires_at > ?", token, time.Now()).First(&session).Error
+	err := db.Where("token_hash = ? AND expires_at > ?", domain.HashToken(token), time.Now()).First(&session).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &session, err
 }
 
-// DeleteByToken deletes a session by token
-func (r *SessionRepository) DeleteByToken(token string) error {
-	return r.db.DB.Where("token = ?", token).Delete(&domain.Session{}).Error
+// GetByID retrieves an unexpired session by ID
+func (r *SessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var session domain.Session
+	err := db.Where("id = ? AND expires_at > ?", id, time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &session, err
+}
+
+// GetByUserID retrieves all unexpired sessions of a user, most recent first
+func (r *SessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var sessions []domain.Session
+	err := db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteByToken deletes a session by the digest of its token
+func (r *SessionRepository) DeleteByToken(ctx context.Context, token string) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Where("token_hash = ?", domain.HashToken(token)).Delete(&domain.Session{}).Error
+}
+
+// DeleteByID deletes a session and its refresh token family by ID
+func (r *SessionRepository) DeleteByID(ctx context.Context, id uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", id).Delete(&domain.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&domain.Session{}).Error
+	})
 }
 
-// DeleteExpired deletes expired sessions
-func (r *SessionRepository) DeleteExpired() error {
-	return r.db.DB.Where("expires_at < ?", time.Now()).Delete(&domain.Session{}).Error
+// DeleteByUserID deletes all sessions and refresh token families of a user
+func (r *SessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		sessionIDs := tx.Model(&domain.Session{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&domain.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", userID).Delete(&domain.Session{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// RotateToken replaces a session's current refresh token and records the old
+// one as spent until the session's absolute expiry. It returns false if the
+// session no longer holds oldToken, which means another request already
+// rotated it.
+func (r *SessionRepository) RotateToken(
+	ctx context.Context, session *domain.Session, oldToken, newToken string, expiresAt time.Time,
+) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	rotated := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&domain.Session{}).
+			Where("id = ? AND token_hash = ?", session.ID, domain.HashToken(oldToken)).
+			Updates(map[string]interface{}{
+				"token_hash":   domain.HashToken(newToken),
+				"expires_at":   expiresAt,
+				"last_seen_at": now,
+				"updated_at":   now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		spent := &domain.RefreshToken{
+			SessionID: session.ID,
+			TokenHash: domain.HashToken(oldToken),
+			RotatedAt: now,
+			ExpiresAt: spentExpiry(session, expiresAt),
+		}
+		if err := tx.Create(spent).Error; err != nil {
+			return err
+		}
+
+		rotated = true
+		return nil
+	})
+	if err != nil || !rotated {
+		return false, err
+	}
+
+	session.TokenHash = domain.HashToken(newToken)
+	session.ExpiresAt = expiresAt
+	session.LastSeenAt = time.Now()
+	return true, nil
+}
+
+// spentExpiry returns when a token rotated out of session expires: when the
+// session itself must end, so replaying it is detected however far the idle
+// expiry slides. Sessions without an absolute expiry fall back to the new one.
+func spentExpiry(session *domain.Session, expiresAt time.Time) time.Time {
+	if session.AbsoluteExpiresAt.IsZero() {
+		return expiresAt
+	}
+	return session.AbsoluteExpiresAt
+}
+
+// RecordActivity sets a session's last-seen time and idle expiry unless activity
+// was already recorded after since. The condition keeps concurrent replicas
+// from rewriting the row on every request.
+func (r *SessionRepository) RecordActivity(
+	ctx context.Context, id uuid.UUID, seenAt, expiresAt, since time.Time,
+) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Model(&domain.Session{}).
+		Where("id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", id, since).
+		UpdateColumns(map[string]interface{}{
+			"last_seen_at": seenAt,
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+// GetRotatedToken retrieves a spent refresh token by the digest of its token
+func (r *SessionRepository) GetRotatedToken(ctx context.Context, token string) (*domain.RefreshToken, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var refreshToken domain.RefreshToken
+	err := db.Where("token_hash = ?", domain.HashToken(token)).First(&refreshToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &refreshToken, err
+}
+
+// DeleteExpired deletes up to limit expired sessions and up to limit expired
+// spent refresh tokens, returning how many of each were deleted. Callers purge
+// a backlog by calling it until both counts fall below limit.
+func (r *SessionRepository) DeleteExpired(ctx context.Context, limit int) (sessions, refreshTokens int64, err error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	now := time.Now()
+
+	expiredTokens := db.Model(&domain.RefreshToken{}).Select("id").Where("expires_at < ?", now).Limit(limit)
+	result := db.Where("id IN (?)", expiredTokens).Delete(&domain.RefreshToken{})
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+	refreshTokens = result.RowsAffected
+
+	expiredSessions := db.Model(&domain.Session{}).Select("id").Where("expires_at < ?", now).Limit(limit)
+	result = db.Where("id IN (?)", expiredSessions).Delete(&domain.Session{})
+	if result.Error != nil {
+		return 0, refreshTokens, result.Error
+	}
+	sessions = result.RowsAffected
+
+	return sessions, refreshTokens, nil
 }
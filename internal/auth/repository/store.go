@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+)
+
+// SessionStore persists sessions and their spent refresh tokens.
+// SessionRepository keeps them in Postgres and MemorySessionStore in process
+// memory. Getters return nil without an error when nothing matches.
+type SessionStore interface {
+	Create(ctx context.Context, session *domain.Session) error
+	GetByToken(ctx context.Context, token string) (*domain.Session, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Session, error)
+	DeleteByToken(ctx context.Context, token string) error
+	DeleteByID(ctx context.Context, id uuid.UUID) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) (int64, error)
+	RotateToken(
+		ctx context.Context, session *domain.Session, oldToken, newToken string, expiresAt time.Time,
+	) (bool, error)
+	RecordActivity(ctx context.Context, id uuid.UUID, seenAt, expiresAt, since time.Time) error
+	GetRotatedToken(ctx context.Context, token string) (*domain.RefreshToken, error)
+	DeleteExpired(ctx context.Context, limit int) (sessions, refreshTokens int64, err error)
+}
+
+// PasswordResetStore persists password reset tokens. PasswordResetRepository
+// keeps them in Postgres and MemoryPasswordResetStore in process memory.
+type PasswordResetStore interface {
+	Create(ctx context.Context, resetToken *domain.PasswordResetToken) error
+	Consume(ctx context.Context, token string, at time.Time) (*domain.PasswordResetToken, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+// LoginAttemptStore persists failed login counts and lockouts.
+// LoginAttemptRepository keeps them in Postgres and MemoryLoginAttemptStore in
+// process memory.
+type LoginAttemptStore interface {
+	GetByKeys(ctx context.Context, keys []string) ([]domain.LoginAttempt, error)
+	RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (*domain.LoginAttempt, error)
+	SetBlockedUntil(ctx context.Context, key string, until time.Time) error
+	DeleteByKey(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context, forgetBefore time.Time, limit int) (int64, error)
+}
+
+// TwoFactorStore persists TOTP credentials and recovery codes.
+// TwoFactorRepository keeps them in Postgres and MemoryTwoFactorStore in
+// process memory. GetCredential returns nil without an error when the user has
+// no credential.
+type TwoFactorStore interface {
+	GetCredential(ctx context.Context, userID uuid.UUID) (*domain.TOTPCredential, error)
+	SavePendingCredential(ctx context.Context, credential *domain.TOTPCredential) (bool, error)
+	UseStep(ctx context.Context, userID uuid.UUID, step int64, confirm bool) (bool, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) (bool, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+// PasskeyStore persists WebAuthn credentials and ceremonies. PasskeyRepository
+// keeps them in Postgres and MemoryPasskeyStore in process memory.
+type PasskeyStore interface {
+	Create(ctx context.Context, credential *domain.WebAuthnCredential) error
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error)
+	RecordUse(ctx context.Context, id uuid.UUID, signCount int64, backupState bool, at time.Time) (bool, error)
+	DeleteByID(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	CreateCeremony(ctx context.Context, ceremony *domain.WebAuthnCeremony) error
+	ConsumeCeremony(ctx context.Context, id uuid.UUID, kind string, at time.Time) (*domain.WebAuthnCeremony, error)
+	DeleteExpired(ctx context.Context, limit int) (int64, error)
+}
+
+// PersonalAccessTokenStore persists personal access tokens.
+// PersonalAccessTokenRepository keeps them in Postgres and
+// MemoryPersonalAccessTokenStore in process memory. GetByToken returns nil
+// without an error when nothing matches.
+type PersonalAccessTokenStore interface {
+	Create(ctx context.Context, accessToken *domain.PersonalAccessToken) error
+	GetByToken(ctx context.Context, rawToken string, at time.Time) (*domain.PersonalAccessToken, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.PersonalAccessToken, error)
+	RecordUse(ctx context.Context, id uuid.UUID, ipAddress string, at, staleBefore time.Time) error
+	DeleteByID(ctx context.Context, userID, id uuid.UUID) (bool, error)
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// TwoFactorRepository handles TOTP credential and recovery code database operations
+type TwoFactorRepository struct {
+	db *database.Database
+}
+
+// NewTwoFactorRepository creates a new two-factor repository
+func NewTwoFactorRepository(db *database.Database) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// GetCredential retrieves a user's TOTP credential, confirmed or not
+func (r *TwoFactorRepository) GetCredential(ctx context.Context, userID uuid.UUID) (*domain.TOTPCredential, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var credential domain.TOTPCredential
+	err := db.Where("user_id = ?", userID).First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &credential, err
+}
+
+// SavePendingCredential stores a new unconfirmed credential, replacing any
+// earlier unconfirmed one. It reports false if the user already has a
+// confirmed credential, which is left untouched.
+func (r *TwoFactorRepository) SavePendingCredential(
+	ctx context.Context, credential *domain.TOTPCredential,
+) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	now := time.Now()
+	result := db.Exec(`
+		INSERT INTO totp_credentials (user_id, secret, confirmed_at, last_used_step, created_at, updated_at)
+		VALUES (?, ?, NULL, 0, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at
+		WHERE totp_credentials.confirmed_at IS NULL`,
+		credential.UserID, credential.Secret, now, now,
+	)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UseStep records step as the last accepted time step of a confirmed
+// credential, confirming a pending one if confirm is set. It reports false if
+// a code for the same or a later step was already accepted, so that each
+// code works only once.
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64, confirm bool) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	updates := map[string]interface{}{"last_used_step": step, "updated_at": time.Now()}
+	query := db.Model(&domain.TOTPCredential{}).Where("user_id = ? AND last_used_step < ?", userID, step)
+	if confirm {
+		updates["confirmed_at"] = time.Now()
+		query = query.Where("confirmed_at IS NULL")
+	} else {
+		query = query.Where("confirmed_at IS NOT NULL")
+	}
+
+	result := query.Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteByUserID removes a user's TOTP credential and recovery codes
+func (r *TwoFactorRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&domain.TOTPCredential{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes replaces all of a user's recovery codes with new ones
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	codes := make([]domain.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = domain.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// ConsumeRecoveryCode atomically marks an unused recovery code as used and
+// reports whether it was available
+func (r *TwoFactorRepository) ConsumeRecoveryCode(
+	ctx context.Context, userID uuid.UUID, codeHash string, at time.Time,
+) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	result := db.Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountUnusedRecoveryCodes counts a user's remaining recovery codes
+func (r *TwoFactorRepository) CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var count int64
+	err := db.Model(&domain.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
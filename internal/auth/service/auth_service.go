@@ -1,16 +1,22 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"sync"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/acheevo/test/internal/auth/domain"
 	"github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/auth/token"
+	"github.com/acheevo/test/internal/shared/config"
+	"github.com/acheevo/test/internal/shared/useragent"
 	userDomain "github.com/acheevo/test/internal/user/domain"
 	userRepository "github.com/acheevo/test/internal/user/repository"
 )
@@ -19,67 +25,146 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	ErrSessionNotFound    = errors.New("session not found")
 )
 
 // AuthService handles authentication operations
 type AuthService struct {
-	userRepo    *userRepository.UserRepository
-	sessionRepo *repository.SessionRepository
+	userRepo        userRepository.UserStore
+	sessionRepo     repository.SessionStore
+	attemptRepo     repository.LoginAttemptStore
+	twoFactorRepo   repository.TwoFactorStore
+	passkeyRepo     repository.PasskeyStore
+	accessTokenRepo repository.PersonalAccessTokenStore
+	tokens          *token.Manager
+	relyingParty    *webauthn.WebAuthn
+	cfg             *config.Config
+	twoFactorKey    [32]byte
+
+	lastSeenMu     sync.Mutex
+	lastSeen       map[uuid.UUID]time.Time // session ID -> last recorded activity
+	lastSeenPruned time.Time
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo *userRepository.UserRepository, sessionRepo *repository.SessionRepository) *AuthService {
+func NewAuthService(
+	userRepo userRepository.UserStore,
+	sessionRepo repository.SessionStore,
+	attemptRepo repository.LoginAttemptStore,
+	twoFactorRepo repository.TwoFactorStore,
+	passkeyRepo repository.PasskeyStore,
+	accessTokenRepo repository.PersonalAccessTokenStore,
+	tokens *token.Manager,
+	relyingParty *webauthn.WebAuthn,
+	cfg *config.Config,
+) *AuthService {
+	keySecret := cfg.TwoFactorEncryptionKey
+	if keySecret == "" {
+		keySecret = cfg.SessionSecret
+	}
+
 	return &AuthService{
-		userRepo:    userRepo,
-		sessionRepo: sessionRepo,
+		userRepo:        userRepo,
+		sessionRepo:     sessionRepo,
+		attemptRepo:     attemptRepo,
+		twoFactorRepo:   twoFactorRepo,
+		passkeyRepo:     passkeyRepo,
+		accessTokenRepo: accessTokenRepo,
+		tokens:          tokens,
+		relyingParty:    relyingParty,
+		cfg:             cfg,
+		twoFactorKey:    deriveTwoFactorKey(keySecret),
+		lastSeen:        make(map[uuid.UUID]time.Time),
 	}
 }
 
-// Login authenticates a user and creates a session
-func (s *AuthService) Login(email, password string) (*domain.LoginResponse, error) {
-	user, err := s.userRepo.GetByEmail(email)
+// Login authenticates a user and creates a session for the given client
+func (s *AuthService) Login(
+	ctx context.Context, email, password string, client domain.ClientInfo,
+) (*domain.LoginResponse, error) {
+	// Refuse attempts while the account or source IP is backing off or locked out
+	if err := s.checkThrottle(ctx, accountKey(email), ipKey(client.IPAddress)); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
-		return nil, ErrInvalidCredentials
+		compareDummyPassword(password)
+		return nil, s.loginFailed(ctx, email, client.IPAddress)
 	}
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, ErrInvalidCredentials
+		return nil, s.loginFailed(ctx, email, client.IPAddress)
+	}
+
+	// Checked only after the password, so the response reveals nothing to a guesser
+	if s.cfg.RequireEmailVerification && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Accounts with a second factor get a challenge instead of a session. Their
+	// failure history is kept until the challenge is passed, so that repeating
+	// the password step does not reset the throttling of code guesses.
+	if err := s.twoFactorChallenge(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// A successful login clears the account's failure history
+	if err := s.attemptRepo.DeleteByKey(ctx, accountKey(email)); err != nil {
+		return nil, err
 	}
 
-	// Generate session token
-	token, err := s.generateToken()
+	return s.createSession(ctx, user, client)
+}
+
+// Refresh rotates a refresh token and issues a new access token.
+// Presenting a refresh token that was already rotated revokes its whole family.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*domain.LoginResponse, error) {
+	session, err := s.sessionRepo.GetByToken(ctx, refreshToken)
 	if err != nil {
 		return nil, err
 	}
+	if session == nil {
+		return nil, s.detectReuse(ctx, refreshToken)
+	}
 
-	// Create session
-	session := &domain.Session{
-		ID:        uuid.New(),
-		UserID:    user.ID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(24 * time.Hour), // 24 hours
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
 	}
 
-	if err := s.sessionRepo.Create(session); err != nil {
+	newToken, err := generateToken()
+	if err != nil {
 		return nil, err
 	}
 
-	return &domain.LoginResponse{
-		Token: token,
-		User:  *user,
-	}, nil
+	// The spent token is kept until the session's deadline, which sessions
+	// created before absolute lifetimes were tracked get here
+	session.AbsoluteExpiresAt = s.sessionDeadline(session, user.Role)
+	rotated, err := s.sessionRepo.RotateToken(ctx, session, refreshToken, newToken, s.slidingExpiry(session, user.Role))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// A concurrent request rotated this token first, so it has now been presented twice
+		return nil, s.detectReuse(ctx, refreshToken)
+	}
+
+	return s.issueTokens(user, session, newToken)
 }
 
 // Register creates a new user account
-func (s *AuthService) Register(email, password, name string) (*userDomain.User, error) {
+func (s *AuthService) Register(ctx context.Context, email, password, name string) (*userDomain.User, error) {
 	// Check if user already exists
-	existingUser, err := s.userRepo.GetByEmail(email)
+	existingUser, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
@@ -101,41 +186,205 @@ func (s *AuthService) Register(email, password, name string) (*userDomain.User,
 		Role:     userDomain.RoleUser,
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// ValidateToken validates a session token and returns the user
-func (s *AuthService) ValidateToken(token string) (*userDomain.User, error) {
-	session, err := s.sessionRepo.GetByToken(token)
+// ValidateToken verifies an access token and returns its claims.
+// The signature is checked locally; the sessions table is only consulted to
+// make sure the session backing the token has not been revoked or gone idle,
+// and to slide its expiry forward on activity.
+func (s *AuthService) ValidateToken(ctx context.Context, accessToken string) (*token.Claims, error) {
+	claims, err := s.tokens.Verify(accessToken)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
 	if err != nil {
 		return nil, err
 	}
-	if session == nil {
+	if session == nil || session.UserID != claims.UserID {
 		return nil, ErrInvalidToken
 	}
 
-	user, err := s.userRepo.GetByID(session.UserID)
+	if err := s.recordActivity(ctx, session, claims.Role); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the session behind an access token
+func (s *AuthService) Logout(ctx context.Context, accessToken string) error {
+	claims, err := s.tokens.VerifySignature(accessToken)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return s.sessionRepo.DeleteByID(ctx, claims.SessionID)
+}
+
+// ListSessions returns the active sessions of a user
+func (s *AuthService) ListSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	return s.sessionRepo.GetByUserID(ctx, userID)
+}
+
+// RevokeSession revokes a single session belonging to a user
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.sessionRepo.DeleteByID(ctx, sessionID)
+}
+
+// RevokeAllSessions revokes every session of a user and returns how many were revoked
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.sessionRepo.DeleteByUserID(ctx, userID)
+}
+
+// recordActivity updates a session's last-seen time and slides its expiry
+// forward, at most once per configured interval per session
+func (s *AuthService) recordActivity(ctx context.Context, session *domain.Session, role userDomain.UserRole) error {
+	now := time.Now()
+	interval := s.cfg.SessionLastSeenInterval
+
+	s.lastSeenMu.Lock()
+	if last, ok := s.lastSeen[session.ID]; ok && now.Sub(last) < interval {
+		s.lastSeenMu.Unlock()
+		return nil
+	}
+	s.lastSeen[session.ID] = now
+
+	// Forget sessions that have not been touched for a full interval
+	if now.Sub(s.lastSeenPruned) >= interval {
+		for id, last := range s.lastSeen {
+			if now.Sub(last) >= interval {
+				delete(s.lastSeen, id)
+			}
+		}
+		s.lastSeenPruned = now
+	}
+	s.lastSeenMu.Unlock()
+
+	return s.sessionRepo.RecordActivity(ctx, session.ID, now, s.slidingExpiry(session, role), now.Add(-interval))
+}
+
+// sessionTTLs returns the idle timeout and absolute lifetime for sessions of a role
+func (s *AuthService) sessionTTLs(role userDomain.UserRole) (idle, absolute time.Duration) {
+	idle, absolute = s.cfg.SessionIdleTTL, s.cfg.SessionMaxTTL
+	if ttl, ok := s.cfg.SessionRoleIdleTTL[string(role)]; ok {
+		idle = ttl
+	}
+	if ttl, ok := s.cfg.SessionRoleMaxTTL[string(role)]; ok {
+		absolute = ttl
+	}
+	return idle, absolute
+}
+
+// slidingExpiry returns the expiry a session gets on activity now: one idle
+// timeout from now, but never past the session's absolute lifetime
+func (s *AuthService) slidingExpiry(session *domain.Session, role userDomain.UserRole) time.Time {
+	idle, _ := s.sessionTTLs(role)
+
+	deadline := s.sessionDeadline(session, role)
+	expiresAt := time.Now().Add(idle)
+	if expiresAt.After(deadline) {
+		expiresAt = deadline
+	}
+	return expiresAt
+}
+
+// sessionDeadline returns the time a session ends however active it is
+func (s *AuthService) sessionDeadline(session *domain.Session, role userDomain.UserRole) time.Time {
+	if !session.AbsoluteExpiresAt.IsZero() {
+		return session.AbsoluteExpiresAt
+	}
+	// Sessions created before absolute lifetimes were tracked
+	_, absolute := s.sessionTTLs(role)
+	return session.CreatedAt.Add(absolute)
+}
+
+// createSession starts a new session and refresh token family for an authenticated user
+func (s *AuthService) createSession(
+	ctx context.Context, user *userDomain.User, client domain.ClientInfo,
+) (*domain.LoginResponse, error) {
+	refreshToken, err := generateToken()
 	if err != nil {
 		return nil, err
 	}
-	if user == nil {
-		return nil, ErrUserNotFound
+
+	// The session backs the access token, acts as its revocation record and
+	// holds the current refresh token
+	now := time.Now()
+	idle, absolute := s.sessionTTLs(user.Role)
+	parsed := useragent.Parse(client.UserAgent)
+	session := &domain.Session{
+		ID:                uuid.New(),
+		UserID:            user.ID,
+		TokenHash:         domain.HashToken(refreshToken),
+		IPAddress:         client.IPAddress,
+		UserAgent:         client.UserAgent,
+		Device:            parsed.Device,
+		Browser:           parsed.Browser,
+		LastSeenAt:        now,
+		ExpiresAt:         now.Add(idle),
+		AbsoluteExpiresAt: now.Add(absolute),
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
-	return user, nil
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, session, refreshToken)
 }
 
-// Logout invalidates a session token
-func (s *AuthService) Logout(token string) error {
-	return s.sessionRepo.DeleteByToken(token)
+// issueTokens signs an access token for a session and pairs it with the session's refresh token.
+// This is the only place a raw refresh token leaves the service; only its digest is stored.
+func (s *AuthService) issueTokens(
+	user *userDomain.User, session *domain.Session, refreshToken string,
+) (*domain.LoginResponse, error) {
+	accessToken, expiresAt, err := s.tokens.Issue(user, session.ID, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.LoginResponse{
+		Token:            accessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+		User:             *user,
+	}, nil
+}
+
+// detectReuse revokes the token family of a refresh token that was already rotated
+func (s *AuthService) detectReuse(ctx context.Context, refreshToken string) error {
+	spent, err := s.sessionRepo.GetRotatedToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if spent == nil {
+		return ErrInvalidToken
+	}
+
+	if err := s.sessionRepo.DeleteByID(ctx, spent.SessionID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
 }
 
-// generateToken generates a random session token
-func (s *AuthService) generateToken() (string, error) {
+// generateToken generates a random opaque token
+func generateToken() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/auth/token"
+	"github.com/acheevo/test/internal/shared/config"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// testStores are the memory stores behind an AuthService under test
+type testStores struct {
+	users     *userRepository.MemoryUserStore
+	sessions  *repository.MemorySessionStore
+	attempts  *repository.MemoryLoginAttemptStore
+	twoFactor *repository.MemoryTwoFactorStore
+}
+
+func newTestAuthService() (*AuthService, testStores) {
+	stores := testStores{
+		users:     userRepository.NewMemoryUserStore(),
+		sessions:  repository.NewMemorySessionStore(),
+		attempts:  repository.NewMemoryLoginAttemptStore(),
+		twoFactor: repository.NewMemoryTwoFactorStore(),
+	}
+	cfg := &config.Config{
+		SessionSecret:  "test-secret",
+		AccessTokenTTL: 15 * time.Minute,
+		SessionIdleTTL: time.Hour,
+		SessionMaxTTL:  24 * time.Hour,
+
+		SessionLastSeenInterval: time.Minute,
+
+		LoginFreeAttempts:    2,
+		LoginBackoffBase:     time.Second,
+		LoginBackoffMax:      time.Minute,
+		LoginMaxFailures:     5,
+		LoginMaxIPFailures:   100,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginFailureWindow:   15 * time.Minute,
+
+		TwoFactorChallengeTTL: 5 * time.Minute,
+	}
+	svc := NewAuthService(
+		stores.users, stores.sessions, stores.attempts, stores.twoFactor,
+		repository.NewMemoryPasskeyStore(), repository.NewMemoryPersonalAccessTokenStore(),
+		token.NewHMACManager(cfg.SessionSecret, cfg.AccessTokenTTL), nil, cfg,
+	)
+	return svc, stores
+}
+
+// createUser creates a user with password
+func createUser(t *testing.T, users *userRepository.MemoryUserStore, email, password string) *userDomain.User {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &userDomain.User{Email: email, Password: string(hashedPassword), Name: "Test User", Role: userDomain.RoleUser}
+	require.NoError(t, users.Create(context.Background(), user))
+	return user
+}
+
+var testClient = domain.ClientInfo{IPAddress: "192.0.2.1", UserAgent: "test"}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Creates A Session", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		user := createUser(t, stores.users, "login@example.com", "password123")
+
+		resp, err := svc.Login(ctx, "login@example.com", "password123", testClient)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, resp.User.ID)
+		assert.Equal(t, "Bearer", resp.TokenType)
+
+		session, err := stores.sessions.GetByToken(ctx, resp.RefreshToken)
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, user.ID, session.UserID)
+		assert.Equal(t, testClient.IPAddress, session.IPAddress)
+
+		claims, err := svc.ValidateToken(ctx, resp.Token)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, claims.SessionID)
+	})
+
+	t.Run("Throttles Repeated Failures", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		createUser(t, stores.users, "throttle@example.com", "password123")
+
+		for i := 0; i < 2; i++ {
+			_, err := svc.Login(ctx, "throttle@example.com", "wrong-password", testClient)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		}
+		_, err := svc.Login(ctx, "throttle@example.com", "wrong-password", testClient)
+		assert.ErrorIs(t, err, ErrInvalidCredentials, "the failure past the free attempts is still counted")
+
+		_, err = svc.Login(ctx, "throttle@example.com", "password123", testClient)
+		var throttled *ThrottleError
+		require.ErrorAs(t, err, &throttled)
+		assert.Positive(t, throttled.RetryAfter)
+
+		// Unknown accounts are throttled the same way
+		for i := 0; i < 3; i++ {
+			_, err = svc.Login(ctx, "unknown@example.com", "password123", testClient)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		}
+		_, err = svc.Login(ctx, "unknown@example.com", "password123", testClient)
+		assert.ErrorIs(t, err, ErrLoginThrottled)
+	})
+
+	t.Run("Success Clears The Failure History", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		createUser(t, stores.users, "clear@example.com", "password123")
+
+		_, err := svc.Login(ctx, "clear@example.com", "wrong-password", testClient)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+		_, err = svc.Login(ctx, "clear@example.com", "password123", testClient)
+		require.NoError(t, err)
+
+		attempts, err := stores.attempts.GetByKeys(ctx, []string{accountKey("clear@example.com")})
+		require.NoError(t, err)
+		assert.Empty(t, attempts)
+	})
+
+	t.Run("Challenges Two-Factor Accounts", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		user := createUser(t, stores.users, "2fa@example.com", "password123")
+		_, err := stores.twoFactor.SavePendingCredential(ctx, &domain.TOTPCredential{UserID: user.ID, Secret: "secret"})
+		require.NoError(t, err)
+		_, err = stores.twoFactor.UseStep(ctx, user.ID, 1, true)
+		require.NoError(t, err)
+
+		_, err = svc.Login(ctx, "2fa@example.com", "password123", testClient)
+		var challenge *ChallengeError
+		require.ErrorAs(t, err, &challenge)
+		assert.True(t, challenge.Challenge.TwoFactorRequired)
+		assert.False(t, challenge.Challenge.EnrollmentRequired)
+		assert.NotEmpty(t, challenge.Challenge.ChallengeToken)
+
+		sessions, err := stores.sessions.GetByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions, "no session before the second factor")
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Rotates The Refresh Token", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		createUser(t, stores.users, "refresh@example.com", "password123")
+		login, err := svc.Login(ctx, "refresh@example.com", "password123", testClient)
+		require.NoError(t, err)
+
+		refreshed, err := svc.Refresh(ctx, login.RefreshToken)
+		require.NoError(t, err)
+		assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+		// The session carries on under the new refresh token
+		claims, err := svc.ValidateToken(ctx, refreshed.Token)
+		require.NoError(t, err)
+		session, err := stores.sessions.GetByToken(ctx, refreshed.RefreshToken)
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, session.ID, claims.SessionID)
+
+		again, err := svc.Refresh(ctx, refreshed.RefreshToken)
+		require.NoError(t, err)
+		assert.NotEqual(t, refreshed.RefreshToken, again.RefreshToken)
+	})
+
+	t.Run("Reuse Revokes The Session", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		createUser(t, stores.users, "reuse@example.com", "password123")
+		login, err := svc.Login(ctx, "reuse@example.com", "password123", testClient)
+		require.NoError(t, err)
+		refreshed, err := svc.Refresh(ctx, login.RefreshToken)
+		require.NoError(t, err)
+
+		_, err = svc.Refresh(ctx, login.RefreshToken)
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+		// The whole token family is gone, including the current refresh token
+		_, err = svc.Refresh(ctx, refreshed.RefreshToken)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		_, err = svc.ValidateToken(ctx, refreshed.Token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Reuse Is Detected After Expired Rows Are Purged", func(t *testing.T) {
+		svc, stores := newTestAuthService()
+		svc.cfg.SessionIdleTTL = 200 * time.Millisecond
+		createUser(t, stores.users, "purged@example.com", "password123")
+		login, err := svc.Login(ctx, "purged@example.com", "password123", testClient)
+		require.NoError(t, err)
+
+		// Activity keeps the session alive past the idle expiry it had when
+		// the first token was rotated out
+		time.Sleep(120 * time.Millisecond)
+		refreshed, err := svc.Refresh(ctx, login.RefreshToken)
+		require.NoError(t, err)
+		time.Sleep(120 * time.Millisecond)
+		_, err = svc.Refresh(ctx, refreshed.RefreshToken)
+		require.NoError(t, err)
+
+		_, _, err = stores.sessions.DeleteExpired(ctx, 100)
+		require.NoError(t, err)
+
+		_, err = svc.Refresh(ctx, login.RefreshToken)
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	})
+
+	t.Run("Unknown Tokens Are Invalid", func(t *testing.T) {
+		svc, _ := newTestAuthService()
+
+		_, err := svc.Refresh(ctx, "unknown-token")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		assert.NotErrorIs(t, err, ErrRefreshTokenReused)
+	})
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/token"
+	"github.com/acheevo/test/internal/shared/config"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+func TestResendVerification(t *testing.T) {
+	ctx := context.Background()
+
+	users := userRepository.NewMemoryUserStore()
+	mail := &recordingMailer{}
+	svc := NewEmailVerificationService(users, token.NewHMACManager("test-secret", time.Minute), mail, &config.Config{
+		EmailVerificationTTL: time.Hour,
+		EmailVerificationURL: "http://localhost:3000/verify-email",
+		MailFrom:             "no-reply@test.local",
+	}, zap.NewNop())
+
+	user := createUser(t, users, "unverified@example.com", "password123")
+	require.False(t, user.EmailVerified)
+
+	t.Run("Unknown Emails Get No Mail", func(t *testing.T) {
+		require.NoError(t, svc.ResendVerification(ctx, "nobody@example.com"))
+		svc.Wait()
+		assert.Empty(t, mail.messages)
+	})
+
+	t.Run("Unverified Accounts Get A New Link", func(t *testing.T) {
+		require.NoError(t, svc.ResendVerification(ctx, user.Email))
+		svc.Wait()
+		require.Len(t, mail.messages, 1)
+		assert.Equal(t, user.Email, mail.messages[0].To)
+
+		match := regexp.MustCompile(`[?&]token=([^&\s]+)`).FindStringSubmatch(mail.messages[0].Body)
+		require.NotNil(t, match)
+		verificationToken, err := url.QueryUnescape(match[1])
+		require.NoError(t, err)
+		verified, err := svc.VerifyEmail(ctx, verificationToken)
+		require.NoError(t, err)
+		assert.True(t, verified.EmailVerified)
+	})
+
+	t.Run("Verified Accounts Get No Mail", func(t *testing.T) {
+		require.NoError(t, svc.ResendVerification(ctx, user.Email))
+		svc.Wait()
+		assert.Len(t, mail.messages, 1)
+	})
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrLoginThrottled is matched by ThrottleError via errors.Is
+var ErrLoginThrottled = errors.New("too many failed login attempts")
+
+// ThrottleError is returned when login attempts are temporarily blocked after
+// repeated failures, either by progressive delay or by lockout
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return ErrLoginThrottled.Error()
+}
+
+// Is reports whether target is ErrLoginThrottled
+func (e *ThrottleError) Is(target error) bool {
+	return target == ErrLoginThrottled
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword spends the same time as a real password check, so that
+// unknown accounts cannot be told apart by response time
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// Throttling keys are derived from the submitted email rather than the user ID,
+// so unknown accounts are throttled exactly like real ones
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkThrottle returns a ThrottleError if any of the keys is currently blocked
+func (s *AuthService) checkThrottle(ctx context.Context, keys ...string) error {
+	attempts, err := s.attemptRepo.GetByKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, attempt := range attempts {
+		if wait := attempt.BlockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &ThrottleError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// loginFailed records a failed login against the account and the source IP
+// and returns the uniform invalid credentials error. Source IPs are often
+// shared, so they skip the progressive delay and are only locked out once
+// their much higher failure limit is reached.
+func (s *AuthService) loginFailed(ctx context.Context, email, ip string) error {
+	if err := s.recordFailure(ctx, accountKey(email), s.cfg.LoginFreeAttempts, s.cfg.LoginMaxFailures); err != nil {
+		return err
+	}
+	if err := s.recordFailure(ctx, ipKey(ip), s.cfg.LoginMaxIPFailures, s.cfg.LoginMaxIPFailures); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// recordFailure counts a failed login against a key. Past freeAttempts the key is
+// blocked for an exponentially growing delay, and once maxFailures is reached
+// it is locked out for the lockout duration.
+func (s *AuthService) recordFailure(ctx context.Context, key string, freeAttempts, maxFailures int) error {
+	now := time.Now()
+	attempt, err := s.attemptRepo.RecordFailure(ctx, key, now, now.Add(-s.cfg.LoginFailureWindow))
+	if err != nil {
+		return err
+	}
+
+	var block time.Duration
+	switch {
+	case maxFailures > 0 && attempt.Failures >= maxFailures:
+		block = s.cfg.LoginLockoutDuration
+	case attempt.Failures > freeAttempts:
+		block = s.backoff(attempt.Failures - freeAttempts)
+	default:
+		return nil
+	}
+
+	return s.attemptRepo.SetBlockedUntil(ctx, key, now.Add(block))
+}
+
+// backoff returns the delay after the nth throttled failure: base, 2*base, 4*base, ... up to the maximum
+func (s *AuthService) backoff(n int) time.Duration {
+	delay := s.cfg.LoginBackoffBase
+	for i := 1; i < n && delay < s.cfg.LoginBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.LoginBackoffMax {
+		delay = s.cfg.LoginBackoffMax
+	}
+	return delay
+}
+
+// UnlockUser clears the failed login history of a user's account
+func (s *AuthService) UnlockUser(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return s.attemptRepo.DeleteByKey(ctx, accountKey(user.Email))
+}
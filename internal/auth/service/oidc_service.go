@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/config"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+var (
+	ErrUnknownProvider   = errors.New("unknown identity provider")
+	ErrInvalidOIDCState  = errors.New("invalid or expired login state")
+	ErrOIDCLoginFailed   = errors.New("external login failed")
+	ErrOIDCEmailRequired = errors.New("identity provider did not share an email address")
+	ErrIdentityConflict  = errors.New("email belongs to an account not linked to this identity")
+)
+
+// defaultOIDCScopes are requested from providers that configure no scopes
+var defaultOIDCScopes = []string{oidc.ScopeOpenID, "email", "profile"}
+
+// OIDCService handles login through external OpenID Connect providers. It
+// signs users in with the authorization code flow and PKCE, and hands the
+// verified user to AuthService for the same session a password login gets.
+type OIDCService struct {
+	authService  *AuthService
+	userRepo     userRepository.UserStore
+	identityRepo *repository.IdentityRepository
+	cfg          *config.Config
+	logger       *zap.Logger
+
+	mu        sync.Mutex
+	providers map[string]*providerDiscovery // by provider name
+}
+
+// providerDiscovery holds a provider once its discovery has succeeded. Its
+// lock is held during discovery, so concurrent first logins with a provider
+// wait for one discovery while logins with other providers go ahead.
+type providerDiscovery struct {
+	mu       sync.Mutex
+	provider *oidcProvider
+}
+
+// oidcProvider is a discovered provider with its client configuration
+type oidcProvider struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// idTokenClaims are the ID token claims used to find or create the user
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// NewOIDCService creates a new OIDC login service
+func NewOIDCService(
+	authService *AuthService,
+	userRepo userRepository.UserStore,
+	identityRepo *repository.IdentityRepository,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *OIDCService {
+	return &OIDCService{
+		authService:  authService,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		cfg:          cfg,
+		logger:       logger,
+		providers:    make(map[string]*providerDiscovery),
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.cfg.OIDCProviders))
+	for name := range s.cfg.OIDCProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// BeginLogin starts a login with a provider. The returned state must be
+// bound to the user agent, and is checked again by CompleteLogin.
+func (s *OIDCService) BeginLogin(ctx context.Context, providerName string) (*domain.OIDCAuthorization, error) {
+	provider, err := s.provider(ctx, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	loginState := &domain.OIDCLoginState{
+		StateHash:    domain.HashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.cfg.OIDCStateTTL),
+	}
+	if err := s.identityRepo.CreateLoginState(ctx, loginState); err != nil {
+		return nil, err
+	}
+
+	return &domain.OIDCAuthorization{
+		URL:       provider.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+		State:     state,
+		ExpiresAt: loginState.ExpiresAt,
+	}, nil
+}
+
+// CompleteLogin finishes a login when the provider redirects back with an
+// authorization code. The code is exchanged with the PKCE verifier, and the
+// ID token is verified against the provider's keys and the login's nonce.
+// Accounts with a second factor get a ChallengeError, as with Login.
+func (s *OIDCService) CompleteLogin(
+	ctx context.Context, providerName, state, code string, client domain.ClientInfo,
+) (*domain.LoginResponse, error) {
+	provider, err := s.provider(ctx, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	loginState, err := s.identityRepo.ConsumeLoginState(ctx, providerName, state, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if loginState == nil {
+		return nil, ErrInvalidOIDCState
+	}
+
+	token, err := provider.oauth2.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange: %v", ErrOIDCLoginFailed, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrOIDCLoginFailed)
+	}
+
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(loginState.Nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCLoginFailed)
+	}
+
+	var claims idTokenClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+
+	user, err := s.resolveUser(ctx, providerName, idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.RequireEmailVerification && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	if err := s.authService.twoFactorChallenge(ctx, user); err != nil {
+		return nil, err
+	}
+	return s.authService.createSession(ctx, user, client)
+}
+
+// resolveUser returns the user linked to an external identity. An unknown
+// identity is linked to the account with the same email if both the provider
+// and the account have verified that email, and otherwise gets a new account.
+func (s *OIDCService) resolveUser(
+	ctx context.Context, provider, subject string, claims idTokenClaims,
+) (*userDomain.User, error) {
+	now := time.Now()
+
+	identity, err := s.identityRepo.GetByProviderSubject(ctx, provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		return user, s.identityRepo.RecordLogin(ctx, identity, claims.Email, now)
+	}
+
+	if claims.Email == "" {
+		return nil, ErrOIDCEmailRequired
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case user == nil:
+		if user, err = s.createUser(ctx, claims, now); err != nil {
+			return nil, err
+		}
+	case !claims.EmailVerified || !user.EmailVerified:
+		// Linking on an unverified email at the provider would let anyone who
+		// can register that address there take over the account. Linking to an
+		// unverified account would leave its password with whoever registered it.
+		return nil, ErrIdentityConflict
+	}
+
+	identity = &domain.Identity{
+		UserID:      user.ID,
+		Provider:    provider,
+		Subject:     subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Linked external identity",
+		zap.String("provider", provider), zap.String("user_id", user.ID.String()))
+	return user, nil
+}
+
+// createUser creates a passwordless account for a new external identity.
+// A password can be set later through the password reset flow.
+func (s *OIDCService) createUser(ctx context.Context, claims idTokenClaims, now time.Time) (*userDomain.User, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = claims.Email
+	}
+
+	user := &userDomain.User{
+		ID:            uuid.New(),
+		Email:         claims.Email,
+		Name:          name,
+		Role:          userDomain.RoleUser,
+		EmailVerified: claims.EmailVerified,
+	}
+	if claims.EmailVerified {
+		user.VerifiedAt = &now
+	}
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provider returns a configured provider, running discovery on first use.
+// Failed discovery is not cached, so a provider that was down is retried.
+func (s *OIDCService) provider(ctx context.Context, name string) (*oidcProvider, error) {
+	providerCfg, ok := s.cfg.OIDCProviders[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	s.mu.Lock()
+	discovery, ok := s.providers[name]
+	if !ok {
+		discovery = &providerDiscovery{}
+		s.providers[name] = discovery
+	}
+	s.mu.Unlock()
+
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+
+	if discovery.provider != nil {
+		return discovery.provider, nil
+	}
+
+	discovered, err := oidc.NewProvider(ctx, providerCfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", name, err)
+	}
+
+	scopes := providerCfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultOIDCScopes
+	}
+
+	provider := &oidcProvider{
+		oauth2: oauth2.Config{
+			ClientID:     providerCfg.ClientID,
+			ClientSecret: providerCfg.ClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  strings.TrimSuffix(s.cfg.OIDCCallbackURL, "/") + "/" + name + "/callback",
+			Scopes:       scopes,
+		},
+		verifier: discovered.Verifier(&oidc.Config{ClientID: providerCfg.ClientID}),
+	}
+	discovery.provider = provider
+	return provider, nil
+}
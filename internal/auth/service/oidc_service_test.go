@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/shared/config"
+)
+
+// discoveryServer serves OpenID Connect discovery, waiting for release to be
+// closed before answering, and counts the discovery requests it gets
+func discoveryServer(t *testing.T, release <-chan struct{}, requests *atomic.Int32) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                server.URL,
+			"authorization_endpoint":                server.URL + "/authorize",
+			"token_endpoint":                        server.URL + "/token",
+			"jwks_uri":                              server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOIDCProviderDiscovery(t *testing.T) {
+	ctx := context.Background()
+
+	slowRelease, fastRelease := make(chan struct{}), make(chan struct{})
+	close(fastRelease)
+	var slowRequests, fastRequests atomic.Int32
+	slow := discoveryServer(t, slowRelease, &slowRequests)
+	fast := discoveryServer(t, fastRelease, &fastRequests)
+
+	svc := NewOIDCService(nil, nil, nil, &config.Config{
+		OIDCProviders: config.OIDCProviders{
+			"slow": {Issuer: slow.URL, ClientID: "client"},
+			"fast": {Issuer: fast.URL, ClientID: "client"},
+		},
+		OIDCCallbackURL: "http://localhost:8080/api/auth/oidc",
+	}, zap.NewNop())
+
+	// Concurrent first logins with the slow provider
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			provider, err := svc.provider(ctx, "slow")
+			assert.NoError(t, err)
+			assert.NotNil(t, provider)
+		}()
+	}
+	require.Eventually(t, func() bool { return slowRequests.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// Another provider is not held up by the slow discovery
+	provider, err := svc.provider(ctx, "fast")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/api/auth/oidc/fast/callback", provider.oauth2.RedirectURL)
+
+	close(slowRelease)
+	wg.Wait()
+	assert.Equal(t, int32(1), slowRequests.Load(), "the slow provider is discovered once")
+
+	_, err = svc.provider(ctx, "fast")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fastRequests.Load(), "discovered providers are kept")
+
+	_, err = svc.provider(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/shared/config"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+// Ceremony kinds, so a registration challenge cannot be answered as a login and vice versa
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+var (
+	ErrInvalidCeremony  = errors.New("invalid or expired passkey ceremony")
+	ErrInvalidPasskey   = errors.New("invalid passkey response")
+	ErrPasskeyCloned    = errors.New("passkey signature counter went backwards")
+	ErrPasskeyNotFound  = errors.New("passkey not found")
+	ErrPasskeyDuplicate = errors.New("passkey already registered")
+)
+
+// NewRelyingParty creates the WebAuthn relying party passkeys are registered with
+func NewRelyingParty(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnOrigins,
+	})
+}
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the raw user ID, which is what discoverable logins are resolved by.
+type webAuthnUser struct {
+	user        *userDomain.User
+	credentials []domain.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       splitTransports(c.Transports),
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: uint32(c.SignCount), //nolint:gosec // stored from a uint32
+			},
+		}
+	}
+	return credentials
+}
+
+// credential returns the stored passkey with the given credential ID
+func (u *webAuthnUser) credential(credentialID []byte) *domain.WebAuthnCredential {
+	for i := range u.credentials {
+		if bytes.Equal(u.credentials[i].CredentialID, credentialID) {
+			return &u.credentials[i]
+		}
+	}
+	return nil
+}
+
+// BeginPasskeyRegistration starts registering a new passkey for a user. The
+// returned options exclude the user's existing passkeys, so the same
+// authenticator is not registered twice.
+func (s *AuthService) BeginPasskeyRegistration(ctx context.Context, userID uuid.UUID) (*domain.PasskeyCeremony, error) {
+	waUser, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.relyingParty.BeginRegistration(waUser,
+		webauthn.WithExclusions(webauthn.Credentials(waUser.WebAuthnCredentials()).CredentialDescriptors()),
+		// Passkeys must be discoverable, so that logins can start without a username
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startCeremony(ctx, &userID, ceremonyRegistration, session, creation)
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response to a
+// registration ceremony and stores the new passkey
+func (s *AuthService) FinishPasskeyRegistration(
+	ctx context.Context, userID, ceremonyID uuid.UUID, name string, response []byte,
+) (*domain.WebAuthnCredential, error) {
+	session, ceremony, err := s.finishCeremony(ctx, ceremonyID, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID == nil || *ceremony.UserID != userID {
+		return nil, ErrInvalidCeremony
+	}
+
+	waUser, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	created, err := s.relyingParty.CreateCredential(waUser, *session, parsed)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	if waUser.credential(created.ID) != nil {
+		return nil, ErrPasskeyDuplicate
+	}
+
+	transports := make([]string, len(created.Transport))
+	for i, transport := range created.Transport {
+		transports[i] = string(transport)
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = "Passkey"
+	}
+
+	credential := &domain.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    created.ID,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		AAGUID:          created.Authenticator.AAGUID,
+		Transports:      strings.Join(transports, ","),
+		SignCount:       int64(created.Authenticator.SignCount),
+		BackupEligible:  created.Flags.BackupEligible,
+		BackupState:     created.Flags.BackupState,
+	}
+	if err := s.passkeyRepo.Create(ctx, credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// BeginPasskeyLogin starts a passkey login. No username is needed: the
+// authenticator offers the user's discoverable credentials itself.
+func (s *AuthService) BeginPasskeyLogin(ctx context.Context) (*domain.PasskeyCeremony, error) {
+	assertion, session, err := s.relyingParty.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startCeremony(ctx, nil, ceremonyLogin, session, assertion)
+}
+
+// FinishPasskeyLogin verifies the authenticator's response to a login
+// ceremony and creates a session. A passkey with user verification is both
+// something the user has and something they are or know, so no second
+// factor is asked for.
+func (s *AuthService) FinishPasskeyLogin(
+	ctx context.Context, ceremonyID uuid.UUID, response []byte, client domain.ClientInfo,
+) (*domain.LoginResponse, error) {
+	// There is no account to throttle until the response is verified, so
+	// failed assertions count against the source IP only
+	if err := s.checkThrottle(ctx, ipKey(client.IPAddress)); err != nil {
+		return nil, err
+	}
+
+	session, _, err := s.finishCeremony(ctx, ceremonyID, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, s.passkeyFailed(ctx, client.IPAddress)
+	}
+
+	waUser, validated, err := s.validatePasskeyLogin(ctx, session, parsed)
+	if errors.Is(err, ErrInvalidPasskey) {
+		return nil, s.passkeyFailed(ctx, client.IPAddress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	credential := waUser.credential(validated.ID)
+
+	// A counter that does not move forward means two authenticators hold the same key
+	if validated.Authenticator.CloneWarning {
+		return nil, ErrPasskeyCloned
+	}
+	recorded, err := s.passkeyRepo.RecordUse(
+		ctx, credential.ID, int64(validated.Authenticator.SignCount), validated.Flags.BackupState, time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !recorded {
+		return nil, ErrPasskeyCloned
+	}
+
+	if s.cfg.RequireEmailVerification && !waUser.user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	return s.createSession(ctx, waUser.user, client)
+}
+
+// ListPasskeys returns the passkeys registered to a user
+func (s *AuthService) ListPasskeys(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	return s.passkeyRepo.GetByUserID(ctx, userID)
+}
+
+// RemovePasskey deletes one of a user's passkeys
+func (s *AuthService) RemovePasskey(ctx context.Context, userID, passkeyID uuid.UUID) error {
+	deleted, err := s.passkeyRepo.DeleteByID(ctx, userID, passkeyID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// validatePasskeyLogin verifies an assertion and resolves the user from its
+// user handle. Any verification failure is reported as ErrInvalidPasskey;
+// other errors come from loading the user.
+func (s *AuthService) validatePasskeyLogin(
+	ctx context.Context, session *webauthn.SessionData, parsed *protocol.ParsedCredentialAssertionData,
+) (*webAuthnUser, *webauthn.Credential, error) {
+	var lookupErr error
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		waUser, err := s.loadWebAuthnUser(ctx, userID)
+		if err != nil {
+			lookupErr = err
+			return nil, err
+		}
+		return waUser, nil
+	}
+
+	user, validated, err := s.relyingParty.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		if lookupErr != nil && !errors.Is(lookupErr, ErrUserNotFound) {
+			return nil, nil, lookupErr
+		}
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	waUser, ok := user.(*webAuthnUser)
+	if !ok || waUser.credential(validated.ID) == nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+	return waUser, validated, nil
+}
+
+// loadWebAuthnUser loads a user together with their passkeys
+func (s *AuthService) loadWebAuthnUser(ctx context.Context, userID uuid.UUID) (*webAuthnUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	credentials, err := s.passkeyRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// startCeremony stores the session data of a begun ceremony and returns the
+// options for the browser along with the ceremony's ID
+func (s *AuthService) startCeremony(
+	ctx context.Context, userID *uuid.UUID, kind string, session *webauthn.SessionData, options interface{},
+) (*domain.PasskeyCeremony, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony := &domain.WebAuthnCeremony{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Kind:      kind,
+		Data:      data,
+		ExpiresAt: time.Now().Add(s.cfg.WebAuthnCeremonyTTL),
+	}
+	if err := s.passkeyRepo.CreateCeremony(ctx, ceremony); err != nil {
+		return nil, err
+	}
+
+	return &domain.PasskeyCeremony{
+		CeremonyID: ceremony.ID,
+		ExpiresAt:  ceremony.ExpiresAt,
+		Options:    options,
+	}, nil
+}
+
+// finishCeremony consumes a ceremony and returns its session data
+func (s *AuthService) finishCeremony(
+	ctx context.Context, ceremonyID uuid.UUID, kind string,
+) (*webauthn.SessionData, *domain.WebAuthnCeremony, error) {
+	ceremony, err := s.passkeyRepo.ConsumeCeremony(ctx, ceremonyID, kind, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if ceremony == nil {
+		return nil, nil, ErrInvalidCeremony
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(ceremony.Data, &session); err != nil {
+		return nil, nil, err
+	}
+	return &session, ceremony, nil
+}
+
+// passkeyFailed records a failed passkey login against the source IP
+func (s *AuthService) passkeyFailed(ctx context.Context, ip string) error {
+	if err := s.recordFailure(ctx, ipKey(ip), s.cfg.LoginMaxIPFailures, s.cfg.LoginMaxIPFailures); err != nil {
+		return err
+	}
+	return ErrInvalidPasskey
+}
+
+func splitTransports(transports string) []protocol.AuthenticatorTransport {
+	if transports == "" {
+		return nil
+	}
+	parts := strings.Split(transports, ",")
+	result := make([]protocol.AuthenticatorTransport, len(parts))
+	for i, part := range parts {
+		result[i] = protocol.AuthenticatorTransport(part)
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/mailer"
+	"github.com/acheevo/test/internal/shared/config"
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// ErrInvalidResetToken is returned for unknown, expired or already used reset tokens
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordResetService handles account recovery through emailed reset tokens.
+// Reset tokens and login lockouts are only changed in units of work, together
+// with the users they belong to.
+type PasswordResetService struct {
+	userRepo  userRepository.UserStore
+	txManager unitofwork.Manager
+	mailer    mailer.Mailer
+	cfg       *config.Config
+	logger    *zap.Logger
+
+	// sending tracks reset links being issued in the background
+	sending sync.WaitGroup
+}
+
+// NewPasswordResetService creates a new password reset service
+func NewPasswordResetService(
+	userRepo userRepository.UserStore,
+	txManager unitofwork.Manager,
+	mail mailer.Mailer,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:  userRepo,
+		txManager: txManager,
+		mailer:    mail,
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// RequestReset emails a password reset link to the account with the given email.
+// Unknown emails are silently ignored so the response does not reveal which
+// accounts exist. The link is issued and sent in the background, so that
+// requests for known and unknown accounts take equally long. Requesting a new
+// link invalidates any earlier one.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		s.logger.Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		if err := s.sendResetLink(context.WithoutCancel(ctx), user); err != nil {
+			s.logger.Error("Failed to send password reset link", zap.String("user_id", user.ID.String()), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until the reset links being issued in the background are sent
+func (s *PasswordResetService) Wait() {
+	s.sending.Wait()
+}
+
+// sendResetLink issues a new reset token for a user, replacing earlier ones,
+// and mails them a link with it
+func (s *PasswordResetService) sendResetLink(ctx context.Context, user *userDomain.User) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(tx unitofwork.Repos) error {
+		if err := tx.PasswordResets.DeleteByUserID(ctx, user.ID); err != nil {
+			return err
+		}
+		return tx.PasswordResets.Create(ctx, &domain.PasswordResetToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			TokenHash: domain.HashToken(token),
+			ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		From:    s.cfg.MailFrom,
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Someone asked to reset the password for your account. If it was you, open the link below " +
+			"within " + s.cfg.PasswordResetTTL.String() + " to choose a new password:\n\n" +
+			tokenLink(s.cfg.PasswordResetURL, token) + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n",
+	})
+}
+
+// ResetPassword redeems a reset token and sets a new password. All of the
+// user's existing sessions are revoked and any login lockout is cleared. The
+// token is only spent if all of that succeeds.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	var (
+		user    *userDomain.User
+		revoked int64
+	)
+	err = s.txManager.WithinTx(ctx, func(tx unitofwork.Repos) error {
+		resetToken, err := tx.PasswordResets.Consume(ctx, token, time.Now())
+		if err != nil {
+			return err
+		}
+		if resetToken == nil {
+			return ErrInvalidResetToken
+		}
+
+		user, err = tx.Users.GetByID(ctx, resetToken.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrInvalidResetToken
+		}
+
+		user.Password = string(hashedPassword)
+		if !user.EmailVerified {
+			// Redeeming a token sent to the address proves ownership of it
+			now := time.Now()
+			user.EmailVerified = true
+			user.VerifiedAt = &now
+		}
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+
+		// Whoever held the old password must not keep a way in
+		revoked, err = tx.Sessions.DeleteByUserID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.PasswordResets.DeleteByUserID(ctx, user.ID); err != nil {
+			return err
+		}
+		return tx.LoginAttempts.DeleteByKey(ctx, accountKey(user.Email))
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Password reset completed",
+		zap.String("user_id", user.ID.String()), zap.Int64("sessions_revoked", revoked))
+	return nil
+}
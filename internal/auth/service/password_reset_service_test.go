@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/mailer"
+	"github.com/acheevo/test/internal/shared/config"
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// recordingMailer keeps the messages it is asked to send
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// tokens returns the token of every link sent, oldest first
+func (m *recordingMailer) tokens() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []string
+	for _, msg := range m.messages {
+		if match := regexp.MustCompile(`[?&]token=([0-9a-f]+)`).FindStringSubmatch(msg.Body); match != nil {
+			tokens = append(tokens, match[1])
+		}
+	}
+	return tokens
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+
+	users, sessions := userRepository.NewMemoryUserStore(), repository.NewMemorySessionStore()
+	attempts := repository.NewMemoryLoginAttemptStore()
+	txManager := unitofwork.NewMemoryManager(users, sessions, repository.NewMemoryPasswordResetStore(), attempts)
+	mail := &recordingMailer{}
+	svc := NewPasswordResetService(users, txManager, mail, &config.Config{
+		PasswordResetTTL: time.Hour,
+		PasswordResetURL: "http://localhost:3000/reset-password",
+		MailFrom:         "no-reply@test.local",
+	}, zap.NewNop())
+
+	user := createUser(t, users, "reset@example.com", "old-password")
+
+	t.Run("Unknown Emails Get No Mail", func(t *testing.T) {
+		require.NoError(t, svc.RequestReset(ctx, "nobody@example.com"))
+		svc.Wait()
+		assert.Empty(t, mail.tokens())
+	})
+
+	t.Run("Reset Sets The Password", func(t *testing.T) {
+		require.NoError(t, svc.RequestReset(ctx, "reset@example.com"))
+		svc.Wait()
+		require.NoError(t, svc.RequestReset(ctx, "reset@example.com"))
+		svc.Wait()
+		tokens := mail.tokens()
+		require.Len(t, tokens, 2)
+
+		require.NoError(t, sessions.Create(ctx, &domain.Session{
+			UserID: user.ID, TokenHash: domain.HashToken("session-token"), ExpiresAt: time.Now().Add(time.Hour),
+		}))
+		now := time.Now()
+		_, err := attempts.RecordFailure(ctx, accountKey(user.Email), now, now.Add(-time.Hour))
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, svc.ResetPassword(ctx, tokens[0], "new-password"), ErrInvalidResetToken,
+			"a new link invalidates the earlier one")
+		require.NoError(t, svc.ResetPassword(ctx, tokens[1], "new-password"))
+		assert.ErrorIs(t, svc.ResetPassword(ctx, tokens[1], "newer-password"), ErrInvalidResetToken)
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("new-password")))
+
+		session, err := sessions.GetByToken(ctx, "session-token")
+		require.NoError(t, err)
+		assert.Nil(t, session, "sessions are revoked")
+		found, err := attempts.GetByKeys(ctx, []string{accountKey(user.Email)})
+		require.NoError(t, err)
+		assert.Empty(t, found, "the lockout is cleared")
+	})
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/principal"
+)
+
+// personalAccessTokenPrefixLength is how much of a token is kept to identify
+// it: the fixed prefix and the first 8 hex digits of the random part
+const personalAccessTokenPrefixLength = len(domain.PersonalAccessTokenPrefix) + 8
+
+var (
+	ErrInvalidTokenScope           = errors.New("invalid token scope")
+	ErrInvalidTokenExpiry          = errors.New("token expiry must be in the future")
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+)
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access
+// token rather than a signed session access token
+func IsPersonalAccessToken(bearer string) bool {
+	return strings.HasPrefix(bearer, domain.PersonalAccessTokenPrefix)
+}
+
+// PersonalAccessTokenPrefix returns the part of a personal access token that
+// may be logged to identify it
+func PersonalAccessTokenPrefix(rawToken string) string {
+	if len(rawToken) > personalAccessTokenPrefixLength {
+		return rawToken[:personalAccessTokenPrefixLength]
+	}
+	return rawToken
+}
+
+// CreatePersonalAccessToken issues a named, scoped token for a user. The raw
+// token is returned once; only its digest is stored.
+func (s *AuthService) CreatePersonalAccessToken(
+	ctx context.Context, userID uuid.UUID, req domain.CreatePersonalAccessTokenRequest,
+) (*domain.CreatedPersonalAccessToken, error) {
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !slices.Contains(domain.TokenScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTokenScope, scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidTokenExpiry
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	rawToken := domain.PersonalAccessTokenPrefix + secret
+
+	accessToken := &domain.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    PersonalAccessTokenPrefix(rawToken),
+		TokenHash: domain.HashToken(rawToken),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.accessTokenRepo.Create(ctx, accessToken); err != nil {
+		return nil, err
+	}
+
+	return &domain.CreatedPersonalAccessToken{PersonalAccessToken: *accessToken, Token: rawToken}, nil
+}
+
+// ListPersonalAccessTokens returns a user's personal access tokens, including expired ones
+func (s *AuthService) ListPersonalAccessTokens(
+	ctx context.Context, userID uuid.UUID,
+) ([]domain.PersonalAccessToken, error) {
+	return s.accessTokenRepo.GetByUserID(ctx, userID)
+}
+
+// RevokePersonalAccessToken deletes one of a user's personal access tokens
+func (s *AuthService) RevokePersonalAccessToken(ctx context.Context, userID, id uuid.UUID) error {
+	deleted, err := s.accessTokenRepo.DeleteByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
+
+// ValidatePersonalAccessToken looks up a personal access token and returns
+// its owner, as they are now, limited to the token's scopes. Use is recorded
+// at most once per configured interval.
+func (s *AuthService) ValidatePersonalAccessToken(
+	ctx context.Context, rawToken, ipAddress string,
+) (*principal.Principal, error) {
+	now := time.Now()
+	accessToken, err := s.accessTokenRepo.GetByToken(ctx, rawToken, now)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken == nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, accessToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidToken
+	}
+
+	interval := s.cfg.SessionLastSeenInterval
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= interval {
+		if err := s.accessTokenRepo.RecordUse(ctx, accessToken.ID, ipAddress, now, now.Add(-interval)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &principal.Principal{
+		Type:             principal.TypeUser,
+		ID:               user.ID,
+		Name:             user.Name,
+		Email:            user.Email,
+		Role:             user.Role,
+		CredentialID:     accessToken.ID,
+		CredentialPrefix: accessToken.Prefix,
+		Scopes:           accessToken.Scopes,
+	}, nil
+}
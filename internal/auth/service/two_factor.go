@@ -0,0 +1,428 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/totp"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+	// totpSkew is how many time steps either side of now a code is accepted for, to allow for clock drift
+	totpSkew = 1
+)
+
+var (
+	ErrInvalidChallenge        = errors.New("invalid or expired login challenge")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication required for role")
+)
+
+// ErrTwoFactorChallenge is matched by ChallengeError via errors.Is
+var ErrTwoFactorChallenge = errors.New("two-factor authentication challenge")
+
+// ChallengeError is returned by Login when the password was correct but the
+// login must be completed with a second factor
+type ChallengeError struct {
+	Challenge domain.TwoFactorChallenge
+}
+
+func (e *ChallengeError) Error() string {
+	return ErrTwoFactorChallenge.Error()
+}
+
+// Is reports whether target is ErrTwoFactorChallenge
+func (e *ChallengeError) Is(target error) bool {
+	return target == ErrTwoFactorChallenge
+}
+
+// twoFactorChallenge returns a ChallengeError if the user must pass a second
+// factor before a session is created, and nil if the password is enough
+func (s *AuthService) twoFactorChallenge(ctx context.Context, user *userDomain.User) error {
+	credential, err := s.twoFactorRepo.GetCredential(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	enrolled := credential != nil && credential.ConfirmedAt != nil
+	if !enrolled && !s.twoFactorRequired(user.Role) {
+		return nil
+	}
+
+	challengeToken, expiresAt, err := s.tokens.IssueLoginChallenge(user, !enrolled, s.cfg.TwoFactorChallengeTTL)
+	if err != nil {
+		return err
+	}
+	return &ChallengeError{Challenge: domain.TwoFactorChallenge{
+		TwoFactorRequired:  true,
+		EnrollmentRequired: !enrolled,
+		ChallengeToken:     challengeToken,
+		ExpiresAt:          expiresAt,
+	}}
+}
+
+// CompleteLogin completes a login challenged for a second factor, with either
+// a TOTP code or a recovery code. For enrollment challenges the TOTP code
+// confirms the enrollment started with EnrollFromChallenge, and the response
+// carries the user's new recovery codes.
+func (s *AuthService) CompleteLogin(
+	ctx context.Context, challengeToken, code, recoveryCode string, client domain.ClientInfo,
+) (*domain.LoginResponse, error) {
+	claims, err := s.tokens.VerifyLoginChallenge(challengeToken)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	// Wrong codes count as failed logins, so guessing is throttled like passwords
+	if err := s.checkThrottle(ctx, accountKey(user.Email), ipKey(client.IPAddress)); err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	switch {
+	case claims.Enroll:
+		recoveryCodes, err = s.confirmEnrollment(ctx, user, code, client.IPAddress)
+	case code != "":
+		err = s.verifyCode(ctx, user, code, client.IPAddress)
+	case recoveryCode != "":
+		err = s.redeemRecoveryCode(ctx, user, recoveryCode, client.IPAddress)
+	default:
+		err = ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a fully completed login clears the account's failure history
+	if err := s.attemptRepo.DeleteByKey(ctx, accountKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	response, err := s.createSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = recoveryCodes
+	return response, nil
+}
+
+// EnrollFromChallenge starts TOTP enrollment for a user whose role requires
+// two-factor authentication, using the challenge from their login
+func (s *AuthService) EnrollFromChallenge(
+	ctx context.Context, challengeToken string,
+) (*domain.TwoFactorEnrollment, error) {
+	claims, err := s.tokens.VerifyLoginChallenge(challengeToken)
+	if err != nil || !claims.Enroll {
+		return nil, ErrInvalidChallenge
+	}
+	return s.BeginEnrollment(ctx, claims.UserID)
+}
+
+// BeginEnrollment generates a new TOTP secret for a user. The secret does not
+// protect logins until it is confirmed with a first code.
+func (s *AuthService) BeginEnrollment(ctx context.Context, userID uuid.UUID) (*domain.TwoFactorEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.twoFactorRepo.SavePendingCredential(ctx, &domain.TOTPCredential{UserID: user.ID, Secret: sealed})
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	return &domain.TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(s.cfg.TwoFactorIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables two-factor authentication with the first code
+// from the user's authenticator and returns their recovery codes
+func (s *AuthService) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code, ip string) ([]string, error) {
+	user, err := s.throttledUser(ctx, userID, ip)
+	if err != nil {
+		return nil, err
+	}
+	return s.confirmEnrollment(ctx, user, code, ip)
+}
+
+// DisableTwoFactor turns off two-factor authentication after checking a
+// current TOTP code. It is refused when the user's role requires it.
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, code, ip string) error {
+	user, err := s.throttledUser(ctx, userID, ip)
+	if err != nil {
+		return err
+	}
+	if s.twoFactorRequired(user.Role) {
+		return ErrTwoFactorRequired
+	}
+	if err := s.verifyCode(ctx, user, code, ip); err != nil {
+		return err
+	}
+	return s.twoFactorRepo.DeleteByUserID(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a current TOTP code
+func (s *AuthService) RegenerateRecoveryCodes(
+	ctx context.Context, userID uuid.UUID, code, ip string,
+) ([]string, error) {
+	user, err := s.throttledUser(ctx, userID, ip)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyCode(ctx, user, code, ip); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, user.ID)
+}
+
+// TwoFactorStatus reports whether a user has two-factor authentication enabled
+func (s *AuthService) TwoFactorStatus(ctx context.Context, userID uuid.UUID) (*domain.TwoFactorStatus, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	credential, err := s.twoFactorRepo.GetCredential(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := s.twoFactorRepo.CountUnusedRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TwoFactorStatus{
+		Enabled:                credential != nil && credential.ConfirmedAt != nil,
+		Required:               s.twoFactorRequired(user.Role),
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// ResetTwoFactor removes a user's two-factor enrollment, e.g. after a lost
+// device. Users whose role requires it must enroll again at their next login.
+func (s *AuthService) ResetTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return s.twoFactorRepo.DeleteByUserID(ctx, user.ID)
+}
+
+// twoFactorRequired reports whether users of a role must use two-factor authentication
+func (s *AuthService) twoFactorRequired(role userDomain.UserRole) bool {
+	return slices.Contains(s.cfg.TwoFactorRequiredRoles, string(role))
+}
+
+// throttledUser loads a user for a code check, refusing while the account is throttled
+func (s *AuthService) throttledUser(ctx context.Context, userID uuid.UUID, ip string) (*userDomain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.checkThrottle(ctx, accountKey(user.Email), ipKey(ip)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// confirmEnrollment confirms a pending credential with its first code and issues recovery codes
+func (s *AuthService) confirmEnrollment(ctx context.Context, user *userDomain.User, code, ip string) ([]string, error) {
+	credential, err := s.twoFactorRepo.GetCredential(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if credential.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.checkCode(ctx, user, credential, code, ip, true); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, user.ID)
+}
+
+// verifyCode checks a TOTP code against the user's confirmed credential
+func (s *AuthService) verifyCode(ctx context.Context, user *userDomain.User, code, ip string) error {
+	credential, err := s.twoFactorRepo.GetCredential(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if credential == nil || credential.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	return s.checkCode(ctx, user, credential, code, ip, false)
+}
+
+// checkCode validates a code and records its time step, so it cannot be used twice
+func (s *AuthService) checkCode(
+	ctx context.Context, user *userDomain.User, credential *domain.TOTPCredential, code, ip string, confirm bool,
+) error {
+	secret, err := s.openSecret(credential.Secret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return s.twoFactorFailed(ctx, user.Email, ip)
+	}
+
+	used, err := s.twoFactorRepo.UseStep(ctx, user.ID, step, confirm)
+	if err != nil {
+		return err
+	}
+	if !used {
+		// A replayed code, or one racing another request with the same code
+		return s.twoFactorFailed(ctx, user.Email, ip)
+	}
+	return nil
+}
+
+// redeemRecoveryCode consumes one of the user's recovery codes
+func (s *AuthService) redeemRecoveryCode(ctx context.Context, user *userDomain.User, code, ip string) error {
+	redeemed, err := s.twoFactorRepo.ConsumeRecoveryCode(ctx, user.ID, s.hashRecoveryCode(code), time.Now())
+	if err != nil {
+		return err
+	}
+	if !redeemed {
+		return s.twoFactorFailed(ctx, user.Email, ip)
+	}
+	return nil
+}
+
+// twoFactorFailed records a wrong second factor as a failed login
+func (s *AuthService) twoFactorFailed(ctx context.Context, email, ip string) error {
+	if err := s.loginFailed(ctx, email, ip); !errors.Is(err, ErrInvalidCredentials) {
+		return err
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// newRecoveryCodes replaces a user's recovery codes and returns the new plaintext codes
+func (s *AuthService) newRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		// 10 base32 characters carry 50 bits, written as xxxxx-xxxxx
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = s.hashRecoveryCode(codes[i])
+	}
+
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode returns the keyed digest a recovery code is stored under.
+// Keying the digest means a leaked table alone is not enough to brute-force the codes.
+func (s *AuthService) hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	mac := hmac.New(sha256.New, s.twoFactorKey[:])
+	mac.Write([]byte("recovery-code:" + normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sealSecret encrypts a TOTP secret with AES-256-GCM for storage
+func (s *AuthService) sealSecret(secret string) (string, error) {
+	gcm, err := s.twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// openSecret decrypts a TOTP secret sealed by sealSecret
+func (s *AuthService) openSecret(sealed string) (string, error) {
+	gcm, err := s.twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed TOTP secret")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+func (s *AuthService) twoFactorCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.twoFactorKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveTwoFactorKey derives the key protecting TOTP secrets and recovery codes
+func deriveTwoFactorKey(secret string) [32]byte {
+	return sha256.Sum256([]byte("two-factor:" + secret))
+}
@@ -0,0 +1,69 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+// loginChallengeAudience scopes challenge tokens so they cannot be used as access tokens
+const loginChallengeAudience = "login-challenge"
+
+// ChallengeClaims represents the claims carried by a login challenge token,
+// issued after a correct password when a second factor is still needed
+type ChallengeClaims struct {
+	UserID uuid.UUID `json:"uid"`
+	// Enroll marks a challenge for a user who must enroll in two-factor authentication first
+	Enroll bool `json:"enroll,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IssueLoginChallenge signs a short-lived token standing for a half-completed login
+func (m *Manager) IssueLoginChallenge(
+	user *userDomain.User, enroll bool, ttl time.Duration,
+) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := ChallengeClaims{
+		UserID: user.ID,
+		Enroll: enroll,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{loginChallengeAudience},
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// VerifyLoginChallenge checks the signature, audience and validity window of a challenge token
+func (m *Manager) VerifyLoginChallenge(tokenString string) (*ChallengeClaims, error) {
+	var claims ChallengeClaims
+	parsed, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(loginChallengeAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == uuid.Nil {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
@@ -0,0 +1,141 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/shared/config"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+const issuer = "test-api"
+
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Claims represents the claims carried by an access token
+type Claims struct {
+	UserID    uuid.UUID           `json:"uid"`
+	SessionID uuid.UUID           `json:"sid"`
+	Role      userDomain.UserRole `json:"role"`
+	Email     string              `json:"email"`
+	Name      string              `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// Manager issues and verifies signed access tokens
+type Manager struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	ttl       time.Duration
+}
+
+// NewManager creates a token manager from the application configuration
+func NewManager(cfg *config.Config) (*Manager, error) {
+	switch cfg.JWTAlgorithm {
+	case jwt.SigningMethodHS256.Alg():
+		return NewHMACManager(cfg.SessionSecret, cfg.AccessTokenTTL), nil
+	case jwt.SigningMethodEdDSA.Alg():
+		seed, err := base64.StdEncoding.DecodeString(cfg.JWTPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("decode JWT private key: %w", err)
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("JWT private key must be a %d-byte Ed25519 seed", ed25519.SeedSize)
+		}
+		return NewEdDSAManager(ed25519.NewKeyFromSeed(seed), cfg.AccessTokenTTL), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+	}
+}
+
+// NewHMACManager creates a token manager signing with HS256
+func NewHMACManager(secret string, ttl time.Duration) *Manager {
+	return &Manager{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+		ttl:       ttl,
+	}
+}
+
+// NewEdDSAManager creates a token manager signing with Ed25519
+func NewEdDSAManager(privateKey ed25519.PrivateKey, ttl time.Duration) *Manager {
+	return &Manager{
+		method:    jwt.SigningMethodEdDSA,
+		signKey:   privateKey,
+		verifyKey: privateKey.Public(),
+		ttl:       ttl,
+	}
+}
+
+// Issue signs an access token for the given user and session.
+// The token never outlives the session it belongs to.
+func (m *Manager) Issue(
+	user *userDomain.User, sessionID uuid.UUID, sessionExpiresAt time.Time,
+) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	if sessionExpiresAt.Before(expiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+
+	claims := Claims{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		Role:      user.Role,
+		Email:     user.Email,
+		Name:      user.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   user.ID.String(),
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify checks the signature and validity window of an access token
+func (m *Manager) Verify(tokenString string) (*Claims, error) {
+	return m.parse(tokenString)
+}
+
+// VerifySignature checks only the signature of an access token, ignoring expiry.
+// It is used where an expired token must still identify its session, such as logout.
+func (m *Manager) VerifySignature(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, jwt.WithoutClaimsValidation())
+}
+
+func (m *Manager) parse(tokenString string, opts ...jwt.ParserOption) (*Claims, error) {
+	opts = append(opts,
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(issuer),
+	)
+
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	}, opts...)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidToken
+	}
+	// Access tokens carry no audience; any audience marks a token issued for another purpose
+	if claims.UserID == uuid.Nil || claims.SessionID == uuid.Nil || len(claims.Audience) > 0 {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
@@ -0,0 +1,147 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+func TestManager(t *testing.T) {
+	user := &userDomain.User{
+		ID:    uuid.New(),
+		Email: "token@example.com",
+		Name:  "Token User",
+		Role:  userDomain.RoleAdmin,
+	}
+	sessionID := uuid.New()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	managers := map[string]*Manager{
+		"HS256": NewHMACManager("test-secret", 15*time.Minute),
+		"EdDSA": NewEdDSAManager(privateKey, 15*time.Minute),
+	}
+
+	for name, manager := range managers {
+		t.Run(name+" Round Trip", func(t *testing.T) {
+			signed, expiresAt, err := manager.Issue(user, sessionID, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(15*time.Minute), expiresAt, time.Second)
+
+			claims, err := manager.Verify(signed)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, claims.UserID)
+			assert.Equal(t, sessionID, claims.SessionID)
+			assert.Equal(t, user.Role, claims.Role)
+			assert.Equal(t, user.Email, claims.Email)
+		})
+	}
+
+	t.Run("Capped By Session Expiry", func(t *testing.T) {
+		sessionExpiry := time.Now().Add(time.Minute)
+		_, expiresAt, err := managers["HS256"].Issue(user, sessionID, sessionExpiry)
+		require.NoError(t, err)
+		assert.Equal(t, sessionExpiry, expiresAt)
+	})
+
+	t.Run("Wrong Key Rejected", func(t *testing.T) {
+		signed, _, err := managers["HS256"].Issue(user, sessionID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		_, err = NewHMACManager("other-secret", 15*time.Minute).Verify(signed)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Algorithm Mismatch Rejected", func(t *testing.T) {
+		signed, _, err := managers["EdDSA"].Issue(user, sessionID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		_, err = managers["HS256"].Verify(signed)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Expired Token", func(t *testing.T) {
+		signed, _, err := managers["HS256"].Issue(user, sessionID, time.Now().Add(-time.Second))
+		require.NoError(t, err)
+
+		_, err = managers["HS256"].Verify(signed)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		claims, err := managers["HS256"].VerifySignature(signed)
+		require.NoError(t, err)
+		assert.Equal(t, sessionID, claims.SessionID)
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	user := &userDomain.User{ID: uuid.New(), Email: "verify@example.com"}
+	manager := NewHMACManager("test-secret", 15*time.Minute)
+
+	t.Run("Round Trip", func(t *testing.T) {
+		signed, err := manager.IssueEmailVerification(user, time.Hour)
+		require.NoError(t, err)
+
+		claims, err := manager.VerifyEmailVerification(signed)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, user.Email, claims.Email)
+	})
+
+	t.Run("Expired Token", func(t *testing.T) {
+		signed, err := manager.IssueEmailVerification(user, -time.Second)
+		require.NoError(t, err)
+
+		_, err = manager.VerifyEmailVerification(signed)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Not Interchangeable With Access Tokens", func(t *testing.T) {
+		verification, err := manager.IssueEmailVerification(user, time.Hour)
+		require.NoError(t, err)
+		_, err = manager.Verify(verification)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		access, _, err := manager.Issue(user, uuid.New(), time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		_, err = manager.VerifyEmailVerification(access)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestLoginChallenge(t *testing.T) {
+	user := &userDomain.User{ID: uuid.New(), Email: "challenge@example.com"}
+	manager := NewHMACManager("test-secret", 15*time.Minute)
+
+	signed, expiresAt, err := manager.IssueLoginChallenge(user, true, 5*time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), expiresAt, time.Second)
+
+	claims, err := manager.VerifyLoginChallenge(signed)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.True(t, claims.Enroll)
+
+	// Challenge, verification and access tokens are not interchangeable
+	_, err = manager.Verify(signed)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = manager.VerifyEmailVerification(signed)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	verification, err := manager.IssueEmailVerification(user, time.Hour)
+	require.NoError(t, err)
+	_, err = manager.VerifyLoginChallenge(verification)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, _, err := manager.IssueLoginChallenge(user, false, -time.Second)
+	require.NoError(t, err)
+	_, err = manager.VerifyLoginChallenge(expired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,60 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+// emailVerificationAudience scopes verification tokens so they cannot be used as access tokens
+const emailVerificationAudience = "email-verification"
+
+// EmailVerificationClaims represents the claims carried by an email verification token.
+// The token is bound to the address it was sent to, so changing the email invalidates it.
+type EmailVerificationClaims struct {
+	UserID uuid.UUID `json:"uid"`
+	Email  string    `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// IssueEmailVerification signs a token proving that its holder received mail at the user's address
+func (m *Manager) IssueEmailVerification(user *userDomain.User, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := EmailVerificationClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+}
+
+// VerifyEmailVerification checks the signature, audience and validity window of a verification token
+func (m *Manager) VerifyEmailVerification(tokenString string) (*EmailVerificationClaims, error) {
+	var claims EmailVerificationClaims
+	parsed, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(emailVerificationAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == uuid.Nil || claims.Email == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
@@ -1,9 +1,13 @@
 package transport
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/acheevo/test/internal/auth/domain"
@@ -12,15 +16,21 @@ import (
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
-	authService *service.AuthService
-	logger      *zap.Logger
+	authService         *service.AuthService
+	verificationService *service.EmailVerificationService
+	logger              *zap.Logger
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(authService *service.AuthService, logger *zap.Logger) *AuthHandler {
+func NewAuthHandler(
+	authService *service.AuthService,
+	verificationService *service.EmailVerificationService,
+	logger *zap.Logger,
+) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		logger:      logger,
+		authService:         authService,
+		verificationService: verificationService,
+		logger:              logger,
 	}
 }
 
@@ -32,8 +42,30 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(req.Email, req.Password)
+	client := domain.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	response, err := h.authService.Login(c.Request.Context(), req.Email, req.Password, client)
 	if err != nil {
+		var throttleErr *service.ThrottleError
+		if errors.As(err, &throttleErr) {
+			h.logger.Warn("Login throttled", zap.String("ip", client.IPAddress))
+			retryAfter := int(math.Ceil(throttleErr.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts, try again later"})
+			return
+		}
+		var challengeErr *service.ChallengeError
+		if errors.As(err, &challengeErr) {
+			c.JSON(http.StatusOK, challengeErr.Challenge)
+			return
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+			return
+		}
 		h.logger.Error("Login failed", zap.String("email", req.Email), zap.Error(err))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
@@ -42,6 +74,28 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Refresh handles access token refresh with refresh token rotation
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req domain.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			h.logger.Warn("Refresh token reuse detected, session revoked")
+		} else {
+			h.logger.Error("Token refresh failed", zap.Error(err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // Register handles user registration
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req domain.RegisterRequest
@@ -50,16 +104,81 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Register(req.Email, req.Password, req.Name)
+	user, err := h.authService.Register(c.Request.Context(), req.Email, req.Password, req.Name)
 	if err != nil {
 		h.logger.Error("Registration failed", zap.String("email", req.Email), zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The account exists either way; a failed send can be retried through the resend endpoint
+	if err := h.verificationService.SendVerification(user); err != nil {
+		h.logger.Error("Failed to send verification email", zap.String("email", req.Email), zap.Error(err))
+	}
+
 	c.JSON(http.StatusCreated, user)
 }
 
+// VerifyEmail handles email verification with a token from the verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req domain.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.verificationService.VerifyEmail(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+		h.logger.Error("Email verification failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResendVerification sends a new verification email. The response is the same
+// whether or not the email belongs to an unverified account.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req domain.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.verificationService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		h.logger.Error("Failed to resend verification email", zap.String("email", req.Email), zap.Error(err))
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account needs verification, a new link has been sent"})
+}
+
+// UnlockUser clears a user's failed login lockout (requires users:write)
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.authService.UnlockUser(c.Request.Context(), id); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to unlock user", zap.String("id", idStr), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
 // Logout handles user logout
 func (h *AuthHandler) Logout(c *gin.Context) {
 	token := c.GetHeader("Authorization")
@@ -73,7 +192,11 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		token = token[7:]
 	}
 
-	if err := h.authService.Logout(token); err != nil {
+	if err := h.authService.Logout(c.Request.Context(), token); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
 		h.logger.Error("Logout failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
 		return
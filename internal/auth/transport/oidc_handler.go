@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/service"
+)
+
+// oidcStateCookie binds a started external login to the browser that started
+// it, so that a login cannot be completed in someone else's browser
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler handles login through external OpenID Connect providers
+type OIDCHandler struct {
+	oidcService *service.OIDCService
+	logger      *zap.Logger
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(oidcService *service.OIDCService, logger *zap.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+		logger:      logger,
+	}
+}
+
+// ListProviders returns the names of the configured providers
+func (h *OIDCHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oidcService.Providers()})
+}
+
+// Login redirects the browser to the provider's authorization endpoint
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider := c.Param("provider")
+
+	authorization, err := h.oidcService.BeginLogin(c.Request.Context(), provider)
+	if err != nil {
+		h.handleError(c, err, "Failed to start external login")
+		return
+	}
+
+	maxAge := int(time.Until(authorization.ExpiresAt).Seconds())
+	h.setStateCookie(c, authorization.State, maxAge)
+	c.Redirect(http.StatusFound, authorization.URL)
+}
+
+// Callback completes a login when the provider redirects back
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider := c.Param("provider")
+	state := c.Query("state")
+
+	// The state is single use either way
+	cookie, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		h.logger.Info("External login refused by provider",
+			zap.String("provider", provider), zap.String("error", providerErr))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was refused by the identity provider"})
+		return
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	client := domain.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	response, err := h.oidcService.CompleteLogin(c.Request.Context(), provider, state, c.Query("code"), client)
+	if err != nil {
+		h.handleError(c, err, "External login failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// setStateCookie sets the state cookie, or clears it with a negative maxAge
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	// Lax still sends the cookie on the provider's top-level redirect back to us
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/api/auth/oidc", "", secure, true)
+}
+
+// handleError maps OIDC service errors to responses
+func (h *OIDCHandler) handleError(c *gin.Context, err error, message string) {
+	var challengeErr *service.ChallengeError
+	switch {
+	case errors.As(err, &challengeErr):
+		// The provider replaces the password step only; a second factor is still required
+		c.JSON(http.StatusOK, challengeErr.Challenge)
+	case errors.Is(err, service.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		h.logger.Warn(message, zap.String("provider", c.Param("provider")), zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	case errors.Is(err, service.ErrOIDCEmailRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The identity provider did not share an email address"})
+	case errors.Is(err, service.ErrIdentityConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email exists and cannot be linked automatically"})
+	case errors.Is(err, service.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+	default:
+		h.logger.Error(message, zap.String("provider", c.Param("provider")), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/service"
+)
+
+// PasskeyHandler handles passkey (WebAuthn) endpoints
+type PasskeyHandler struct {
+	authService *service.AuthService
+	logger      *zap.Logger
+}
+
+// NewPasskeyHandler creates a new passkey handler
+func NewPasskeyHandler(authService *service.AuthService, logger *zap.Logger) *PasskeyHandler {
+	return &PasskeyHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// BeginRegistration starts registering a passkey for the current user
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	ceremony, err := h.authService.BeginPasskeyRegistration(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err, "Failed to start passkey registration")
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishRegistration verifies the authenticator's response and stores the passkey
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	var req domain.PasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := h.authService.FinishPasskeyRegistration(
+		ctx, claims.UserID, req.CeremonyID, req.Name, req.Credential,
+	)
+	if err != nil {
+		h.handleError(c, err, "Failed to register passkey")
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// BeginLogin starts a passkey login
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	ceremony, err := h.authService.BeginPasskeyLogin(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err, "Failed to start passkey login")
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishLogin verifies the authenticator's assertion and creates a session
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var req domain.PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client := domain.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	response, err := h.authService.FinishPasskeyLogin(c.Request.Context(), req.CeremonyID, req.Credential, client)
+	if err != nil {
+		h.handleError(c, err, "Passkey login failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListPasskeys returns the current user's passkeys
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	passkeys, err := h.authService.ListPasskeys(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err, "Failed to list passkeys")
+		return
+	}
+
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// RemovePasskey deletes one of the current user's passkeys
+func (h *PasskeyHandler) RemovePasskey(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	passkeyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if err := h.authService.RemovePasskey(c.Request.Context(), claims.UserID, passkeyID); err != nil {
+		h.handleError(c, err, "Failed to remove passkey")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed"})
+}
+
+// handleError maps passkey service errors to responses
+func (h *PasskeyHandler) handleError(c *gin.Context, err error, message string) {
+	var throttleErr *service.ThrottleError
+	switch {
+	case errors.As(err, &throttleErr):
+		retryAfter := int(math.Ceil(throttleErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+	case errors.Is(err, service.ErrInvalidCeremony):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired passkey ceremony"})
+	case errors.Is(err, service.ErrInvalidPasskey):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+	case errors.Is(err, service.ErrPasskeyCloned):
+		h.logger.Warn("Passkey signature counter regression", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+	case errors.Is(err, service.ErrPasskeyDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "Passkey is already registered"})
+	case errors.Is(err, service.ErrPasskeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+	case errors.Is(err, service.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/service"
+)
+
+// PasswordHandler handles password reset endpoints
+type PasswordHandler struct {
+	resetService *service.PasswordResetService
+	logger       *zap.Logger
+}
+
+// NewPasswordHandler creates a new password handler
+func NewPasswordHandler(resetService *service.PasswordResetService, logger *zap.Logger) *PasswordHandler {
+	return &PasswordHandler{
+		resetService: resetService,
+		logger:       logger,
+	}
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email belongs to an account.
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var req domain.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.resetService.RequestReset(c.Request.Context(), req.Email); err != nil {
+		// Still answer as if the link went out, so failures do not reveal which accounts exist
+		h.logger.Error("Password reset request failed", zap.Error(err))
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a password reset link has been sent"})
+}
+
+// ResetPassword sets a new password using a reset token
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var req domain.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.resetService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		h.logger.Error("Password reset failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/service"
+)
+
+// PersonalAccessTokenHandler handles personal access token management endpoints
+type PersonalAccessTokenHandler struct {
+	authService *service.AuthService
+	logger      *zap.Logger
+}
+
+// NewPersonalAccessTokenHandler creates a new personal access token handler
+func NewPersonalAccessTokenHandler(authService *service.AuthService, logger *zap.Logger) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// CreateToken issues a personal access token to the current user. The token
+// is only ever included in this response.
+func (h *PersonalAccessTokenHandler) CreateToken(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	var req domain.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.authService.CreatePersonalAccessToken(c.Request.Context(), claims.UserID, req)
+	if err != nil {
+		h.handleError(c, err, "Failed to create personal access token")
+		return
+	}
+
+	h.logger.Info("Created personal access token",
+		zap.String("token_prefix", created.Prefix), zap.String("user_id", claims.UserID.String()))
+	c.JSON(http.StatusCreated, created)
+}
+
+// ListTokens returns the current user's personal access tokens
+func (h *PersonalAccessTokenHandler) ListTokens(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	accessTokens, err := h.authService.ListPersonalAccessTokens(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err, "Failed to list personal access tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, accessTokens)
+}
+
+// RevokeToken deletes one of the current user's personal access tokens
+func (h *PersonalAccessTokenHandler) RevokeToken(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.authService.RevokePersonalAccessToken(c.Request.Context(), claims.UserID, tokenID); err != nil {
+		h.handleError(c, err, "Failed to revoke personal access token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Personal access token revoked"})
+}
+
+// handleError maps personal access token service errors to responses
+func (h *PersonalAccessTokenHandler) handleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTokenScope), errors.Is(err, service.ErrInvalidTokenExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPersonalAccessTokenNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Personal access token not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
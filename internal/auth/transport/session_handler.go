@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/service"
+	"github.com/acheevo/test/internal/auth/token"
+)
+
+// SessionHandler handles session management endpoints
+type SessionHandler struct {
+	authService *service.AuthService
+	logger      *zap.Logger
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(authService *service.AuthService, logger *zap.Logger) *SessionHandler {
+	return &SessionHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// ListSessions returns the current user's active sessions
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	h.listSessions(c, claims.UserID, claims.SessionID)
+}
+
+// RevokeSession revokes one of the current user's sessions
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	h.revokeSession(c, claims.UserID, c.Param("id"))
+}
+
+// LogoutAll revokes all of the current user's sessions, including the current one
+func (h *SessionHandler) LogoutAll(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	h.revokeAllSessions(c, claims.UserID)
+}
+
+// ListUserSessions returns a user's active sessions (requires sessions:read)
+func (h *SessionHandler) ListUserSessions(c *gin.Context) {
+	userID, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	h.listSessions(c, userID, uuid.Nil)
+}
+
+// RevokeUserSession revokes one of a user's sessions (requires sessions:revoke)
+func (h *SessionHandler) RevokeUserSession(c *gin.Context) {
+	userID, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	h.revokeSession(c, userID, c.Param("sessionId"))
+}
+
+// RevokeUserSessions revokes all of a user's sessions (requires sessions:revoke)
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	userID, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	h.revokeAllSessions(c, userID)
+}
+
+func (h *SessionHandler) listSessions(c *gin.Context, userID, currentSessionID uuid.UUID) {
+	sessions, err := h.authService.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to list sessions", zap.String("user_id", userID.String()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	response := make([]domain.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, domain.SessionResponse{
+			Session: session,
+			Current: session.ID == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *SessionHandler) revokeSession(c *gin.Context, userID uuid.UUID, sessionIDStr string) {
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		h.logger.Error("Failed to revoke session", zap.String("session_id", sessionIDStr), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func (h *SessionHandler) revokeAllSessions(c *gin.Context, userID uuid.UUID) {
+	revoked, err := h.authService.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to revoke sessions", zap.String("user_id", userID.String()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": revoked})
+}
+
+// claims returns the access token claims set by the auth middleware
+func requestClaims(c *gin.Context) (*token.Claims, bool) {
+	value, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return nil, false
+	}
+
+	claims, ok := value.(*token.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid claims type in context"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// targetUser returns the user ID from the path of an administration endpoint
+func targetUser(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
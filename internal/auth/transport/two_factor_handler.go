@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/service"
+)
+
+// TwoFactorHandler handles two-factor authentication endpoints
+type TwoFactorHandler struct {
+	authService *service.AuthService
+	logger      *zap.Logger
+}
+
+// NewTwoFactorHandler creates a new two-factor handler
+func NewTwoFactorHandler(authService *service.AuthService, logger *zap.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// CompleteLogin handles the second login step with a TOTP or recovery code
+func (h *TwoFactorHandler) CompleteLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req domain.TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client := domain.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	response, err := h.authService.CompleteLogin(ctx, req.ChallengeToken, req.Code, req.RecoveryCode, client)
+	if err != nil {
+		h.handleError(c, err, "Two-factor login failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// EnrollFromChallenge starts TOTP enrollment during a login that requires it
+func (h *TwoFactorHandler) EnrollFromChallenge(c *gin.Context) {
+	var req domain.TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.authService.EnrollFromChallenge(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		h.handleError(c, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// GetStatus returns the current user's two-factor authentication state
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.authService.TwoFactorStatus(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err, "Failed to get two-factor status")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Enroll starts TOTP enrollment for the current user
+func (h *TwoFactorHandler) Enroll(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.authService.BeginEnrollment(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.handleError(c, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm enables two-factor authentication with the first code from the authenticator
+func (h *TwoFactorHandler) Confirm(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.ConfirmEnrollment(c.Request.Context(), claims.UserID, req.Code, c.ClientIP())
+	if err != nil {
+		h.handleError(c, err, "Failed to confirm two-factor enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, domain.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c.Request.Context(), claims.UserID, req.Code, c.ClientIP())
+	if err != nil {
+		h.handleError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, domain.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable turns off two-factor authentication for the current user
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	claims, ok := requestClaims(c)
+	if !ok {
+		return
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.DisableTwoFactor(c.Request.Context(), claims.UserID, req.Code, c.ClientIP()); err != nil {
+		h.handleError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// ResetUserTwoFactor removes a user's two-factor enrollment (requires users:write)
+func (h *TwoFactorHandler) ResetUserTwoFactor(c *gin.Context) {
+	userID, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.ResetTwoFactor(c.Request.Context(), userID); err != nil {
+		h.handleError(c, err, "Failed to reset two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// handleError maps two-factor service errors to responses
+func (h *TwoFactorHandler) handleError(c *gin.Context, err error, message string) {
+	var throttleErr *service.ThrottleError
+	switch {
+	case errors.As(err, &throttleErr):
+		retryAfter := int(math.Ceil(throttleErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later"})
+	case errors.Is(err, service.ErrInvalidChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, service.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -10,54 +11,178 @@ import (
 
 	"github.com/acheevo/test/internal/auth/repository"
 	"github.com/acheevo/test/internal/auth/service"
+	"github.com/acheevo/test/internal/auth/token"
 	"github.com/acheevo/test/internal/auth/transport"
+	"github.com/acheevo/test/internal/mailer"
+	"github.com/acheevo/test/internal/maintenance"
 	"github.com/acheevo/test/internal/middleware"
+	oauthRepository "github.com/acheevo/test/internal/oauth/repository"
+	oauthService "github.com/acheevo/test/internal/oauth/service"
+	oauthTransport "github.com/acheevo/test/internal/oauth/transport"
+	"github.com/acheevo/test/internal/policy"
+	"github.com/acheevo/test/internal/ratelimit"
+	rbacRepository "github.com/acheevo/test/internal/rbac/repository"
+	rbacService "github.com/acheevo/test/internal/rbac/service"
+	rbacTransport "github.com/acheevo/test/internal/rbac/transport"
+	serviceAccountRepository "github.com/acheevo/test/internal/serviceaccount/repository"
+	serviceAccountService "github.com/acheevo/test/internal/serviceaccount/service"
+	serviceAccountTransport "github.com/acheevo/test/internal/serviceaccount/transport"
 	"github.com/acheevo/test/internal/shared/config"
 	"github.com/acheevo/test/internal/shared/database"
+	"github.com/acheevo/test/internal/shared/unitofwork"
 	userRepository "github.com/acheevo/test/internal/user/repository"
 	userService "github.com/acheevo/test/internal/user/service"
 	userTransport "github.com/acheevo/test/internal/user/transport"
 )
 
 type Server struct {
-	server *http.Server
-	logger *zap.Logger
-	db     *database.Database
+	server       *http.Server
+	logger       *zap.Logger
+	db           *database.Database
+	reaper       *maintenance.SessionReaper
+	resets       *service.PasswordResetService
+	verification *service.EmailVerificationService
 }
 
 func NewServer(logger *zap.Logger, cfg *config.Config) (*Server, error) {
+	// Refuse to sign and encrypt with secrets anyone could know
+	if err := cfg.CheckSecrets(); err != nil {
+		return nil, err
+	}
+
 	// Initialize database
-	db, err := database.NewDatabase(cfg.GetDSN())
+	db, err := database.NewDatabase(cfg.GetDSN(), cfg.DBOperationTimeout)
 	if err != nil {
 		return nil, err
 	}
+	if err := migrateDatabase(db, cfg, logger); err != nil {
+		return nil, err
+	}
 
 	// Initialize repositories
 	userRepo := userRepository.NewUserRepository(db)
 	sessionRepo := repository.NewSessionRepository(db)
+	attemptRepo := repository.NewLoginAttemptRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	passkeyRepo := repository.NewPasskeyRepository(db)
+	accessTokenRepo := repository.NewPersonalAccessTokenRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+	clientRepo := oauthRepository.NewClientRepository(db)
+	grantRepo := oauthRepository.NewGrantRepository(db)
+	keyRepo := oauthRepository.NewKeyRepository(db)
+	serviceAccountRepo := serviceAccountRepository.NewServiceAccountRepository(db)
+	roleRepo := rbacRepository.NewRoleRepository(db)
+
+	// Changes spanning users and their sessions run as units of work
+	txManager := unitofwork.NewPostgresManager(db, cfg.DBTxAttempts)
+
+	// Initialize outgoing mail
+	mail, err := mailer.New(cfg.MailDriver, cfg.MailDir, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize access token manager
+	tokenManager, err := token.NewManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the WebAuthn relying party for passkeys
+	relyingParty, err := service.NewRelyingParty(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize services
-	authSvc := service.NewAuthService(userRepo, sessionRepo)
-	userSvc := userService.NewUserService(userRepo)
+	authSvc := service.NewAuthService(
+		userRepo, sessionRepo, attemptRepo, twoFactorRepo, passkeyRepo, accessTokenRepo, tokenManager, relyingParty, cfg,
+	)
+	userSvc := userService.NewUserService(userRepo, txManager)
+	resetSvc := service.NewPasswordResetService(userRepo, txManager, mail, cfg, logger)
+	verificationSvc := service.NewEmailVerificationService(userRepo, tokenManager, mail, cfg, logger)
+	oidcSvc := service.NewOIDCService(authSvc, userRepo, identityRepo, cfg, logger)
+	serviceAccountSvc := serviceAccountService.NewServiceAccountService(serviceAccountRepo, userRepo, cfg)
+	roleSvc := rbacService.NewRoleService(roleRepo, userRepo)
+	keySvc := oauthService.NewKeyService(keyRepo, cfg, logger)
+
+	// Make sure a fresh deployment has an admin
+	if err := bootstrapAdmin(db, userSvc, cfg, logger); err != nil {
+		return nil, err
+	}
+	oauth := oauthServices{
+		provider: oauthService.NewProviderService(
+			clientRepo, grantRepo, userRepo, keySvc, serviceAccountSvc, cfg, logger,
+		),
+		clients: oauthService.NewClientService(clientRepo, grantRepo),
+		keys:    keySvc,
+	}
+
+	// Load the authorization policy
+	accessPolicy, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authSvc, logger)
+	authMiddleware := middleware.NewAuthMiddleware(authSvc, serviceAccountSvc, roleSvc, logger)
+	policyMiddleware := middleware.NewPolicyMiddleware(policy.NewEngine(accessPolicy, logger), roleSvc, userRepo, logger)
+
+	rateLimitStore, err := newRateLimitStore(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := ratelimit.Algorithm(cfg.RateLimitAlgorithm)
+	authLimit, err := ratelimit.ParseLimit(cfg.RateLimitAuth, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	apiLimit, err := ratelimit.ParseLimit(cfg.RateLimitAPI, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	rateLimiter := middleware.NewRateLimitMiddleware(rateLimitStore, logger)
+	rateLimits := routeRateLimits{
+		// Unauthenticated auth endpoints can only be keyed by client IP
+		auth: rateLimiter.Limit("auth", authLimit, middleware.ByIP),
+		// Authenticated API calls are keyed by API key or user, so NATed users don't share a budget
+		api: rateLimiter.Limit("api", apiLimit, middleware.ByAPIKey, middleware.ByUserID),
+	}
+
+	// Start background maintenance
+	reaper := maintenance.NewSessionReaper(
+		db, sessionRepo, logger, cfg.SessionReaperInterval, cfg.SessionReaperBatchSize,
+	)
+	reaper.Purge("login_attempts", func(ctx context.Context, limit int) (int64, error) {
+		return attemptRepo.DeleteExpired(ctx, time.Now().Add(-cfg.LoginFailureWindow), limit)
+	})
+	reaper.Purge("webauthn_ceremonies", passkeyRepo.DeleteExpired)
+	reaper.Purge("oidc_login_states", identityRepo.DeleteExpiredLoginStates)
+	reaper.Purge("oauth_authorization_codes", grantRepo.DeleteExpiredCodes)
+	reaper.Purge("oauth_access_tokens", grantRepo.DeleteExpiredAccessTokens)
+	reaper.Purge("service_account_keys", serviceAccountRepo.DeleteExpiredClientCredentialsTokens)
+	reaper.Start()
 
 	// Set Gin mode
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := gin.Default()
+	router, err := newRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		allowedHeaders := "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, " +
-			"Authorization, accept, origin, Cache-Control, X-Requested-With"
+			"Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With"
 		c.Writer.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers",
+			"RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -68,7 +193,10 @@ func NewServer(logger *zap.Logger, cfg *config.Config) (*Server, error) {
 	})
 
 	// Setup routes
-	setupRoutes(router, logger, userSvc, authSvc, authMiddleware)
+	setupRoutes(
+		router, logger, userSvc, authSvc, resetSvc, verificationSvc, oidcSvc, oauth, serviceAccountSvc, roleSvc,
+		authMiddleware, policyMiddleware, rateLimits, reaper,
+	)
 
 	server := &http.Server{
 		Addr:         cfg.HTTPAddr,
@@ -79,9 +207,12 @@ func NewServer(logger *zap.Logger, cfg *config.Config) (*Server, error) {
 	}
 
 	return &Server{
-		server: server,
-		logger: logger,
-		db:     db,
+		server:       server,
+		logger:       logger,
+		db:           db,
+		reaper:       reaper,
+		resets:       resetSvc,
+		verification: verificationSvc,
 	}, nil
 }
 
@@ -90,6 +221,11 @@ func (s *Server) Start(ctx context.Context) error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	// Stop background work before the database goes away
+	s.reaper.Stop()
+	s.resets.Wait()
+	s.verification.Wait()
+
 	// Close database connection
 	if err := s.db.Close(); err != nil {
 		s.logger.Error("Failed to close database connection", zap.Error(err))
@@ -98,41 +234,299 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
+// newRouter creates the engine, believing forwarded client IPs only from
+// TRUSTED_PROXIES
+func newRouter(cfg *config.Config) (*gin.Engine, error) {
+	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	return router, nil
+}
+
+// routeRateLimits holds the rate limiting handlers for each route group
+type routeRateLimits struct {
+	auth gin.HandlerFunc
+	api  gin.HandlerFunc
+}
+
+// oauthServices holds the services of the OpenID Connect provider
+type oauthServices struct {
+	provider *oauthService.ProviderService
+	clients  *oauthService.ClientService
+	keys     *oauthService.KeyService
+}
+
+// migrateDatabase applies pending migrations, or with DB_MIGRATION_MODE=check
+// refuses to start until they have been applied with `migrate up`
+func migrateDatabase(db *database.Database, cfg *config.Config, logger *zap.Logger) error {
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.DBMigrationMode {
+	case "apply":
+		applied, err := migrator.Up(context.Background())
+		for _, migration := range applied {
+			logger.Info("Applied migration", zap.String("migration", migration.String()))
+		}
+		if err != nil {
+			return fmt.Errorf("migrate database: %w", err)
+		}
+		return nil
+	case "check":
+		return migrator.Check(context.Background())
+	default:
+		return fmt.Errorf("unknown database migration mode %q", cfg.DBMigrationMode)
+	}
+}
+
+// bootstrapAdmin creates the configured admin if there is no admin yet, or
+// rotates their password if ADMIN_PASSWORD has changed. Clearing ADMIN_EMAIL
+// or ADMIN_PASSWORD disables it.
+func bootstrapAdmin(
+	db *database.Database, userSvc *userService.UserService, cfg *config.Config, logger *zap.Logger,
+) error {
+	if cfg.AdminEmail == "" || cfg.AdminPassword == "" {
+		return nil
+	}
+	if cfg.Environment == "production" && cfg.AdminPassword == userService.DefaultAdminPassword {
+		return fmt.Errorf("refusing to bootstrap admin %s with the default password in production: "+
+			"set ADMIN_PASSWORD, or clear ADMIN_EMAIL to skip the bootstrap", cfg.AdminEmail)
+	}
+
+	var result userService.BootstrapResult
+	acquired, err := db.WithAdvisoryLock(context.Background(), userService.AdminBootstrapLockKey, func() error {
+		var err error
+		result, err = userSvc.BootstrapAdmin(context.Background(), cfg.AdminEmail, cfg.AdminPassword, cfg.AdminName)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("bootstrap admin: %w", err)
+	}
+
+	switch {
+	case !acquired:
+		logger.Info("Admin bootstrap skipped, another replica is running it")
+	case result == userService.BootstrapNotAdmin:
+		logger.Warn("Admin bootstrap skipped, the email belongs to a user who is not an admin",
+			zap.String("email", cfg.AdminEmail))
+	default:
+		logger.Info("Admin bootstrap complete", zap.String("email", cfg.AdminEmail), zap.String("result", string(result)))
+	}
+	return nil
+}
+
+// newRateLimitStore creates the configured rate limit store
+func newRateLimitStore(cfg *config.Config, db *database.Database) (ratelimit.Store, error) {
+	switch cfg.RateLimitStore {
+	case "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "postgres":
+		return ratelimit.NewPostgresStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+}
+
 func setupRoutes(
 	router *gin.Engine,
 	logger *zap.Logger,
 	userSvc *userService.UserService,
 	authSvc *service.AuthService,
+	resetSvc *service.PasswordResetService,
+	verificationSvc *service.EmailVerificationService,
+	oidcSvc *service.OIDCService,
+	oauth oauthServices,
+	serviceAccountSvc *serviceAccountService.ServiceAccountService,
+	roleSvc *rbacService.RoleService,
 	authMiddleware *middleware.AuthMiddleware,
+	policies *middleware.PolicyMiddleware,
+	rateLimits routeRateLimits,
+	reaper *maintenance.SessionReaper,
 ) {
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": "test-api"})
 	})
 
+	// OpenID Connect provider for apps that delegate login to this service.
+	// Users authenticate with the API's own login endpoints; the consent page
+	// then posts the authorization request back with their access token.
+	providerHandler := oauthTransport.NewProviderHandler(oauth.provider, oauth.keys, logger)
+	router.GET("/.well-known/openid-configuration", providerHandler.Discovery)
+	router.GET("/oauth/jwks", providerHandler.JWKS)
+	provider := router.Group("/oauth")
+	{
+		provider.GET("/authorize", rateLimits.auth, providerHandler.Authorize)
+		provider.POST(
+			"/authorize", rateLimits.auth, authMiddleware.Authenticate, authMiddleware.RequireSession, providerHandler.Decide,
+		)
+		provider.POST("/token", rateLimits.auth, providerHandler.Token)
+		provider.GET("/userinfo", rateLimits.api, providerHandler.UserInfo)
+		provider.POST("/userinfo", rateLimits.api, providerHandler.UserInfo)
+	}
+
+	// User and session endpoints ask the authorization policy, and other
+	// administration endpoints check the caller's roles for a permission
+	authorize := policies.Authorize
+	can := authMiddleware.RequirePermission
+
 	// API routes group
 	api := router.Group("/api")
 	{
 		// Auth handlers
-		authHandler := transport.NewAuthHandler(authSvc, logger)
+		authHandler := transport.NewAuthHandler(authSvc, verificationSvc, logger)
+		sessionHandler := transport.NewSessionHandler(authSvc, logger)
+		passwordHandler := transport.NewPasswordHandler(resetSvc, logger)
+		twoFactorHandler := transport.NewTwoFactorHandler(authSvc, logger)
+		passkeyHandler := transport.NewPasskeyHandler(authSvc, logger)
+		oidcHandler := transport.NewOIDCHandler(oidcSvc, logger)
+		accessTokenHandler := transport.NewPersonalAccessTokenHandler(authSvc, logger)
 		auth := api.Group("/auth")
+		auth.Use(rateLimits.auth)
 		{
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/login/2fa", twoFactorHandler.CompleteLogin)
+			auth.POST("/login/2fa/enroll", twoFactorHandler.EnrollFromChallenge)
+			auth.POST("/login/passkey/begin", passkeyHandler.BeginLogin)
+			auth.POST("/login/passkey/finish", passkeyHandler.FinishLogin)
+			auth.GET("/oidc", oidcHandler.ListProviders)
+			auth.GET("/oidc/:provider/login", oidcHandler.Login)
+			auth.GET("/oidc/:provider/callback", oidcHandler.Callback)
 			auth.POST("/register", authHandler.Register)
+			auth.POST("/refresh", authHandler.Refresh)
 			auth.POST("/logout", authHandler.Logout)
+			auth.POST(
+				"/logout-all",
+				authMiddleware.Authenticate, authMiddleware.RequireUser, authMiddleware.RequireScope("sessions"),
+				authorize("sessions:revoke", policies.OwnSessions), sessionHandler.LogoutAll,
+			)
+			auth.POST("/password/forgot", passwordHandler.ForgotPassword)
+			auth.POST("/password/reset", passwordHandler.ResetPassword)
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/verify-email/resend", authHandler.ResendVerification)
+
+			sessions := auth.Group("/sessions")
+			sessions.Use(authMiddleware.Authenticate, authMiddleware.RequireUser, authMiddleware.RequireScope("sessions"))
+			{
+				sessions.GET("", authorize("sessions:read", policies.OwnSessions), sessionHandler.ListSessions)
+				sessions.DELETE("/:id", authorize("sessions:revoke", policies.OwnSessions), sessionHandler.RevokeSession)
+			}
+
+			twoFactor := auth.Group("/2fa")
+			twoFactor.Use(authMiddleware.Authenticate, authMiddleware.RequireSession)
+			{
+				twoFactor.GET("", twoFactorHandler.GetStatus)
+				twoFactor.POST("/enroll", twoFactorHandler.Enroll)
+				twoFactor.POST("/confirm", twoFactorHandler.Confirm)
+				twoFactor.POST("/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+				twoFactor.POST("/disable", twoFactorHandler.Disable)
+			}
+
+			passkeys := auth.Group("/passkeys")
+			passkeys.Use(authMiddleware.Authenticate, authMiddleware.RequireSession)
+			{
+				passkeys.GET("", passkeyHandler.ListPasskeys)
+				passkeys.POST("/register/begin", passkeyHandler.BeginRegistration)
+				passkeys.POST("/register/finish", passkeyHandler.FinishRegistration)
+				passkeys.DELETE("/:id", passkeyHandler.RemovePasskey)
+			}
+
+			// Personal access tokens can only be managed from an interactive session
+			tokens := auth.Group("/tokens")
+			tokens.Use(authMiddleware.Authenticate, authMiddleware.RequireSession)
+			{
+				tokens.GET("", accessTokenHandler.ListTokens)
+				tokens.POST("", accessTokenHandler.CreateToken)
+				tokens.DELETE("/:id", accessTokenHandler.RevokeToken)
+			}
 		}
 
 		// User handlers
-		userHandler := userTransport.NewUserHandler(userSvc, logger)
+		userHandler := userTransport.NewUserHandler(userSvc, roleSvc, verificationSvc, logger)
+		roleHandler := rbacTransport.NewRoleHandler(roleSvc, logger)
 
 		// Protected routes with authentication middleware
+		// A personal access token needs the sessions scope as well for a user's sessions
+		sessionScope := authMiddleware.RequireScope("sessions")
 		protected := api.Group("/users")
-		protected.Use(authMiddleware.Authenticate)
+		protected.Use(authMiddleware.Authenticate, authMiddleware.RequireScope("users"), rateLimits.api)
+		{
+			readSessions := authorize("sessions:read", policies.UserSessionsFromPath)
+			revokeSessions := authorize("sessions:revoke", policies.UserSessionsFromPath)
+			protected.GET("/me", authMiddleware.RequireUser, authorize("users:read", policies.Self), userHandler.GetCurrentUser)
+			protected.GET("", authorize("users:read", policies.Users), userHandler.GetUsers)
+			protected.GET("/:id", authorize("users:read", policies.UserFromPath), userHandler.GetUserByID)
+			protected.POST("", authorize("users:write", policies.Users), userHandler.CreateUser)
+			protected.PUT("/:id", authorize("users:update", policies.UserFromPath), userHandler.UpdateUser)
+			protected.PATCH("/:id", authorize("users:update", policies.UserFromPath), userHandler.PatchUser)
+			protected.DELETE("/:id", authorize("users:delete", policies.UserFromPath), userHandler.DeleteUser)
+			protected.GET("/:id/sessions", sessionScope, readSessions, sessionHandler.ListUserSessions)
+			protected.DELETE("/:id/sessions", sessionScope, revokeSessions, sessionHandler.RevokeUserSessions)
+			protected.DELETE("/:id/sessions/:sessionId", sessionScope, revokeSessions, sessionHandler.RevokeUserSession)
+			protected.POST("/:id/unlock", authorize("users:write", policies.UserFromPath), authHandler.UnlockUser)
+			protected.DELETE(
+				"/:id/2fa", authorize("users:write", policies.UserFromPath), twoFactorHandler.ResetUserTwoFactor,
+			)
+
+			// Roles can only be managed from an interactive session
+			userRoles := protected.Group("/:id/roles")
+			userRoles.Use(authMiddleware.RequireSession)
+			{
+				userRoles.GET("", can("roles:read"), roleHandler.ListUserRoles)
+				userRoles.PUT("/:roleId", can("roles:write"), roleHandler.AssignUserRole)
+				userRoles.DELETE("/:roleId", can("roles:write"), roleHandler.UnassignUserRole)
+			}
+		}
+
+		// Role administration, from an interactive session only
+		roles := api.Group("/roles")
+		roles.Use(authMiddleware.Authenticate, authMiddleware.RequireSession, rateLimits.api)
+		{
+			roles.GET("", can("roles:read"), roleHandler.ListRoles)
+			roles.POST("", can("roles:write"), roleHandler.CreateRole)
+			roles.GET("/:id", can("roles:read"), roleHandler.GetRole)
+			roles.PUT("/:id", can("roles:write"), roleHandler.UpdateRole)
+			roles.DELETE("/:id", can("roles:write"), roleHandler.DeleteRole)
+		}
+
+		// OAuth client administration and users' consents
+		clientHandler := oauthTransport.NewClientHandler(oauth.clients, oauth.keys, logger)
+		oauthAPI := api.Group("/oauth")
+		oauthAPI.Use(authMiddleware.Authenticate, authMiddleware.RequireSession, rateLimits.api)
+		{
+			oauthAPI.GET("/clients", can("oauth_clients:read"), clientHandler.ListClients)
+			oauthAPI.POST("/clients", can("oauth_clients:write"), clientHandler.CreateClient)
+			oauthAPI.DELETE("/clients/:id", can("oauth_clients:write"), clientHandler.DeleteClient)
+			oauthAPI.POST("/keys/rotate", can("oauth_clients:write"), clientHandler.RotateKeys)
+			oauthAPI.GET("/consents", clientHandler.ListConsents)
+			oauthAPI.DELETE("/consents/:clientId", clientHandler.RevokeConsent)
+		}
+
+		// Service account administration, from an interactive session only
+		serviceAccountHandler := serviceAccountTransport.NewServiceAccountHandler(serviceAccountSvc, roleSvc, logger)
+		serviceAccounts := api.Group("/service-accounts")
+		serviceAccounts.Use(authMiddleware.Authenticate, authMiddleware.RequireSession, rateLimits.api)
+		{
+			read, write := can("service_accounts:read"), can("service_accounts:write")
+			serviceAccounts.GET("", read, serviceAccountHandler.ListServiceAccounts)
+			serviceAccounts.POST("", write, serviceAccountHandler.CreateServiceAccount)
+			serviceAccounts.GET("/:id", read, serviceAccountHandler.GetServiceAccount)
+			serviceAccounts.DELETE("/:id", write, serviceAccountHandler.DeleteServiceAccount)
+			serviceAccounts.GET("/:id/keys", read, serviceAccountHandler.ListKeys)
+			serviceAccounts.POST("/:id/keys", write, serviceAccountHandler.CreateKey)
+			serviceAccounts.DELETE("/:id/keys/:keyId", write, serviceAccountHandler.RevokeKey)
+			serviceAccounts.POST("/:id/secret", write, serviceAccountHandler.RotateClientSecret)
+		}
+
+		// Maintenance status
+		maintenanceHandler := maintenance.NewHandler(reaper)
+		maint := api.Group("/maintenance")
+		maint.Use(authMiddleware.Authenticate, authMiddleware.RequireScope("maintenance"), rateLimits.api)
 		{
-			protected.GET("/me", userHandler.GetCurrentUser)
-			protected.GET("", userHandler.GetUsers)
-			protected.GET("/:id", userHandler.GetUserByID)
-			protected.POST("", userHandler.CreateUser)
+			maint.GET("/session-reaper", can("maintenance:read"), maintenanceHandler.GetSessionReaperStats)
 		}
 	}
 }
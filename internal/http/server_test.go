@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/middleware"
+	"github.com/acheevo/test/internal/shared/config"
+)
+
+func TestRouterClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keyFor := func(t *testing.T, cfg *config.Config, remoteAddr, forwardedFor string) string {
+		router, err := newRouter(cfg)
+		require.NoError(t, err)
+
+		var key string
+		router.GET("/", func(c *gin.Context) { key = middleware.ByIP(c) })
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", forwardedFor)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		return key
+	}
+
+	t.Run("Ignores Forwarded Headers By Default", func(t *testing.T) {
+		key := keyFor(t, &config.Config{}, "198.51.100.7:4321", "203.0.113.1")
+		assert.Equal(t, "ip:198.51.100.7", key)
+	})
+
+	t.Run("Believes Trusted Proxies", func(t *testing.T) {
+		cfg := &config.Config{TrustedProxies: []string{"10.0.0.0/8"}}
+		assert.Equal(t, "ip:203.0.113.1", keyFor(t, cfg, "10.1.2.3:4321", "203.0.113.1"))
+		assert.Equal(t, "ip:198.51.100.7", keyFor(t, cfg, "198.51.100.7:4321", "203.0.113.1"))
+	})
+
+	t.Run("Rejects Invalid Proxies", func(t *testing.T) {
+		_, err := newRouter(&config.Config{TrustedProxies: []string{"not-an-ip"}})
+		assert.Error(t, err)
+	})
+}
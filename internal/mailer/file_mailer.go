@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer writes each message to its own .eml file in a directory, so that
+// local developers and tests can read what would have been sent
+type FileMailer struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewFileMailer creates a new file-backed mailer, creating dir if needed
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+// Send writes the message to a new file named after the send time and recipient
+func (m *FileMailer) Send(msg Message) error {
+	now := time.Now()
+
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%06d-%s.eml", now.UTC().Format("20060102T150405.000000000"), seq, sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(format(msg, now)), 0o600)
+}
+
+// Messages returns the paths of the messages sent to a recipient, oldest first
+func (m *FileMailer) Messages(to string) ([]string, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := "-" + sanitize(to) + ".eml"
+	var paths []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), suffix) {
+			paths = append(paths, filepath.Join(m.dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// sanitize makes an address safe to use in a file name
+func sanitize(address string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, address)
+}
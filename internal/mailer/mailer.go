@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is a plain-text email
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New creates the mailer selected by driver: "log" writes messages to the
+// application log and "file" writes each message to a file in dir
+func New(driver, dir string, logger *zap.Logger) (Mailer, error) {
+	switch driver {
+	case "log":
+		return NewLogMailer(logger), nil
+	case "file":
+		return NewFileMailer(dir)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+// LogMailer writes messages to the application log instead of delivering them.
+// It is meant for local development only, as message bodies may contain secrets.
+type LogMailer struct {
+	logger *zap.Logger
+}
+
+// NewLogMailer creates a new log-backed mailer
+func NewLogMailer(logger *zap.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send logs the message
+func (m *LogMailer) Send(msg Message) error {
+	m.logger.Info("Email",
+		zap.String("from", msg.From),
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+	return nil
+}
+
+// format renders a message in RFC 5322 form
+func format(msg Message, date time.Time) string {
+	return "From: " + msg.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"Date: " + date.Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		msg.Body
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFileMailer(dir)
+	require.NoError(t, err)
+
+	for _, subject := range []string{"First", "Second"} {
+		require.NoError(t, m.Send(Message{
+			From:    "no-reply@example.com",
+			To:      "user@example.com",
+			Subject: subject,
+			Body:    "Hello " + subject,
+		}))
+	}
+	require.NoError(t, m.Send(Message{To: "other@example.com", Subject: "Other"}))
+
+	paths, err := m.Messages("user@example.com")
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+
+	content, err := os.ReadFile(paths[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "To: user@example.com\r\n")
+	assert.Contains(t, string(content), "Subject: Second\r\n")
+	assert.True(t, strings.HasSuffix(string(content), "\r\n\r\nHello Second"))
+
+	paths, err = m.Messages("nobody@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestNew(t *testing.T) {
+	m, err := New("log", "", zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &LogMailer{}, m)
+	assert.NoError(t, m.Send(Message{To: "user@example.com"}))
+
+	m, err = New("file", t.TempDir(), zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &FileMailer{}, m)
+
+	_, err = New("smtp", "", zap.NewNop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package maintenance
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes maintenance status endpoints
+type Handler struct {
+	reaper *SessionReaper
+}
+
+// NewHandler creates a new maintenance handler
+func NewHandler(reaper *SessionReaper) *Handler {
+	return &Handler{reaper: reaper}
+}
+
+// GetSessionReaperStats returns the session reaper's counters (requires maintenance:read)
+func (h *Handler) GetSessionReaperStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.reaper.Stats())
+}
@@ -0,0 +1,195 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// SessionReaperLockKey is the Postgres advisory lock key that keeps the reaper
+// to a single replica at a time
+const SessionReaperLockKey int64 = 0x5E55_0001
+
+// ReaperStats holds cumulative counters for the session reaper
+type ReaperStats struct {
+	Runs                 int64            `json:"runs"`
+	SkippedRuns          int64            `json:"skipped_runs"` // another replica held the lock
+	SessionsDeleted      int64            `json:"sessions_deleted"`
+	RefreshTokensDeleted int64            `json:"refresh_tokens_deleted"`
+	RowsDeleted          map[string]int64 `json:"rows_deleted"` // by table registered with Purge
+	LastRunAt            time.Time        `json:"last_run_at"`
+	LastError            string           `json:"last_error,omitempty"`
+}
+
+// DeleteExpiredFunc deletes up to limit expired rows of a table and returns
+// how many it deleted
+type DeleteExpiredFunc func(ctx context.Context, limit int) (int64, error)
+
+// purge is a table registered with Purge
+type purge struct {
+	table         string
+	deleteExpired DeleteExpiredFunc
+}
+
+// SessionReaper periodically purges expired sessions and refresh tokens, and
+// the expired rows of the tables registered with Purge
+type SessionReaper struct {
+	db          *database.Database
+	sessionRepo repository.SessionStore
+	logger      *zap.Logger
+	interval    time.Duration
+	batchSize   int
+	purges      []purge
+
+	mu    sync.Mutex
+	stats ReaperStats
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSessionReaper creates a new session reaper
+func NewSessionReaper(
+	db *database.Database,
+	sessionRepo repository.SessionStore,
+	logger *zap.Logger,
+	interval time.Duration,
+	batchSize int,
+) *SessionReaper {
+	return &SessionReaper{
+		db:          db,
+		sessionRepo: sessionRepo,
+		logger:      logger,
+		interval:    interval,
+		batchSize:   batchSize,
+		stats:       ReaperStats{RowsDeleted: make(map[string]int64)},
+	}
+}
+
+// Purge registers a table whose expired rows each run deletes in batches. It
+// must be called before Start.
+func (r *SessionReaper) Purge(table string, deleteExpired DeleteExpiredFunc) {
+	r.purges = append(r.purges, purge{table: table, deleteExpired: deleteExpired})
+	r.stats.RowsDeleted[table] = 0
+}
+
+// Start runs the reaper in the background until Stop is called
+func (r *SessionReaper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			r.RunOnce(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the background loop and waits for an in-flight run to finish
+func (r *SessionReaper) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// RunOnce purges expired rows in batches if no other replica is doing so
+func (r *SessionReaper) RunOnce(ctx context.Context) {
+	var sessions, refreshTokens int64
+	rows := make(map[string]int64, len(r.purges))
+
+	acquired, err := r.db.WithAdvisoryLock(ctx, SessionReaperLockKey, func() error {
+		for ctx.Err() == nil {
+			deletedSessions, deletedTokens, err := r.sessionRepo.DeleteExpired(ctx, r.batchSize)
+			sessions += deletedSessions
+			refreshTokens += deletedTokens
+			if err != nil {
+				return err
+			}
+			if deletedSessions < int64(r.batchSize) && deletedTokens < int64(r.batchSize) {
+				break
+			}
+		}
+
+		for _, purge := range r.purges {
+			for ctx.Err() == nil {
+				deleted, err := purge.deleteExpired(ctx, r.batchSize)
+				rows[purge.table] += deleted
+				if err != nil {
+					return fmt.Errorf("purge %s: %w", purge.table, err)
+				}
+				if deleted < int64(r.batchSize) {
+					break
+				}
+			}
+		}
+		return nil
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.LastRunAt = time.Now()
+	r.stats.LastError = ""
+	if err != nil {
+		r.stats.LastError = err.Error()
+		r.logger.Error("Session reaper failed", zap.Error(err))
+	}
+	if !acquired {
+		if err == nil {
+			r.stats.SkippedRuns++
+			r.logger.Debug("Session reaper skipped, lock held by another replica")
+		}
+		return
+	}
+
+	r.stats.Runs++
+	r.stats.SessionsDeleted += sessions
+	r.stats.RefreshTokensDeleted += refreshTokens
+	deleted := sessions + refreshTokens
+	fields := []zap.Field{
+		zap.Int64("sessions_deleted", sessions),
+		zap.Int64("refresh_tokens_deleted", refreshTokens),
+	}
+	for _, purge := range r.purges {
+		r.stats.RowsDeleted[purge.table] += rows[purge.table]
+		deleted += rows[purge.table]
+		fields = append(fields, zap.Int64(purge.table+"_deleted", rows[purge.table]))
+	}
+	// Most runs find nothing to purge; only runs that did are worth an info line
+	log := r.logger.Debug
+	if deleted > 0 {
+		log = r.logger.Info
+	}
+	log("Session reaper purged expired rows", fields...)
+}
+
+// Stats returns a snapshot of the reaper's counters
+func (r *SessionReaper) Stats() ReaperStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	stats.RowsDeleted = maps.Clone(r.stats.RowsDeleted)
+	return stats
+}
@@ -7,27 +7,51 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"github.com/acheevo/test/internal/auth/principal"
 	"github.com/acheevo/test/internal/auth/service"
+	"github.com/acheevo/test/internal/auth/token"
+	rbacService "github.com/acheevo/test/internal/rbac/service"
+	serviceAccountService "github.com/acheevo/test/internal/serviceaccount/service"
+	"github.com/acheevo/test/internal/user/domain"
 )
 
 // AuthMiddleware handles authentication middleware
 type AuthMiddleware struct {
-	authService *service.AuthService
-	logger      *zap.Logger
+	authService     *service.AuthService
+	serviceAccounts *serviceAccountService.ServiceAccountService
+	roles           *rbacService.RoleService
+	logger          *zap.Logger
 }
 
 // NewAuthMiddleware creates a new auth middleware
-func NewAuthMiddleware(authService *service.AuthService, logger *zap.Logger) *AuthMiddleware {
+func NewAuthMiddleware(
+	authService *service.AuthService,
+	serviceAccounts *serviceAccountService.ServiceAccountService,
+	roles *rbacService.RoleService,
+	logger *zap.Logger,
+) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
-		logger:      logger,
+		authService:     authService,
+		serviceAccounts: serviceAccounts,
+		roles:           roles,
+		logger:          logger,
 	}
 }
 
-// Authenticate middleware validates the authorization token
+// Authenticate middleware validates the authorization token and stores the
+// principal it belongs to in the context. Users authenticate with session
+// access tokens or personal access tokens, service accounts with API keys or
+// client credentials access tokens; tokens and keys may also be sent in the
+// X-API-Key header. For users, "claims" and "user" are set as well. Routes
+// reachable with a token or key must also use RequireScope, and all others
+// RequireSession.
 func (m *AuthMiddleware) Authenticate(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			m.authenticateCredential(c, apiKey)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 		c.Abort()
 		return
@@ -42,7 +66,12 @@ func (m *AuthMiddleware) Authenticate(c *gin.Context) {
 	}
 
 	token := parts[1]
-	user, err := m.authService.ValidateToken(token)
+	if service.IsPersonalAccessToken(token) || serviceAccountService.IsAPIKey(token) {
+		m.authenticateCredential(c, token)
+		return
+	}
+
+	claims, err := m.authService.ValidateToken(c.Request.Context(), token)
 	if err != nil {
 		m.logger.Error("Token validation failed", zap.Error(err))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -50,7 +79,140 @@ func (m *AuthMiddleware) Authenticate(c *gin.Context) {
 		return
 	}
 
-	// Set user in context
-	c.Set("user", user)
+	principal.Set(c, &principal.Principal{
+		Type:      principal.TypeUser,
+		ID:        claims.UserID,
+		Name:      claims.Name,
+		Email:     claims.Email,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+	})
+	setUser(c, claims)
+	c.Next()
+}
+
+// RequireScope returns a handler that limits tokens and keys to what their
+// scopes allow on resource: GET and HEAD requests need resource:read and any
+// other method resource:write. Sessions are not limited.
+func (m *AuthMiddleware) RequireScope(resource string) gin.HandlerFunc {
+	readScope, writeScope := resource+":read", resource+":write"
+
+	return func(c *gin.Context) {
+		p, ok := principal.FromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+			c.Abort()
+			return
+		}
+
+		scope := writeScope
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			scope = readScope
+		}
+		if !p.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission returns a handler that only lets principals through
+// whose roles grant permission. Tokens and keys are limited by RequireScope
+// as well.
+func (m *AuthMiddleware) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := principal.FromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+			c.Abort()
+			return
+		}
+
+		allowed, err := m.roles.HasPermission(c.Request.Context(), p, permission)
+		if err != nil {
+			m.logger.Error("Failed to check permission", zap.String("permission", permission), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession refuses tokens and keys, for routes that manage the account
+// itself and so need an interactive login
+func (m *AuthMiddleware) RequireSession(c *gin.Context) {
+	if p, ok := principal.FromContext(c); !ok || !p.HasSession() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens and API keys cannot be used here"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// RequireUser refuses service accounts, for routes about the caller's own
+// user account
+func (m *AuthMiddleware) RequireUser(c *gin.Context) {
+	if p, ok := principal.FromContext(c); !ok || !p.IsUser() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only available to users"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// authenticateCredential validates a personal access token or service
+// account API key. Only the credential's prefix is ever logged.
+func (m *AuthMiddleware) authenticateCredential(c *gin.Context, credential string) {
+	ctx := c.Request.Context()
+
+	var (
+		p      *principal.Principal
+		prefix string
+		err    error
+	)
+	switch {
+	case service.IsPersonalAccessToken(credential):
+		prefix = service.PersonalAccessTokenPrefix(credential)
+		p, err = m.authService.ValidatePersonalAccessToken(ctx, credential, c.ClientIP())
+	case serviceAccountService.IsAPIKey(credential):
+		prefix = serviceAccountService.APIKeyPrefix(credential)
+		p, err = m.serviceAccounts.Authenticate(ctx, credential, c.ClientIP())
+	default:
+		err = service.ErrInvalidToken
+	}
+	if err != nil {
+		m.logger.Error("Credential validation failed", zap.String("credential_prefix", prefix), zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	m.logger.Debug("Authenticated with credential",
+		zap.String("credential_prefix", prefix),
+		zap.String("principal_type", string(p.Type)), zap.String("principal_id", p.ID.String()))
+	principal.Set(c, p)
+	if p.IsUser() {
+		// Token requests carry no session, so SessionID stays nil
+		setUser(c, &token.Claims{UserID: p.ID, Role: p.Role, Email: p.Email, Name: p.Name})
+	}
 	c.Next()
 }
+
+// setUser sets a user's claims and the user they describe in context, without a database lookup
+func setUser(c *gin.Context, claims *token.Claims) {
+	c.Set("claims", claims)
+	c.Set("user", &domain.User{
+		ID:    claims.UserID,
+		Email: claims.Email,
+		Name:  claims.Name,
+		Role:  claims.Role,
+	})
+}
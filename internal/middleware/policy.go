@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/principal"
+	"github.com/acheevo/test/internal/policy"
+	rbacService "github.com/acheevo/test/internal/rbac/service"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// Resource describes the resource a request acts on, for policy evaluation
+type Resource func(c *gin.Context, caller *principal.Principal) (policy.Attributes, error)
+
+// PolicyMiddleware enforces the authorization policy
+type PolicyMiddleware struct {
+	engine   *policy.Engine
+	roles    *rbacService.RoleService
+	userRepo userRepository.UserStore
+	logger   *zap.Logger
+}
+
+// NewPolicyMiddleware creates a new policy middleware
+func NewPolicyMiddleware(
+	engine *policy.Engine,
+	roles *rbacService.RoleService,
+	userRepo userRepository.UserStore,
+	logger *zap.Logger,
+) *PolicyMiddleware {
+	return &PolicyMiddleware{
+		engine:   engine,
+		roles:    roles,
+		userRepo: userRepo,
+		logger:   logger,
+	}
+}
+
+// Authorize returns a handler that asks the policy whether the principal may
+// perform action on the resource described by resource. The subject's
+// attributes are its type, id, role and the permissions its roles grant; the
+// context's are the client's ip, the request method and whether the request
+// came from an interactive session.
+func (m *PolicyMiddleware) Authorize(action string, resource Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := principal.FromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+			c.Abort()
+			return
+		}
+
+		subject, err := m.subject(c.Request.Context(), p)
+		if err != nil {
+			m.logger.Error("Failed to describe policy subject", zap.String("action", action), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			c.Abort()
+			return
+		}
+		target, err := resource(c, p)
+		if err != nil {
+			m.logger.Error("Failed to describe policy resource", zap.String("action", action), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			c.Abort()
+			return
+		}
+
+		decision := m.engine.Evaluate(policy.Request{
+			Subject:  subject,
+			Action:   action,
+			Resource: target,
+			Context: policy.Attributes{
+				"ip":      c.ClientIP(),
+				"method":  c.Request.Method,
+				"session": p.HasSession(),
+			},
+		})
+		if !decision.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Users describes the user collection, for listing and creating users
+func (m *PolicyMiddleware) Users(c *gin.Context, caller *principal.Principal) (policy.Attributes, error) {
+	return policy.Attributes{"type": "user"}, nil
+}
+
+// Self describes the caller's own user account
+func (m *PolicyMiddleware) Self(c *gin.Context, caller *principal.Principal) (policy.Attributes, error) {
+	return policy.Attributes{"type": "user", "id": caller.ID.String(), "role": string(caller.Role)}, nil
+}
+
+// UserFromPath describes the user named by the :id path parameter. Its role
+// is only known if the user exists.
+func (m *PolicyMiddleware) UserFromPath(c *gin.Context, caller *principal.Principal) (policy.Attributes, error) {
+	attributes := policy.Attributes{"type": "user"}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		// The handler rejects the ID
+		return attributes, nil
+	}
+	attributes["id"] = id.String()
+
+	user, err := m.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		attributes["role"] = string(user.Role)
+	}
+	return attributes, nil
+}
+
+// OwnSessions describes the caller's own sessions
+func (m *PolicyMiddleware) OwnSessions(c *gin.Context, caller *principal.Principal) (policy.Attributes, error) {
+	return policy.Attributes{
+		"type":      "session",
+		"user_id":   caller.ID.String(),
+		"user_role": string(caller.Role),
+	}, nil
+}
+
+// UserSessionsFromPath describes the sessions of the user named by the :id
+// path parameter
+func (m *PolicyMiddleware) UserSessionsFromPath(
+	c *gin.Context, caller *principal.Principal,
+) (policy.Attributes, error) {
+	user, err := m.UserFromPath(c, caller)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Attributes{"type": "session", "user_id": user["id"], "user_role": user["role"]}, nil
+}
+
+// subject describes a principal
+func (m *PolicyMiddleware) subject(ctx context.Context, p *principal.Principal) (policy.Attributes, error) {
+	permissions, err := m.roles.Permissions(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return policy.Attributes{
+		"type":        string(p.Type),
+		"id":          p.ID.String(),
+		"role":        string(p.Role),
+		"permissions": permissions,
+	}, nil
+}
@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Scopes supported by the provider. openid is required in every authorization
+// request; profile and email release the matching claims.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// SupportedScopes lists the scopes the provider understands. Other requested
+// scopes are ignored.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// CreateClientRequest represents the OAuth client registration payload
+type CreateClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,required"`
+	// Public clients, such as single-page and native apps, cannot keep a
+	// secret and must use PKCE instead
+	Public bool `json:"public"`
+}
+
+// AuthorizationRequest holds the parameters of an authorization request. It
+// is bound from the query string of GET /oauth/authorize and passed on to the
+// consent page, which posts it back with the user's decision.
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type"`
+	ClientID            string `json:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	Nonce               string `json:"nonce" form:"nonce"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+}
+
+// AuthorizationDecision represents the consent page's payload: the original
+// authorization request, and whether the user approved it. A nil Approve
+// asks whether consent is still needed.
+type AuthorizationDecision struct {
+	AuthorizationRequest
+	Approve *bool `json:"approve"`
+}
+
+// TokenRequest represents the token endpoint's form parameters. Clients may
+// authenticate with HTTP Basic instead of ClientID and ClientSecret. Scope is
+// only used by the client credentials grant.
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	Scope        string `form:"scope"`
+}
+
+// Client represents an app registered to log users in through the provider.
+// Only the digest of a confidential client's secret is stored.
+type Client struct {
+	ID           uuid.UUID `json:"client_id" gorm:"type:uuid;primaryKey"`
+	Name         string    `json:"name" gorm:"not null"`
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris" gorm:"serializer:json;not null"`
+	Public       bool      `json:"public" gorm:"not null;default:false"`
+	CreatedBy    uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ClientRegistration is returned when a client is registered. ClientSecret is
+// shown once and cannot be retrieved again.
+type ClientRegistration struct {
+	Client
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// Consent records the scopes a user has allowed a client. Later
+// authorizations within those scopes skip the consent page.
+type Consent struct {
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	ClientID  uuid.UUID `json:"client_id" gorm:"type:uuid;primaryKey"`
+	Scope     string    `json:"scope" gorm:"not null"` // space-separated
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConsentResponse represents a consent in a user's consent listing
+type ConsentResponse struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// AuthorizationCode represents an issued authorization code. Only the code's
+// digest is stored, and a code can be exchanged once.
+type AuthorizationCode struct {
+	CodeHash      string    `gorm:"primaryKey"`
+	ClientID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	RedirectURI   string    `gorm:"not null"`
+	Scope         string    `gorm:"not null"`
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time `gorm:"not null;index"`
+	CreatedAt     time.Time
+}
+
+// AccessToken represents an access token issued to a client for the userinfo
+// endpoint. Only the token's digest is stored.
+type AccessToken struct {
+	TokenHash string    `gorm:"primaryKey"`
+	ClientID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Scope     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// SigningKey is an RSA key ID tokens are signed with. The newest unretired
+// key signs; retired keys stay published until their retention ends.
+type SigningKey struct {
+	ID         string     `json:"kid" gorm:"primaryKey"`
+	Algorithm  string     `json:"alg" gorm:"not null"`
+	PrivateKey string     `json:"-" gorm:"not null"` // PKCS #8, encrypted with AES-256-GCM
+	PublicKey  string     `json:"-" gorm:"not null"` // PKIX, base64
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at" gorm:"index"`
+}
+
+// AuthorizationResult is the answer to an authorization decision: either the
+// URL to send the user agent back to the client with, or a request for consent
+type AuthorizationResult struct {
+	RedirectTo      string   `json:"redirect_to,omitempty"`
+	ConsentRequired bool     `json:"consent_required,omitempty"`
+	ClientName      string   `json:"client_name,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+}
+
+// TokenResponse represents the token endpoint's response
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope"`
+}
+
+// ProviderMetadata is the OpenID Connect discovery document
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// JSONWebKey is a public signing key as published in the JWKS
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// JSONWebKeySet is the JWKS document
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// ParseScope splits a space-separated scope parameter, dropping duplicates
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// Scopes returns the scopes the consent covers
+func (c *Consent) Scopes() []string {
+	return ParseScope(c.Scope)
+}
+
+// Covers reports whether the consent includes every one of scopes
+func (c *Consent) Covers(scopes []string) bool {
+	granted := c.Scopes()
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// TableName returns the table name for the Client model
+func (Client) TableName() string {
+	return "oauth_clients"
+}
+
+// BeforeCreate hook runs before creating a new client
+func (c *Client) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the Consent model
+func (Consent) TableName() string {
+	return "oauth_consents"
+}
+
+// TableName returns the table name for the AuthorizationCode model
+func (AuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// TableName returns the table name for the AccessToken model
+func (AccessToken) TableName() string {
+	return "oauth_access_tokens"
+}
+
+// TableName returns the table name for the SigningKey model
+func (SigningKey) TableName() string {
+	return "oauth_signing_keys"
+}
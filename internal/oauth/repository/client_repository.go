@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// ClientRepository handles OAuth client database operations
+type ClientRepository struct {
+	db *database.Database
+}
+
+// NewClientRepository creates a new client repository
+func NewClientRepository(db *database.Database) *ClientRepository {
+	return &ClientRepository{db: db}
+}
+
+// Create registers a new client
+func (r *ClientRepository) Create(ctx context.Context, client *domain.Client) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(client).Error
+}
+
+// GetByID retrieves a client by ID
+func (r *ClientRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Client, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var client domain.Client
+	err := db.Where("id = ?", id).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &client, err
+}
+
+// List retrieves all clients, oldest first
+func (r *ClientRepository) List(ctx context.Context) ([]domain.Client, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var clients []domain.Client
+	err := db.Order("created_at ASC").Find(&clients).Error
+	return clients, err
+}
+
+// Delete removes a client together with its consents, codes and access
+// tokens, and reports whether the client existed
+func (r *ClientRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var deleted bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&domain.Consent{}, &domain.AuthorizationCode{}, &domain.AccessToken{}} {
+			if err := tx.Where("client_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Where("id = ?", id).Delete(&domain.Client{})
+		deleted = result.RowsAffected > 0
+		return result.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// GrantRepository handles consent, authorization code and access token
+// database operations
+type GrantRepository struct {
+	db *database.Database
+}
+
+// NewGrantRepository creates a new grant repository
+func NewGrantRepository(db *database.Database) *GrantRepository {
+	return &GrantRepository{db: db}
+}
+
+// GetConsent retrieves the consent a user has given a client
+func (r *GrantRepository) GetConsent(ctx context.Context, userID, clientID uuid.UUID) (*domain.Consent, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var consent domain.Consent
+	err := db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &consent, err
+}
+
+// SaveConsent creates a consent, or replaces the scopes of an existing one
+func (r *GrantRepository) SaveConsent(ctx context.Context, consent *domain.Consent) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scope", "updated_at"}),
+	}).Create(consent).Error
+}
+
+// ListConsents retrieves a user's consents with the names of their clients
+func (r *GrantRepository) ListConsents(ctx context.Context, userID uuid.UUID) ([]domain.ConsentResponse, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var consents []domain.ConsentResponse
+	err := db.Model(&domain.Consent{}).
+		Select("oauth_consents.client_id, oauth_clients.name AS client_name, oauth_consents.scope, "+
+			"oauth_consents.created_at, oauth_consents.updated_at").
+		Joins("JOIN oauth_clients ON oauth_clients.id = oauth_consents.client_id").
+		Where("oauth_consents.user_id = ?", userID).
+		Order("oauth_consents.created_at ASC").
+		Scan(&consents).Error
+	return consents, err
+}
+
+// RevokeConsent deletes a user's consent for a client along with the access
+// tokens it was given, and reports whether there was a consent
+func (r *GrantRepository) RevokeConsent(ctx context.Context, userID, clientID uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var revoked bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&domain.AccessToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&domain.Consent{})
+		revoked = result.RowsAffected > 0
+		return result.Error
+	})
+	return revoked, err
+}
+
+// DeleteByUserID deletes all of a user's consents, and the authorization codes
+// and access tokens issued to clients on their behalf
+func (r *GrantRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&domain.AuthorizationCode{}, &domain.AccessToken{}, &domain.Consent{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateCode stores an issued authorization code
+func (r *GrantRepository) CreateCode(ctx context.Context, code *domain.AuthorizationCode) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(code).Error
+}
+
+// DeleteExpiredCodes deletes up to limit expired authorization codes,
+// returning how many were deleted
+func (r *GrantRepository) DeleteExpiredCodes(ctx context.Context, limit int) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	expired := db.Model(&domain.AuthorizationCode{}).Select("code_hash").Where("expires_at < ?", time.Now()).Limit(limit)
+	result := db.Where("code_hash IN (?)", expired).Delete(&domain.AuthorizationCode{})
+	return result.RowsAffected, result.Error
+}
+
+// ConsumeCode atomically deletes an unexpired authorization code and returns
+// it. It returns nil if the code is unknown, expired or was already
+// exchanged, so that each code is exchanged at most once.
+func (r *GrantRepository) ConsumeCode(
+	ctx context.Context, code string, at time.Time,
+) (*domain.AuthorizationCode, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var consumed []domain.AuthorizationCode
+	err := db.Clauses(clause.Returning{}).
+		Where("code_hash = ? AND expires_at > ?", authDomain.HashToken(code), at).
+		Delete(&consumed).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(consumed) == 0 {
+		return nil, nil
+	}
+	return &consumed[0], nil
+}
+
+// CreateAccessToken stores an issued access token
+func (r *GrantRepository) CreateAccessToken(ctx context.Context, accessToken *domain.AccessToken) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(accessToken).Error
+}
+
+// DeleteExpiredAccessTokens deletes up to limit expired access tokens,
+// returning how many were deleted
+func (r *GrantRepository) DeleteExpiredAccessTokens(ctx context.Context, limit int) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	expired := db.Model(&domain.AccessToken{}).Select("token_hash").Where("expires_at < ?", time.Now()).Limit(limit)
+	result := db.Where("token_hash IN (?)", expired).Delete(&domain.AccessToken{})
+	return result.RowsAffected, result.Error
+}
+
+// GetAccessToken retrieves an unexpired access token, or nil if it is
+// unknown, expired or revoked
+func (r *GrantRepository) GetAccessToken(ctx context.Context, token string, at time.Time) (*domain.AccessToken, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var accessToken domain.AccessToken
+	err := db.Where("token_hash = ? AND expires_at > ?", authDomain.HashToken(token), at).
+		First(&accessToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &accessToken, err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// KeyRepository handles signing key database operations
+type KeyRepository struct {
+	db *database.Database
+}
+
+// NewKeyRepository creates a new signing key repository
+func NewKeyRepository(db *database.Database) *KeyRepository {
+	return &KeyRepository{db: db}
+}
+
+// GetActive retrieves the newest key that has not been retired, or nil if there is none
+func (r *KeyRepository) GetActive(ctx context.Context) (*domain.SigningKey, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var key domain.SigningKey
+	err := db.Where("retired_at IS NULL").Order("created_at DESC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &key, err
+}
+
+// ListPublished retrieves the keys that are active or were retired after
+// retiredAfter, newest first
+func (r *KeyRepository) ListPublished(ctx context.Context, retiredAfter time.Time) ([]domain.SigningKey, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var keys []domain.SigningKey
+	err := db.Where("retired_at IS NULL OR retired_at > ?", retiredAfter).
+		Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Rotate stores a new key and retires every other active key. Keys retired
+// before retiredBefore are deleted on the way.
+func (r *KeyRepository) Rotate(ctx context.Context, key *domain.SigningKey, retiredBefore time.Time) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("retired_at < ?", retiredBefore).Delete(&domain.SigningKey{}).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&domain.SigningKey{}).Where("retired_at IS NULL").Update("retired_at", key.CreatedAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(key).Error
+	})
+}
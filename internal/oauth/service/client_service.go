@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/oauth/repository"
+)
+
+var (
+	ErrInvalidRedirectURI = errors.New("invalid redirect URI")
+	ErrClientNotFound     = errors.New("client not found")
+	ErrConsentNotFound    = errors.New("consent not found")
+)
+
+// ClientService handles OAuth client registration and users' consents
+type ClientService struct {
+	clientRepo *repository.ClientRepository
+	grantRepo  *repository.GrantRepository
+}
+
+// NewClientService creates a new client service
+func NewClientService(clientRepo *repository.ClientRepository, grantRepo *repository.GrantRepository) *ClientService {
+	return &ClientService{
+		clientRepo: clientRepo,
+		grantRepo:  grantRepo,
+	}
+}
+
+// RegisterClient registers a new client. Confidential clients get a secret,
+// which is returned once.
+func (s *ClientService) RegisterClient(
+	ctx context.Context, req domain.CreateClientRequest, createdBy uuid.UUID,
+) (*domain.ClientRegistration, error) {
+	for _, redirectURI := range req.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return nil, err
+		}
+	}
+
+	client := &domain.Client{
+		Name:         strings.TrimSpace(req.Name),
+		RedirectURIs: req.RedirectURIs,
+		Public:       req.Public,
+		CreatedBy:    createdBy,
+	}
+
+	var secret string
+	if !req.Public {
+		var err error
+		if secret, err = generateToken(); err != nil {
+			return nil, err
+		}
+		client.SecretHash = authDomain.HashToken(secret)
+	}
+
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return nil, err
+	}
+	return &domain.ClientRegistration{Client: *client, ClientSecret: secret}, nil
+}
+
+// ListClients returns all registered clients
+func (s *ClientService) ListClients(ctx context.Context) ([]domain.Client, error) {
+	return s.clientRepo.List(ctx)
+}
+
+// DeleteClient removes a client, revoking every consent and token it holds
+func (s *ClientService) DeleteClient(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.clientRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// ListConsents returns the clients a user has given consent to
+func (s *ClientService) ListConsents(ctx context.Context, userID uuid.UUID) ([]domain.ConsentResponse, error) {
+	return s.grantRepo.ListConsents(ctx, userID)
+}
+
+// RevokeConsent withdraws a user's consent for a client and revokes the
+// access tokens the client holds for the user
+func (s *ClientService) RevokeConsent(ctx context.Context, userID, clientID uuid.UUID) error {
+	revoked, err := s.grantRepo.RevokeConsent(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrConsentNotFound
+	}
+	return nil
+}
+
+// validateRedirectURI checks that a redirect URI can be registered: it must
+// be absolute, without a fragment, and use https except on loopback hosts
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" ||
+		strings.ContainsAny(redirectURI, " \t\r\n") {
+		return fmt.Errorf("%w: %q", ErrInvalidRedirectURI, redirectURI)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := parsed.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q must use https", ErrInvalidRedirectURI, redirectURI)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/oauth/repository"
+	"github.com/acheevo/test/internal/shared/config"
+)
+
+// signingKeyBits is the size of generated RSA signing keys
+const signingKeyBits = 2048
+
+// KeyService manages the keys ID tokens are signed with. Keys are generated
+// on first use and rotated once they are older than the rotation interval;
+// retired keys stay in the JWKS for the retention period, so that tokens they
+// signed can still be verified.
+type KeyService struct {
+	keyRepo       *repository.KeyRepository
+	cfg           *config.Config
+	logger        *zap.Logger
+	encryptionKey [32]byte
+
+	mu     sync.Mutex
+	cached *signer // the active key, decrypted
+}
+
+// signer is a decrypted signing key
+type signer struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+// NewKeyService creates a new signing key service
+func NewKeyService(keyRepo *repository.KeyRepository, cfg *config.Config, logger *zap.Logger) *KeyService {
+	keySecret := cfg.OAuthKeyEncryptionKey
+	if keySecret == "" {
+		keySecret = cfg.SessionSecret
+	}
+
+	return &KeyService{
+		keyRepo:       keyRepo,
+		cfg:           cfg,
+		logger:        logger,
+		encryptionKey: sha256.Sum256([]byte("oauth-signing-key:" + keySecret)),
+	}
+}
+
+// Sign signs claims as a JWT with the active key, rotating it first if it is due
+func (s *KeyService) Sign(ctx context.Context, claims jwt.Claims) (string, error) {
+	active, err := s.activeSigner(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = active.id
+	return token.SignedString(active.key)
+}
+
+// Rotate replaces the active key with a new one immediately
+func (s *KeyService) Rotate(ctx context.Context) (*domain.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, _, err := s.rotate(ctx)
+	return key, err
+}
+
+// JWKS returns the published public keys
+func (s *KeyService) JWKS(ctx context.Context) (*domain.JSONWebKeySet, error) {
+	keys, err := s.keyRepo.ListPublished(ctx, time.Now().Add(-s.cfg.OAuthKeyRetention))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &domain.JSONWebKeySet{Keys: make([]domain.JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		der, err := base64.StdEncoding.DecodeString(key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		public, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("signing key is not an RSA key")
+		}
+
+		set.Keys = append(set.Keys, domain.JSONWebKey{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: key.Algorithm,
+			KeyID:     key.ID,
+			N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		})
+	}
+	return set, nil
+}
+
+// activeSigner returns the active key, generating one if there is none or
+// the active one is due for rotation
+func (s *KeyService) activeSigner(ctx context.Context) (*signer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.keyRepo.GetActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || time.Since(key.CreatedAt) >= s.cfg.OAuthKeyRotationInterval {
+		_, active, err := s.rotate(ctx)
+		return active, err
+	}
+
+	if s.cached != nil && s.cached.id == key.ID {
+		return s.cached, nil
+	}
+	private, err := s.openKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	s.cached = &signer{id: key.ID, key: private}
+	return s.cached, nil
+}
+
+// rotate generates and stores a new active key. The caller must hold s.mu.
+func (s *KeyService) rotate(ctx context.Context) (*domain.SigningKey, *signer, error) {
+	private, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := s.sealKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	key := &domain.SigningKey{
+		ID:         hex.EncodeToString(id),
+		Algorithm:  jwt.SigningMethodRS256.Alg(),
+		PrivateKey: sealed,
+		PublicKey:  base64.StdEncoding.EncodeToString(public),
+		CreatedAt:  now,
+	}
+	if err := s.keyRepo.Rotate(ctx, key, now.Add(-s.cfg.OAuthKeyRetention)); err != nil {
+		return nil, nil, err
+	}
+
+	s.logger.Info("Rotated OAuth signing key", zap.String("kid", key.ID))
+	s.cached = &signer{id: key.ID, key: private}
+	return key, s.cached, nil
+}
+
+// sealKey encrypts a private key with AES-256-GCM for storage
+func (s *KeyService) sealKey(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, der, nil)), nil
+}
+
+// openKey decrypts a private key sealed by sealKey
+func (s *KeyService) openKey(sealed string) (*rsa.PrivateKey, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return nil, errors.New("malformed signing key")
+	}
+	der, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return key, nil
+}
+
+func (s *KeyService) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.encryptionKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,465 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/oauth/repository"
+	serviceAccountService "github.com/acheevo/test/internal/serviceaccount/service"
+	"github.com/acheevo/test/internal/shared/config"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+const (
+	responseTypeCode           = "code"
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeClientCredentials = "client_credentials"
+	codeChallengeMethodS256    = "S256"
+)
+
+var (
+	ErrInvalidRequest          = errors.New("invalid request")
+	ErrInvalidClient           = errors.New("invalid client")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")
+	ErrInvalidScope            = errors.New("invalid scope")
+	ErrInvalidGrant            = errors.New("invalid or expired authorization code")
+	ErrAccessDenied            = errors.New("access denied")
+	ErrInvalidAccessToken      = errors.New("invalid access token")
+)
+
+// ProviderService implements the OpenID Connect provider: the authorization
+// code flow with PKCE, ID tokens and the userinfo endpoint. Users log in to
+// this service as usual, and the consent page calls Authorize with the
+// resulting access token; claims are taken from the user record. Service
+// accounts get API access tokens through the client credentials grant.
+type ProviderService struct {
+	clientRepo *repository.ClientRepository
+	grantRepo  *repository.GrantRepository
+	userRepo   userRepository.UserStore
+	keys       *KeyService
+	// serviceAccounts authenticates the client credentials grant
+	serviceAccounts *serviceAccountService.ServiceAccountService
+	cfg             *config.Config
+	logger          *zap.Logger
+}
+
+// authorization is a validated authorization request
+type authorization struct {
+	client *domain.Client
+	scopes []string // the requested scopes the provider supports
+}
+
+// NewProviderService creates a new OpenID Connect provider service
+func NewProviderService(
+	clientRepo *repository.ClientRepository,
+	grantRepo *repository.GrantRepository,
+	userRepo userRepository.UserStore,
+	keys *KeyService,
+	serviceAccounts *serviceAccountService.ServiceAccountService,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *ProviderService {
+	return &ProviderService{
+		clientRepo:      clientRepo,
+		grantRepo:       grantRepo,
+		userRepo:        userRepo,
+		keys:            keys,
+		serviceAccounts: serviceAccounts,
+		cfg:             cfg,
+		logger:          logger,
+	}
+}
+
+// Metadata returns the discovery document
+func (s *ProviderService) Metadata() *domain.ProviderMetadata {
+	issuer := s.issuer()
+	return &domain.ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/oauth/jwks",
+		ScopesSupported:                   domain.SupportedScopes,
+		ResponseTypesSupported:            []string{responseTypeCode},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce", "name", "updated_at", "email", "email_verified",
+		},
+	}
+}
+
+// ValidateAuthorization checks an authorization request before the user is
+// sent to the consent page. ErrInvalidClient and ErrInvalidRedirectURI must
+// be shown to the user; other errors can be returned to the client through
+// the redirect URI.
+func (s *ProviderService) ValidateAuthorization(ctx context.Context, req domain.AuthorizationRequest) error {
+	_, err := s.validate(ctx, req)
+	return err
+}
+
+// ConsentURL returns the consent page URL for a validated authorization
+// request, passing the request's query string on unchanged
+func (s *ProviderService) ConsentURL(rawQuery string) string {
+	separator := "?"
+	if strings.Contains(s.cfg.OAuthConsentURL, "?") {
+		separator = "&"
+	}
+	return s.cfg.OAuthConsentURL + separator + rawQuery
+}
+
+// Authorize decides an authorization request for a logged-in user. Without
+// an explicit decision, the request is granted if the user's earlier consent
+// covers the requested scopes, and consent is asked for otherwise. An
+// approval is remembered for later requests.
+func (s *ProviderService) Authorize(
+	ctx context.Context, userID uuid.UUID, decision domain.AuthorizationDecision,
+) (*domain.AuthorizationResult, error) {
+	auth, err := s.validate(ctx, decision.AuthorizationRequest)
+	if err != nil {
+		return nil, err
+	}
+	if decision.Approve != nil && !*decision.Approve {
+		return nil, ErrAccessDenied
+	}
+
+	consent, err := s.grantRepo.GetConsent(ctx, userID, auth.client.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if decision.Approve == nil {
+		if consent == nil || !consent.Covers(auth.scopes) {
+			return &domain.AuthorizationResult{
+				ConsentRequired: true,
+				ClientName:      auth.client.Name,
+				Scopes:          auth.scopes,
+			}, nil
+		}
+	} else {
+		granted := auth.scopes
+		if consent != nil {
+			granted = domain.ParseScope(consent.Scope + " " + strings.Join(auth.scopes, " "))
+		}
+		err := s.grantRepo.SaveConsent(ctx, &domain.Consent{
+			UserID:   userID,
+			ClientID: auth.client.ID,
+			Scope:    strings.Join(granted, " "),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.grantRepo.CreateCode(ctx, &domain.AuthorizationCode{
+		CodeHash:      authDomain.HashToken(code),
+		ClientID:      auth.client.ID,
+		UserID:        userID,
+		RedirectURI:   decision.RedirectURI,
+		Scope:         strings.Join(auth.scopes, " "),
+		Nonce:         decision.Nonce,
+		CodeChallenge: decision.CodeChallenge,
+		ExpiresAt:     time.Now().Add(s.cfg.OAuthCodeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AuthorizationResult{
+		RedirectTo: RedirectURL(decision.RedirectURI, decision.State, url.Values{"code": {code}}),
+	}, nil
+}
+
+// Exchange handles a token request with the authorization code or client
+// credentials grant
+func (s *ProviderService) Exchange(
+	ctx context.Context, clientID, clientSecret string, req domain.TokenRequest,
+) (*domain.TokenResponse, error) {
+	switch req.GrantType {
+	case grantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, clientID, clientSecret, req)
+	case grantTypeClientCredentials:
+		return s.clientCredentials(ctx, clientID, clientSecret, req)
+	default:
+		return nil, ErrUnsupportedGrantType
+	}
+}
+
+// exchangeCode redeems an authorization code for an access token and an ID
+// token. Confidential clients authenticate with their secret; codes issued
+// with a PKCE challenge need the matching verifier.
+func (s *ProviderService) exchangeCode(
+	ctx context.Context, clientID, clientSecret string, req domain.TokenRequest,
+) (*domain.TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if req.Code == "" {
+		return nil, fmt.Errorf("%w: code is required", ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	code, err := s.grantRepo.ConsumeCode(ctx, req.Code, now)
+	if err != nil {
+		return nil, err
+	}
+	if code == nil || code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(code.CodeChallenge, req.CodeVerifier) {
+		return nil, fmt.Errorf("%w: code verifier does not match", ErrInvalidGrant)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidGrant
+	}
+
+	accessToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.grantRepo.CreateAccessToken(ctx, &domain.AccessToken{
+		TokenHash: authDomain.HashToken(accessToken),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scope:     code.Scope,
+		ExpiresAt: now.Add(s.cfg.OAuthAccessTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := s.keys.Sign(ctx, s.idTokenClaims(user, client, code, now))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Issued OAuth tokens",
+		zap.String("client_id", client.ID.String()), zap.String("user_id", user.ID.String()))
+	return &domain.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.OAuthAccessTokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       code.Scope,
+	}, nil
+}
+
+// clientCredentials issues an access token to a service account, which
+// authenticates with its ID and client secret. The token is an API key in
+// all but name, so it is accepted by the API rather than the userinfo
+// endpoint, and no ID token is issued.
+func (s *ProviderService) clientCredentials(
+	ctx context.Context, clientID, clientSecret string, req domain.TokenRequest,
+) (*domain.TokenResponse, error) {
+	issued, err := s.serviceAccounts.IssueToken(ctx, clientID, clientSecret, strings.Fields(req.Scope))
+	switch {
+	case errors.Is(err, serviceAccountService.ErrInvalidClientCredentials):
+		return nil, ErrInvalidClient
+	case errors.Is(err, serviceAccountService.ErrInvalidKeyScope):
+		return nil, fmt.Errorf("%w: %v", ErrInvalidScope, err)
+	case err != nil:
+		return nil, err
+	}
+
+	s.logger.Info("Issued client credentials token", zap.String("service_account_id", clientID))
+	return &domain.TokenResponse{
+		AccessToken: issued.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.OAuthAccessTokenTTL.Seconds()),
+		Scope:       strings.Join(issued.Scopes, " "),
+	}, nil
+}
+
+// UserInfo returns the claims an access token's scopes release
+func (s *ProviderService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	grant, err := s.grantRepo.GetAccessToken(ctx, accessToken, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, grant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidAccessToken
+	}
+	return userClaims(user, domain.ParseScope(grant.Scope)), nil
+}
+
+// RedirectURL returns redirectURI with params and, if set, the client's
+// state added to its query
+func RedirectURL(redirectURI, state string, params url.Values) string {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// validate checks an authorization request. The client and redirect URI are
+// checked first, so that any other error can safely be redirected.
+func (s *ProviderService) validate(ctx context.Context, req domain.AuthorizationRequest) (*authorization, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	client, err := s.clientRepo.GetByID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+	// Redirect URIs must match a registered one exactly
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != responseTypeCode {
+		return nil, ErrUnsupportedResponseType
+	}
+
+	requested := domain.ParseScope(req.Scope)
+	if !slices.Contains(requested, domain.ScopeOpenID) {
+		return nil, fmt.Errorf("%w: the openid scope is required", ErrInvalidScope)
+	}
+	scopes := slices.DeleteFunc(requested, func(scope string) bool {
+		return !slices.Contains(domain.SupportedScopes, scope)
+	})
+
+	switch {
+	case req.CodeChallenge == "" && client.Public:
+		return nil, fmt.Errorf("%w: public clients must use PKCE", ErrInvalidRequest)
+	case req.CodeChallenge != "" && req.CodeChallengeMethod != codeChallengeMethodS256:
+		return nil, fmt.Errorf("%w: code_challenge_method must be S256", ErrInvalidRequest)
+	}
+
+	return &authorization{client: client, scopes: scopes}, nil
+}
+
+// authenticateClient checks a client's credentials. Public clients have no
+// secret and are identified by their ID alone.
+func (s *ProviderService) authenticateClient(
+	ctx context.Context, clientID, clientSecret string,
+) (*domain.Client, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	client, err := s.clientRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if clientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(authDomain.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// idTokenClaims returns the claims of the ID token issued for a code
+func (s *ProviderService) idTokenClaims(
+	user *userDomain.User, client *domain.Client, code *domain.AuthorizationCode, now time.Time,
+) jwt.MapClaims {
+	claims := jwt.MapClaims(userClaims(user, domain.ParseScope(code.Scope)))
+	claims["iss"] = s.issuer()
+	claims["aud"] = client.ID.String()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.cfg.OAuthIDTokenTTL).Unix()
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	return claims
+}
+
+func (s *ProviderService) issuer() string {
+	return strings.TrimSuffix(s.cfg.OAuthIssuer, "/")
+}
+
+// userClaims returns the claims about a user that scopes release
+func userClaims(user *userDomain.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID.String()}
+	if slices.Contains(scopes, domain.ScopeProfile) {
+		claims["name"] = user.Name
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if slices.Contains(scopes, domain.ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
+
+// verifyCodeChallenge checks a PKCE verifier against the S256 challenge it
+// was issued with. Codes issued without a challenge take no verifier.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// generateToken generates a random opaque token
+func generateToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
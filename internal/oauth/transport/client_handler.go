@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/oauth/service"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+// ClientHandler handles OAuth client registration, signing key rotation and
+// users' consents
+type ClientHandler struct {
+	clientService *service.ClientService
+	keyService    *service.KeyService
+	logger        *zap.Logger
+}
+
+// NewClientHandler creates a new OAuth client handler
+func NewClientHandler(
+	clientService *service.ClientService, keyService *service.KeyService, logger *zap.Logger,
+) *ClientHandler {
+	return &ClientHandler{
+		clientService: clientService,
+		keyService:    keyService,
+		logger:        logger,
+	}
+}
+
+// CreateClient registers a new client (requires oauth_clients:write)
+func (h *ClientHandler) CreateClient(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req domain.CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	registration, err := h.clientService.RegisterClient(c.Request.Context(), req, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRedirectURI) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to register OAuth client", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register client"})
+		return
+	}
+
+	h.logger.Info("Registered OAuth client",
+		zap.String("client_id", registration.ID.String()), zap.String("user_id", user.ID.String()))
+	c.JSON(http.StatusCreated, registration)
+}
+
+// ListClients returns all registered clients (requires oauth_clients:read)
+func (h *ClientHandler) ListClients(c *gin.Context) {
+	clients, err := h.clientService.ListClients(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to list OAuth clients", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list clients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+}
+
+// DeleteClient removes a client and everything it was granted (requires oauth_clients:write)
+func (h *ClientHandler) DeleteClient(c *gin.Context) {
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	if err := h.clientService.DeleteClient(c.Request.Context(), clientID); err != nil {
+		if errors.Is(err, service.ErrClientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		h.logger.Error("Failed to delete OAuth client", zap.String("client_id", clientID.String()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted"})
+}
+
+// RotateKeys replaces the ID token signing key (requires oauth_clients:write).
+// The previous key stays published until its retention ends.
+func (h *ClientHandler) RotateKeys(c *gin.Context) {
+	key, err := h.keyService.Rotate(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to rotate OAuth signing key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// ListConsents returns the clients the current user has given consent to
+func (h *ClientHandler) ListConsents(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	consents, err := h.clientService.ListConsents(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error("Failed to list consents", zap.String("user_id", user.ID.String()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list consents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, consents)
+}
+
+// RevokeConsent withdraws the current user's consent for a client
+func (h *ClientHandler) RevokeConsent(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	clientID, err := uuid.Parse(c.Param("clientId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	if err := h.clientService.RevokeConsent(c.Request.Context(), user.ID, clientID); err != nil {
+		if errors.Is(err, service.ErrConsentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Consent not found"})
+			return
+		}
+		h.logger.Error("Failed to revoke consent", zap.String("user_id", user.ID.String()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke consent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Consent revoked"})
+}
+
+// currentUser returns the user set by the auth middleware
+func currentUser(c *gin.Context) (*userDomain.User, bool) {
+	value, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return nil, false
+	}
+
+	user, ok := value.(*userDomain.User)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user type in context"})
+		return nil, false
+	}
+	return user, true
+}
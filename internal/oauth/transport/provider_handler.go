@@ -0,0 +1,222 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/oauth/service"
+)
+
+// oauthErrors maps service errors to OAuth 2.0 error codes
+var oauthErrors = []struct {
+	err  error
+	code string
+}{
+	{service.ErrInvalidRequest, "invalid_request"},
+	{service.ErrInvalidClient, "invalid_client"},
+	{service.ErrInvalidRedirectURI, "invalid_request"},
+	{service.ErrUnsupportedResponseType, "unsupported_response_type"},
+	{service.ErrUnsupportedGrantType, "unsupported_grant_type"},
+	{service.ErrInvalidScope, "invalid_scope"},
+	{service.ErrInvalidGrant, "invalid_grant"},
+	{service.ErrAccessDenied, "access_denied"},
+}
+
+// ProviderHandler handles the OpenID Connect provider endpoints. Errors are
+// reported in the OAuth 2.0 format rather than the API's usual one.
+type ProviderHandler struct {
+	providerService *service.ProviderService
+	keyService      *service.KeyService
+	logger          *zap.Logger
+}
+
+// NewProviderHandler creates a new OpenID Connect provider handler
+func NewProviderHandler(
+	providerService *service.ProviderService, keyService *service.KeyService, logger *zap.Logger,
+) *ProviderHandler {
+	return &ProviderHandler{
+		providerService: providerService,
+		keyService:      keyService,
+		logger:          logger,
+	}
+}
+
+// Discovery returns the OpenID Connect discovery document
+func (h *ProviderHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.providerService.Metadata())
+}
+
+// JWKS returns the public keys ID tokens are signed with
+func (h *ProviderHandler) JWKS(c *gin.Context) {
+	keys, err := h.keyService.JWKS(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to load signing keys", zap.Error(err))
+		h.oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// Authorize validates an authorization request and sends the user agent on to
+// the consent page, which logs the user in and posts the request back to Decide
+func (h *ProviderHandler) Authorize(c *gin.Context) {
+	var req domain.AuthorizationRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if err := h.providerService.ValidateAuthorization(c.Request.Context(), req); err != nil {
+		if redirectTo, ok := h.authorizationError(c, req, err); ok {
+			c.Redirect(http.StatusFound, redirectTo)
+		}
+		return
+	}
+
+	c.Redirect(http.StatusFound, h.providerService.ConsentURL(c.Request.URL.RawQuery))
+}
+
+// Decide completes an authorization request for the authenticated user. The
+// response carries the URL to send the user agent back to the client with,
+// or asks for the user's consent first.
+func (h *ProviderHandler) Decide(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var decision domain.AuthorizationDecision
+	if err := c.ShouldBindJSON(&decision); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.providerService.Authorize(c.Request.Context(), user.ID, decision)
+	if err != nil {
+		if redirectTo, ok := h.authorizationError(c, decision.AuthorizationRequest, err); ok {
+			c.JSON(http.StatusOK, domain.AuthorizationResult{RedirectTo: redirectTo})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Token exchanges an authorization code, or a service account's client
+// credentials, for tokens
+func (h *ProviderHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req domain.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// HTTP Basic credentials are form-encoded before being base64 encoded
+	clientID, clientSecret, basic := c.Request.BasicAuth()
+	if basic {
+		var idErr, secretErr error
+		clientID, idErr = url.QueryUnescape(clientID)
+		clientSecret, secretErr = url.QueryUnescape(clientSecret)
+		if idErr != nil || secretErr != nil {
+			h.oauthError(c, http.StatusBadRequest, "invalid_request", "malformed client credentials")
+			return
+		}
+	} else {
+		clientID, clientSecret = req.ClientID, req.ClientSecret
+	}
+
+	response, err := h.providerService.Exchange(c.Request.Context(), clientID, clientSecret, req)
+	if err != nil {
+		code, known := oauthErrorCode(err)
+		switch {
+		case errors.Is(err, service.ErrInvalidClient):
+			if basic {
+				c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+			}
+			h.oauthError(c, http.StatusUnauthorized, code, err.Error())
+		case known:
+			h.oauthError(c, http.StatusBadRequest, code, err.Error())
+		default:
+			h.logger.Error("Failed to issue tokens", zap.String("grant_type", req.GrantType), zap.Error(err))
+			h.oauthError(c, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UserInfo returns the claims about the user an access token was issued for
+func (h *ProviderHandler) UserInfo(c *gin.Context) {
+	accessToken, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || accessToken == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="oauth"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.providerService.UserInfo(c.Request.Context(), accessToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccessToken) {
+			c.Header("WWW-Authenticate", `Bearer realm="oauth", error="invalid_token"`)
+			h.oauthError(c, http.StatusUnauthorized, "invalid_token", "")
+			return
+		}
+		h.logger.Error("Failed to get user info", zap.Error(err))
+		h.oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	c.JSON(http.StatusOK, claims)
+}
+
+// authorizationError handles an error from an authorization request. Errors
+// the client can be told about return the redirect URI carrying them; an
+// unknown client or redirect URI is answered directly, as redirecting could
+// deliver the response to an attacker.
+func (h *ProviderHandler) authorizationError(
+	c *gin.Context, req domain.AuthorizationRequest, err error,
+) (string, bool) {
+	code, known := oauthErrorCode(err)
+	switch {
+	case errors.Is(err, service.ErrInvalidClient), errors.Is(err, service.ErrInvalidRedirectURI):
+		h.oauthError(c, http.StatusBadRequest, code, err.Error())
+		return "", false
+	case known:
+		params := url.Values{"error": {code}, "error_description": {err.Error()}}
+		return service.RedirectURL(req.RedirectURI, req.State, params), true
+	default:
+		h.logger.Error("Failed to authorize", zap.String("client_id", req.ClientID), zap.Error(err))
+		h.oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return "", false
+	}
+}
+
+// oauthError writes an OAuth 2.0 error response
+func (h *ProviderHandler) oauthError(c *gin.Context, status int, code, description string) {
+	body := gin.H{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	c.JSON(status, body)
+}
+
+// oauthErrorCode returns the OAuth 2.0 error code for a service error
+func oauthErrorCode(err error) (string, bool) {
+	for _, e := range oauthErrors {
+		if errors.Is(err, e.err) {
+			return e.code, true
+		}
+	}
+	return "", false
+}
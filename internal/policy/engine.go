@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Attributes describe the subject, resource or context of a request. Values
+// are strings, booleans, numbers or lists of strings.
+type Attributes map[string]interface{}
+
+// Request is an access request to evaluate: whether Subject may perform
+// Action on Resource, whose "type" attribute names its type, in Context
+type Request struct {
+	Subject  Attributes
+	Action   string
+	Resource Attributes
+	Context  Attributes
+}
+
+// Decision is the outcome of evaluating a request. Rule names the rule that
+// decided it, and is empty if no rule matched.
+type Decision struct {
+	Allowed bool
+	Rule    string
+}
+
+// Engine evaluates requests against a policy and logs every decision
+type Engine struct {
+	policy *Policy
+	logger *zap.Logger
+}
+
+// NewEngine creates a policy engine
+func NewEngine(policy *Policy, logger *zap.Logger) *Engine {
+	return &Engine{
+		policy: policy,
+		logger: logger,
+	}
+}
+
+// Evaluate decides a request. Deny rules take precedence over allow rules,
+// and requests no rule matches are denied.
+func (e *Engine) Evaluate(req Request) Decision {
+	decision := e.decide(req)
+
+	e.logger.Info("Policy decision",
+		zap.Bool("allowed", decision.Allowed),
+		zap.String("rule", decision.Rule),
+		zap.String("action", req.Action),
+		zap.Any("subject_type", req.Subject["type"]),
+		zap.Any("subject_id", req.Subject["id"]),
+		zap.Any("resource_type", req.Resource["type"]),
+		zap.Any("resource_id", req.Resource["id"]),
+	)
+	return decision
+}
+
+// decide finds the deciding rule for a request
+func (e *Engine) decide(req Request) Decision {
+	var allowedBy string
+	for _, rule := range e.policy.Rules {
+		if !rule.matches(req) {
+			continue
+		}
+		if rule.Effect == Deny {
+			return Decision{Allowed: false, Rule: rule.Name}
+		}
+		if allowedBy == "" {
+			allowedBy = rule.Name
+		}
+	}
+	return Decision{Allowed: allowedBy != "", Rule: allowedBy}
+}
+
+// matches reports whether a rule applies to a request
+func (r Rule) matches(req Request) bool {
+	resourceType, _ := req.Resource["type"].(string)
+	if !matchesName(r.Actions, req.Action) || !matchesName(r.Resources, resourceType) {
+		return false
+	}
+	for _, condition := range r.Conditions {
+		if !condition.holds(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// holds reports whether a condition holds for a request
+func (c Condition) holds(req Request) bool {
+	actual, ok := lookup(req, c.Attribute)
+	if !ok {
+		return false
+	}
+	expected := c.Value
+	if c.ValueFrom != "" {
+		if expected, ok = lookup(req, c.ValueFrom); !ok {
+			return false
+		}
+	}
+	actual, expected = normalize(actual), normalize(expected)
+
+	switch c.Operator {
+	case OpEquals:
+		return reflect.DeepEqual(actual, expected)
+	case OpNotEquals:
+		return !reflect.DeepEqual(actual, expected)
+	case OpIn:
+		values, ok := expected.([]interface{})
+		return ok && containsValue(values, actual)
+	case OpContains:
+		values, ok := actual.([]interface{})
+		return ok && containsValue(values, expected)
+	case OpCIDR:
+		return inNetworks(actual, expected)
+	default:
+		return false
+	}
+}
+
+// lookup resolves an attribute reference such as "subject.id"
+func lookup(req Request, reference string) (interface{}, bool) {
+	source, name, _ := strings.Cut(reference, ".")
+	var attributes Attributes
+	switch source {
+	case "subject":
+		attributes = req.Subject
+	case "resource":
+		attributes = req.Resource
+	case "context":
+		attributes = req.Context
+	}
+	value, ok := attributes[name]
+	return value, ok && value != nil
+}
+
+// normalize converts values to the types JSON decodes to, so that
+// attributes set in code compare equal to values from a policy file
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return value
+	}
+}
+
+// containsValue reports whether values includes value
+func containsValue(values []interface{}, value interface{}) bool {
+	return slices.ContainsFunc(values, func(v interface{}) bool {
+		return reflect.DeepEqual(normalize(v), value)
+	})
+}
+
+// inNetworks reports whether address is an IP address within one of networks
+func inNetworks(address, networks interface{}) bool {
+	s, _ := address.(string)
+	ip := net.ParseIP(s)
+	cidrs, _ := networks.([]interface{})
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		s, _ := cidr.(string)
+		if _, network, err := net.ParseCIDR(s); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesName reports whether names includes name or the wildcard
+func matchesName(names []string, name string) bool {
+	return slices.Contains(names, Wildcard) || slices.Contains(names, name)
+}
@@ -0,0 +1,165 @@
+package policy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Effect is what a rule decides when it matches
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Operators a condition can compare attributes with
+const (
+	// OpEquals holds if the attribute equals the value
+	OpEquals = "equals"
+	// OpNotEquals holds if the attribute differs from the value
+	OpNotEquals = "not_equals"
+	// OpIn holds if the attribute is one of a list of values
+	OpIn = "in"
+	// OpContains holds if the attribute is a list containing the value
+	OpContains = "contains"
+	// OpCIDR holds if the attribute is an IP address within one of a list of CIDR ranges
+	OpCIDR = "cidr"
+)
+
+// Wildcard matches any action or resource type in a rule
+const Wildcard = "*"
+
+// attributeSources are the prefixes attribute references may start with
+var attributeSources = []string{"subject", "resource", "context"}
+
+//go:embed default_policy.json
+var defaultPolicy []byte
+
+// Policy is a set of rules. A request is allowed if an allow rule matches it
+// and no deny rule does; requests no rule matches are denied.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule allows or denies actions on resource types when all of its conditions hold
+type Rule struct {
+	Name       string      `json:"name"`
+	Effect     Effect      `json:"effect"`
+	Actions    []string    `json:"actions"`
+	Resources  []string    `json:"resources"`
+	Conditions []Condition `json:"conditions"`
+}
+
+// Condition compares an attribute, such as "subject.id", with either a
+// literal Value or another attribute named by ValueFrom. A condition on an
+// attribute the request does not have never holds.
+type Condition struct {
+	Attribute string      `json:"attribute"`
+	Operator  string      `json:"operator"`
+	Value     interface{} `json:"value,omitempty"`
+	ValueFrom string      `json:"value_from,omitempty"`
+}
+
+// Load reads a policy file, or the built-in default policy if path is empty
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return Parse(defaultPolicy)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates a JSON policy
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// validate checks that every rule can be evaluated
+func (p *Policy) validate() error {
+	if len(p.Rules) == 0 {
+		return errors.New("policy has no rules")
+	}
+
+	names := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Effect != Allow && rule.Effect != Deny {
+			return fmt.Errorf("rule %q: effect must be %q or %q", rule.Name, Allow, Deny)
+		}
+		if len(rule.Actions) == 0 || len(rule.Resources) == 0 {
+			return fmt.Errorf("rule %q: actions and resources are required", rule.Name)
+		}
+		for _, condition := range rule.Conditions {
+			if err := condition.validate(); err != nil {
+				return fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a condition's attribute references, operator and value
+func (c Condition) validate() error {
+	if !validReference(c.Attribute) {
+		return fmt.Errorf("invalid attribute %q", c.Attribute)
+	}
+	if (c.Value == nil) == (c.ValueFrom == "") {
+		return fmt.Errorf("condition on %s needs either value or value_from", c.Attribute)
+	}
+	if c.ValueFrom != "" && !validReference(c.ValueFrom) {
+		return fmt.Errorf("invalid attribute %q", c.ValueFrom)
+	}
+
+	switch c.Operator {
+	case OpEquals, OpNotEquals, OpContains:
+	case OpIn:
+		if _, ok := c.Value.([]interface{}); !ok && c.ValueFrom == "" {
+			return fmt.Errorf("condition on %s: %s needs a list", c.Attribute, c.Operator)
+		}
+	case OpCIDR:
+		networks, ok := c.Value.([]interface{})
+		if !ok {
+			return fmt.Errorf("condition on %s: %s needs a list of CIDR ranges", c.Attribute, c.Operator)
+		}
+		for _, network := range networks {
+			cidr, _ := network.(string)
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("condition on %s: invalid CIDR range %v", c.Attribute, network)
+			}
+		}
+	default:
+		return fmt.Errorf("condition on %s: unknown operator %q", c.Attribute, c.Operator)
+	}
+	return nil
+}
+
+// validReference reports whether an attribute reference names a source and an attribute
+func validReference(reference string) bool {
+	source, name, ok := strings.Cut(reference, ".")
+	return ok && name != "" && slices.Contains(attributeSources, source)
+}
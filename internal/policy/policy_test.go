@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Default Policy", func(t *testing.T) {
+		policy, err := Load("")
+		require.NoError(t, err)
+		assert.NotEmpty(t, policy.Rules)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "policy.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"rules": [
+			{"name": "everything", "effect": "allow", "actions": ["*"], "resources": ["*"]}
+		]}`), 0o600))
+
+		policy, err := Load(path)
+		require.NoError(t, err)
+		require.Len(t, policy.Rules, 1)
+		assert.Equal(t, "everything", policy.Rules[0].Name)
+
+		_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"not json":  `rules`,
+			"no rules":  `{"rules": []}`,
+			"no name":   `{"rules": [{"effect": "allow", "actions": ["a"], "resources": ["r"]}]}`,
+			"effect":    `{"rules": [{"name": "r", "effect": "maybe", "actions": ["a"], "resources": ["r"]}]}`,
+			"no action": `{"rules": [{"name": "r", "effect": "allow", "resources": ["r"]}]}`,
+			"duplicate": `{"rules": [
+				{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"]},
+				{"name": "r", "effect": "deny", "actions": ["a"], "resources": ["r"]}]}`,
+			"attribute": `{"rules": [{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"],
+				"conditions": [{"attribute": "user.id", "operator": "equals", "value": "x"}]}]}`,
+			"no value": `{"rules": [{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"],
+				"conditions": [{"attribute": "subject.id", "operator": "equals"}]}]}`,
+			"both values": `{"rules": [{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"],
+				"conditions": [{"attribute": "subject.id", "operator": "equals", "value": "x",
+				"value_from": "resource.id"}]}]}`,
+			"operator": `{"rules": [{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"],
+				"conditions": [{"attribute": "subject.id", "operator": "like", "value": "x"}]}]}`,
+			"in": `{"rules": [{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"],
+				"conditions": [{"attribute": "subject.role", "operator": "in", "value": "admin"}]}]}`,
+			"cidr": `{"rules": [{"name": "r", "effect": "allow", "actions": ["a"], "resources": ["r"],
+				"conditions": [{"attribute": "context.ip", "operator": "cidr", "value": ["10.0.0.0/33"]}]}]}`,
+		} {
+			_, err := Parse([]byte(data))
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Load("")
+	require.NoError(t, err)
+	core, logs := observer.New(zap.InfoLevel)
+	engine := NewEngine(policy, zap.New(core))
+
+	user := Attributes{"type": "user", "id": "u1", "role": "user", "permissions": []string{}}
+	support := Attributes{"type": "user", "id": "u2", "role": "support", "permissions": []string{"users:write"}}
+	admin := Attributes{"type": "user", "id": "u3", "role": "admin", "permissions": []string{"users:read", "users:write"}}
+
+	t.Run("Default Policy", func(t *testing.T) {
+		for _, tc := range []struct {
+			name     string
+			subject  Attributes
+			action   string
+			resource Attributes
+			allowed  bool
+			rule     string
+		}{
+			{"own user", user, "users:read", Attributes{"type": "user", "id": "u1"}, true, "read-own-user"},
+			{"other user", user, "users:read", Attributes{"type": "user", "id": "u3"}, false, ""},
+			{"with permission", admin, "users:read", Attributes{"type": "user", "id": "u1"}, true,
+				"read-users-with-permission"},
+			{"collection", user, "users:read", Attributes{"type": "user"}, false, ""},
+			{"own sessions", user, "sessions:revoke", Attributes{"type": "session", "user_id": "u1"}, true,
+				"manage-own-sessions"},
+			{"write user", support, "users:write", Attributes{"type": "user", "id": "u1", "role": "user"}, true,
+				"write-users-with-permission"},
+			{"write admin", support, "users:write", Attributes{"type": "user", "id": "u3", "role": "admin"}, false,
+				"protect-admin-users"},
+			{"admin writes admin", admin, "users:write", Attributes{"type": "user", "id": "u3", "role": "admin"}, true,
+				"write-users-with-permission"},
+			{"update self", user, "users:update", Attributes{"type": "user", "id": "u1", "role": "user"}, true,
+				"update-own-user"},
+			{"update other", user, "users:update", Attributes{"type": "user", "id": "u2", "role": "user"}, false, ""},
+			{"delete self", user, "users:delete", Attributes{"type": "user", "id": "u1", "role": "user"}, false, ""},
+			{"delete admin", support, "users:delete", Attributes{"type": "user", "id": "u3", "role": "admin"}, false,
+				"protect-admin-users"},
+			{"unknown action", admin, "users:purge", Attributes{"type": "user", "id": "u1"}, false, ""},
+		} {
+			decision := engine.Evaluate(Request{Subject: tc.subject, Action: tc.action, Resource: tc.resource})
+			assert.Equal(t, tc.allowed, decision.Allowed, tc.name)
+			assert.Equal(t, tc.rule, decision.Rule, tc.name)
+		}
+	})
+
+	t.Run("Decisions Are Logged", func(t *testing.T) {
+		logs.TakeAll()
+		engine.Evaluate(Request{Subject: user, Action: "users:read", Resource: Attributes{"type": "user", "id": "u3"}})
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, false, fields["allowed"])
+		assert.Equal(t, "users:read", fields["action"])
+		assert.Equal(t, "u1", fields["subject_id"])
+		assert.Equal(t, "u3", fields["resource_id"])
+	})
+}
+
+func TestConditions(t *testing.T) {
+	policy, err := Parse([]byte(`{"rules": [
+		{"name": "office", "effect": "allow", "actions": ["*"], "resources": ["report"], "conditions": [
+			{"attribute": "context.ip", "operator": "cidr", "value": ["10.0.0.0/8", "192.168.1.0/24"]},
+			{"attribute": "subject.role", "operator": "in", "value": ["admin", "auditor"]}
+		]},
+		{"name": "no-drafts", "effect": "deny", "actions": ["reports:read"], "resources": ["report"], "conditions": [
+			{"attribute": "resource.draft", "operator": "equals", "value": true}
+		]},
+		{"name": "small", "effect": "allow", "actions": ["reports:read"], "resources": ["report"], "conditions": [
+			{"attribute": "resource.pages", "operator": "equals", "value": 3}
+		]}
+	]}`))
+	require.NoError(t, err)
+	engine := NewEngine(policy, zap.NewNop())
+
+	evaluate := func(subject, resource, context Attributes) Decision {
+		resource["type"] = "report"
+		return engine.Evaluate(Request{Subject: subject, Action: "reports:read", Resource: resource, Context: context})
+	}
+	auditor := Attributes{"role": "auditor"}
+
+	assert.True(t, evaluate(auditor, Attributes{}, Attributes{"ip": "10.1.2.3"}).Allowed)
+	assert.True(t, evaluate(auditor, Attributes{}, Attributes{"ip": "192.168.1.7"}).Allowed)
+	assert.False(t, evaluate(auditor, Attributes{}, Attributes{"ip": "192.168.2.7"}).Allowed)
+	assert.False(t, evaluate(auditor, Attributes{}, Attributes{"ip": "not an ip"}).Allowed)
+	assert.False(t, evaluate(Attributes{"role": "user"}, Attributes{}, Attributes{"ip": "10.1.2.3"}).Allowed)
+
+	// Missing attributes never match
+	assert.False(t, evaluate(Attributes{}, Attributes{}, Attributes{"ip": "10.1.2.3"}).Allowed)
+	assert.False(t, evaluate(auditor, Attributes{}, Attributes{}).Allowed)
+
+	// Numbers set in code compare equal to numbers from the policy file
+	assert.Equal(t, "small", evaluate(Attributes{}, Attributes{"pages": 3}, Attributes{}).Rule)
+
+	// Deny rules win over allow rules
+	decision := evaluate(auditor, Attributes{"draft": true, "pages": 3}, Attributes{"ip": "10.1.2.3"})
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "no-drafts", decision.Rule)
+}
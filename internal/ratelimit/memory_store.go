@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+// MemoryStore keeps rate limit state in process memory. Limits are per replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	pruned  time.Time
+}
+
+// NewMemoryStore creates a new in-memory rate limit store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// Update applies fn to the state of key under the store's lock
+func (s *MemoryStore) Update(
+	_ context.Context, key string, ttl time.Duration, fn func(state *State, exists bool),
+) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[key]
+	if exists && now.After(entry.expiresAt) {
+		exists = false
+	}
+	if !exists {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+
+	fn(&entry.state, exists)
+	entry.expiresAt = now.Add(ttl)
+
+	// Drop expired keys about once a minute so the map does not grow without bound
+	if now.Sub(s.pruned) >= time.Minute {
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.pruned = now
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// Record is the persisted rate limit state of one key
+type Record struct {
+	Key       string    `gorm:"primaryKey"`
+	Value     float64   `gorm:"not null"`
+	Previous  float64   `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TableName returns the table name for the Record model
+func (Record) TableName() string {
+	return "rate_limits"
+}
+
+// PostgresStore keeps rate limit state in Postgres so limits hold across replicas
+type PostgresStore struct {
+	db *database.Database
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+// NewPostgresStore creates a new Postgres-backed rate limit store
+func NewPostgresStore(db *database.Database) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Update applies fn to the state of key inside a transaction holding the key's row lock
+func (s *PostgresStore) Update(
+	ctx context.Context, key string, ttl time.Duration, fn func(state *State, exists bool),
+) error {
+	db, done := s.db.Operation(ctx)
+	defer done()
+
+	now := time.Now()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Make sure a row exists to lock, so concurrent first requests for a key
+		// serialize like any others. An already expired placeholder reads as absent.
+		placeholder := Record{Key: key, Timestamp: now, ExpiresAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&placeholder).Error; err != nil {
+			return err
+		}
+
+		var record Record
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&record).Error; err != nil {
+			return err
+		}
+
+		exists := record.ExpiresAt.After(now)
+		state := State{}
+		if exists {
+			state = State{Value: record.Value, Previous: record.Previous, Timestamp: record.Timestamp}
+		}
+		fn(&state, exists)
+
+		return tx.Model(&Record{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"value":      state.Value,
+			"previous":   state.Previous,
+			"timestamp":  state.Timestamp,
+			"expires_at": now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.pruneExpired(ctx, now)
+	return nil
+}
+
+// pruneExpired deletes expired keys about once a minute per replica
+func (s *PostgresStore) pruneExpired(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.pruned) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.pruned = now
+	s.mu.Unlock()
+
+	// Best effort: a failed prune is retried on the next cycle
+	db, done := s.db.Operation(ctx)
+	defer done()
+	_ = db.Where("expires_at < ?", now).Delete(&Record{}).Error
+}
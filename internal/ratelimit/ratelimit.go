@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm selects how requests are counted against a limit
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts up to the limit and refills continuously
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow approximates a rolling window by weighting the previous fixed window
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Limit describes how many requests are allowed per window
+type Limit struct {
+	Algorithm Algorithm
+	Requests  int
+	Window    time.Duration
+}
+
+// Result describes the outcome of a single rate limit check
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // until the limit is fully available again
+	RetryAfter time.Duration // until the next request would be allowed; zero if allowed
+}
+
+// State is the per-key state an algorithm keeps between requests. Stores
+// persist it without interpreting it.
+type State struct {
+	// Value is the tokens left (token bucket) or the requests counted in the current window (sliding window)
+	Value float64
+	// Previous is the requests counted in the previous window (sliding window only)
+	Previous float64
+	// Timestamp is the last refill (token bucket) or the start of the current window (sliding window)
+	Timestamp time.Time
+}
+
+// Store persists algorithm state. Update must apply fn atomically for a key,
+// so that concurrent requests, possibly on other replicas, see each other's effects.
+type Store interface {
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State, exists bool)) error
+}
+
+// ParseLimit parses a limit of the form "<requests>/<window>", e.g. "100/1m".
+// An empty string or "0" disables limiting and returns a zero Limit.
+func ParseLimit(s string, algorithm Algorithm) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	requests, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected <requests>/<window>", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad request count", s)
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad window", s)
+	}
+
+	switch algorithm {
+	case TokenBucket, SlidingWindow:
+	default:
+		return Limit{}, fmt.Errorf("unknown rate limit algorithm %q", algorithm)
+	}
+
+	return Limit{Algorithm: algorithm, Requests: n, Window: d}, nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+// Policy returns the limit in RateLimit-Policy header form, e.g. "100;w=60"
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.Requests, int(math.Ceil(l.Window.Seconds())))
+}
+
+// Allow counts one request for key against the limit
+func Allow(ctx context.Context, store Store, key string, limit Limit) (Result, error) {
+	var result Result
+	now := time.Now()
+
+	// Keep state around for two windows so the sliding window can still see the previous one
+	err := store.Update(ctx, key, 2*limit.Window, func(state *State, exists bool) {
+		switch limit.Algorithm {
+		case TokenBucket:
+			result = limit.takeToken(state, exists, now)
+		case SlidingWindow:
+			result = limit.countInWindow(state, exists, now)
+		}
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if result.Limit == 0 {
+		return Result{}, errors.New("rate limit has no algorithm")
+	}
+	return result, nil
+}
+
+// takeToken refills the bucket for the time elapsed and takes one token if available
+func (l Limit) takeToken(state *State, exists bool, now time.Time) Result {
+	capacity := float64(l.Requests)
+	rate := capacity / l.Window.Seconds() // tokens per second
+
+	tokens := capacity
+	if exists {
+		elapsed := now.Sub(state.Timestamp).Seconds()
+		tokens = math.Min(capacity, state.Value+math.Max(0, elapsed)*rate)
+	}
+
+	result := Result{Limit: l.Requests}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+
+	state.Value = tokens
+	state.Timestamp = now
+
+	result.Remaining = int(math.Floor(tokens))
+	result.ResetAfter = secondsToDuration((capacity - tokens) / rate)
+	return result
+}
+
+// countInWindow counts the request in the current fixed window, weighting the
+// previous window by how much of it still overlaps the rolling window
+func (l Limit) countInWindow(state *State, exists bool, now time.Time) Result {
+	windowStart := now.Truncate(l.Window)
+
+	switch {
+	case !exists || windowStart.Sub(state.Timestamp) >= 2*l.Window:
+		state.Previous, state.Value = 0, 0
+	case windowStart.After(state.Timestamp):
+		state.Previous, state.Value = state.Value, 0
+	}
+	state.Timestamp = windowStart
+
+	elapsed := now.Sub(windowStart)
+	previousWeight := 1 - elapsed.Seconds()/l.Window.Seconds()
+	estimated := state.Previous*previousWeight + state.Value
+
+	result := Result{Limit: l.Requests}
+	if estimated+1 <= float64(l.Requests) {
+		state.Value++
+		estimated++
+		result.Allowed = true
+	} else if state.Previous > 0 {
+		// Wait until enough of the previous window has slid out
+		needed := estimated + 1 - float64(l.Requests)
+		result.RetryAfter = secondsToDuration(needed / state.Previous * l.Window.Seconds())
+	} else {
+		result.RetryAfter = l.Window - elapsed
+	}
+
+	result.Remaining = int(math.Max(0, math.Floor(float64(l.Requests)-estimated)))
+	result.ResetAfter = 2*l.Window - elapsed
+	if state.Previous == 0 {
+		result.ResetAfter = l.Window - elapsed
+	}
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		limit, err := ParseLimit("100/1m", TokenBucket)
+		require.NoError(t, err)
+		assert.Equal(t, Limit{Algorithm: TokenBucket, Requests: 100, Window: time.Minute}, limit)
+		assert.True(t, limit.Enabled())
+		assert.Equal(t, "100;w=60", limit.Policy())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		for _, s := range []string{"", "0", " "} {
+			limit, err := ParseLimit(s, SlidingWindow)
+			require.NoError(t, err)
+			assert.False(t, limit.Enabled())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, s := range []string{"100", "x/1m", "-1/1m", "10/soon", "10/0s"} {
+			_, err := ParseLimit(s, SlidingWindow)
+			assert.Error(t, err, s)
+		}
+
+		_, err := ParseLimit("10/1m", Algorithm("leaky_bucket"))
+		assert.Error(t, err)
+	})
+}
+
+func TestAllow(t *testing.T) {
+	for _, algorithm := range []Algorithm{TokenBucket, SlidingWindow} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			store := NewMemoryStore()
+			limit := Limit{Algorithm: algorithm, Requests: 3, Window: time.Hour}
+
+			for i := 0; i < 3; i++ {
+				result, err := Allow(context.Background(), store, "key", limit)
+				require.NoError(t, err)
+				assert.True(t, result.Allowed)
+				assert.Equal(t, 3, result.Limit)
+				assert.Equal(t, 2-i, result.Remaining)
+				assert.Zero(t, result.RetryAfter)
+				assert.Positive(t, result.ResetAfter)
+			}
+
+			result, err := Allow(context.Background(), store, "key", limit)
+			require.NoError(t, err)
+			assert.False(t, result.Allowed)
+			assert.Zero(t, result.Remaining)
+			assert.Positive(t, result.RetryAfter)
+			assert.LessOrEqual(t, result.RetryAfter, time.Hour)
+
+			// Keys are limited independently
+			result, err = Allow(context.Background(), store, "other", limit)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed)
+		})
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	limit := Limit{Algorithm: TokenBucket, Requests: 10, Window: 10 * time.Second}
+	now := time.Now()
+	state := State{Value: 0, Timestamp: now.Add(-2 * time.Second)}
+
+	result := limit.takeToken(&state, true, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+	assert.InDelta(t, 1, state.Value, 1e-9)
+}
+
+func TestSlidingWindowWeighting(t *testing.T) {
+	limit := Limit{Algorithm: SlidingWindow, Requests: 10, Window: time.Minute}
+	windowStart := time.Now().Truncate(time.Minute)
+	now := windowStart.Add(45 * time.Second)
+
+	// A full previous window still counts for the quarter of it that overlaps the rolling window
+	state := State{Value: 10, Timestamp: windowStart.Add(-time.Minute)}
+	result := limit.countInWindow(&state, true, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 10.0, state.Previous)
+	assert.Equal(t, 1.0, state.Value)
+	assert.Equal(t, 6, result.Remaining)
+
+	// A previous window older than one window is forgotten entirely
+	state = State{Value: 10, Timestamp: windowStart.Add(-2 * time.Minute)}
+	result = limit.countInWindow(&state, true, now)
+	assert.True(t, result.Allowed)
+	assert.Zero(t, state.Previous)
+	assert.Equal(t, 9, result.Remaining)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+
+	require.NoError(t, store.Update(context.Background(), "key", time.Millisecond, func(state *State, exists bool) {
+		assert.False(t, exists)
+		state.Value = 5
+	}))
+
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, store.Update(context.Background(), "key", time.Minute, func(state *State, exists bool) {
+		assert.False(t, exists)
+		assert.Zero(t, state.Value)
+	}))
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/acheevo/test/internal/rbac/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// RoleRepository handles role and role assignment database operations
+type RoleRepository struct {
+	db *database.Database
+}
+
+// NewRoleRepository creates a new role repository
+func NewRoleRepository(db *database.Database) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// Create stores a new role
+func (r *RoleRepository) Create(ctx context.Context, role *domain.Role) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(role).Error
+}
+
+// GetByID retrieves a role by ID
+func (r *RoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Role, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var role domain.Role
+	err := db.Where("id = ?", id).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &role, err
+}
+
+// GetByName retrieves a role by name
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*domain.Role, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var role domain.Role
+	err := db.Where("name = ?", name).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &role, err
+}
+
+// List retrieves all roles, built-in ones first
+func (r *RoleRepository) List(ctx context.Context) ([]domain.Role, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var roles []domain.Role
+	err := db.Order("builtin DESC, name").Find(&roles).Error
+	return roles, err
+}
+
+// Update updates a role
+func (r *RoleRepository) Update(ctx context.Context, role *domain.Role) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Save(role).Error
+}
+
+// Delete removes a role and its assignments, and reports whether it existed
+func (r *RoleRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var deleted bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&domain.RoleAssignment{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&domain.Role{})
+		deleted = result.RowsAffected > 0
+		return result.Error
+	})
+	return deleted, err
+}
+
+// ListForUser retrieves a user's roles: the built-in role named by the user's
+// role and the custom roles assigned to them
+func (r *RoleRepository) ListForUser(ctx context.Context, userID uuid.UUID) ([]domain.Role, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var roles []domain.Role
+	err := db.
+		Where("name = (SELECT role FROM users WHERE id = ?) OR id IN (SELECT role_id FROM user_roles WHERE user_id = ?)",
+			userID, userID).
+		Order("builtin DESC, name").Find(&roles).Error
+	return roles, err
+}
+
+// Assign assigns a role to a user; assigning it again has no effect
+func (r *RoleRepository) Assign(ctx context.Context, userID, roleID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.RoleAssignment{UserID: userID, RoleID: roleID}).Error
+}
+
+// Unassign removes a role from a user and reports whether it was assigned
+func (r *RoleRepository) Unassign(ctx context.Context, userID, roleID uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	result := db.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&domain.RoleAssignment{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteByUserID removes every role assigned to a user
+func (r *RoleRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Where("user_id = ?", userID).Delete(&domain.RoleAssignment{}).Error
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/auth/principal"
+	"github.com/acheevo/test/internal/rbac/domain"
+	"github.com/acheevo/test/internal/rbac/repository"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// roleNamePattern is what role names may look like, so they read well in
+// listings and logs
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("a role with this name already exists")
+	ErrInvalidRoleName   = errors.New("role names must be lowercase letters, digits, '-' or '_'")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrBuiltinRole       = errors.New("built-in roles cannot be changed or assigned")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrRoleNotAssigned   = errors.New("role is not assigned to the user")
+	ErrCannotGrantRole   = errors.New("role grants permissions the caller does not have")
+)
+
+// RoleService manages roles and their assignment to users, and resolves the
+// permissions of principals
+type RoleService struct {
+	roleRepo *repository.RoleRepository
+	userRepo userRepository.UserStore
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(roleRepo *repository.RoleRepository, userRepo userRepository.UserStore) *RoleService {
+	return &RoleService{
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+	}
+}
+
+// List returns all roles
+func (s *RoleService) List(ctx context.Context) ([]domain.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+// Get returns a role
+func (s *RoleService) Get(ctx context.Context, id uuid.UUID) (*domain.Role, error) {
+	role, err := s.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotFound
+	}
+	return role, nil
+}
+
+// Create creates a custom role. The principal creating it must have every
+// permission it grants.
+func (s *RoleService) Create(
+	ctx context.Context, p *principal.Principal, req domain.CreateRoleRequest,
+) (*domain.Role, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidRoleName
+	}
+	permissions, err := validatePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPermissions(ctx, p, permissions); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.roleRepo.GetByName(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrRoleExists
+	}
+
+	role := &domain.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := s.roleRepo.Create(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Update replaces a custom role's description and permissions. The principal
+// updating it must have every permission it grants afterwards.
+func (s *RoleService) Update(
+	ctx context.Context, p *principal.Principal, id uuid.UUID, req domain.UpdateRoleRequest,
+) (*domain.Role, error) {
+	permissions, err := validatePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPermissions(ctx, p, permissions); err != nil {
+		return nil, err
+	}
+
+	role, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if role.Builtin {
+		return nil, ErrBuiltinRole
+	}
+
+	role.Description = req.Description
+	role.Permissions = permissions
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Delete removes a custom role, taking it away from every user it was assigned to
+func (s *RoleService) Delete(ctx context.Context, id uuid.UUID) error {
+	role, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+
+	deleted, err := s.roleRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// UserRoles returns a user's built-in role and the custom roles assigned to them
+func (s *RoleService) UserRoles(ctx context.Context, userID uuid.UUID) ([]domain.Role, error) {
+	if err := s.requireUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.roleRepo.ListForUser(ctx, userID)
+}
+
+// AssignRole assigns a custom role to a user. Built-in roles follow the
+// user's role instead. The principal assigning the role must have every
+// permission it grants.
+func (s *RoleService) AssignRole(ctx context.Context, p *principal.Principal, userID, roleID uuid.UUID) error {
+	if err := s.requireUser(ctx, userID); err != nil {
+		return err
+	}
+	role, err := s.Get(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+	if err := s.CheckGrant(ctx, p, role.Name); err != nil {
+		return err
+	}
+	return s.roleRepo.Assign(ctx, userID, role.ID)
+}
+
+// UnassignRole takes a custom role away from a user
+func (s *RoleService) UnassignRole(ctx context.Context, userID, roleID uuid.UUID) error {
+	unassigned, err := s.roleRepo.Unassign(ctx, userID, roleID)
+	if err != nil {
+		return err
+	}
+	if !unassigned {
+		return ErrRoleNotAssigned
+	}
+	return nil
+}
+
+// Permissions returns everything a principal's roles allow
+func (s *RoleService) Permissions(ctx context.Context, p *principal.Principal) ([]string, error) {
+	var roles []domain.Role
+	switch p.Type {
+	case principal.TypeUser:
+		userRoles, err := s.roleRepo.ListForUser(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		roles = userRoles
+	case principal.TypeServiceAccount:
+		role, err := s.roleRepo.GetByName(ctx, string(p.Role))
+		if err != nil {
+			return nil, err
+		}
+		if role != nil {
+			roles = append(roles, *role)
+		}
+	}
+
+	var permissions []string
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// HasPermission reports whether a principal's roles allow permission
+func (s *RoleService) HasPermission(ctx context.Context, p *principal.Principal, permission string) (bool, error) {
+	permissions, err := s.Permissions(ctx, p)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(permissions, permission), nil
+}
+
+// CheckGrant checks that a principal may give the role named roleName to a
+// user or service account: it must have every permission the role has, so
+// that nobody can make an account more powerful than themselves
+func (s *RoleService) CheckGrant(ctx context.Context, p *principal.Principal, roleName string) error {
+	role, err := s.roleRepo.GetByName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotFound
+	}
+	return s.checkPermissions(ctx, p, role.Permissions)
+}
+
+// checkPermissions checks that a principal has every one of permissions
+func (s *RoleService) checkPermissions(ctx context.Context, p *principal.Principal, permissions []string) error {
+	held, err := s.Permissions(ctx, p)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(held, permission) {
+			return ErrCannotGrantRole
+		}
+	}
+	return nil
+}
+
+// requireUser checks that a user exists
+func (s *RoleService) requireUser(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// validatePermissions checks permissions against the known ones and removes duplicates
+func validatePermissions(requested []string) ([]string, error) {
+	permissions := make([]string, 0, len(requested))
+	for _, permission := range requested {
+		if !slices.Contains(domain.Permissions, permission) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownPermission, permission)
+		}
+		if !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
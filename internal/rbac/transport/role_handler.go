@@ -0,0 +1,225 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/principal"
+	"github.com/acheevo/test/internal/rbac/domain"
+	"github.com/acheevo/test/internal/rbac/service"
+)
+
+// RoleHandler handles role administration endpoints. Access is checked by
+// the auth middleware's RequirePermission.
+type RoleHandler struct {
+	roleService *service.RoleService
+	logger      *zap.Logger
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roleService *service.RoleService, logger *zap.Logger) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+		logger:      logger,
+	}
+}
+
+// ListRoles returns all roles
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleService.List(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err, "Failed to list roles")
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole returns a role
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	roleID, ok := pathID(c, "id", "Invalid role ID")
+	if !ok {
+		return
+	}
+
+	role, err := h.roleService.Get(c.Request.Context(), roleID)
+	if err != nil {
+		h.handleError(c, err, "Failed to get role")
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole creates a custom role granting only permissions the caller has
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	caller, ok := principal.FromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+		return
+	}
+
+	var req domain.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.roleService.Create(c.Request.Context(), caller, req)
+	if err != nil {
+		h.handleError(c, err, "Failed to create role")
+		return
+	}
+
+	h.logger.Info("Created role", zap.String("role", role.Name), zap.Strings("permissions", role.Permissions))
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole replaces a custom role's description and permissions, which must
+// all be permissions the caller has
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	caller, ok := principal.FromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+		return
+	}
+
+	roleID, ok := pathID(c, "id", "Invalid role ID")
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.roleService.Update(c.Request.Context(), caller, roleID, req)
+	if err != nil {
+		h.handleError(c, err, "Failed to update role")
+		return
+	}
+
+	h.logger.Info("Updated role", zap.String("role", role.Name), zap.Strings("permissions", role.Permissions))
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole removes a custom role
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	roleID, ok := pathID(c, "id", "Invalid role ID")
+	if !ok {
+		return
+	}
+
+	if err := h.roleService.Delete(c.Request.Context(), roleID); err != nil {
+		h.handleError(c, err, "Failed to delete role")
+		return
+	}
+
+	h.logger.Info("Deleted role", zap.String("role_id", roleID.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// ListUserRoles returns a user's built-in role and assigned custom roles
+func (h *RoleHandler) ListUserRoles(c *gin.Context) {
+	userID, ok := pathID(c, "id", "Invalid user ID")
+	if !ok {
+		return
+	}
+
+	roles, err := h.roleService.UserRoles(c.Request.Context(), userID)
+	if err != nil {
+		h.handleError(c, err, "Failed to list user roles")
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// AssignUserRole assigns a custom role granting only permissions the caller
+// has to a user
+func (h *RoleHandler) AssignUserRole(c *gin.Context) {
+	caller, ok := principal.FromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+		return
+	}
+
+	userID, roleID, ok := userRoleIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.roleService.AssignRole(c.Request.Context(), caller, userID, roleID); err != nil {
+		h.handleError(c, err, "Failed to assign role")
+		return
+	}
+
+	h.logger.Info("Assigned role", zap.String("user_id", userID.String()), zap.String("role_id", roleID.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned"})
+}
+
+// UnassignUserRole takes a custom role away from a user
+func (h *RoleHandler) UnassignUserRole(c *gin.Context) {
+	userID, roleID, ok := userRoleIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.roleService.UnassignRole(c.Request.Context(), userID, roleID); err != nil {
+		h.handleError(c, err, "Failed to unassign role")
+		return
+	}
+
+	h.logger.Info("Unassigned role", zap.String("user_id", userID.String()), zap.String("role_id", roleID.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "Role unassigned"})
+}
+
+// handleError maps role service errors to responses
+func (h *RoleHandler) handleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRoleName), errors.Is(err, service.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrBuiltinRole):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrCannotGrantRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrRoleNotAssigned):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role is not assigned to the user"})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// pathID parses a UUID path parameter
+func pathID(c *gin.Context, param, invalidMessage string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidMessage})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// userRoleIDs parses the user and role IDs of a role assignment path
+func userRoleIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := pathID(c, "id", "Invalid user ID")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	roleID, ok := pathID(c, "roleId", "Invalid role ID")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, roleID, true
+}
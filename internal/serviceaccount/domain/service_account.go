@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	userDomain "github.com/acheevo/test/internal/user/domain"
+)
+
+// APIKeyPrefix starts every API key and client credentials access token, so
+// that they are recognizable in logs and by secret scanners
+const APIKeyPrefix = "sak_"
+
+// CreateServiceAccountRequest represents the service account creation payload
+type CreateServiceAccountRequest struct {
+	Name        string              `json:"name" binding:"required,max=100"`
+	Description string              `json:"description" binding:"max=500"`
+	Role        userDomain.UserRole `json:"role" binding:"required,oneof=admin user"`
+}
+
+// CreateAPIKeyRequest represents the API key creation payload. A key without
+// ExpiresAt does not expire.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ServiceAccount is a non-human principal for automation. It has no email
+// or password and cannot log in; it authenticates with API keys, or with its
+// ID and client secret through the client credentials grant. OwnerID is the
+// admin accountable for it.
+type ServiceAccount struct {
+	ID               uuid.UUID           `json:"id" gorm:"type:uuid;primaryKey"`
+	Name             string              `json:"name" gorm:"not null"`
+	Description      string              `json:"description"`
+	Role             userDomain.UserRole `json:"role" gorm:"not null"`
+	OwnerID          uuid.UUID           `json:"owner_id" gorm:"type:uuid;not null;index"`
+	ClientSecretHash string              `json:"-"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+}
+
+// APIKey is a credential of a service account. Only the key's digest is
+// stored; Prefix holds its first characters so the key can be identified in
+// listings and logs. Keys issued by the client credentials grant are
+// short-lived and not listed.
+type APIKey struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	ServiceAccountID  uuid.UUID  `json:"service_account_id" gorm:"type:uuid;not null;index"`
+	Name              string     `json:"name" gorm:"not null"`
+	Prefix            string     `json:"prefix" gorm:"not null"`
+	KeyHash           string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes            []string   `json:"scopes" gorm:"serializer:json;not null"`
+	ClientCredentials bool       `json:"-" gorm:"not null;default:false"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	LastUsedAt        *time.Time `json:"last_used_at"`
+	LastUsedIP        string     `json:"last_used_ip"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKey is returned when an API key is created. Key is shown once
+// and cannot be retrieved again.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// ClientCredentials is returned when a service account's client secret is
+// rotated. ClientSecret is shown once and cannot be retrieved again.
+type ClientCredentials struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+}
+
+// IssuedToken is an access token issued by the client credentials grant
+type IssuedToken struct {
+	Token     string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// TableName returns the table name for the ServiceAccount model
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
+
+// BeforeCreate hook runs before creating a new service account
+func (a *ServiceAccount) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = time.Now()
+	return
+}
+
+// BeforeUpdate hook runs before updating a service account
+func (a *ServiceAccount) BeforeUpdate(tx *gorm.DB) (err error) {
+	a.UpdatedAt = time.Now()
+	return
+}
+
+// TableName returns the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "service_account_keys"
+}
+
+// BeforeCreate hook runs before creating a new API key
+func (k *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	k.CreatedAt = time.Now()
+	return
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/serviceaccount/domain"
+	"github.com/acheevo/test/internal/shared/database"
+)
+
+// ServiceAccountRepository handles service account and API key database operations
+type ServiceAccountRepository struct {
+	db *database.Database
+}
+
+// NewServiceAccountRepository creates a new service account repository
+func NewServiceAccountRepository(db *database.Database) *ServiceAccountRepository {
+	return &ServiceAccountRepository{db: db}
+}
+
+// Create stores a new service account
+func (r *ServiceAccountRepository) Create(ctx context.Context, account *domain.ServiceAccount) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(account).Error
+}
+
+// GetByID retrieves a service account by ID
+func (r *ServiceAccountRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ServiceAccount, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var account domain.ServiceAccount
+	err := db.Where("id = ?", id).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &account, err
+}
+
+// List retrieves all service accounts, oldest first
+func (r *ServiceAccountRepository) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var accounts []domain.ServiceAccount
+	err := db.Order("created_at").Find(&accounts).Error
+	return accounts, err
+}
+
+// SetClientSecret replaces a service account's client secret digest and
+// revokes the access tokens issued with the previous secret
+func (r *ServiceAccountRepository) SetClientSecret(ctx context.Context, id uuid.UUID, secretHash string) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("service_account_id = ? AND client_credentials", id).Delete(&domain.APIKey{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&domain.ServiceAccount{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"client_secret_hash": secretHash,
+			"updated_at":         time.Now(),
+		}).Error
+	})
+}
+
+// Delete removes a service account and its API keys, and reports whether it existed
+func (r *ServiceAccountRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var deleted bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_account_id = ?", id).Delete(&domain.APIKey{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&domain.ServiceAccount{})
+		deleted = result.RowsAffected > 0
+		return result.Error
+	})
+	return deleted, err
+}
+
+// DeleteByUserID deletes the service accounts a user owns and their API keys
+func (r *ServiceAccountRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		owned := tx.Model(&domain.ServiceAccount{}).Select("id").Where("owner_id = ?", userID)
+		if err := tx.Where("service_account_id IN (?)", owned).Delete(&domain.APIKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("owner_id = ?", userID).Delete(&domain.ServiceAccount{}).Error
+	})
+}
+
+// CreateKey stores a new API key
+func (r *ServiceAccountRepository) CreateKey(ctx context.Context, key *domain.APIKey) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(key).Error
+}
+
+// DeleteExpiredClientCredentialsTokens deletes up to limit expired client
+// credentials tokens, returning how many were deleted. Expired API keys are
+// kept so that their owners can still list them.
+func (r *ServiceAccountRepository) DeleteExpiredClientCredentialsTokens(ctx context.Context, limit int) (int64, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	expired := db.Model(&domain.APIKey{}).Select("id").
+		Where("client_credentials AND expires_at < ?", time.Now()).
+		Limit(limit)
+	result := db.Where("id IN (?)", expired).Delete(&domain.APIKey{})
+	return result.RowsAffected, result.Error
+}
+
+// GetKeyByToken retrieves the unexpired API key matching a raw key
+func (r *ServiceAccountRepository) GetKeyByToken(
+	ctx context.Context, rawKey string, at time.Time,
+) (*domain.APIKey, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var key domain.APIKey
+	err := db.Where("key_hash = ? AND (expires_at IS NULL OR expires_at > ?)", authDomain.HashToken(rawKey), at).
+		First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &key, err
+}
+
+// ListKeys retrieves a service account's API keys, including expired ones
+// but not client credentials tokens, oldest first
+func (r *ServiceAccountRepository) ListKeys(ctx context.Context, accountID uuid.UUID) ([]domain.APIKey, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var keys []domain.APIKey
+	err := db.Where("service_account_id = ? AND NOT client_credentials", accountID).
+		Order("created_at").Find(&keys).Error
+	return keys, err
+}
+
+// RecordKeyUse stores when and from where a key was last used, unless that
+// was already recorded after staleBefore
+func (r *ServiceAccountRepository) RecordKeyUse(
+	ctx context.Context, id uuid.UUID, ipAddress string, at, staleBefore time.Time,
+) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Model(&domain.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, staleBefore).
+		Updates(map[string]interface{}{
+			"last_used_at": at,
+			"last_used_ip": ipAddress,
+		}).Error
+}
+
+// DeleteKey deletes one of a service account's API keys and reports whether it existed
+func (r *ServiceAccountRepository) DeleteKey(ctx context.Context, accountID, id uuid.UUID) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	result := db.Where("id = ? AND service_account_id = ? AND NOT client_credentials", id, accountID).
+		Delete(&domain.APIKey{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/principal"
+	"github.com/acheevo/test/internal/serviceaccount/domain"
+	"github.com/acheevo/test/internal/serviceaccount/repository"
+	"github.com/acheevo/test/internal/shared/config"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// apiKeyPrefixLength is how much of a key is kept to identify it: the fixed
+// prefix and the first 8 hex digits of the random part
+const apiKeyPrefixLength = len(domain.APIKeyPrefix) + 8
+
+var (
+	ErrServiceAccountNotFound   = errors.New("service account not found")
+	ErrOwnerNotFound            = errors.New("service account owner must be a user")
+	ErrAPIKeyNotFound           = errors.New("API key not found")
+	ErrInvalidKeyScope          = errors.New("invalid key scope")
+	ErrInvalidKeyExpiry         = errors.New("key expiry must be in the future")
+	ErrInvalidAPIKey            = errors.New("invalid API key")
+	ErrInvalidClientCredentials = errors.New("invalid client credentials")
+)
+
+// ServiceAccountService manages service accounts and their credentials, and
+// authenticates requests made with them
+type ServiceAccountService struct {
+	accountRepo *repository.ServiceAccountRepository
+	userRepo    userRepository.UserStore
+	cfg         *config.Config
+}
+
+// NewServiceAccountService creates a new service account service
+func NewServiceAccountService(
+	accountRepo *repository.ServiceAccountRepository,
+	userRepo userRepository.UserStore,
+	cfg *config.Config,
+) *ServiceAccountService {
+	return &ServiceAccountService{
+		accountRepo: accountRepo,
+		userRepo:    userRepo,
+		cfg:         cfg,
+	}
+}
+
+// IsAPIKey reports whether a bearer token is a service account API key or
+// client credentials access token
+func IsAPIKey(bearer string) bool {
+	return strings.HasPrefix(bearer, domain.APIKeyPrefix)
+}
+
+// APIKeyPrefix returns the part of an API key that may be logged to identify it
+func APIKeyPrefix(rawKey string) string {
+	if len(rawKey) > apiKeyPrefixLength {
+		return rawKey[:apiKeyPrefixLength]
+	}
+	return rawKey
+}
+
+// Create creates a service account owned by a user
+func (s *ServiceAccountService) Create(
+	ctx context.Context, req domain.CreateServiceAccountRequest, ownerID uuid.UUID,
+) (*domain.ServiceAccount, error) {
+	owner, err := s.userRepo.GetByID(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil {
+		return nil, ErrOwnerNotFound
+	}
+
+	account := &domain.ServiceAccount{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Role:        req.Role,
+		OwnerID:     owner.ID,
+	}
+	if err := s.accountRepo.Create(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// List returns all service accounts
+func (s *ServiceAccountService) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	return s.accountRepo.List(ctx)
+}
+
+// Get returns a service account
+func (s *ServiceAccountService) Get(ctx context.Context, id uuid.UUID) (*domain.ServiceAccount, error) {
+	account, err := s.accountRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+// Delete removes a service account, revoking all of its credentials
+func (s *ServiceAccountService) Delete(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.accountRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrServiceAccountNotFound
+	}
+	return nil
+}
+
+// CreateKey issues a named, scoped API key for a service account. The raw key
+// is returned once; only its digest is stored.
+func (s *ServiceAccountService) CreateKey(
+	ctx context.Context, accountID uuid.UUID, req domain.CreateAPIKeyRequest,
+) (*domain.CreatedAPIKey, error) {
+	scopes, err := validateScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidKeyExpiry
+	}
+
+	account, err := s.Get(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, rawKey, err := s.createKey(ctx, account, strings.TrimSpace(req.Name), scopes, req.ExpiresAt, false)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.CreatedAPIKey{APIKey: *key, Key: rawKey}, nil
+}
+
+// ListKeys returns a service account's API keys, including expired ones
+func (s *ServiceAccountService) ListKeys(ctx context.Context, accountID uuid.UUID) ([]domain.APIKey, error) {
+	if _, err := s.Get(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return s.accountRepo.ListKeys(ctx, accountID)
+}
+
+// RevokeKey deletes one of a service account's API keys
+func (s *ServiceAccountService) RevokeKey(ctx context.Context, accountID, keyID uuid.UUID) error {
+	deleted, err := s.accountRepo.DeleteKey(ctx, accountID, keyID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RotateClientSecret gives a service account a new client secret for the
+// client credentials grant, revoking the access tokens issued with the old
+// one. The secret is returned once; only its digest is stored.
+func (s *ServiceAccountService) RotateClientSecret(
+	ctx context.Context, accountID uuid.UUID,
+) (*domain.ClientCredentials, error) {
+	account, err := s.Get(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.accountRepo.SetClientSecret(ctx, account.ID, authDomain.HashToken(secret)); err != nil {
+		return nil, err
+	}
+	return &domain.ClientCredentials{ClientID: account.ID, ClientSecret: secret}, nil
+}
+
+// IssueToken implements the client credentials grant: it authenticates a
+// service account by its ID and client secret and issues a short-lived access
+// token limited to the requested scopes, or to every scope if none are given
+func (s *ServiceAccountService) IssueToken(
+	ctx context.Context, clientID, clientSecret string, scopes []string,
+) (*domain.IssuedToken, error) {
+	accountID, err := uuid.Parse(clientID)
+	if err != nil {
+		return nil, ErrInvalidClientCredentials
+	}
+	account, err := s.accountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.ClientSecretHash == "" ||
+		subtle.ConstantTimeCompare([]byte(authDomain.HashToken(clientSecret)), []byte(account.ClientSecretHash)) != 1 {
+		return nil, ErrInvalidClientCredentials
+	}
+
+	if len(scopes) == 0 {
+		scopes = authDomain.TokenScopes
+	}
+	if scopes, err = validateScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.OAuthAccessTokenTTL)
+	_, rawKey, err := s.createKey(ctx, account, "client_credentials", scopes, &expiresAt, true)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.IssuedToken{Token: rawKey, Scopes: scopes, ExpiresAt: expiresAt}, nil
+}
+
+// Authenticate looks up an API key or client credentials access token and
+// returns its service account, limited to the key's scopes. Use is recorded
+// at most once per configured interval.
+func (s *ServiceAccountService) Authenticate(
+	ctx context.Context, rawKey, ipAddress string,
+) (*principal.Principal, error) {
+	now := time.Now()
+	key, err := s.accountRepo.GetKeyByToken(ctx, rawKey, now)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	account, err := s.accountRepo.GetByID(ctx, key.ServiceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	interval := s.cfg.SessionLastSeenInterval
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= interval {
+		if err := s.accountRepo.RecordKeyUse(ctx, key.ID, ipAddress, now, now.Add(-interval)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &principal.Principal{
+		Type:             principal.TypeServiceAccount,
+		ID:               account.ID,
+		Name:             account.Name,
+		Role:             account.Role,
+		CredentialID:     key.ID,
+		CredentialPrefix: key.Prefix,
+		Scopes:           key.Scopes,
+	}, nil
+}
+
+// createKey generates and stores a key for a service account
+func (s *ServiceAccountService) createKey(
+	ctx context.Context, account *domain.ServiceAccount, name string, scopes []string, expiresAt *time.Time,
+	clientCredentials bool,
+) (*domain.APIKey, string, error) {
+	secret, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	rawKey := domain.APIKeyPrefix + secret
+
+	key := &domain.APIKey{
+		ServiceAccountID:  account.ID,
+		Name:              name,
+		Prefix:            APIKeyPrefix(rawKey),
+		KeyHash:           authDomain.HashToken(rawKey),
+		Scopes:            scopes,
+		ClientCredentials: clientCredentials,
+		ExpiresAt:         expiresAt,
+	}
+	if err := s.accountRepo.CreateKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, rawKey, nil
+}
+
+// validateScopes checks requested scopes against the known ones and removes duplicates
+func validateScopes(requested []string) ([]string, error) {
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !slices.Contains(authDomain.TokenScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKeyScope, scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// generateToken generates a random opaque token
+func generateToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,216 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/acheevo/test/internal/auth/principal"
+	rbacService "github.com/acheevo/test/internal/rbac/service"
+	"github.com/acheevo/test/internal/serviceaccount/domain"
+	"github.com/acheevo/test/internal/serviceaccount/service"
+)
+
+// ServiceAccountHandler handles service account administration endpoints.
+// Access is checked by the auth middleware's RequirePermission.
+type ServiceAccountHandler struct {
+	serviceAccounts *service.ServiceAccountService
+	roleService     *rbacService.RoleService
+	logger          *zap.Logger
+}
+
+// NewServiceAccountHandler creates a new service account handler
+func NewServiceAccountHandler(
+	serviceAccounts *service.ServiceAccountService, roleService *rbacService.RoleService, logger *zap.Logger,
+) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		serviceAccounts: serviceAccounts,
+		roleService:     roleService,
+		logger:          logger,
+	}
+}
+
+// CreateServiceAccount creates a service account owned by the caller, who
+// must have every permission of its role
+func (h *ServiceAccountHandler) CreateServiceAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	caller, ok := principal.FromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+		return
+	}
+
+	var req domain.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.roleService.CheckGrant(ctx, caller, string(req.Role)); err != nil {
+		h.handleError(c, err, "Failed to create service account")
+		return
+	}
+
+	account, err := h.serviceAccounts.Create(ctx, req, caller.ID)
+	if err != nil {
+		h.handleError(c, err, "Failed to create service account")
+		return
+	}
+
+	h.logger.Info("Created service account",
+		zap.String("service_account_id", account.ID.String()), zap.String("owner_id", caller.ID.String()))
+	c.JSON(http.StatusCreated, account)
+}
+
+// ListServiceAccounts returns all service accounts
+func (h *ServiceAccountHandler) ListServiceAccounts(c *gin.Context) {
+	accounts, err := h.serviceAccounts.List(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err, "Failed to list service accounts")
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// GetServiceAccount returns a service account
+func (h *ServiceAccountHandler) GetServiceAccount(c *gin.Context) {
+	accountID, ok := targetAccount(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.serviceAccounts.Get(c.Request.Context(), accountID)
+	if err != nil {
+		h.handleError(c, err, "Failed to get service account")
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DeleteServiceAccount removes a service account and revokes its credentials
+func (h *ServiceAccountHandler) DeleteServiceAccount(c *gin.Context) {
+	accountID, ok := targetAccount(c)
+	if !ok {
+		return
+	}
+
+	if err := h.serviceAccounts.Delete(c.Request.Context(), accountID); err != nil {
+		h.handleError(c, err, "Failed to delete service account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted"})
+}
+
+// CreateKey issues an API key to a service account. The key is only ever
+// included in this response.
+func (h *ServiceAccountHandler) CreateKey(c *gin.Context) {
+	accountID, ok := targetAccount(c)
+	if !ok {
+		return
+	}
+
+	var req domain.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.serviceAccounts.CreateKey(c.Request.Context(), accountID, req)
+	if err != nil {
+		h.handleError(c, err, "Failed to create API key")
+		return
+	}
+
+	h.logger.Info("Created API key",
+		zap.String("key_prefix", created.Prefix), zap.String("service_account_id", accountID.String()))
+	c.JSON(http.StatusCreated, created)
+}
+
+// ListKeys returns a service account's API keys
+func (h *ServiceAccountHandler) ListKeys(c *gin.Context) {
+	accountID, ok := targetAccount(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.serviceAccounts.ListKeys(c.Request.Context(), accountID)
+	if err != nil {
+		h.handleError(c, err, "Failed to list API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeKey deletes one of a service account's API keys
+func (h *ServiceAccountHandler) RevokeKey(c *gin.Context) {
+	accountID, ok := targetAccount(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	if err := h.serviceAccounts.RevokeKey(c.Request.Context(), accountID, keyID); err != nil {
+		h.handleError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// RotateClientSecret replaces a service account's client secret. The secret
+// is only ever included in this response.
+func (h *ServiceAccountHandler) RotateClientSecret(c *gin.Context) {
+	accountID, ok := targetAccount(c)
+	if !ok {
+		return
+	}
+
+	credentials, err := h.serviceAccounts.RotateClientSecret(c.Request.Context(), accountID)
+	if err != nil {
+		h.handleError(c, err, "Failed to rotate client secret")
+		return
+	}
+
+	h.logger.Info("Rotated service account client secret", zap.String("service_account_id", accountID.String()))
+	c.JSON(http.StatusOK, credentials)
+}
+
+// handleError maps service account errors to responses
+func (h *ServiceAccountHandler) handleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidKeyScope), errors.Is(err, service.ErrInvalidKeyExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, rbacService.ErrCannotGrantRole), errors.Is(err, service.ErrOwnerNotFound):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrServiceAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// targetAccount returns the service account ID from the path
+func targetAccount(c *gin.Context) (uuid.UUID, bool) {
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return uuid.Nil, false
+	}
+	return accountID, true
+}
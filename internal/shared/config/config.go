@@ -1,15 +1,32 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
+// DefaultSessionSecret is the session secret configured by default.
+// Production deployments must set their own.
+const DefaultSessionSecret = "your-secret-key-change-in-production"
+
+// MinSecretLength is the length in bytes of the shortest secret accepted in
+// production
+const MinSecretLength = 32
+
 // Config holds all configuration for the application
 type Config struct {
 	HTTPAddr    string `envconfig:"HTTP_ADDR" default:":8080"`
 	LogLevel    string `envconfig:"LOG_LEVEL" default:"info"`
 	Environment string `envconfig:"ENVIRONMENT" default:"development"`
 
+	// Proxies, as IPs or CIDRs, whose X-Forwarded-For and X-Real-IP headers
+	// are believed for the client IP that rate limits and login throttling
+	// key on. None by default, so the client IP is the connection's address.
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
+
 	// Database configuration
 	DBHost     string `envconfig:"DB_HOST" default:"localhost"`
 	DBPort     string `envconfig:"DB_PORT" default:"5432"`
@@ -18,20 +35,183 @@ type Config struct {
 	DBName     string `envconfig:"DB_NAME" default:"testdb"`
 	DBSSLMode  string `envconfig:"DB_SSLMODE" default:"disable"`
 
-	// Session configuration
+	// Deadline of each database operation, on top of the request's own.
+	// Zero leaves operations bounded by the request only.
+	DBOperationTimeout time.Duration `envconfig:"DB_OPERATION_TIMEOUT" default:"5s"`
+	// How many times a transaction that conflicts with a concurrent one is run
+	// before giving up
+	DBTxAttempts int `envconfig:"DB_TX_ATTEMPTS" default:"3"`
+
+	// What the server does with pending schema migrations on startup: "apply"
+	// runs them, and "check" refuses to start until `migrate up` has
+	DBMigrationMode string `envconfig:"DB_MIGRATION_MODE" default:"apply"`
+
+	// Session configuration. SessionSecret signs HS256 access tokens, and
+	// encrypts TOTP secrets and OAuth signing keys unless they have their own key.
 	SessionSecret string `envconfig:"SESSION_SECRET" default:"your-secret-key-change-in-production"`
 
+	// Access token configuration
+	AccessTokenTTL time.Duration `envconfig:"ACCESS_TOKEN_TTL" default:"15m"`
+	JWTAlgorithm   string        `envconfig:"JWT_ALGORITHM" default:"HS256"`
+	JWTPrivateKey  string        `envconfig:"JWT_PRIVATE_KEY"` // base64-encoded Ed25519 seed, required for EdDSA
+
+	// Session lifetime configuration. Sessions expire after SessionIdleTTL without
+	// activity and never live longer than SessionMaxTTL. The role maps override
+	// both per role, e.g. SESSION_ROLE_MAX_TTL="admin:8h".
+	SessionIdleTTL     time.Duration            `envconfig:"SESSION_IDLE_TTL" default:"24h"`
+	SessionMaxTTL      time.Duration            `envconfig:"SESSION_MAX_TTL" default:"720h"`
+	SessionRoleIdleTTL map[string]time.Duration `envconfig:"SESSION_ROLE_IDLE_TTL"`
+	SessionRoleMaxTTL  map[string]time.Duration `envconfig:"SESSION_ROLE_MAX_TTL"`
+
+	// Minimum interval between session last-seen and expiry updates
+	SessionLastSeenInterval time.Duration `envconfig:"SESSION_LAST_SEEN_INTERVAL" default:"1m"`
+
+	// Failed login throttling. After LoginFreeAttempts failures each further
+	// failure blocks the account (and source IP) for an exponentially growing
+	// delay; reaching the max failures locks it out for LoginLockoutDuration.
+	// Failures older than LoginFailureWindow are forgotten.
+	LoginFreeAttempts    int           `envconfig:"LOGIN_FREE_ATTEMPTS" default:"3"`
+	LoginBackoffBase     time.Duration `envconfig:"LOGIN_BACKOFF_BASE" default:"1s"`
+	LoginBackoffMax      time.Duration `envconfig:"LOGIN_BACKOFF_MAX" default:"1m"`
+	LoginMaxFailures     int           `envconfig:"LOGIN_MAX_FAILURES" default:"10"`
+	LoginMaxIPFailures   int           `envconfig:"LOGIN_MAX_IP_FAILURES" default:"100"`
+	LoginLockoutDuration time.Duration `envconfig:"LOGIN_LOCKOUT_DURATION" default:"15m"`
+	LoginFailureWindow   time.Duration `envconfig:"LOGIN_FAILURE_WINDOW" default:"15m"`
+
+	// Rate limiting. Limits are "<requests>/<window>", e.g. "20/1m"; empty or "0"
+	// disables a group. The postgres store shares limits across replicas.
+	RateLimitStore     string `envconfig:"RATE_LIMIT_STORE" default:"memory"`
+	RateLimitAlgorithm string `envconfig:"RATE_LIMIT_ALGORITHM" default:"sliding_window"`
+	RateLimitAuth      string `envconfig:"RATE_LIMIT_AUTH" default:"20/1m"`
+	RateLimitAPI       string `envconfig:"RATE_LIMIT_API" default:"300/1m"`
+
+	// Two-factor authentication. Users whose role is listed in
+	// TwoFactorRequiredRoles must enroll in TOTP before they can log in. TOTP
+	// secrets are encrypted with a key derived from TwoFactorEncryptionKey,
+	// falling back to SessionSecret.
+	TwoFactorIssuer        string        `envconfig:"TWO_FACTOR_ISSUER" default:"test-api"`
+	TwoFactorChallengeTTL  time.Duration `envconfig:"TWO_FACTOR_CHALLENGE_TTL" default:"5m"`
+	TwoFactorRequiredRoles []string      `envconfig:"TWO_FACTOR_REQUIRED_ROLES"`
+	TwoFactorEncryptionKey string        `envconfig:"TWO_FACTOR_ENCRYPTION_KEY"`
+
+	// Passkey (WebAuthn) configuration. WebAuthnRPID is the domain passkeys are
+	// bound to and WebAuthnOrigins lists the origins allowed to use them.
+	WebAuthnRPID        string        `envconfig:"WEBAUTHN_RP_ID" default:"localhost"`
+	WebAuthnRPName      string        `envconfig:"WEBAUTHN_RP_NAME" default:"test-api"`
+	WebAuthnOrigins     []string      `envconfig:"WEBAUTHN_ORIGINS" default:"http://localhost:3000"`
+	WebAuthnCeremonyTTL time.Duration `envconfig:"WEBAUTHN_CEREMONY_TTL" default:"5m"`
+
+	// External OpenID Connect login providers, as a JSON object keyed by
+	// provider name. A provider's callback URL is OIDCCallbackURL/<name>/callback.
+	OIDCProviders   OIDCProviders `envconfig:"OIDC_PROVIDERS"`
+	OIDCCallbackURL string        `envconfig:"OIDC_CALLBACK_URL" default:"http://localhost:8080/api/auth/oidc"`
+	OIDCStateTTL    time.Duration `envconfig:"OIDC_STATE_TTL" default:"10m"`
+
+	// OpenID Connect provider configuration, for apps that delegate login to
+	// this service. Browsers starting an authorization are sent to
+	// OAuthConsentURL, which logs the user in and asks for consent. Signing
+	// keys are rotated every OAuthKeyRotationInterval and stay published for
+	// OAuthKeyRetention afterwards, so tokens they signed can still be verified.
+	// Private keys are encrypted with OAuthKeyEncryptionKey, falling back to SessionSecret.
+	OAuthIssuer              string        `envconfig:"OAUTH_ISSUER" default:"http://localhost:8080"`
+	OAuthConsentURL          string        `envconfig:"OAUTH_CONSENT_URL" default:"http://localhost:3000/oauth/consent"`
+	OAuthCodeTTL             time.Duration `envconfig:"OAUTH_CODE_TTL" default:"1m"`
+	OAuthAccessTokenTTL      time.Duration `envconfig:"OAUTH_ACCESS_TOKEN_TTL" default:"1h"`
+	OAuthIDTokenTTL          time.Duration `envconfig:"OAUTH_ID_TOKEN_TTL" default:"1h"`
+	OAuthKeyRotationInterval time.Duration `envconfig:"OAUTH_KEY_ROTATION_INTERVAL" default:"720h"`
+	OAuthKeyRetention        time.Duration `envconfig:"OAUTH_KEY_RETENTION" default:"24h"`
+	OAuthKeyEncryptionKey    string        `envconfig:"OAUTH_KEY_ENCRYPTION_KEY"`
+
+	// Password reset configuration. The emailed link is PasswordResetURL with
+	// the reset token appended as the "token" query parameter.
+	PasswordResetTTL time.Duration `envconfig:"PASSWORD_RESET_TTL" default:"1h"`
+	PasswordResetURL string        `envconfig:"PASSWORD_RESET_URL" default:"http://localhost:3000/reset-password"`
+
+	// Email verification configuration. The emailed link is EmailVerificationURL
+	// with the signed verification token appended as the "token" query parameter.
+	EmailVerificationTTL time.Duration `envconfig:"EMAIL_VERIFICATION_TTL" default:"48h"`
+	EmailVerificationURL string        `envconfig:"EMAIL_VERIFICATION_URL" default:"http://localhost:3000/verify-email"`
+
+	// Refuse logins from accounts that have not verified their email yet
+	RequireEmailVerification bool `envconfig:"REQUIRE_EMAIL_VERIFICATION" default:"false"`
+
+	// Outgoing mail configuration. MailDriver is "log" or "file"; the file
+	// driver writes each message to MailDir.
+	MailDriver string `envconfig:"MAIL_DRIVER" default:"log"`
+	MailFrom   string `envconfig:"MAIL_FROM" default:"no-reply@test.local"`
+	MailDir    string `envconfig:"MAIL_DIR" default:"tmp/mail"`
+
+	// Expired session cleanup configuration
+	SessionReaperInterval  time.Duration `envconfig:"SESSION_REAPER_INTERVAL" default:"10m"`
+	SessionReaperBatchSize int           `envconfig:"SESSION_REAPER_BATCH_SIZE" default:"1000"`
+
+	// Authorization policy file for user and session endpoints (see
+	// internal/policy/default_policy.json); the built-in policy is used if empty
+	PolicyFile string `envconfig:"POLICY_FILE"`
+
 	// Admin bootstrap configuration
 	AdminEmail    string `envconfig:"ADMIN_EMAIL" default:"admin@test.local"`
 	AdminPassword string `envconfig:"ADMIN_PASSWORD" default:"admin123"`
 	AdminName     string `envconfig:"ADMIN_NAME" default:"Administrator"`
 }
 
+// OIDCProvider configures one external OpenID Connect provider
+type OIDCProvider struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"` // defaults to openid, email and profile
+}
+
+// OIDCProviders maps provider names to their configuration
+type OIDCProviders map[string]OIDCProvider
+
+// Decode parses OIDC_PROVIDERS, e.g.
+// {"google":{"issuer":"https://accounts.google.com","client_id":"...","client_secret":"..."}}
+func (p *OIDCProviders) Decode(value string) error {
+	return json.Unmarshal([]byte(value), p)
+}
+
 // Parse loads configuration from environment variables
 func (c *Config) Parse() error {
 	return envconfig.Process("", c)
 }
 
+// CheckSecrets refuses, with ENVIRONMENT=production, to use the default
+// session secret or a secret shorter than MinSecretLength for signing access
+// tokens or encrypting TOTP secrets and OAuth signing keys
+func (c *Config) CheckSecrets() error {
+	if c.Environment != "production" {
+		return nil
+	}
+
+	type namedSecret struct{ name, value string }
+	var secrets []namedSecret
+	if c.JWTAlgorithm == "HS256" {
+		secrets = append(secrets, namedSecret{"SESSION_SECRET", c.SessionSecret})
+	}
+	for _, key := range []namedSecret{
+		{"TWO_FACTOR_ENCRYPTION_KEY", c.TwoFactorEncryptionKey},
+		{"OAUTH_KEY_ENCRYPTION_KEY", c.OAuthKeyEncryptionKey},
+	} {
+		if key.value == "" {
+			key = namedSecret{"SESSION_SECRET, which " + key.name + " falls back to,", c.SessionSecret}
+		}
+		secrets = append(secrets, key)
+	}
+
+	for _, secret := range secrets {
+		if secret.value == DefaultSessionSecret {
+			return fmt.Errorf("refusing to start in production: %s is the default secret", secret.name)
+		}
+		if len(secret.value) < MinSecretLength {
+			return fmt.Errorf("refusing to start in production: %s must be at least %d bytes",
+				secret.name, MinSecretLength)
+		}
+	}
+	return nil
+}
+
 // GetDSN returns the database connection string
 func (c *Config) GetDSN() string {
 	host := c.DBHost
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSecrets(t *testing.T) {
+	strong := strings.Repeat("s", MinSecretLength)
+	production := func(change func(cfg *Config)) *Config {
+		cfg := &Config{Environment: "production", JWTAlgorithm: "HS256", SessionSecret: strong}
+		change(cfg)
+		return cfg
+	}
+
+	t.Run("Accepts Strong Secrets", func(t *testing.T) {
+		assert.NoError(t, production(func(cfg *Config) {}).CheckSecrets())
+	})
+
+	t.Run("Refuses The Default Session Secret", func(t *testing.T) {
+		err := production(func(cfg *Config) { cfg.SessionSecret = DefaultSessionSecret }).CheckSecrets()
+		assert.ErrorContains(t, err, "SESSION_SECRET is the default secret")
+	})
+
+	t.Run("Refuses Empty And Short Session Secrets", func(t *testing.T) {
+		for _, secret := range []string{"", strong[1:]} {
+			err := production(func(cfg *Config) { cfg.SessionSecret = secret }).CheckSecrets()
+			assert.ErrorContains(t, err, "SESSION_SECRET must be at least 32 bytes")
+		}
+	})
+
+	t.Run("Refuses Encryption Keys Falling Back To A Weak Session Secret", func(t *testing.T) {
+		err := production(func(cfg *Config) {
+			cfg.JWTAlgorithm = "EdDSA"
+			cfg.SessionSecret = DefaultSessionSecret
+			cfg.TwoFactorEncryptionKey = strong
+		}).CheckSecrets()
+		assert.ErrorContains(t, err, "OAUTH_KEY_ENCRYPTION_KEY falls back to")
+
+		err = production(func(cfg *Config) {
+			cfg.JWTAlgorithm = "EdDSA"
+			cfg.SessionSecret = ""
+			cfg.TwoFactorEncryptionKey = strong
+			cfg.OAuthKeyEncryptionKey = strong
+		}).CheckSecrets()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Refuses Short Encryption Keys", func(t *testing.T) {
+		err := production(func(cfg *Config) { cfg.TwoFactorEncryptionKey = "change-me" }).CheckSecrets()
+		assert.ErrorContains(t, err, "TWO_FACTOR_ENCRYPTION_KEY must be at least 32 bytes")
+	})
+
+	t.Run("Allows Any Secret Outside Production", func(t *testing.T) {
+		cfg := &Config{Environment: "development", JWTAlgorithm: "HS256", SessionSecret: DefaultSessionSecret}
+		assert.NoError(t, cfg.CheckSecrets())
+	})
+}
@@ -1,21 +1,26 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-
-	authDomain "github.com/acheevo/test/internal/auth/domain"
-	userDomain "github.com/acheevo/test/internal/user/domain"
 )
 
 // Database represents the database connection and operations
 type Database struct {
 	DB *gorm.DB
+
+	// operationTimeout bounds each operation started with Operation
+	operationTimeout time.Duration
 }
 
-// NewDatabase creates a new database connection
-func NewDatabase(dsn string) (*Database, error) {
+// NewDatabase creates a new database connection whose operations time out
+// after operationTimeout, or only with their context if it is zero. The
+// schema is managed by Migrator.
+func NewDatabase(dsn string, operationTimeout time.Duration) (*Database, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
@@ -23,18 +28,66 @@ func NewDatabase(dsn string) (*Database, error) {
 		return nil, err
 	}
 
-	// Enable uuid-ossp extension for PostgreSQL
-	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error; err != nil {
-		// Log warning but don't fail - some databases might not support this
-		// or might have it enabled already
+	return &Database{DB: db, operationTimeout: operationTimeout}, nil
+}
+
+// Operation starts a database operation bound to ctx and the operation
+// timeout, so that queries are canceled along with the request that made
+// them. done must be called once the operation has finished.
+func (d *Database) Operation(ctx context.Context) (db *gorm.DB, done context.CancelFunc) {
+	if d.operationTimeout > 0 {
+		ctx, done = context.WithTimeout(ctx, d.operationTimeout)
+	} else {
+		ctx, done = context.WithCancel(ctx)
 	}
+	return d.DB.WithContext(ctx), done
+}
 
-	// Auto-migrate the schema
-	if err := db.AutoMigrate(&userDomain.User{}, &authDomain.Session{}); err != nil {
-		return nil, err
+// WithAdvisoryLock runs fn while holding the Postgres session-level advisory lock key.
+// The lock is taken on a dedicated connection so it is released on the same one.
+// If another session holds the lock, fn is not run and acquired is false.
+func (d *Database) WithAdvisoryLock(ctx context.Context, key int64, fn func() error) (acquired bool, err error) {
+	return d.withAdvisoryLock(ctx, "SELECT pg_try_advisory_lock($1)", key, fn)
+}
+
+// WaitForAdvisoryLock runs fn while holding the Postgres session-level
+// advisory lock key, first waiting for any other session holding it to
+// release it
+func (d *Database) WaitForAdvisoryLock(ctx context.Context, key int64, fn func() error) error {
+	_, err := d.withAdvisoryLock(ctx, "SELECT true FROM pg_advisory_lock($1)", key, fn)
+	return err
+}
+
+// withAdvisoryLock takes the lock with query, which reports whether it was acquired
+func (d *Database) withAdvisoryLock(
+	ctx context.Context, query string, key int64, fn func() error,
+) (acquired bool, err error) {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := conn.QueryRowContext(ctx, query, key).Scan(&acquired); err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
 	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was canceled
+		_, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		if unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
 
-	return &Database{DB: db}, nil
+	return true, fn()
 }
 
 // Close closes the database connection
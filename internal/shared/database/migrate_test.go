@@ -0,0 +1,71 @@
+package database
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rbacDomain "github.com/acheevo/test/internal/rbac/domain"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(script string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(script)} }
+
+	t.Run("Valid", func(t *testing.T) {
+		migrations, err := LoadMigrations(fstest.MapFS{
+			"0010_add_locale.up.sql":   file("ALTER TABLE users ADD COLUMN locale text;"),
+			"0010_add_locale.down.sql": file("ALTER TABLE users DROP COLUMN locale;"),
+			"0002_roles.up.sql":        file("CREATE TABLE roles ();"),
+			"0002_roles.down.sql":      file("DROP TABLE roles;"),
+		})
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+
+		assert.Equal(t, int64(2), migrations[0].Version)
+		assert.Equal(t, "0002_roles", migrations[0].String())
+		assert.Equal(t, "CREATE TABLE roles ();", migrations[0].Up)
+		assert.Equal(t, "DROP TABLE roles;", migrations[0].Down)
+		assert.Equal(t, "0010_add_locale", migrations[1].String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, fsys := range map[string]fstest.MapFS{
+			"no down script": {"0001_init.up.sql": file("SELECT 1;")},
+			"no up script":   {"0001_init.down.sql": file("SELECT 1;")},
+			"empty script":   {"0001_init.up.sql": file(""), "0001_init.down.sql": file("SELECT 1;")},
+			"bad name":       {"0001-init.up.sql": file("SELECT 1;")},
+			"no version":     {"init.up.sql": file("SELECT 1;")},
+			"version zero":   {"0000_init.up.sql": file("SELECT 1;"), "0000_init.down.sql": file("SELECT 1;")},
+			"two names":      {"0001_init.up.sql": file("SELECT 1;"), "0001_other.down.sql": file("SELECT 1;")},
+			"other file":     {"README.md": file("# Migrations")},
+		} {
+			_, err := LoadMigrations(fsys)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	require.NoError(t, err)
+	migrations, err := LoadMigrations(files)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, int64(i+1), migration.Version, "versions have no gaps")
+	}
+
+	// Every permission is granted to the admin role by some migration
+	var scripts strings.Builder
+	for _, migration := range migrations {
+		scripts.WriteString(migration.Up)
+	}
+	for _, permission := range rbacDomain.Permissions {
+		assert.Contains(t, scripts.String(), `"`+permission+`"`, permission)
+	}
+}
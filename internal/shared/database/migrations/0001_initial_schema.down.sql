@@ -0,0 +1,24 @@
+-- Drops every table, and all data with them.
+
+DROP TABLE IF EXISTS rate_limits;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS service_account_keys;
+DROP TABLE IF EXISTS service_accounts;
+DROP TABLE IF EXISTS oauth_signing_keys;
+DROP TABLE IF EXISTS oauth_access_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS identities;
+DROP TABLE IF EXISTS webauthn_ceremonies;
+DROP TABLE IF EXISTS webauthn_credentials;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_credentials;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,326 @@
+-- Baseline schema. Databases created by the AutoMigrate releases already have
+-- some of these tables, so everything is created only if missing, and the
+-- tables of the earliest releases are upgraded before they are indexed.
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid,
+    email text,
+    password text,
+    name text,
+    role text,
+    email_verified boolean NOT NULL DEFAULT false,
+    verified_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid,
+    user_id uuid NOT NULL,
+    token_hash text,
+    ip_address text,
+    user_agent text,
+    device text,
+    browser text,
+    location text,
+    last_seen_at timestamptz,
+    expires_at timestamptz,
+    absolute_expires_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id uuid,
+    session_id uuid NOT NULL,
+    token_hash text,
+    rotated_at timestamptz,
+    expires_at timestamptz,
+    PRIMARY KEY (id)
+);
+
+-- Columns added since the first releases. Sessions from before activity and
+-- absolute lifetimes were tracked keep them empty, which the server handles.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at timestamptz;
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS token_hash text,
+    ADD COLUMN IF NOT EXISTS ip_address text,
+    ADD COLUMN IF NOT EXISTS user_agent text,
+    ADD COLUMN IF NOT EXISTS device text,
+    ADD COLUMN IF NOT EXISTS browser text,
+    ADD COLUMN IF NOT EXISTS location text,
+    ADD COLUMN IF NOT EXISTS last_seen_at timestamptz,
+    ADD COLUMN IF NOT EXISTS absolute_expires_at timestamptz;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS token_hash text;
+
+DO $$
+BEGIN
+    -- Accounts that predate email verification count as verified
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'email_verified'
+    ) THEN
+        ALTER TABLE users ADD COLUMN email_verified boolean NOT NULL DEFAULT false;
+        UPDATE users SET email_verified = true, verified_at = created_at;
+    END IF;
+
+    -- Replace plaintext tokens with their digests, which match
+    -- domain.HashToken: lowercase hex SHA-256
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'sessions' AND column_name = 'token'
+    ) THEN
+        UPDATE sessions SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex')
+        WHERE token_hash IS NULL OR token_hash = '';
+        ALTER TABLE sessions DROP COLUMN token;
+    END IF;
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'refresh_tokens' AND column_name = 'token'
+    ) THEN
+        UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex')
+        WHERE token_hash IS NULL OR token_hash = '';
+        ALTER TABLE refresh_tokens DROP COLUMN token;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key text,
+    failures bigint,
+    last_failure_at timestamptz,
+    blocked_until timestamptz,
+    PRIMARY KEY (key)
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id uuid,
+    user_id uuid NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    user_id uuid,
+    secret text NOT NULL,
+    confirmed_at timestamptz,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id uuid,
+    user_id uuid NOT NULL,
+    code_hash text NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id uuid,
+    user_id uuid NOT NULL,
+    name text,
+    credential_id bytea NOT NULL,
+    public_key bytea NOT NULL,
+    attestation_type text,
+    aa_guid bytea,
+    transports text,
+    sign_count bigint NOT NULL DEFAULT 0,
+    backup_eligible boolean,
+    backup_state boolean,
+    last_used_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webauthn_credentials_credential_id ON webauthn_credentials (credential_id);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_ceremonies (
+    id uuid,
+    user_id uuid,
+    kind text NOT NULL,
+    data bytea NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_ceremonies_expires_at ON webauthn_ceremonies (expires_at);
+
+CREATE TABLE IF NOT EXISTS identities (
+    id uuid,
+    user_id uuid NOT NULL,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    last_login_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_provider_subject ON identities (provider,subject);
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash text,
+    provider text NOT NULL,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (state_hash)
+);
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states (expires_at);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id uuid,
+    user_id uuid NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    token_hash text NOT NULL,
+    scopes text NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip text,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id uuid,
+    name text NOT NULL,
+    secret_hash text,
+    redirect_uris text NOT NULL,
+    public boolean NOT NULL DEFAULT false,
+    created_by uuid,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id uuid,
+    client_id uuid,
+    scope text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (user_id,client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash text,
+    client_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    redirect_uri text NOT NULL,
+    scope text NOT NULL,
+    nonce text,
+    code_challenge text,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (code_hash)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes (expires_at);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_user_id ON oauth_authorization_codes (user_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_client_id ON oauth_authorization_codes (client_id);
+
+CREATE TABLE IF NOT EXISTS oauth_access_tokens (
+    token_hash text,
+    client_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    scope text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (token_hash)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_access_tokens_expires_at ON oauth_access_tokens (expires_at);
+CREATE INDEX IF NOT EXISTS idx_oauth_access_tokens_user_id ON oauth_access_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_access_tokens_client_id ON oauth_access_tokens (client_id);
+
+CREATE TABLE IF NOT EXISTS oauth_signing_keys (
+    id text,
+    algorithm text NOT NULL,
+    private_key text NOT NULL,
+    public_key text NOT NULL,
+    created_at timestamptz,
+    retired_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_signing_keys_retired_at ON oauth_signing_keys (retired_at);
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id uuid,
+    name text NOT NULL,
+    description text,
+    role text NOT NULL,
+    owner_id uuid NOT NULL,
+    client_secret_hash text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_service_accounts_owner_id ON service_accounts (owner_id);
+
+CREATE TABLE IF NOT EXISTS service_account_keys (
+    id uuid,
+    service_account_id uuid NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    key_hash text NOT NULL,
+    scopes text NOT NULL,
+    client_credentials boolean NOT NULL DEFAULT false,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip text,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_account_keys_key_hash ON service_account_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_service_account_keys_service_account_id ON service_account_keys (service_account_id);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id uuid,
+    name text NOT NULL,
+    description text,
+    permissions text NOT NULL,
+    builtin boolean NOT NULL DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles (name);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id uuid,
+    role_id uuid,
+    created_at timestamptz,
+    PRIMARY KEY (user_id,role_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles (role_id);
+
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key text,
+    value decimal NOT NULL,
+    previous decimal NOT NULL,
+    timestamp timestamptz NOT NULL,
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (key)
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limits_expires_at ON rate_limits (expires_at);
@@ -0,0 +1,15 @@
+-- The built-in roles matching the user roles. Migrations that add permissions
+-- must grant them to the admin role as well.
+INSERT INTO roles (id, name, description, permissions, builtin, created_at, updated_at)
+VALUES
+    (
+        gen_random_uuid(), 'admin', 'Full access to every user and administration endpoint',
+        '["users:read","users:write","sessions:read","sessions:revoke","roles:read","roles:write","service_accounts:read","service_accounts:write","oauth_clients:read","oauth_clients:write","maintenance:read"]',
+        true, now(), now()
+    ),
+    (gen_random_uuid(), 'user', 'Access to the user''s own account only', '[]', true, now(), now())
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    permissions = EXCLUDED.permissions,
+    builtin = EXCLUDED.builtin,
+    updated_at = EXCLUDED.updated_at;
@@ -0,0 +1,4 @@
+-- The password hash the admin bootstrap last applied. The bootstrap only
+-- rotates the admin's password when ADMIN_PASSWORD no longer matches it, so a
+-- password the admin has changed since is left alone.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bootstrap_password text NOT NULL DEFAULT '';
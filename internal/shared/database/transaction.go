@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// retryBackoff is how long RetryOnSerializationFailure waits after the first
+// failed attempt. Later attempts wait proportionally longer, plus jitter.
+const retryBackoff = 10 * time.Millisecond
+
+// Transaction runs fn in a serializable transaction, passing it a Database
+// whose operations all run in that transaction. The transaction is committed
+// if fn returns nil and rolled back otherwise. Transactions started within fn
+// become savepoints.
+func (d *Database) Transaction(ctx context.Context, fn func(tx *Database) error) error {
+	return d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{DB: tx, operationTimeout: d.operationTimeout})
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+}
+
+// IsSerializationFailure reports whether err is Postgres aborting a
+// transaction that conflicted with a concurrent one, which succeeds if retried
+func IsSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	// serialization_failure and deadlock_detected
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+// RetryOnSerializationFailure calls fn until it does not fail with a
+// serialization failure, at most attempts times. It waits a little longer
+// after each failure, and gives up early if ctx is done.
+func RetryOnSerializationFailure(ctx context.Context, attempts int, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !IsSerializationFailure(err) {
+			return err
+		}
+
+		backoff := time.Duration(attempt)*retryBackoff + time.Duration(rand.Int63n(int64(retryBackoff)))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSerializationFailure(t *testing.T) {
+	assert.True(t, IsSerializationFailure(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, IsSerializationFailure(&pgconn.PgError{Code: "40P01"}))
+	assert.True(t, IsSerializationFailure(fmt.Errorf("commit: %w", &pgconn.PgError{Code: "40001"})))
+	assert.False(t, IsSerializationFailure(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, IsSerializationFailure(errors.New("serialization failure")))
+	assert.False(t, IsSerializationFailure(nil))
+}
+
+func TestRetryOnSerializationFailure(t *testing.T) {
+	ctx := context.Background()
+	conflict := &pgconn.PgError{Code: "40001"}
+
+	t.Run("Retries Until Success", func(t *testing.T) {
+		calls := 0
+		err := RetryOnSerializationFailure(ctx, 3, func() error {
+			calls++
+			if calls < 3 {
+				return conflict
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Gives Up After Attempts", func(t *testing.T) {
+		calls := 0
+		err := RetryOnSerializationFailure(ctx, 3, func() error {
+			calls++
+			return conflict
+		})
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Other Errors Are Not Retried", func(t *testing.T) {
+		calls := 0
+		failure := errors.New("failure")
+		err := RetryOnSerializationFailure(ctx, 3, func() error {
+			calls++
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Stops When The Context Is Done", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		calls := 0
+		err := RetryOnSerializationFailure(cancelled, 3, func() error {
+			calls++
+			cancel()
+			return conflict
+		})
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,1237 @@
+// Package storetest is a conformance suite for the store implementations,
+// such as UserStore and SessionStore, and the unit of work managers over them. Every
+// implementation must pass it, so that tests using the in-memory stores
+// exercise the same behavior as Postgres.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// Stores are the stores under test. UnitOfWork must run units of work over
+// Users, Sessions, PasswordResets and LoginAttempts.
+type Stores struct {
+	Users          userRepository.UserStore
+	Sessions       authRepository.SessionStore
+	PasswordResets authRepository.PasswordResetStore
+	LoginAttempts  authRepository.LoginAttemptStore
+	TwoFactor      authRepository.TwoFactorStore
+	Passkeys       authRepository.PasskeyStore
+	AccessTokens   authRepository.PersonalAccessTokenStore
+	UnitOfWork     unitofwork.Manager
+}
+
+// Run runs the conformance suite. newStores is called for every test and
+// must return empty stores.
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("UserStore", func(t *testing.T) { runUserStore(t, newStores) })
+	t.Run("SessionStore", func(t *testing.T) { runSessionStore(t, newStores) })
+	t.Run("PasswordResetStore", func(t *testing.T) { runPasswordResetStore(t, newStores) })
+	t.Run("LoginAttemptStore", func(t *testing.T) { runLoginAttemptStore(t, newStores) })
+	t.Run("TwoFactorStore", func(t *testing.T) { runTwoFactorStore(t, newStores) })
+	t.Run("PasskeyStore", func(t *testing.T) { runPasskeyStore(t, newStores) })
+	t.Run("PersonalAccessTokenStore", func(t *testing.T) { runPersonalAccessTokenStore(t, newStores) })
+	t.Run("UnitOfWork", func(t *testing.T) { runUnitOfWork(t, newStores) })
+}
+
+func runUserStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+
+	t.Run("Create And Get", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user := newUser("create@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, user))
+		assert.NotEqual(t, uuid.Nil, user.ID)
+		assert.False(t, user.CreatedAt.IsZero())
+
+		byID, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		require.NotNil(t, byID)
+		assertSameUser(t, user, byID)
+
+		byEmail, err := users.GetByEmail(ctx, "create@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, byEmail)
+		assertSameUser(t, user, byEmail)
+
+		// Changing a returned user does not change the stored one
+		byID.Name = "Changed"
+		again, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.Name, again.Name)
+	})
+
+	t.Run("Missing Users Are Nil", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user, err := users.GetByID(ctx, uuid.New())
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		user, err = users.GetByEmail(ctx, "missing@example.com")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		all, err := users.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, all)
+	})
+
+	t.Run("Emails Are Unique", func(t *testing.T) {
+		users := newStores(t).Users
+
+		first := newUser("first@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, first))
+		assert.Error(t, users.Create(ctx, newUser("first@example.com", userDomain.RoleUser)))
+
+		second := newUser("second@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, second))
+		second.Email = "first@example.com"
+		assert.Error(t, users.Update(ctx, second))
+	})
+
+	t.Run("GetAll", func(t *testing.T) {
+		users := newStores(t).Users
+
+		a := newUser("a@example.com", userDomain.RoleUser)
+		b := newUser("b@example.com", userDomain.RoleAdmin)
+		require.NoError(t, users.Create(ctx, a))
+		require.NoError(t, users.Create(ctx, b))
+
+		all, err := users.GetAll(ctx)
+		require.NoError(t, err)
+		ids := make([]uuid.UUID, 0, len(all))
+		for _, user := range all {
+			ids = append(ids, user.ID)
+		}
+		assert.ElementsMatch(t, []uuid.UUID{a.ID, b.ID}, ids)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user := newUser("update@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, user))
+		createdAt := user.UpdatedAt
+
+		user.Name = "Renamed"
+		user.Email = "renamed@example.com"
+		require.NoError(t, users.Update(ctx, user))
+		assert.True(t, user.UpdatedAt.After(createdAt))
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assertSameUser(t, user, stored)
+
+		old, err := users.GetByEmail(ctx, "update@example.com")
+		require.NoError(t, err)
+		assert.Nil(t, old)
+	})
+
+	t.Run("SetPassword", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user := newUser("password@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, user))
+
+		require.NoError(t, users.SetPassword(ctx, user.ID, "new-hash"))
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "new-hash", stored.Password)
+	})
+
+	t.Run("SetBootstrapPassword", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user := newUser("bootstrap@example.com", userDomain.RoleAdmin)
+		require.NoError(t, users.Create(ctx, user))
+
+		require.NoError(t, users.SetBootstrapPassword(ctx, user.ID, "bootstrap-hash"))
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "bootstrap-hash", stored.BootstrapPassword)
+		assert.Equal(t, user.Password, stored.Password)
+	})
+
+	t.Run("HasAdmin", func(t *testing.T) {
+		users := newStores(t).Users
+
+		hasAdmin, err := users.HasAdmin(ctx)
+		require.NoError(t, err)
+		assert.False(t, hasAdmin)
+
+		require.NoError(t, users.Create(ctx, newUser("user@example.com", userDomain.RoleUser)))
+		hasAdmin, err = users.HasAdmin(ctx)
+		require.NoError(t, err)
+		assert.False(t, hasAdmin)
+
+		require.NoError(t, users.Create(ctx, newUser("admin@example.com", userDomain.RoleAdmin)))
+		hasAdmin, err = users.HasAdmin(ctx)
+		require.NoError(t, err)
+		assert.True(t, hasAdmin)
+	})
+
+	t.Run("MarkEmailVerified", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user := newUser("verify@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, user))
+		at := time.Now().Truncate(time.Second)
+
+		updated, err := users.MarkEmailVerified(ctx, user.ID, "old@example.com", at)
+		require.NoError(t, err)
+		assert.False(t, updated, "the email has changed since")
+
+		updated, err = users.MarkEmailVerified(ctx, user.ID, "verify@example.com", at)
+		require.NoError(t, err)
+		assert.True(t, updated)
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, stored.EmailVerified)
+		require.NotNil(t, stored.VerifiedAt)
+		assert.True(t, stored.VerifiedAt.Equal(at))
+
+		updated, err = users.MarkEmailVerified(ctx, user.ID, "verify@example.com", at)
+		require.NoError(t, err)
+		assert.False(t, updated, "already verified")
+	})
+
+	t.Run("UpdateRole", func(t *testing.T) {
+		users := newStores(t).Users
+
+		admin := newUser("admin@example.com", userDomain.RoleAdmin)
+		require.NoError(t, users.Create(ctx, admin))
+
+		admin.Role = userDomain.RoleUser
+		updated, err := users.UpdateRole(ctx, admin)
+		require.NoError(t, err)
+		assert.False(t, updated, "the last admin cannot be demoted")
+		stored, err := users.GetByID(ctx, admin.ID)
+		require.NoError(t, err)
+		assert.Equal(t, userDomain.RoleAdmin, stored.Role)
+
+		require.NoError(t, users.Create(ctx, newUser("other-admin@example.com", userDomain.RoleAdmin)))
+		updated, err = users.UpdateRole(ctx, admin)
+		require.NoError(t, err)
+		assert.True(t, updated)
+		stored, err = users.GetByID(ctx, admin.ID)
+		require.NoError(t, err)
+		assert.Equal(t, userDomain.RoleUser, stored.Role)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		users := newStores(t).Users
+
+		admin := newUser("admin@example.com", userDomain.RoleAdmin)
+		require.NoError(t, users.Create(ctx, admin))
+		deleted, err := users.Delete(ctx, admin.ID)
+		require.NoError(t, err)
+		assert.False(t, deleted, "the last admin cannot be deleted")
+
+		user := newUser("delete@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, user))
+
+		deleted, err = users.Delete(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+
+		stored, err = users.GetByID(ctx, admin.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, stored)
+	})
+
+	t.Run("Concurrent Deletes Keep An Admin", func(t *testing.T) {
+		users := newStores(t).Users
+
+		admins := make([]*userDomain.User, 4)
+		for i := range admins {
+			admins[i] = newUser(fmt.Sprintf("admin%d@example.com", i), userDomain.RoleAdmin)
+			require.NoError(t, users.Create(ctx, admins[i]))
+		}
+
+		var wg sync.WaitGroup
+		for _, admin := range admins {
+			wg.Add(1)
+			go func(id uuid.UUID) {
+				defer wg.Done()
+				_, err := users.Delete(ctx, id)
+				assert.NoError(t, err)
+			}(admin.ID)
+		}
+		wg.Wait()
+
+		hasAdmin, err := users.HasAdmin(ctx)
+		require.NoError(t, err)
+		assert.True(t, hasAdmin)
+	})
+
+	t.Run("Cancelled Context", func(t *testing.T) {
+		users := newStores(t).Users
+
+		user := newUser("cancelled@example.com", userDomain.RoleUser)
+		require.NoError(t, users.Create(ctx, user))
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := users.GetByID(cancelled, user.ID)
+		assert.ErrorIs(t, err, context.Canceled)
+		_, err = users.Delete(cancelled, user.ID)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		stored, err := users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, stored)
+	})
+}
+
+func runSessionStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("Create And Get", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		session := newSession(userID, "create-token", time.Hour)
+		require.NoError(t, sessions.Create(ctx, session))
+		assert.NotEqual(t, uuid.Nil, session.ID)
+
+		byToken := getByToken(t, sessions, "create-token")
+		require.NotNil(t, byToken)
+		assert.Equal(t, session.ID, byToken.ID)
+		assert.Equal(t, userID, byToken.UserID)
+		assert.Equal(t, "Firefox", byToken.Browser)
+
+		byID, err := sessions.GetByID(ctx, session.ID)
+		require.NoError(t, err)
+		require.NotNil(t, byID)
+		assert.Equal(t, session.ID, byID.ID)
+
+		assert.Error(t, sessions.Create(ctx, newSession(userID, "create-token", time.Hour)), "tokens are unique")
+	})
+
+	t.Run("Expired And Missing Sessions Are Nil", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		expired := newSession(userID, "expired-token", -time.Minute)
+		require.NoError(t, sessions.Create(ctx, expired))
+
+		assert.Nil(t, getByToken(t, sessions, "expired-token"))
+		session, err := sessions.GetByID(ctx, expired.ID)
+		require.NoError(t, err)
+		assert.Nil(t, session)
+		session, err = sessions.GetByID(ctx, uuid.New())
+		require.NoError(t, err)
+		assert.Nil(t, session)
+
+		list, err := sessions.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("GetByUserID Lists The Newest First", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		first := newSession(userID, "first-token", time.Hour)
+		require.NoError(t, sessions.Create(ctx, first))
+		time.Sleep(10 * time.Millisecond)
+		second := newSession(userID, "second-token", time.Hour)
+		require.NoError(t, sessions.Create(ctx, second))
+		require.NoError(t, sessions.Create(ctx, newSession(uuid.New(), "other-token", time.Hour)))
+
+		list, err := sessions.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, second.ID, list[0].ID)
+		assert.Equal(t, first.ID, list[1].ID)
+	})
+
+	t.Run("RotateToken", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		session := newSession(userID, "old-token", time.Hour)
+		session.AbsoluteExpiresAt = time.Now().Add(24 * time.Hour)
+		require.NoError(t, sessions.Create(ctx, session))
+		expiresAt := time.Now().Add(2 * time.Hour)
+
+		rotated, err := sessions.RotateToken(ctx, session, "old-token", "new-token", expiresAt)
+		require.NoError(t, err)
+		assert.True(t, rotated)
+		assert.Equal(t, authDomain.HashToken("new-token"), session.TokenHash)
+		assert.True(t, session.ExpiresAt.Equal(expiresAt))
+
+		assert.Nil(t, getByToken(t, sessions, "old-token"))
+		current := getByToken(t, sessions, "new-token")
+		require.NotNil(t, current)
+		assert.Equal(t, session.ID, current.ID)
+		assert.WithinDuration(t, expiresAt, current.ExpiresAt, time.Millisecond)
+
+		spent, err := sessions.GetRotatedToken(ctx, "old-token")
+		require.NoError(t, err)
+		require.NotNil(t, spent)
+		assert.Equal(t, session.ID, spent.SessionID)
+		// The spent token is kept as long as the session can live, not just its idle expiry
+		assert.WithinDuration(t, session.AbsoluteExpiresAt, spent.ExpiresAt, time.Millisecond)
+
+		// A second rotation with the same token loses the race
+		rotated, err = sessions.RotateToken(ctx, session, "old-token", "newer-token", expiresAt)
+		require.NoError(t, err)
+		assert.False(t, rotated)
+		assert.Nil(t, getByToken(t, sessions, "newer-token"))
+
+		spent, err = sessions.GetRotatedToken(ctx, "new-token")
+		require.NoError(t, err)
+		assert.Nil(t, spent)
+	})
+
+	t.Run("Concurrent Rotations Of A Token", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		session := newSession(userID, "contested-token", time.Hour)
+		require.NoError(t, sessions.Create(ctx, session))
+
+		var wg sync.WaitGroup
+		var wins atomic.Int32
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				copied := *session
+				rotated, err := sessions.RotateToken(ctx, &copied, "contested-token", fmt.Sprintf("winner-%d", i),
+					time.Now().Add(time.Hour))
+				if err == nil && rotated {
+					wins.Add(1)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Losers either see the new token or fail on the spent token's unique digest
+		assert.Equal(t, int32(1), wins.Load())
+	})
+
+	t.Run("RecordActivity", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		session := newSession(userID, "activity-token", time.Hour)
+		session.LastSeenAt = time.Now().Add(-time.Minute)
+		require.NoError(t, sessions.Create(ctx, session))
+
+		// Activity recorded after since is left alone
+		seenAt := time.Now()
+		require.NoError(t, sessions.RecordActivity(ctx, session.ID, seenAt, seenAt.Add(3*time.Hour), seenAt.Add(-time.Hour)))
+		stored := getByToken(t, sessions, "activity-token")
+		assert.WithinDuration(t, session.ExpiresAt, stored.ExpiresAt, time.Millisecond)
+
+		require.NoError(t, sessions.RecordActivity(ctx, session.ID, seenAt, seenAt.Add(3*time.Hour), seenAt))
+		stored = getByToken(t, sessions, "activity-token")
+		assert.WithinDuration(t, seenAt, stored.LastSeenAt, time.Millisecond)
+		assert.WithinDuration(t, seenAt.Add(3*time.Hour), stored.ExpiresAt, time.Millisecond)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		byToken := newSession(userID, "by-token", time.Hour)
+		byID := newSession(userID, "by-id", time.Hour)
+		kept := newSession(uuid.New(), "kept", time.Hour)
+		for _, session := range []*authDomain.Session{byToken, byID, kept} {
+			require.NoError(t, sessions.Create(ctx, session))
+		}
+		rotated, err := sessions.RotateToken(ctx, byID, "by-id", "by-id-rotated", time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.True(t, rotated)
+
+		require.NoError(t, sessions.DeleteByToken(ctx, "by-token"))
+		assert.Nil(t, getByToken(t, sessions, "by-token"))
+
+		require.NoError(t, sessions.DeleteByID(ctx, byID.ID))
+		assert.Nil(t, getByToken(t, sessions, "by-id-rotated"))
+		spent, err := sessions.GetRotatedToken(ctx, "by-id")
+		require.NoError(t, err)
+		assert.Nil(t, spent, "the refresh token family is deleted with the session")
+
+		assert.NotNil(t, getByToken(t, sessions, "kept"))
+	})
+
+	t.Run("DeleteByUserID", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		createSession(t, sessions, userID, time.Hour)
+		createSession(t, sessions, userID, time.Hour)
+		kept := createSession(t, sessions, uuid.New(), time.Hour)
+
+		deleted, err := sessions.DeleteByUserID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+
+		list, err := sessions.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+		assert.NotNil(t, getByToken(t, sessions, kept))
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		sessions := newStores(t).Sessions
+
+		for i := 0; i < 3; i++ {
+			createSession(t, sessions, userID, -time.Minute)
+		}
+		live := createSession(t, sessions, userID, time.Hour)
+
+		// A spent token whose session expired has expired as well
+		expiring := newSession(userID, "expiring", time.Millisecond)
+		require.NoError(t, sessions.Create(ctx, expiring))
+		rotated, err := sessions.RotateToken(ctx, expiring, "expiring", "expiring-rotated", time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.True(t, rotated)
+		time.Sleep(10 * time.Millisecond)
+
+		deletedSessions, deletedTokens, err := sessions.DeleteExpired(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deletedSessions)
+		assert.Equal(t, int64(1), deletedTokens)
+
+		deletedSessions, deletedTokens, err = sessions.DeleteExpired(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deletedSessions)
+		assert.Equal(t, int64(0), deletedTokens)
+
+		assert.NotNil(t, getByToken(t, sessions, live))
+		assert.NotNil(t, getByToken(t, sessions, "expiring-rotated"))
+	})
+}
+
+func runPasswordResetStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+
+	t.Run("Create And Consume", func(t *testing.T) {
+		resets := newStores(t).PasswordResets
+
+		userID := uuid.New()
+		require.NoError(t, resets.Create(ctx, newResetToken(userID, "reset-token", time.Hour)))
+
+		at := time.Now()
+		consumed, err := resets.Consume(ctx, "reset-token", at)
+		require.NoError(t, err)
+		require.NotNil(t, consumed)
+		assert.Equal(t, userID, consumed.UserID)
+		require.NotNil(t, consumed.UsedAt)
+		assert.WithinDuration(t, at, *consumed.UsedAt, time.Millisecond)
+
+		consumed, err = resets.Consume(ctx, "reset-token", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, consumed, "a token is only consumed once")
+	})
+
+	t.Run("Consume Refuses Unknown And Expired Tokens", func(t *testing.T) {
+		resets := newStores(t).PasswordResets
+
+		require.NoError(t, resets.Create(ctx, newResetToken(uuid.New(), "expired-token", -time.Minute)))
+
+		consumed, err := resets.Consume(ctx, "expired-token", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, consumed)
+		consumed, err = resets.Consume(ctx, "unknown-token", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, consumed)
+	})
+
+	t.Run("Create Refuses Duplicate Tokens", func(t *testing.T) {
+		resets := newStores(t).PasswordResets
+
+		require.NoError(t, resets.Create(ctx, newResetToken(uuid.New(), "duplicate-token", time.Hour)))
+		assert.Error(t, resets.Create(ctx, newResetToken(uuid.New(), "duplicate-token", time.Hour)))
+	})
+
+	t.Run("DeleteByUserID", func(t *testing.T) {
+		resets := newStores(t).PasswordResets
+
+		userID, otherID := uuid.New(), uuid.New()
+		require.NoError(t, resets.Create(ctx, newResetToken(userID, "first-token", time.Hour)))
+		require.NoError(t, resets.Create(ctx, newResetToken(userID, "second-token", time.Hour)))
+		require.NoError(t, resets.Create(ctx, newResetToken(otherID, "other-token", time.Hour)))
+
+		require.NoError(t, resets.DeleteByUserID(ctx, userID))
+
+		for _, token := range []string{"first-token", "second-token"} {
+			consumed, err := resets.Consume(ctx, token, time.Now())
+			require.NoError(t, err)
+			assert.Nil(t, consumed, token)
+		}
+		consumed, err := resets.Consume(ctx, "other-token", time.Now())
+		require.NoError(t, err)
+		assert.NotNil(t, consumed)
+	})
+}
+
+func runLoginAttemptStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+
+	t.Run("RecordFailure Counts Failures", func(t *testing.T) {
+		attempts := newStores(t).LoginAttempts
+
+		start := time.Now()
+		attempt, err := attempts.RecordFailure(ctx, "account:count", start, start.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, "account:count", attempt.Key)
+		assert.Equal(t, 1, attempt.Failures)
+		assert.WithinDuration(t, start, attempt.LastFailureAt, time.Millisecond)
+
+		attempt, err = attempts.RecordFailure(ctx, "account:count", start.Add(time.Second), start.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempt.Failures)
+
+		// Failures before resetBefore are forgotten
+		later := start.Add(time.Hour)
+		attempt, err = attempts.RecordFailure(ctx, "account:count", later, later.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 1, attempt.Failures)
+		assert.WithinDuration(t, later, attempt.LastFailureAt, time.Millisecond)
+	})
+
+	t.Run("GetByKeys", func(t *testing.T) {
+		attempts := newStores(t).LoginAttempts
+
+		now := time.Now()
+		for _, key := range []string{"account:a", "ip:b"} {
+			_, err := attempts.RecordFailure(ctx, key, now, now.Add(-time.Hour))
+			require.NoError(t, err)
+		}
+
+		found, err := attempts.GetByKeys(ctx, []string{"account:a", "account:missing"})
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.Equal(t, "account:a", found[0].Key)
+		assert.Equal(t, 1, found[0].Failures)
+	})
+
+	t.Run("SetBlockedUntil", func(t *testing.T) {
+		attempts := newStores(t).LoginAttempts
+
+		now := time.Now()
+		_, err := attempts.RecordFailure(ctx, "account:blocked", now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		until := now.Add(15 * time.Minute)
+		require.NoError(t, attempts.SetBlockedUntil(ctx, "account:blocked", until))
+
+		found, err := attempts.GetByKeys(ctx, []string{"account:blocked"})
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.WithinDuration(t, until, found[0].BlockedUntil, time.Millisecond)
+	})
+
+	t.Run("DeleteByKey", func(t *testing.T) {
+		attempts := newStores(t).LoginAttempts
+
+		now := time.Now()
+		_, err := attempts.RecordFailure(ctx, "account:deleted", now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		require.NoError(t, attempts.DeleteByKey(ctx, "account:deleted"))
+
+		found, err := attempts.GetByKeys(ctx, []string{"account:deleted"})
+		require.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		attempts := newStores(t).LoginAttempts
+
+		now := time.Now()
+		old := now.Add(-time.Hour)
+		for _, key := range []string{"account:old-1", "account:old-2", "ip:old-3", "account:locked", "account:recent"} {
+			at := old
+			if key == "account:recent" {
+				at = now
+			}
+			_, err := attempts.RecordFailure(ctx, key, at, at.Add(-time.Hour))
+			require.NoError(t, err)
+		}
+		// An old failure whose lockout is still running is kept
+		require.NoError(t, attempts.SetBlockedUntil(ctx, "account:locked", now.Add(time.Minute)))
+
+		forgetBefore := now.Add(-15 * time.Minute)
+		deleted, err := attempts.DeleteExpired(ctx, forgetBefore, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+		deleted, err = attempts.DeleteExpired(ctx, forgetBefore, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		found, err := attempts.GetByKeys(ctx, []string{
+			"account:old-1", "account:old-2", "ip:old-3", "account:locked", "account:recent",
+		})
+		require.NoError(t, err)
+		keys := make([]string, 0, len(found))
+		for _, attempt := range found {
+			keys = append(keys, attempt.Key)
+		}
+		assert.ElementsMatch(t, []string{"account:locked", "account:recent"}, keys)
+	})
+}
+
+func runTwoFactorStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+
+	t.Run("Enroll And Use Steps", func(t *testing.T) {
+		twoFactor := newStores(t).TwoFactor
+
+		userID := uuid.New()
+		credential, err := twoFactor.GetCredential(ctx, userID)
+		require.NoError(t, err)
+		assert.Nil(t, credential)
+
+		saved, err := twoFactor.SavePendingCredential(ctx, &authDomain.TOTPCredential{UserID: userID, Secret: "first"})
+		require.NoError(t, err)
+		assert.True(t, saved)
+		saved, err = twoFactor.SavePendingCredential(ctx, &authDomain.TOTPCredential{UserID: userID, Secret: "second"})
+		require.NoError(t, err)
+		assert.True(t, saved, "a pending credential is replaced")
+
+		used, err := twoFactor.UseStep(ctx, userID, 10, false)
+		require.NoError(t, err)
+		assert.False(t, used, "a pending credential only accepts confirming steps")
+		used, err = twoFactor.UseStep(ctx, userID, 10, true)
+		require.NoError(t, err)
+		assert.True(t, used)
+
+		credential, err = twoFactor.GetCredential(ctx, userID)
+		require.NoError(t, err)
+		require.NotNil(t, credential)
+		assert.Equal(t, "second", credential.Secret)
+		assert.NotNil(t, credential.ConfirmedAt)
+		assert.Equal(t, int64(10), credential.LastUsedStep)
+
+		used, err = twoFactor.UseStep(ctx, userID, 10, false)
+		require.NoError(t, err)
+		assert.False(t, used, "a step is only accepted once")
+		used, err = twoFactor.UseStep(ctx, userID, 11, false)
+		require.NoError(t, err)
+		assert.True(t, used)
+
+		saved, err = twoFactor.SavePendingCredential(ctx, &authDomain.TOTPCredential{UserID: userID, Secret: "third"})
+		require.NoError(t, err)
+		assert.False(t, saved, "a confirmed credential is kept")
+	})
+
+	t.Run("Recovery Codes", func(t *testing.T) {
+		twoFactor := newStores(t).TwoFactor
+
+		userID := uuid.New()
+		require.NoError(t, twoFactor.ReplaceRecoveryCodes(ctx, userID, []string{"a", "b", "c"}))
+		require.NoError(t, twoFactor.ReplaceRecoveryCodes(ctx, uuid.New(), []string{"a"}))
+
+		consumed, err := twoFactor.ConsumeRecoveryCode(ctx, userID, "b", time.Now())
+		require.NoError(t, err)
+		assert.True(t, consumed)
+		consumed, err = twoFactor.ConsumeRecoveryCode(ctx, userID, "b", time.Now())
+		require.NoError(t, err)
+		assert.False(t, consumed, "a code is only used once")
+
+		count, err := twoFactor.CountUnusedRecoveryCodes(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		require.NoError(t, twoFactor.ReplaceRecoveryCodes(ctx, userID, []string{"d"}))
+		consumed, err = twoFactor.ConsumeRecoveryCode(ctx, userID, "a", time.Now())
+		require.NoError(t, err)
+		assert.False(t, consumed, "replaced codes are gone")
+		count, err = twoFactor.CountUnusedRecoveryCodes(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("DeleteByUserID", func(t *testing.T) {
+		twoFactor := newStores(t).TwoFactor
+
+		userID := uuid.New()
+		_, err := twoFactor.SavePendingCredential(ctx, &authDomain.TOTPCredential{UserID: userID, Secret: "secret"})
+		require.NoError(t, err)
+		require.NoError(t, twoFactor.ReplaceRecoveryCodes(ctx, userID, []string{"a", "b"}))
+
+		require.NoError(t, twoFactor.DeleteByUserID(ctx, userID))
+
+		credential, err := twoFactor.GetCredential(ctx, userID)
+		require.NoError(t, err)
+		assert.Nil(t, credential)
+		count, err := twoFactor.CountUnusedRecoveryCodes(ctx, userID)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
+
+func runPasskeyStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+
+	t.Run("Create And List", func(t *testing.T) {
+		passkeys := newStores(t).Passkeys
+
+		userID := uuid.New()
+		first := newPasskey(userID, "first")
+		require.NoError(t, passkeys.Create(ctx, first))
+		require.NoError(t, passkeys.Create(ctx, newPasskey(userID, "second")))
+		require.NoError(t, passkeys.Create(ctx, newPasskey(uuid.New(), "other")))
+		assert.Error(t, passkeys.Create(ctx, newPasskey(userID, "first")), "credential IDs are unique")
+
+		credentials, err := passkeys.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, credentials, 2)
+		assert.Equal(t, first.ID, credentials[0].ID)
+		assert.Equal(t, []byte("first"), credentials[0].CredentialID)
+		assert.Equal(t, []byte("second"), credentials[1].CredentialID)
+	})
+
+	t.Run("RecordUse", func(t *testing.T) {
+		passkeys := newStores(t).Passkeys
+
+		credential := newPasskey(uuid.New(), "counter")
+		require.NoError(t, passkeys.Create(ctx, credential))
+
+		// Authenticators without a counter always report zero
+		recorded, err := passkeys.RecordUse(ctx, credential.ID, 0, false, time.Now())
+		require.NoError(t, err)
+		assert.True(t, recorded)
+
+		at := time.Now()
+		recorded, err = passkeys.RecordUse(ctx, credential.ID, 5, true, at)
+		require.NoError(t, err)
+		assert.True(t, recorded)
+		recorded, err = passkeys.RecordUse(ctx, credential.ID, 5, true, time.Now())
+		require.NoError(t, err)
+		assert.False(t, recorded, "the counter cannot go back")
+
+		credentials, err := passkeys.GetByUserID(ctx, credential.UserID)
+		require.NoError(t, err)
+		require.Len(t, credentials, 1)
+		assert.Equal(t, int64(5), credentials[0].SignCount)
+		assert.True(t, credentials[0].BackupState)
+		require.NotNil(t, credentials[0].LastUsedAt)
+		assert.WithinDuration(t, at, *credentials[0].LastUsedAt, time.Millisecond)
+	})
+
+	t.Run("DeleteByID", func(t *testing.T) {
+		passkeys := newStores(t).Passkeys
+
+		credential := newPasskey(uuid.New(), "deleted")
+		require.NoError(t, passkeys.Create(ctx, credential))
+
+		deleted, err := passkeys.DeleteByID(ctx, uuid.New(), credential.ID)
+		require.NoError(t, err)
+		assert.False(t, deleted, "only the owner can delete a credential")
+		deleted, err = passkeys.DeleteByID(ctx, credential.UserID, credential.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		deleted, err = passkeys.DeleteByID(ctx, credential.UserID, credential.ID)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	})
+
+	t.Run("Ceremonies", func(t *testing.T) {
+		passkeys := newStores(t).Passkeys
+
+		ceremony := &authDomain.WebAuthnCeremony{
+			Kind: "login", Data: []byte("{}"), ExpiresAt: time.Now().Add(time.Minute),
+		}
+		require.NoError(t, passkeys.CreateCeremony(ctx, ceremony))
+		expired := &authDomain.WebAuthnCeremony{
+			Kind: "login", Data: []byte("{}"), ExpiresAt: time.Now().Add(-time.Minute),
+		}
+		require.NoError(t, passkeys.CreateCeremony(ctx, expired))
+
+		consumed, err := passkeys.ConsumeCeremony(ctx, ceremony.ID, "registration", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, consumed, "the kind must match")
+		consumed, err = passkeys.ConsumeCeremony(ctx, ceremony.ID, "login", time.Now())
+		require.NoError(t, err)
+		require.NotNil(t, consumed)
+		assert.Equal(t, []byte("{}"), consumed.Data)
+		consumed, err = passkeys.ConsumeCeremony(ctx, ceremony.ID, "login", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, consumed, "a ceremony is only finished once")
+
+		consumed, err = passkeys.ConsumeCeremony(ctx, expired.ID, "login", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, consumed)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		passkeys := newStores(t).Passkeys
+
+		live := &authDomain.WebAuthnCeremony{
+			Kind: "login", Data: []byte("{}"), ExpiresAt: time.Now().Add(time.Minute),
+		}
+		require.NoError(t, passkeys.CreateCeremony(ctx, live))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, passkeys.CreateCeremony(ctx, &authDomain.WebAuthnCeremony{
+				Kind: "login", Data: []byte("{}"), ExpiresAt: time.Now().Add(-time.Minute),
+			}))
+		}
+
+		deleted, err := passkeys.DeleteExpired(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+		deleted, err = passkeys.DeleteExpired(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		consumed, err := passkeys.ConsumeCeremony(ctx, live.ID, "login", time.Now())
+		require.NoError(t, err)
+		assert.NotNil(t, consumed)
+	})
+}
+
+func runPersonalAccessTokenStore(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+
+	t.Run("Create And Get", func(t *testing.T) {
+		accessTokens := newStores(t).AccessTokens
+
+		userID := uuid.New()
+		accessToken := newAccessToken(userID, "first-token", nil)
+		require.NoError(t, accessTokens.Create(ctx, accessToken))
+		require.NoError(t, accessTokens.Create(ctx, newAccessToken(userID, "second-token", nil)))
+		assert.Error(t, accessTokens.Create(ctx, newAccessToken(userID, "first-token", nil)), "tokens are unique")
+
+		found, err := accessTokens.GetByToken(ctx, "first-token", time.Now())
+		require.NoError(t, err)
+		require.NotNil(t, found)
+		assert.Equal(t, accessToken.ID, found.ID)
+		assert.Equal(t, []string{"read"}, found.Scopes)
+
+		found, err = accessTokens.GetByToken(ctx, "unknown-token", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, found)
+
+		listed, err := accessTokens.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, listed, 2)
+		assert.Equal(t, accessToken.ID, listed[0].ID)
+	})
+
+	t.Run("GetByToken Refuses Expired Tokens", func(t *testing.T) {
+		accessTokens := newStores(t).AccessTokens
+
+		expiresAt := time.Now().Add(-time.Minute)
+		expired := newAccessToken(uuid.New(), "expired-token", &expiresAt)
+		require.NoError(t, accessTokens.Create(ctx, expired))
+
+		found, err := accessTokens.GetByToken(ctx, "expired-token", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, found)
+
+		listed, err := accessTokens.GetByUserID(ctx, expired.UserID)
+		require.NoError(t, err)
+		assert.Len(t, listed, 1, "expired tokens are still listed")
+	})
+
+	t.Run("RecordUse", func(t *testing.T) {
+		accessTokens := newStores(t).AccessTokens
+
+		accessToken := newAccessToken(uuid.New(), "used-token", nil)
+		require.NoError(t, accessTokens.Create(ctx, accessToken))
+
+		at := time.Now()
+		require.NoError(t, accessTokens.RecordUse(ctx, accessToken.ID, "192.0.2.1", at, at.Add(-time.Minute)))
+		// Uses shortly after are not recorded
+		require.NoError(t, accessTokens.RecordUse(ctx, accessToken.ID, "192.0.2.2", at, at.Add(-time.Minute)))
+
+		found, err := accessTokens.GetByToken(ctx, "used-token", time.Now())
+		require.NoError(t, err)
+		require.NotNil(t, found.LastUsedAt)
+		assert.WithinDuration(t, at, *found.LastUsedAt, time.Millisecond)
+		assert.Equal(t, "192.0.2.1", found.LastUsedIP)
+
+		later := at.Add(time.Hour)
+		require.NoError(t, accessTokens.RecordUse(ctx, accessToken.ID, "192.0.2.3", later, later.Add(-time.Minute)))
+		found, err = accessTokens.GetByToken(ctx, "used-token", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, "192.0.2.3", found.LastUsedIP)
+	})
+
+	t.Run("DeleteByID", func(t *testing.T) {
+		accessTokens := newStores(t).AccessTokens
+
+		accessToken := newAccessToken(uuid.New(), "deleted-token", nil)
+		require.NoError(t, accessTokens.Create(ctx, accessToken))
+
+		deleted, err := accessTokens.DeleteByID(ctx, uuid.New(), accessToken.ID)
+		require.NoError(t, err)
+		assert.False(t, deleted, "only the owner can delete a token")
+		deleted, err = accessTokens.DeleteByID(ctx, accessToken.UserID, accessToken.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		found, err := accessTokens.GetByToken(ctx, "deleted-token", time.Now())
+		require.NoError(t, err)
+		assert.Nil(t, found)
+	})
+}
+
+func runUnitOfWork(t *testing.T, newStores func(t *testing.T) Stores) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	t.Run("Commits", func(t *testing.T) {
+		stores := newStores(t)
+
+		user := newUser("commit@example.com", userDomain.RoleUser)
+		token := uuid.NewString()
+		err := stores.UnitOfWork.WithinTx(ctx, func(tx unitofwork.Repos) error {
+			if err := tx.Users.Create(ctx, user); err != nil {
+				return err
+			}
+			stored, err := tx.Users.GetByEmail(ctx, "commit@example.com")
+			if err != nil {
+				return err
+			}
+			assert.NotNil(t, stored, "a unit of work sees its own changes")
+			return tx.Sessions.Create(ctx, newSession(user.ID, token, time.Hour))
+		})
+		require.NoError(t, err)
+
+		stored, err := stores.Users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, stored)
+		assert.NotNil(t, getByToken(t, stores.Sessions, token))
+	})
+
+	t.Run("Rolls Back On Error", func(t *testing.T) {
+		stores := newStores(t)
+
+		user := newUser("rollback@example.com", userDomain.RoleUser)
+		require.NoError(t, stores.Users.Create(ctx, user))
+		token := createSession(t, stores.Sessions, user.ID, time.Hour)
+
+		created := newUser("created@example.com", userDomain.RoleUser)
+		err := stores.UnitOfWork.WithinTx(ctx, func(tx unitofwork.Repos) error {
+			if _, err := tx.Sessions.DeleteByUserID(ctx, user.ID); err != nil {
+				return err
+			}
+			if err := tx.Users.SetPassword(ctx, user.ID, "new-hash"); err != nil {
+				return err
+			}
+			if err := tx.Users.Create(ctx, created); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		stored, err := stores.Users.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "hash", stored.Password)
+		assert.NotNil(t, getByToken(t, stores.Sessions, token))
+		stored, err = stores.Users.GetByEmail(ctx, "created@example.com")
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+	})
+
+	t.Run("Rolls Back Reset Tokens And Login Attempts", func(t *testing.T) {
+		stores := newStores(t)
+
+		userID := uuid.New()
+		require.NoError(t, stores.PasswordResets.Create(ctx, newResetToken(userID, "reset-token", time.Hour)))
+		now := time.Now()
+		_, err := stores.LoginAttempts.RecordFailure(ctx, "account:rollback", now, now.Add(-time.Hour))
+		require.NoError(t, err)
+
+		err = stores.UnitOfWork.WithinTx(ctx, func(tx unitofwork.Repos) error {
+			if _, err := tx.PasswordResets.Consume(ctx, "reset-token", time.Now()); err != nil {
+				return err
+			}
+			if err := tx.LoginAttempts.DeleteByKey(ctx, "account:rollback"); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		consumed, err := stores.PasswordResets.Consume(ctx, "reset-token", time.Now())
+		require.NoError(t, err)
+		assert.NotNil(t, consumed, "the token was not spent")
+		found, err := stores.LoginAttempts.GetByKeys(ctx, []string{"account:rollback"})
+		require.NoError(t, err)
+		assert.Len(t, found, 1)
+	})
+
+	t.Run("Rolls Back A Refused Delete", func(t *testing.T) {
+		stores := newStores(t)
+
+		admin := newUser("admin@example.com", userDomain.RoleAdmin)
+		require.NoError(t, stores.Users.Create(ctx, admin))
+		token := createSession(t, stores.Sessions, admin.ID, time.Hour)
+
+		err := stores.UnitOfWork.WithinTx(ctx, func(tx unitofwork.Repos) error {
+			if _, err := tx.Sessions.DeleteByUserID(ctx, admin.ID); err != nil {
+				return err
+			}
+			deleted, err := tx.Users.Delete(ctx, admin.ID)
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				return errFailed
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, errFailed, "the last admin cannot be deleted")
+		assert.NotNil(t, getByToken(t, stores.Sessions, token))
+	})
+
+	t.Run("Retries Serialization Failures", func(t *testing.T) {
+		stores := newStores(t)
+
+		calls := 0
+		err := stores.UnitOfWork.WithinTx(ctx, func(tx unitofwork.Repos) error {
+			calls++
+			// A second attempt fails with a duplicate email unless the first was rolled back
+			if err := tx.Users.Create(ctx, newUser("retry@example.com", userDomain.RoleUser)); err != nil {
+				return err
+			}
+			if calls == 1 {
+				return &pgconn.PgError{Code: "40001"}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+
+		stored, err := stores.Users.GetByEmail(ctx, "retry@example.com")
+		require.NoError(t, err)
+		assert.NotNil(t, stored)
+	})
+
+	t.Run("Concurrent Units Of Work Create One Admin", func(t *testing.T) {
+		stores := newStores(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := stores.UnitOfWork.WithinTx(ctx, func(tx unitofwork.Repos) error {
+					hasAdmin, err := tx.Users.HasAdmin(ctx)
+					if err != nil || hasAdmin {
+						return err
+					}
+					return tx.Users.Create(ctx, newUser(fmt.Sprintf("admin%d@example.com", i), userDomain.RoleAdmin))
+				})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		users, err := stores.Users.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, users, 1)
+	})
+}
+
+// newUser returns a user that has not been created yet
+func newUser(email string, role userDomain.UserRole) *userDomain.User {
+	return &userDomain.User{Email: email, Password: "hash", Name: "Test User", Role: role}
+}
+
+// newSession returns a session for token that expires after ttl and has not
+// been created yet
+func newSession(userID uuid.UUID, token string, ttl time.Duration) *authDomain.Session {
+	now := time.Now()
+	return &authDomain.Session{
+		UserID:            userID,
+		TokenHash:         authDomain.HashToken(token),
+		IPAddress:         "192.0.2.1",
+		Browser:           "Firefox",
+		LastSeenAt:        now,
+		ExpiresAt:         now.Add(ttl),
+		AbsoluteExpiresAt: now.Add(ttl),
+	}
+}
+
+// newResetToken returns a password reset token for userID that expires after
+// ttl and has not been created yet
+func newResetToken(userID uuid.UUID, token string, ttl time.Duration) *authDomain.PasswordResetToken {
+	return &authDomain.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: authDomain.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+}
+
+// newPasskey returns a passkey of userID with the given credential ID that
+// has not been created yet
+func newPasskey(userID uuid.UUID, credentialID string) *authDomain.WebAuthnCredential {
+	return &authDomain.WebAuthnCredential{
+		UserID:       userID,
+		Name:         credentialID,
+		CredentialID: []byte(credentialID),
+		PublicKey:    []byte("public-key"),
+	}
+}
+
+// newAccessToken returns a personal access token of userID for token that has
+// not been created yet
+func newAccessToken(userID uuid.UUID, token string, expiresAt *time.Time) *authDomain.PersonalAccessToken {
+	return &authDomain.PersonalAccessToken{
+		UserID:    userID,
+		Name:      token,
+		Prefix:    token[:4],
+		TokenHash: authDomain.HashToken(token),
+		Scopes:    []string{"read"},
+		ExpiresAt: expiresAt,
+	}
+}
+
+// createSession creates a session for userID and returns its token
+func createSession(t *testing.T, sessions authRepository.SessionStore, userID uuid.UUID, ttl time.Duration) string {
+	ctx := context.Background()
+	token := uuid.NewString()
+	require.NoError(t, sessions.Create(ctx, newSession(userID, token, ttl)))
+	return token
+}
+
+func getByToken(t *testing.T, sessions authRepository.SessionStore, token string) *authDomain.Session {
+	ctx := context.Background()
+	session, err := sessions.GetByToken(ctx, token)
+	require.NoError(t, err)
+	return session
+}
+
+func assertRevoked(t *testing.T, sessions authRepository.SessionStore, token string) {
+	assert.Nil(t, getByToken(t, sessions, token), "the session is revoked")
+}
+
+func assertSameUser(t *testing.T, want, got *userDomain.User) {
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.Email, got.Email)
+	assert.Equal(t, want.Password, got.Password)
+	assert.Equal(t, want.Name, got.Name)
+	assert.Equal(t, want.Role, got.Role)
+	assert.Equal(t, want.EmailVerified, got.EmailVerified)
+	assert.WithinDuration(t, want.CreatedAt, got.CreatedAt, time.Millisecond)
+}
@@ -0,0 +1,26 @@
+package storetest
+
+import (
+	"testing"
+
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+func TestMemoryStores(t *testing.T) {
+	Run(t, func(t *testing.T) Stores {
+		users, sessions := userRepository.NewMemoryUserStore(), authRepository.NewMemorySessionStore()
+		resets, attempts := authRepository.NewMemoryPasswordResetStore(), authRepository.NewMemoryLoginAttemptStore()
+		return Stores{
+			Users:          users,
+			Sessions:       sessions,
+			PasswordResets: resets,
+			LoginAttempts:  attempts,
+			TwoFactor:      authRepository.NewMemoryTwoFactorStore(),
+			Passkeys:       authRepository.NewMemoryPasskeyStore(),
+			AccessTokens:   authRepository.NewMemoryPersonalAccessTokenStore(),
+			UnitOfWork:     unitofwork.NewMemoryManager(users, sessions, resets, attempts),
+		}
+	})
+}
@@ -56,14 +56,18 @@ func SetupTestDB(t *testing.T) *TestDB {
 		host, port.Port())
 
 	// Create database connection
-	db, err := database.NewDatabase(dsn)
+	db, err := database.NewDatabase(dsn, 0)
 	if err != nil {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
-	// Enable uuid-ossp extension for PostgreSQL
-	if err := db.DB.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error; err != nil {
-		t.Logf("Warning: Failed to create uuid-ossp extension: %v", err)
+	// Create the schema
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	return &TestDB{
@@ -0,0 +1,61 @@
+package unitofwork
+
+import (
+	"context"
+	"sync"
+
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/database"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// memoryAttempts is how many times MemoryManager runs a unit of work failing
+// with a serialization failure
+const memoryAttempts = 3
+
+// MemoryManager runs units of work against memory stores, one at a time. It
+// is meant for tests. A unit of work that fails restores the stores as they
+// were before it started, which also undoes changes made concurrently without
+// the manager. Of the data belonging to users, only password reset tokens are
+// kept in its stores.
+type MemoryManager struct {
+	mu       sync.Mutex
+	users    *userRepository.MemoryUserStore
+	sessions *authRepository.MemorySessionStore
+	resets   *authRepository.MemoryPasswordResetStore
+	attempts *authRepository.MemoryLoginAttemptStore
+}
+
+// NewMemoryManager creates a new unit of work manager for memory stores
+func NewMemoryManager(
+	users *userRepository.MemoryUserStore,
+	sessions *authRepository.MemorySessionStore,
+	resets *authRepository.MemoryPasswordResetStore,
+	attempts *authRepository.MemoryLoginAttemptStore,
+) *MemoryManager {
+	return &MemoryManager{users: users, sessions: sessions, resets: resets, attempts: attempts}
+}
+
+// WithinTx runs fn with the stores, restoring them if it fails
+func (m *MemoryManager) WithinTx(ctx context.Context, fn func(tx Repos) error) error {
+	return database.RetryOnSerializationFailure(ctx, memoryAttempts, func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		restores := []func(){m.users.Snapshot(), m.sessions.Snapshot(), m.resets.Snapshot(), m.attempts.Snapshot()}
+		err := fn(Repos{
+			Users:          m.users,
+			Sessions:       m.sessions,
+			PasswordResets: m.resets,
+			LoginAttempts:  m.attempts,
+			UserData:       []UserDataStore{m.resets},
+		})
+		if err != nil {
+			for _, restore := range restores {
+				restore()
+			}
+			return err
+		}
+		return nil
+	})
+}
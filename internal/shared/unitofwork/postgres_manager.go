@@ -0,0 +1,50 @@
+package unitofwork
+
+import (
+	"context"
+
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	oauthRepository "github.com/acheevo/test/internal/oauth/repository"
+	rbacRepository "github.com/acheevo/test/internal/rbac/repository"
+	serviceAccountRepository "github.com/acheevo/test/internal/serviceaccount/repository"
+	"github.com/acheevo/test/internal/shared/database"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// PostgresManager runs units of work in serializable Postgres transactions,
+// retrying those that fail to serialize
+type PostgresManager struct {
+	db       *database.Database
+	attempts int
+}
+
+// NewPostgresManager creates a new Postgres unit of work manager that runs
+// each unit of work at most attempts times
+func NewPostgresManager(db *database.Database, attempts int) *PostgresManager {
+	return &PostgresManager{db: db, attempts: attempts}
+}
+
+// WithinTx runs fn in a transaction with repositories bound to it
+func (m *PostgresManager) WithinTx(ctx context.Context, fn func(tx Repos) error) error {
+	return database.RetryOnSerializationFailure(ctx, m.attempts, func() error {
+		return m.db.Transaction(ctx, func(tx *database.Database) error {
+			resets := authRepository.NewPasswordResetRepository(tx)
+			return fn(Repos{
+				Users:          userRepository.NewUserRepository(tx),
+				Sessions:       authRepository.NewSessionRepository(tx),
+				PasswordResets: resets,
+				LoginAttempts:  authRepository.NewLoginAttemptRepository(tx),
+				UserData: []UserDataStore{
+					resets,
+					authRepository.NewTwoFactorRepository(tx),
+					authRepository.NewPasskeyRepository(tx),
+					authRepository.NewPersonalAccessTokenRepository(tx),
+					authRepository.NewIdentityRepository(tx),
+					oauthRepository.NewGrantRepository(tx),
+					rbacRepository.NewRoleRepository(tx),
+					serviceAccountRepository.NewServiceAccountRepository(tx),
+				},
+			})
+		})
+	})
+}
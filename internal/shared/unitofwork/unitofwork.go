@@ -0,0 +1,35 @@
+package unitofwork
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+// Repos are the repositories a unit of work changes together
+type Repos struct {
+	Users          userRepository.UserStore
+	Sessions       authRepository.SessionStore
+	PasswordResets authRepository.PasswordResetStore
+	LoginAttempts  authRepository.LoginAttemptStore
+
+	// UserData holds every repository keeping rows that belong to a user,
+	// other than their sessions, so they can be deleted with the user
+	UserData []UserDataStore
+}
+
+// UserDataStore is a repository keeping rows that belong to a user
+type UserDataStore interface {
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+// Manager runs units of work. WithinTx calls fn with repositories whose
+// changes are all kept if fn returns nil, and all undone otherwise. fn may be
+// called again when its transaction conflicts with a concurrent one, so it
+// must not have effects outside the repositories it is given.
+type Manager interface {
+	WithinTx(ctx context.Context, fn func(tx Repos) error) error
+}
@@ -0,0 +1,61 @@
+package useragent
+
+import "strings"
+
+// Client describes the device and browser families parsed from a User-Agent header
+type Client struct {
+	Device  string `json:"device"`
+	Browser string `json:"browser"`
+}
+
+const unknown = "Other"
+
+// rule maps a User-Agent substring to a family name; rules are checked in order
+type rule struct {
+	token  string
+	family string
+}
+
+// Order matters: many browsers include the tokens of the engines they build on,
+// e.g. Edge and Opera both advertise "Chrome", and Chrome advertises "Safari".
+var browserRules = []rule{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"okhttp/", "OkHttp"},
+	{"Go-http-client/", "Go HTTP client"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+var deviceRules = []rule{
+	{"iPad", "iPad"},
+	{"iPhone", "iPhone"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Macintosh", "Mac"},
+	{"CrOS", "Chrome OS"},
+	{"Linux", "Linux"},
+}
+
+// Parse extracts device and browser families from a User-Agent header.
+// It is deliberately coarse: the result is meant for humans reviewing sessions.
+func Parse(userAgent string) Client {
+	return Client{
+		Device:  match(userAgent, deviceRules),
+		Browser: match(userAgent, browserRules),
+	}
+}
+
+func match(userAgent string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(userAgent, r.token) {
+			return r.family
+		}
+	}
+	return unknown
+}
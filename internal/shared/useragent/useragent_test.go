@@ -0,0 +1,55 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  Client
+	}{
+		{
+			name: "Chrome On Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
+				"(KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			expected: Client{Device: "Windows", Browser: "Chrome"},
+		},
+		{
+			name: "Edge On Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
+				"(KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			expected: Client{Device: "Windows", Browser: "Edge"},
+		},
+		{
+			name: "Safari On iPhone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 " +
+				"(KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			expected: Client{Device: "iPhone", Browser: "Safari"},
+		},
+		{
+			name:      "Firefox On Android",
+			userAgent: "Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0",
+			expected:  Client{Device: "Android", Browser: "Firefox"},
+		},
+		{
+			name:      "curl",
+			userAgent: "curl/8.4.0",
+			expected:  Client{Device: "Other", Browser: "curl"},
+		},
+		{
+			name:      "Empty",
+			userAgent: "",
+			expected:  Client{Device: "Other", Browser: "Other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Parse(tt.userAgent))
+		})
+	}
+}
@@ -17,13 +17,19 @@ const (
 
 // User represents a user in the system
 type User struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
-	Email     string    `json:"email" gorm:"uniqueIndex"`
-	Password  string    `json:"-"` // "-" excludes from JSON
-	Name      string    `json:"name"`
-	Role      UserRole  `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	Email         string     `json:"email" gorm:"uniqueIndex"`
+	Password      string     `json:"-"` // "-" excludes from JSON
+	Name          string     `json:"name"`
+	Role          UserRole   `json:"role"`
+	EmailVerified bool       `json:"email_verified" gorm:"not null;default:false"`
+	VerifiedAt    *time.Time `json:"verified_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// BootstrapPassword is the hash of the bootstrap password last applied to
+	// this user, who is then the bootstrap admin
+	BootstrapPassword string `json:"-" gorm:"not null;default:''"`
 }
 
 // CreateUserRequest represents the user creation request payload
@@ -31,7 +37,22 @@ type CreateUserRequest struct {
 	Email    string   `json:"email" binding:"required,email"`
 	Password string   `json:"password" binding:"required,min=6"`
 	Name     string   `json:"name" binding:"required"`
-	Role     UserRole `json:"role" binding:"required"`
+	Role     UserRole `json:"role" binding:"required,oneof=admin user"`
+}
+
+// UpdateUserRequest replaces a user's editable fields
+type UpdateUserRequest struct {
+	Email string   `json:"email" binding:"required,email"`
+	Name  string   `json:"name" binding:"required"`
+	Role  UserRole `json:"role" binding:"required,oneof=admin user"`
+}
+
+// PatchUserRequest is a JSON merge patch of a user's editable fields; fields
+// left out are unchanged. None of them can be removed, so null is rejected.
+type PatchUserRequest struct {
+	Email *string   `json:"email" binding:"omitempty,email"`
+	Name  *string   `json:"name" binding:"omitempty,min=1"`
+	Role  *UserRole `json:"role" binding:"omitempty,oneof=admin user"`
 }
 
 // TableName returns the table name for the User model
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/user/domain"
+)
+
+// ErrDuplicateEmail is returned by MemoryUserStore for an email another user
+// has, where Postgres would report a unique constraint violation
+var ErrDuplicateEmail = errors.New("duplicate user email")
+
+// MemoryUserStore keeps users in process memory. It is meant for tests and
+// does not persist anything.
+type MemoryUserStore struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]domain.User
+}
+
+// NewMemoryUserStore creates a new in-memory user store
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[uuid.UUID]domain.User)}
+}
+
+// Create creates a new user
+func (s *MemoryUserStore) Create(ctx context.Context, user *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = user.BeforeCreate(nil)
+	if _, exists := s.users[user.ID]; exists {
+		return errors.New("duplicate user id")
+	}
+	if s.emailTaken(user.ID, user.Email) {
+		return ErrDuplicateEmail
+	}
+	s.users[user.ID] = *user
+	return nil
+}
+
+// GetByEmail retrieves a user by email
+func (s *MemoryUserStore) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetByID retrieves a user by ID
+func (s *MemoryUserStore) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// GetAll retrieves all users, oldest first
+func (s *MemoryUserStore) GetAll(ctx context.Context) ([]domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]domain.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return users, nil
+}
+
+// Update updates a user
+func (s *MemoryUserStore) Update(ctx context.Context, user *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(user)
+}
+
+// SetPassword replaces a user's password hash
+func (s *MemoryUserStore) SetPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[id]; ok {
+		user.Password = passwordHash
+		user.UpdatedAt = time.Now()
+		s.users[id] = user
+	}
+	return nil
+}
+
+// SetBootstrapPassword records the hash of the bootstrap password last applied
+// to a user
+func (s *MemoryUserStore) SetBootstrapPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[id]; ok {
+		user.BootstrapPassword = passwordHash
+		s.users[id] = user
+	}
+	return nil
+}
+
+// HasAdmin reports whether any user is an admin
+func (s *MemoryUserStore) HasAdmin(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.admins()) > 0, nil
+}
+
+// MarkEmailVerified marks a user's email as verified, provided it is still the
+// given address. It reports whether the user was updated.
+func (s *MemoryUserStore) MarkEmailVerified(
+	ctx context.Context, id uuid.UUID, email string, at time.Time,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || user.Email != email || user.EmailVerified {
+		return false, nil
+	}
+	user.EmailVerified = true
+	user.VerifiedAt = &at
+	user.UpdatedAt = at
+	s.users[id] = user
+	return true, nil
+}
+
+// UpdateRole saves a user whose role has changed. It refuses to demote the
+// last admin, reporting false.
+func (s *MemoryUserStore) UpdateRole(ctx context.Context, user *domain.User) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.Role != domain.RoleAdmin && s.isLastAdmin(user.ID) {
+		return false, nil
+	}
+	return true, s.save(user)
+}
+
+// Delete deletes a user. It refuses to delete the last admin, reporting false.
+// The rows a user owns are left to the stores of their modules.
+func (s *MemoryUserStore) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isLastAdmin(id) {
+		return false, nil
+	}
+	delete(s.users, id)
+	return true, nil
+}
+
+// Snapshot records the users in the store and returns a function that puts
+// them back, undoing every change made in between
+func (s *MemoryUserStore) Snapshot() (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := maps.Clone(s.users)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.users = users
+	}
+}
+
+// save stores user, like GORM's Save
+func (s *MemoryUserStore) save(user *domain.User) error {
+	if s.emailTaken(user.ID, user.Email) {
+		return ErrDuplicateEmail
+	}
+	_ = user.BeforeUpdate(nil)
+	s.users[user.ID] = *user
+	return nil
+}
+
+// emailTaken reports whether a user other than id has email
+func (s *MemoryUserStore) emailTaken(id uuid.UUID, email string) bool {
+	for _, user := range s.users {
+		if user.ID != id && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// admins returns the IDs of the admins
+func (s *MemoryUserStore) admins() []uuid.UUID {
+	var admins []uuid.UUID
+	for _, user := range s.users {
+		if user.Role == domain.RoleAdmin {
+			admins = append(admins, user.ID)
+		}
+	}
+	return admins
+}
+
+// isLastAdmin reports whether id is the only admin
+func (s *MemoryUserStore) isLastAdmin(id uuid.UUID) bool {
+	admins := s.admins()
+	return len(admins) == 1 && admins[0] == id
+}
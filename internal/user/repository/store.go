@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/acheevo/test/internal/user/domain"
+)
+
+// UserStore persists users. UserRepository keeps them in Postgres and
+// MemoryUserStore in process memory. Getters return nil without an error when
+// the user does not exist.
+type UserStore interface {
+	Create(ctx context.Context, user *domain.User) error
+	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+	GetAll(ctx context.Context) ([]domain.User, error)
+	Update(ctx context.Context, user *domain.User) error
+	SetPassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	SetBootstrapPassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	HasAdmin(ctx context.Context) (bool, error)
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, email string, at time.Time) (bool, error)
+	UpdateRole(ctx context.Context, user *domain.User) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/acheevo/test/internal/shared/database"
 	"github.com/acheevo/test/internal/user/domain"
@@ -21,14 +24,19 @@ func NewUserRepository(db *database.Database) *UserRepository {
 }
 
 // Create creates a new user
-func (r *UserRepository) Create(user *domain.User) error {
-	return r.db.DB.Create(user).Error
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Create(user).Error
 }
 
 // GetByEmail retrieves a user by email
-func (r *UserRepository) GetByEmail(email string) (*domain.User, error) {
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
 	var user domain.User
-	err := r.db.DB.Where("email = ?", email).First(&user).Error
+	err := db.Where("email = ?", email).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -36,9 +44,12 @@ func (r *UserRepository) GetByEmail(email string) (*domain.User, error) {
 }
 
 // GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(id uuid.UUID) (*domain.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
 	var user domain.User
-	err := r.db.DB.Where("id = ?", id).First(&user).Error
+	err := db.Where("id = ?", id).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -46,18 +57,108 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*domain.User, error) {
 }
 
 // GetAll retrieves all users
-func (r *UserRepository) GetAll() ([]domain.User, error) {
+func (r *UserRepository) GetAll(ctx context.Context) ([]domain.User, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
 	var users []domain.User
-	err := r.db.DB.Find(&users).Error
+	err := db.Find(&users).Error
 	return users, err
 }
 
 // Update updates a user
-func (r *UserRepository) Update(user *domain.User) error {
-	return r.db.DB.Save(user).Error
+func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+	return db.Save(user).Error
+}
+
+// SetPassword replaces a user's password hash
+func (r *UserRepository) SetPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Model(&domain.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"password": passwordHash, "updated_at": time.Now()}).Error
+}
+
+// SetBootstrapPassword records the hash of the bootstrap password last applied
+// to a user
+func (r *UserRepository) SetBootstrapPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	return db.Model(&domain.User{}).
+		Where("id = ?", id).
+		Update("bootstrap_password", passwordHash).Error
+}
+
+// HasAdmin reports whether any user is an admin
+func (r *UserRepository) HasAdmin(ctx context.Context) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	var count int64
+	err := db.Model(&domain.User{}).Where("role = ?", domain.RoleAdmin).Count(&count).Error
+	return count > 0, err
+}
+
+// MarkEmailVerified marks a user's email as verified, provided it is still the
+// given address. It reports whether the user was updated.
+func (r *UserRepository) MarkEmailVerified(
+	ctx context.Context, id uuid.UUID, email string, at time.Time,
+) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	result := db.Model(&domain.User{}).
+		Where("id = ? AND email = ? AND NOT email_verified", id, email).
+		Updates(map[string]interface{}{"email_verified": true, "verified_at": at, "updated_at": at})
+	return result.RowsAffected > 0, result.Error
 }
 
-// Delete deletes a user
-func (r *UserRepository) Delete(id uuid.UUID) error {
-	return r.db.DB.Delete(&domain.User{}, id).Error
+// UpdateRole saves a user whose role has changed. It refuses to demote the
+// last admin, reporting false.
+func (r *UserRepository) UpdateRole(ctx context.Context, user *domain.User) (bool, error) {
+	return r.unlessLastAdmin(ctx, user.ID, user.Role != domain.RoleAdmin, func(tx *gorm.DB) error {
+		return tx.Save(user).Error
+	})
+}
+
+// Delete deletes a user. It refuses to delete the last admin, reporting false.
+// The rows a user owns are left to the repositories of their modules.
+func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	return r.unlessLastAdmin(ctx, id, true, func(tx *gorm.DB) error {
+		return tx.Delete(&domain.User{}, id).Error
+	})
+}
+
+// unlessLastAdmin runs fn in a transaction, unless removing is set and the
+// user is the only admin, in which case it reports false. The admins stay
+// locked until the transaction ends, so concurrent changes cannot remove
+// every admin between them.
+func (r *UserRepository) unlessLastAdmin(
+	ctx context.Context, id uuid.UUID, removing bool, fn func(tx *gorm.DB) error,
+) (bool, error) {
+	db, done := r.db.Operation(ctx)
+	defer done()
+
+	lastAdmin := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var admins []uuid.UUID
+		err := tx.Model(&domain.User{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("role = ?", domain.RoleAdmin).
+			Pluck("id", &admins).Error
+		if err != nil {
+			return err
+		}
+		if removing && len(admins) == 1 && admins[0] == id {
+			lastAdmin = true
+			return nil
+		}
+		return fn(tx)
+	})
+	return !lastAdmin, err
 }
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	"github.com/acheevo/test/internal/user/domain"
+)
+
+// AdminBootstrapLockKey is the Postgres advisory lock key that keeps replicas
+// starting at the same time from bootstrapping the admin twice
+const AdminBootstrapLockKey int64 = 0x5E55_0002
+
+// DefaultAdminPassword is the bootstrap admin password configured by default.
+// Production deployments must set their own.
+const DefaultAdminPassword = "admin123"
+
+// BootstrapResult describes what BootstrapAdmin did
+type BootstrapResult string
+
+const (
+	// BootstrapCreated means there was no admin, so the admin was created
+	BootstrapCreated BootstrapResult = "created"
+	// BootstrapRotated means the configured password changed since it was last
+	// applied, so the admin's password was changed to it
+	BootstrapRotated BootstrapResult = "rotated"
+	// BootstrapUnchanged means the configured password was already applied to
+	// the admin, or another admin exists
+	BootstrapUnchanged BootstrapResult = "unchanged"
+	// BootstrapNotAdmin means the email belongs to a user who is not an
+	// admin, who is left alone
+	BootstrapNotAdmin BootstrapResult = "not_admin"
+)
+
+// BootstrapAdmin makes sure a deployment has an admin. If no admin exists, it
+// creates one with the given email, password and name. If the email already
+// belongs to an admin and the password differs from the one last bootstrapped,
+// the admin's password is rotated to it and their sessions revoked. A password
+// the admin changed themselves is kept as long as the configured one stays the
+// same. Running it again with the same arguments changes nothing.
+func (s *UserService) BootstrapAdmin(ctx context.Context, email, password, name string) (BootstrapResult, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+
+	if user != nil {
+		if user.Role != domain.RoleAdmin {
+			return BootstrapNotAdmin, nil
+		}
+		if user.BootstrapPassword == "" {
+			// Admins bootstrapped before the last applied password was kept
+			// may have changed theirs since, so the configured password is
+			// only recorded as applied
+			if err := s.recordBootstrapPassword(ctx, user, password); err != nil {
+				return "", err
+			}
+			return BootstrapUnchanged, nil
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.BootstrapPassword), []byte(password)) == nil {
+			return BootstrapUnchanged, nil
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		err = s.txManager.WithinTx(ctx, func(tx unitofwork.Repos) error {
+			if err := tx.Users.SetPassword(ctx, user.ID, string(hashedPassword)); err != nil {
+				return err
+			}
+			if err := tx.Users.SetBootstrapPassword(ctx, user.ID, string(hashedPassword)); err != nil {
+				return err
+			}
+			_, err := tx.Sessions.DeleteByUserID(ctx, user.ID)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		return BootstrapRotated, nil
+	}
+
+	hasAdmin, err := s.userRepo.HasAdmin(ctx)
+	if err != nil {
+		return "", err
+	}
+	if hasAdmin {
+		return BootstrapUnchanged, nil
+	}
+
+	user, err = newUser(email, password, name, domain.RoleAdmin)
+	if err != nil {
+		return "", err
+	}
+	user.BootstrapPassword = user.Password
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return "", err
+	}
+	return BootstrapCreated, nil
+}
+
+// recordBootstrapPassword records password as the bootstrap password last
+// applied to user, reusing their password hash if it is the same password
+func (s *UserService) recordBootstrapPassword(ctx context.Context, user *domain.User, password string) error {
+	passwordHash := user.Password
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		passwordHash = string(hashedPassword)
+	}
+	return s.userRepo.SetBootstrapPassword(ctx, user.ID, passwordHash)
+}
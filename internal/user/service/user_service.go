@@ -1,67 +1,183 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/acheevo/test/internal/shared/unitofwork"
 	"github.com/acheevo/test/internal/user/domain"
 	"github.com/acheevo/test/internal/user/repository"
 )
 
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email is already in use")
+	ErrInvalidName  = errors.New("name cannot be empty")
+	ErrLastAdmin    = errors.New("the last admin cannot be deleted or demoted")
+)
+
 // UserService handles user-related business logic
 type UserService struct {
-	userRepo *repository.UserRepository
+	userRepo  repository.UserStore
+	txManager unitofwork.Manager
 }
 
-// NewUserService creates a new user service
-func NewUserService(userRepo *repository.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+// NewUserService creates a new user service. Changes that touch both a user
+// and their sessions are made through txManager.
+func NewUserService(userRepo repository.UserStore, txManager unitofwork.Manager) *UserService {
+	return &UserService{userRepo: userRepo, txManager: txManager}
 }
 
 // GetByID retrieves a user by ID
-func (s *UserService) GetByID(id uuid.UUID) (*domain.User, error) {
-	return s.userRepo.GetByID(id)
+func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return s.userRepo.GetByID(ctx, id)
 }
 
 // GetByEmail retrieves a user by email
-func (s *UserService) GetByEmail(email string) (*domain.User, error) {
-	return s.userRepo.GetByEmail(email)
+func (s *UserService) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return s.userRepo.GetByEmail(ctx, email)
 }
 
 // GetAll retrieves all users
-func (s *UserService) GetAll() ([]domain.User, error) {
-	return s.userRepo.GetAll()
+func (s *UserService) GetAll(ctx context.Context) ([]domain.User, error) {
+	return s.userRepo.GetAll(ctx)
 }
 
 // Create creates a new user
-func (s *UserService) Create(email, password, name string, role domain.UserRole) (*domain.User, error) {
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (s *UserService) Create(
+	ctx context.Context, email, password, name string, role domain.UserRole,
+) (*domain.User, error) {
+	user, err := newUser(email, password, name, role)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &domain.User{
-		ID:       uuid.New(),
-		Email:    email,
-		Password: string(hashedPassword),
-		Name:     name,
-		Role:     role,
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	return user, nil
+}
+
+// newUser builds a user created by an administrator, hashing their password
+func newUser(email, password, name string, role domain.UserRole) (*domain.User, error) {
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	// Accounts created by an administrator are vouched for and need no email verification
+	now := time.Now()
+	return &domain.User{
+		ID:            uuid.New(),
+		Email:         email,
+		Password:      string(hashedPassword),
+		Name:          name,
+		Role:          role,
+		EmailVerified: true,
+		VerifiedAt:    &now,
+	}, nil
 }
 
 // Update updates a user
-func (s *UserService) Update(user *domain.User) error {
-	return s.userRepo.Update(user)
+func (s *UserService) Update(ctx context.Context, user *domain.User) error {
+	return s.userRepo.Update(ctx, user)
+}
+
+// Patch applies a merge patch to a user and returns the updated user.
+// Changing the email marks it unverified and cancels pending password resets,
+// which were mailed to the old address. Changing the role revokes the user's
+// sessions.
+func (s *UserService) Patch(ctx context.Context, id uuid.UUID, patch domain.PatchUserRequest) (*domain.User, error) {
+	var user *domain.User
+	err := s.txManager.WithinTx(ctx, func(tx unitofwork.Repos) error {
+		var err error
+		user, err = tx.Users.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+
+		if patch.Email != nil && *patch.Email != user.Email {
+			existing, err := tx.Users.GetByEmail(ctx, *patch.Email)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return ErrEmailTaken
+			}
+			user.Email = *patch.Email
+			user.EmailVerified = false
+			user.VerifiedAt = nil
+			if err := tx.PasswordResets.DeleteByUserID(ctx, user.ID); err != nil {
+				return err
+			}
+		}
+		if patch.Name != nil {
+			user.Name = strings.TrimSpace(*patch.Name)
+			if user.Name == "" {
+				return ErrInvalidName
+			}
+		}
+
+		if patch.Role == nil || *patch.Role == user.Role {
+			return tx.Users.Update(ctx, user)
+		}
+		user.Role = *patch.Role
+		updated, err := tx.Users.UpdateRole(ctx, user)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return ErrLastAdmin
+		}
+
+		// Access tokens of the user's sessions carry the old role
+		_, err = tx.Sessions.DeleteByUserID(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-// Delete deletes a user
-func (s *UserService) Delete(id uuid.UUID) error {
-	return s.userRepo.Delete(id)
+// Delete deletes a user with everything they own and revokes their sessions
+func (s *UserService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.txManager.WithinTx(ctx, func(tx unitofwork.Repos) error {
+		user, err := tx.Users.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+
+		if _, err := tx.Sessions.DeleteByUserID(ctx, id); err != nil {
+			return err
+		}
+		deleted, err := tx.Users.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			// Rolls back the revoked sessions as well
+			return ErrLastAdmin
+		}
+
+		for _, store := range tx.UserData {
+			if err := store.DeleteByUserID(ctx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
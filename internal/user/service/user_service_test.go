@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	"github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/internal/user/repository"
+)
+
+func newTestService() (*UserService, *authRepository.MemorySessionStore) {
+	users, sessions := repository.NewMemoryUserStore(), authRepository.NewMemorySessionStore()
+	txManager := unitofwork.NewMemoryManager(
+		users, sessions, authRepository.NewMemoryPasswordResetStore(), authRepository.NewMemoryLoginAttemptStore(),
+	)
+	return NewUserService(users, txManager), sessions
+}
+
+// createSession creates a session for userID and returns its token
+func createSession(t *testing.T, sessions *authRepository.MemorySessionStore, userID uuid.UUID) string {
+	token := uuid.NewString()
+	require.NoError(t, sessions.Create(context.Background(), &authDomain.Session{
+		UserID:    userID,
+		TokenHash: authDomain.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	return token
+}
+
+// hasSession reports whether the session with token still exists
+func hasSession(t *testing.T, sessions *authRepository.MemorySessionStore, token string) bool {
+	session, err := sessions.GetByToken(context.Background(), token)
+	require.NoError(t, err)
+	return session != nil
+}
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+	svc, sessions := newTestService()
+	admin, err := svc.Create(ctx, "admin@example.com", "password123", "Admin", domain.RoleAdmin)
+	require.NoError(t, err)
+	user, err := svc.Create(ctx, "user@example.com", "password123", "User", domain.RoleUser)
+	require.NoError(t, err)
+	adminSession := createSession(t, sessions, admin.ID)
+	userSession := createSession(t, sessions, user.ID)
+
+	strptr := func(s string) *string { return &s }
+	role := func(r domain.UserRole) *domain.UserRole { return &r }
+
+	patched, err := svc.Patch(ctx, user.ID, domain.PatchUserRequest{Name: strptr("  Renamed  ")})
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", patched.Name)
+	assert.Equal(t, "user@example.com", patched.Email)
+
+	_, err = svc.Patch(ctx, user.ID, domain.PatchUserRequest{Name: strptr("   ")})
+	assert.ErrorIs(t, err, ErrInvalidName)
+
+	_, err = svc.Patch(ctx, user.ID, domain.PatchUserRequest{Email: strptr("admin@example.com")})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	_, err = svc.Patch(ctx, uuid.New(), domain.PatchUserRequest{Name: strptr("Nobody")})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	assert.True(t, hasSession(t, sessions, userSession), "only role changes revoke sessions")
+
+	_, err = svc.Patch(ctx, admin.ID, domain.PatchUserRequest{Role: role(domain.RoleUser)})
+	assert.ErrorIs(t, err, ErrLastAdmin)
+	assert.True(t, hasSession(t, sessions, adminSession))
+
+	patched, err = svc.Patch(ctx, user.ID, domain.PatchUserRequest{Role: role(domain.RoleAdmin)})
+	require.NoError(t, err)
+	assert.Equal(t, domain.RoleAdmin, patched.Role)
+	assert.False(t, hasSession(t, sessions, userSession))
+
+	patched, err = svc.Patch(ctx, admin.ID, domain.PatchUserRequest{Role: role(domain.RoleUser)})
+	require.NoError(t, err)
+	assert.Equal(t, domain.RoleUser, patched.Role)
+	assert.False(t, hasSession(t, sessions, adminSession))
+}
+
+// newTestServiceWithResets returns a user service and the password reset
+// store of its units of work
+func newTestServiceWithResets() (*UserService, *authRepository.MemoryPasswordResetStore) {
+	users, resets := repository.NewMemoryUserStore(), authRepository.NewMemoryPasswordResetStore()
+	txManager := unitofwork.NewMemoryManager(
+		users, authRepository.NewMemorySessionStore(), resets, authRepository.NewMemoryLoginAttemptStore(),
+	)
+	return NewUserService(users, txManager), resets
+}
+
+// createResetToken creates a password reset token for userID
+func createResetToken(t *testing.T, resets *authRepository.MemoryPasswordResetStore, userID uuid.UUID, token string) {
+	require.NoError(t, resets.Create(context.Background(), &authDomain.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: authDomain.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+}
+
+func TestPatchEmail(t *testing.T) {
+	ctx := context.Background()
+	svc, resets := newTestServiceWithResets()
+	user, err := svc.Create(ctx, "old@example.com", "password123", "User", domain.RoleUser)
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+	createResetToken(t, resets, user.ID, "reset-token")
+
+	name := "Renamed"
+	patched, err := svc.Patch(ctx, user.ID, domain.PatchUserRequest{Name: &name})
+	require.NoError(t, err)
+	assert.True(t, patched.EmailVerified, "other changes keep the email verified")
+
+	// The new address has not been proven, and reset links went to the old one
+	email := "new@example.com"
+	patched, err = svc.Patch(ctx, user.ID, domain.PatchUserRequest{Email: &email})
+	require.NoError(t, err)
+	assert.False(t, patched.EmailVerified)
+	assert.Nil(t, patched.VerifiedAt)
+
+	stored, err := svc.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", stored.Email)
+	assert.False(t, stored.EmailVerified)
+	consumed, err := resets.Consume(ctx, "reset-token", time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, consumed)
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	svc, sessions := newTestService()
+	admin, err := svc.Create(ctx, "admin@example.com", "password123", "Admin", domain.RoleAdmin)
+	require.NoError(t, err)
+	user, err := svc.Create(ctx, "user@example.com", "password123", "User", domain.RoleUser)
+	require.NoError(t, err)
+	adminSession := createSession(t, sessions, admin.ID)
+	userSession := createSession(t, sessions, user.ID)
+
+	// Refusing to delete the last admin rolls back the revoked sessions
+	assert.ErrorIs(t, svc.Delete(ctx, admin.ID), ErrLastAdmin)
+	assert.True(t, hasSession(t, sessions, adminSession))
+
+	require.NoError(t, svc.Delete(ctx, user.ID))
+	assert.False(t, hasSession(t, sessions, userSession))
+	assert.ErrorIs(t, svc.Delete(ctx, user.ID), ErrUserNotFound)
+
+	users, err := svc.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, admin.ID, users[0].ID)
+}
+
+func TestDeleteRemovesUserData(t *testing.T) {
+	ctx := context.Background()
+	svc, resets := newTestServiceWithResets()
+	user, err := svc.Create(ctx, "owner@example.com", "password123", "Owner", domain.RoleUser)
+	require.NoError(t, err)
+	other, err := svc.Create(ctx, "other@example.com", "password123", "Other", domain.RoleUser)
+	require.NoError(t, err)
+	createResetToken(t, resets, user.ID, "owner-token")
+	createResetToken(t, resets, other.ID, "other-token")
+
+	require.NoError(t, svc.Delete(ctx, user.ID))
+
+	consumed, err := resets.Consume(ctx, "owner-token", time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, consumed)
+	consumed, err = resets.Consume(ctx, "other-token", time.Now())
+	require.NoError(t, err)
+	assert.NotNil(t, consumed)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	svc, sessions := newTestService()
+
+	result, err := svc.BootstrapAdmin(ctx, "admin@example.com", "first-password", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapCreated, result)
+	admin, err := svc.GetByEmail(ctx, "admin@example.com")
+	require.NoError(t, err)
+	adminSession := createSession(t, sessions, admin.ID)
+
+	result, err = svc.BootstrapAdmin(ctx, "admin@example.com", "first-password", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapUnchanged, result)
+
+	result, err = svc.BootstrapAdmin(ctx, "admin@example.com", "second-password", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapRotated, result)
+	assert.False(t, hasSession(t, sessions, adminSession))
+	assert.True(t, hasPassword(t, svc, admin.ID, "second-password"))
+
+	// A password the admin changed is kept while the configured one stays the same
+	ownPassword, err := bcrypt.GenerateFromPassword([]byte("own-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, svc.userRepo.SetPassword(ctx, admin.ID, string(ownPassword)))
+	result, err = svc.BootstrapAdmin(ctx, "admin@example.com", "second-password", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapUnchanged, result)
+	assert.True(t, hasPassword(t, svc, admin.ID, "own-password"))
+
+	result, err = svc.BootstrapAdmin(ctx, "another@example.com", "password123", "Another")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapUnchanged, result)
+}
+
+func TestBootstrapAdminWithoutAppliedPassword(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService()
+
+	// An admin bootstrapped before the applied password was recorded
+	admin, err := svc.Create(ctx, "admin@example.com", "own-password", "Admin", domain.RoleAdmin)
+	require.NoError(t, err)
+
+	result, err := svc.BootstrapAdmin(ctx, "admin@example.com", "first-password", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapUnchanged, result)
+	assert.True(t, hasPassword(t, svc, admin.ID, "own-password"))
+
+	result, err = svc.BootstrapAdmin(ctx, "admin@example.com", "second-password", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, BootstrapRotated, result)
+	assert.True(t, hasPassword(t, svc, admin.ID, "second-password"))
+}
+
+// hasPassword reports whether password is the password of the user with id
+func hasPassword(t *testing.T, svc *UserService, id uuid.UUID, password string) bool {
+	user, err := svc.GetByID(context.Background(), id)
+	require.NoError(t, err)
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+}
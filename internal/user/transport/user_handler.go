@@ -1,60 +1,81 @@
 package transport
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/acheevo/test/internal/auth/principal"
+	authService "github.com/acheevo/test/internal/auth/service"
+	rbacDomain "github.com/acheevo/test/internal/rbac/domain"
+	rbacService "github.com/acheevo/test/internal/rbac/service"
 	"github.com/acheevo/test/internal/user/domain"
 	"github.com/acheevo/test/internal/user/service"
 )
 
 // UserHandler handles user endpoints
 type UserHandler struct {
-	userService *service.UserService
-	logger      *zap.Logger
+	userService         *service.UserService
+	roleService         *rbacService.RoleService
+	verificationService *authService.EmailVerificationService
+	logger              *zap.Logger
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(userService *service.UserService, logger *zap.Logger) *UserHandler {
+func NewUserHandler(
+	userService *service.UserService,
+	roleService *rbacService.RoleService,
+	verificationService *authService.EmailVerificationService,
+	logger *zap.Logger,
+) *UserHandler {
 	return &UserHandler{
-		userService: userService,
-		logger:      logger,
+		userService:         userService,
+		roleService:         roleService,
+		verificationService: verificationService,
+		logger:              logger,
 	}
 }
 
 // GetCurrentUser returns the current authenticated user
 func (h *UserHandler) GetCurrentUser(c *gin.Context) {
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
-		return
-	}
-
-	c.JSON(http.StatusOK, user)
-}
-
-// GetUsers returns all users (admin only)
-func (h *UserHandler) GetUsers(c *gin.Context) {
 	currentUser, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
-	user, ok := currentUser.(*domain.User)
+	claimsUser, ok := currentUser.(*domain.User)
 	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user type in context"})
 		return
 	}
-	if user.Role != domain.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+
+	// The context only carries token claims, so load the full record
+	user, err := h.userService.GetByID(c.Request.Context(), claimsUser.ID)
+	if err != nil {
+		h.logger.Error("Failed to get current user", zap.String("id", claimsUser.ID.String()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
 		return
 	}
 
-	users, err := h.userService.GetAll()
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// GetUsers returns all users (requires users:read)
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	users, err := h.userService.GetAll(c.Request.Context())
 	if err != nil {
 		h.logger.Error("Failed to get users", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
@@ -73,7 +94,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetByID(id)
+	user, err := h.userService.GetByID(c.Request.Context(), id)
 	if err != nil {
 		h.logger.Error("Failed to get user", zap.String("id", idStr), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
@@ -88,21 +109,14 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// CreateUser creates a new user (admin only)
+// CreateUser creates a new user (requires users:write, and every permission
+// of the new user's role)
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	currentUser, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
-		return
-	}
+	ctx := c.Request.Context()
 
-	user, ok := currentUser.(*domain.User)
+	caller, ok := principal.FromContext(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user type in context"})
-		return
-	}
-	if user.Role != domain.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
 		return
 	}
 
@@ -112,7 +126,17 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	newUser, err := h.userService.Create(req.Email, req.Password, req.Name, req.Role)
+	if err := h.roleService.CheckGrant(ctx, caller, string(req.Role)); err != nil {
+		if errors.Is(err, rbacService.ErrCannotGrantRole) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to check role grant", zap.String("role", string(req.Role)), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	newUser, err := h.userService.Create(ctx, req.Email, req.Password, req.Name, req.Role)
 	if err != nil {
 		h.logger.Error("Failed to create user", zap.String("email", req.Email), zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -121,3 +145,163 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, newUser)
 }
+
+// patchableFields are the user fields PUT and PATCH can change
+var patchableFields = map[string]bool{"email": true, "name": true, "role": true}
+
+// UpdateUser replaces a user's email, name and role. Anyone allowed to update
+// a user may change their name; changing the email requires users:write, and
+// changing the role requires roles:write and every permission of the new role.
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var req domain.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.patchUser(c, domain.PatchUserRequest{Email: &req.Email, Name: &req.Name, Role: &req.Role})
+}
+
+// PatchUser applies a JSON merge patch to a user's email, name and role, under
+// the same rules as UpdateUser
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patch must be a JSON object"})
+		return
+	}
+	for name, value := range fields {
+		if !patchableFields[name] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Field %q cannot be changed", name)})
+			return
+		}
+		if string(value) == "null" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Field %q cannot be removed", name)})
+			return
+		}
+	}
+
+	var req domain.PatchUserRequest
+	if err := binding.JSON.BindBody(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.patchUser(c, req)
+}
+
+// DeleteUser deletes a user and revokes their sessions. The last admin cannot
+// be deleted.
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.userService.Delete(c.Request.Context(), id); err != nil {
+		h.handleError(c, err, "Failed to delete user")
+		return
+	}
+
+	h.logger.Info("Deleted user", zap.String("user_id", id.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+func (h *UserHandler) patchUser(c *gin.Context, patch domain.PatchUserRequest) {
+	ctx := c.Request.Context()
+
+	caller, ok := principal.FromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Principal not found in context"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.userService.GetByID(ctx, id)
+	if err != nil {
+		h.handleError(c, err, "Failed to update user")
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	denied, err := h.checkFieldRules(ctx, caller, user, patch)
+	if err != nil {
+		h.handleError(c, err, "Failed to update user")
+		return
+	}
+	if denied != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": denied})
+		return
+	}
+
+	updated, err := h.userService.Patch(ctx, id, patch)
+	if err != nil {
+		h.handleError(c, err, "Failed to update user")
+		return
+	}
+
+	// The new address starts out unverified; a failed send can be retried
+	// through the resend endpoint
+	if updated.Email != user.Email {
+		if err := h.verificationService.SendVerification(updated); err != nil {
+			h.logger.Error("Failed to send verification email", zap.String("user_id", id.String()), zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// checkFieldRules returns why the caller may not make a change to a user, or
+// an empty string if they may
+func (h *UserHandler) checkFieldRules(
+	ctx context.Context, caller *principal.Principal, user *domain.User, patch domain.PatchUserRequest,
+) (string, error) {
+	if patch.Email != nil && *patch.Email != user.Email {
+		allowed, err := h.roleService.HasPermission(ctx, caller, rbacDomain.PermissionUsersWrite)
+		if err != nil || !allowed {
+			return "Changing the email requires the users:write permission", err
+		}
+	}
+
+	if patch.Role != nil && *patch.Role != user.Role {
+		allowed, err := h.roleService.HasPermission(ctx, caller, rbacDomain.PermissionRolesWrite)
+		if err != nil || !allowed {
+			return "Changing the role requires the roles:write permission", err
+		}
+		if err := h.roleService.CheckGrant(ctx, caller, string(*patch.Role)); err != nil {
+			if errors.Is(err, rbacService.ErrCannotGrantRole) {
+				return err.Error(), nil
+			}
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func (h *UserHandler) handleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailTaken), errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
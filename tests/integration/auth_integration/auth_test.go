@@ -1,10 +1,12 @@
 package auth_integration
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,6 +17,7 @@ import (
 )
 
 func TestAuthIntegration(t *testing.T) {
+	ctx := context.Background()
 	deps := shared.SetupTestDependencies(t)
 	defer deps.Cleanup(t)
 
@@ -79,6 +82,8 @@ func TestAuthIntegration(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.NotEmpty(t, loginResp.Token)
+		assert.Equal(t, "Bearer", loginResp.TokenType)
+		assert.True(t, loginResp.ExpiresAt.After(time.Now()))
 		assert.Equal(t, loginReq.Email, loginResp.User.Email)
 		assert.Equal(t, userDomain.RoleUser, loginResp.User.Role)
 	})
@@ -126,4 +131,131 @@ func TestAuthIntegration(t *testing.T) {
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
+	t.Run("Access Token Carries Session Claims", func(t *testing.T) {
+		token := shared.CreateAndLoginUser(
+			t, deps, "claims@example.com", "password123", "Claims User", userDomain.RoleUser,
+		)
+
+		claims, err := deps.TokenManager.Verify(token)
+		require.NoError(t, err)
+		assert.Equal(t, "claims@example.com", claims.Email)
+		assert.Equal(t, userDomain.RoleUser, claims.Role)
+
+		session, err := deps.SessionRepo.GetByID(ctx, claims.SessionID)
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, claims.UserID, session.UserID)
+	})
+
+	t.Run("Logout Revokes Access Token", func(t *testing.T) {
+		token := shared.CreateAndLoginUser(
+			t, deps, "logout@example.com", "password123", "Logout User", userDomain.RoleUser,
+		)
+
+		req := shared.MakeAuthenticatedRequest(http.MethodPost, "/api/auth/logout", token, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// The token is still correctly signed, but its session is gone
+		req = shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", token, nil)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Tampered Token Rejected", func(t *testing.T) {
+		token := shared.CreateAndLoginUser(
+			t, deps, "tampered@example.com", "password123", "Tampered User", userDomain.RoleUser,
+		)
+
+		req := shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", token+"x", nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("Refresh Token Rotation", func(t *testing.T) {
+		shared.CreateAndLoginUser(t, deps, "refresh@example.com", "password123", "Refresh User", userDomain.RoleUser)
+		loginResp := shared.LoginUser(t, deps, "refresh@example.com", "password123")
+		require.NotEmpty(t, loginResp.RefreshToken)
+
+		reqBody, _ := json.Marshal(domain.RefreshRequest{RefreshToken: loginResp.RefreshToken})
+		req := shared.MakeRequest(http.MethodPost, "/api/auth/refresh", reqBody)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var refreshResp domain.LoginResponse
+		err := json.Unmarshal(w.Body.Bytes(), &refreshResp)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, refreshResp.Token)
+		assert.NotEqual(t, loginResp.RefreshToken, refreshResp.RefreshToken)
+		assert.Equal(t, "refresh@example.com", refreshResp.User.Email)
+
+		req = shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", refreshResp.Token, nil)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Refresh Token Reuse Revokes Family", func(t *testing.T) {
+		shared.CreateAndLoginUser(t, deps, "reuse@example.com", "password123", "Reuse User", userDomain.RoleUser)
+		loginResp := shared.LoginUser(t, deps, "reuse@example.com", "password123")
+
+		refresh := func(refreshToken string) *httptest.ResponseRecorder {
+			reqBody, _ := json.Marshal(domain.RefreshRequest{RefreshToken: refreshToken})
+			w := httptest.NewRecorder()
+			deps.Router.ServeHTTP(w, shared.MakeRequest(http.MethodPost, "/api/auth/refresh", reqBody))
+			return w
+		}
+
+		w := refresh(loginResp.RefreshToken)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var rotated domain.LoginResponse
+		err := json.Unmarshal(w.Body.Bytes(), &rotated)
+		require.NoError(t, err)
+
+		// Replaying the original refresh token is reuse
+		w = refresh(loginResp.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// The whole family is gone, including the legitimately rotated token
+		w = refresh(rotated.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		req := shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", rotated.Token, nil)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Unknown Refresh Token", func(t *testing.T) {
+		reqBody, _ := json.Marshal(domain.RefreshRequest{RefreshToken: "does-not-exist"})
+		req := shared.MakeRequest(http.MethodPost, "/api/auth/refresh", reqBody)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Refresh Tokens Stored Hashed", func(t *testing.T) {
+		shared.CreateAndLoginUser(t, deps, "hashed@example.com", "password123", "Hashed User", userDomain.RoleUser)
+		loginResp := shared.LoginUser(t, deps, "hashed@example.com", "password123")
+
+		session, err := deps.SessionRepo.GetByToken(ctx, loginResp.RefreshToken)
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, domain.HashToken(loginResp.RefreshToken), session.TokenHash)
+
+		var plaintextRows int64
+		err = deps.TestDB.Database.DB.Model(&domain.Session{}).
+			Where("token_hash = ?", loginResp.RefreshToken).
+			Count(&plaintextRows).Error
+		require.NoError(t, err)
+		assert.Zero(t, plaintextRows)
+	})
 }
@@ -0,0 +1,169 @@
+package auth_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestEmailVerificationIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupAuthRoutes()
+
+	register := func(t *testing.T, email string) userDomain.User {
+		body, _ := json.Marshal(domain.RegisterRequest{Email: email, Password: "password123", Name: "Verify User"})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/register", body))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var user userDomain.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		return user
+	}
+
+	verify := func(t *testing.T, token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(domain.VerifyEmailRequest{Token: token})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/verify-email", body))
+		return w
+	}
+
+	resend := func(t *testing.T, email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(domain.ResendVerificationRequest{Email: email})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/verify-email/resend", body))
+		return w
+	}
+
+	login := func(t *testing.T, email string) int {
+		body, _ := json.Marshal(domain.LoginRequest{Email: email, Password: "password123"})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/login", body))
+		return w.Code
+	}
+
+	t.Run("Registration Sends Verification Email", func(t *testing.T) {
+		email := "verify@example.com"
+		user := register(t, email)
+		assert.False(t, user.EmailVerified)
+		assert.Nil(t, user.VerifiedAt)
+
+		w := verify(t, shared.LastMailToken(t, deps, email))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var verified userDomain.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verified))
+		assert.True(t, verified.EmailVerified)
+		require.NotNil(t, verified.VerifiedAt)
+
+		stored, err := deps.UserRepo.GetByEmail(ctx, email)
+		require.NoError(t, err)
+		assert.True(t, stored.EmailVerified)
+
+		// Verifying again is harmless
+		assert.Equal(t, http.StatusOK, verify(t, shared.LastMailToken(t, deps, email)).Code)
+	})
+
+	t.Run("Unverified Login Blocked When Required", func(t *testing.T) {
+		deps.Config.RequireEmailVerification = true
+		defer func() { deps.Config.RequireEmailVerification = false }()
+
+		email := "blocked@example.com"
+		register(t, email)
+
+		assert.Equal(t, http.StatusForbidden, login(t, email))
+
+		require.Equal(t, http.StatusOK, verify(t, shared.LastMailToken(t, deps, email)).Code)
+		assert.Equal(t, http.StatusOK, login(t, email))
+	})
+
+	t.Run("Unverified Login Allowed By Default", func(t *testing.T) {
+		email := "allowed@example.com"
+		register(t, email)
+		assert.Equal(t, http.StatusOK, login(t, email))
+	})
+
+	t.Run("Wrong Password Still Reports Invalid Credentials", func(t *testing.T) {
+		deps.Config.RequireEmailVerification = true
+		defer func() { deps.Config.RequireEmailVerification = false }()
+
+		email := "unverified-guess@example.com"
+		register(t, email)
+
+		body, _ := json.Marshal(domain.LoginRequest{Email: email, Password: "wrongpassword"})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/login", body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Resend Sends New Link", func(t *testing.T) {
+		email := "resend@example.com"
+		register(t, email)
+
+		paths, err := deps.Mailer.Messages(email)
+		require.NoError(t, err)
+		require.Len(t, paths, 1)
+
+		assert.Equal(t, http.StatusAccepted, resend(t, email).Code)
+		deps.VerificationService.Wait()
+		paths, err = deps.Mailer.Messages(email)
+		require.NoError(t, err)
+		require.Len(t, paths, 2)
+
+		assert.Equal(t, http.StatusOK, verify(t, shared.LastMailToken(t, deps, email)).Code)
+
+		// Verified and unknown accounts get the same response but no mail
+		assert.Equal(t, http.StatusAccepted, resend(t, email).Code)
+		assert.Equal(t, http.StatusAccepted, resend(t, "unknown@example.com").Code)
+		deps.VerificationService.Wait()
+		paths, err = deps.Mailer.Messages(email)
+		require.NoError(t, err)
+		assert.Len(t, paths, 2)
+	})
+
+	t.Run("Token Bound To Email Address", func(t *testing.T) {
+		email := "changed@example.com"
+		user := register(t, email)
+		token := shared.LastMailToken(t, deps, email)
+
+		stored, err := deps.UserRepo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		stored.Email = "changed-again@example.com"
+		require.NoError(t, deps.UserRepo.Update(ctx, stored))
+
+		assert.Equal(t, http.StatusBadRequest, verify(t, token).Code)
+	})
+
+	t.Run("Invalid Tokens Rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, verify(t, "not-a-token").Code)
+
+		// An access token is not a verification token
+		loginResp := shared.LoginUser(t, deps, "verify@example.com", "password123")
+		assert.Equal(t, http.StatusBadRequest, verify(t, loginResp.Token).Code)
+
+		user, err := deps.UserRepo.GetByEmail(ctx, "allowed@example.com")
+		require.NoError(t, err)
+		expired, err := deps.TokenManager.IssueEmailVerification(user, -time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, verify(t, expired).Code)
+	})
+
+	t.Run("Admin Created Users Are Verified", func(t *testing.T) {
+		user, err := deps.UserService.Create(ctx, "admin-made@example.com", "password123", "Admin Made", userDomain.RoleUser)
+		require.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+	})
+}
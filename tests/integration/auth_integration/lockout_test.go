@@ -0,0 +1,105 @@
+package auth_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestLoginLockoutIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupUserRoutes()
+
+	login := func(email, password, remoteAddr string) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(domain.LoginRequest{Email: email, Password: password})
+		req := shared.MakeRequest(http.MethodPost, "/api/auth/login", reqBody)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Lift the progressive delay so the next attempt is evaluated immediately
+	clearDelay := func(t *testing.T) {
+		err := deps.TestDB.Database.DB.Model(&domain.LoginAttempt{}).Where("1 = 1").
+			Update("blocked_until", time.Now().Add(-time.Second)).Error
+		require.NoError(t, err)
+	}
+
+	t.Run("Progressive Delay Then Lockout", func(t *testing.T) {
+		_, err := deps.UserService.Create(ctx, "locked@example.com", "password123", "Locked User", userDomain.RoleUser)
+		require.NoError(t, err)
+		const addr = "198.51.100.7:1234"
+
+		for i := 0; i < deps.Config.LoginFreeAttempts; i++ {
+			w := login("locked@example.com", "wrongpassword", addr)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+
+		// The first failure past the free attempts starts the delay
+		w := login("locked@example.com", "wrongpassword", addr)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = login("locked@example.com", "password123", addr)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		// Keep failing until the lockout threshold
+		for i := deps.Config.LoginFreeAttempts + 1; i < deps.Config.LoginMaxFailures; i++ {
+			clearDelay(t)
+			w = login("locked@example.com", "wrongpassword", addr)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+
+		w = login("locked@example.com", "password123", addr)
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "900", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Admin Unlock", func(t *testing.T) {
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "unlockadmin@example.com", "password123", "Unlock Admin", userDomain.RoleAdmin,
+		)
+		user, err := deps.UserService.GetByEmail(ctx, "locked@example.com")
+		require.NoError(t, err)
+
+		url := "/api/users/" + user.ID.String() + "/unlock"
+		req := shared.MakeAuthenticatedRequest(http.MethodPost, url, adminToken, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = login("locked@example.com", "password123", "198.51.100.7:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Unknown Accounts Are Indistinguishable", func(t *testing.T) {
+		_, err := deps.UserService.Create(ctx, "known@example.com", "password123", "Known User", userDomain.RoleUser)
+		require.NoError(t, err)
+
+		known := login("known@example.com", "wrongpassword", "198.51.100.8:1234")
+		unknown := login("unknown@example.com", "wrongpassword", "198.51.100.9:1234")
+
+		assert.Equal(t, known.Code, unknown.Code)
+		assert.JSONEq(t, known.Body.String(), unknown.Body.String())
+
+		for i := 1; i <= deps.Config.LoginFreeAttempts; i++ {
+			login("unknown@example.com", "wrongpassword", "198.51.100.9:1234")
+		}
+		w := login("unknown@example.com", "wrongpassword", "198.51.100.9:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+}
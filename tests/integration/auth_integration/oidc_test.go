@@ -0,0 +1,177 @@
+package auth_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestOIDCIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	idp := shared.NewMockIdP(t)
+	idp.Register(deps, "mock")
+	deps.SetupAuthRoutes()
+
+	get := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// start begins a login and returns the authorization URL and the state cookie
+	start := func(t *testing.T) (string, *http.Cookie) {
+		w := get("/api/auth/oidc/mock/login", nil)
+		require.Equal(t, http.StatusFound, w.Code)
+
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == "oidc_state" {
+				assert.True(t, cookie.HttpOnly)
+				return w.Header().Get("Location"), cookie
+			}
+		}
+		t.Fatal("no state cookie set")
+		return "", nil
+	}
+
+	callback := func(callbackURL *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+		return get(callbackURL.RequestURI(), cookie)
+	}
+
+	signIn := func(t *testing.T, user shared.MockIdPUser) *httptest.ResponseRecorder {
+		authorizationURL, cookie := start(t)
+		return callback(idp.Authorize(t, authorizationURL, user), cookie)
+	}
+
+	loginResponse := func(t *testing.T, w *httptest.ResponseRecorder) domain.LoginResponse {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp domain.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.Token)
+		require.NotEmpty(t, resp.RefreshToken)
+		return resp
+	}
+
+	t.Run("Providers", func(t *testing.T) {
+		w := get("/api/auth/oidc", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"providers":["mock"]}`, w.Body.String())
+
+		assert.Equal(t, http.StatusNotFound, get("/api/auth/oidc/unknown/login", nil).Code)
+	})
+
+	t.Run("New Account", func(t *testing.T) {
+		user := shared.MockIdPUser{
+			Subject: "new-subject", Email: "oidc-new@example.com", EmailVerified: true, Name: "OIDC New",
+		}
+
+		first := loginResponse(t, signIn(t, user))
+		assert.Equal(t, user.Email, first.User.Email)
+		assert.Equal(t, "OIDC New", first.User.Name)
+		assert.Equal(t, userDomain.RoleUser, first.User.Role)
+		assert.True(t, first.User.EmailVerified)
+
+		// The session is the same kind a password login gets
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest("GET", "/api/users/me", first.Token, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// The identity signs in to the same account, even after an email change at the provider
+		user.Email = "oidc-renamed@example.com"
+		second := loginResponse(t, signIn(t, user))
+		assert.Equal(t, first.User.ID, second.User.ID)
+
+		identity, err := deps.IdentityRepo.GetByProviderSubject(ctx, "mock", "new-subject")
+		require.NoError(t, err)
+		require.NotNil(t, identity)
+		assert.Equal(t, first.User.ID, identity.UserID)
+		assert.Equal(t, "oidc-renamed@example.com", identity.Email)
+		assert.NotNil(t, identity.LastLoginAt)
+
+		// The account has no password to log in with
+		body, _ := json.Marshal(domain.LoginRequest{Email: "oidc-new@example.com", Password: "password123"})
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/login", body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Links Verified Email", func(t *testing.T) {
+		existing, err := deps.UserService.Create(ctx, "linked@example.com", "password123", "Linked", userDomain.RoleUser)
+		require.NoError(t, err)
+
+		resp := loginResponse(t, signIn(t, shared.MockIdPUser{
+			Subject: "linked-subject", Email: "linked@example.com", EmailVerified: true,
+		}))
+		assert.Equal(t, existing.ID, resp.User.ID)
+		assert.Equal(t, "Linked", resp.User.Name)
+	})
+
+	t.Run("Refuses Unverified Email", func(t *testing.T) {
+		_, err := deps.UserService.Create(ctx, "victim@example.com", "password123", "Victim", userDomain.RoleUser)
+		require.NoError(t, err)
+
+		w := signIn(t, shared.MockIdPUser{Subject: "attacker", Email: "victim@example.com", EmailVerified: false})
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		identity, err := deps.IdentityRepo.GetByProviderSubject(ctx, "mock", "attacker")
+		require.NoError(t, err)
+		assert.Nil(t, identity)
+	})
+
+	t.Run("State Is Bound And Single Use", func(t *testing.T) {
+		user := shared.MockIdPUser{Subject: "state-subject", Email: "state@example.com", EmailVerified: true}
+
+		// Without the cookie of the browser that started the login
+		authorizationURL, _ := start(t)
+		assert.Equal(t, http.StatusBadRequest, callback(idp.Authorize(t, authorizationURL, user), nil).Code)
+
+		// With the cookie of another login
+		authorizationURL, _ = start(t)
+		_, otherCookie := start(t)
+		assert.Equal(t, http.StatusBadRequest, callback(idp.Authorize(t, authorizationURL, user), otherCookie).Code)
+
+		// Replaying a completed callback
+		authorizationURL, cookie := start(t)
+		callbackURL := idp.Authorize(t, authorizationURL, user)
+		loginResponse(t, callback(callbackURL, cookie))
+		assert.Equal(t, http.StatusBadRequest, callback(callbackURL, cookie).Code)
+	})
+
+	t.Run("Nonce Mismatch", func(t *testing.T) {
+		authorizationURL, cookie := start(t)
+
+		// An ID token minted for another login is refused
+		parsed, err := url.Parse(authorizationURL)
+		require.NoError(t, err)
+		query := parsed.Query()
+		query.Set("nonce", "other-nonce")
+		parsed.RawQuery = query.Encode()
+
+		w := callback(idp.Authorize(t, parsed.String(), shared.MockIdPUser{
+			Subject: "nonce-subject", Email: "nonce@example.com", EmailVerified: true,
+		}), cookie)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Refused By Provider", func(t *testing.T) {
+		_, cookie := start(t)
+		w := get("/api/auth/oidc/mock/callback?error=access_denied&state="+url.QueryEscape(cookie.Value), cookie)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -0,0 +1,163 @@
+package auth_integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+// passkeyCeremony mirrors domain.PasskeyCeremony with the options kept raw for the authenticator
+type passkeyCeremony struct {
+	CeremonyID uuid.UUID       `json:"ceremony_id"`
+	Options    json.RawMessage `json:"options"`
+}
+
+func TestPasskeyIntegration(t *testing.T) {
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupAuthRoutes()
+
+	do := func(method, url, token string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if payload != nil {
+			body, _ = json.Marshal(payload)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(method, url, token, body))
+		return w
+	}
+
+	begin := func(t *testing.T, url, token string) passkeyCeremony {
+		w := do("POST", url, token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var ceremony passkeyCeremony
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ceremony))
+		require.NotEqual(t, uuid.Nil, ceremony.CeremonyID)
+		return ceremony
+	}
+
+	register := func(t *testing.T, authenticator *shared.SoftAuthenticator, token, name string) domain.WebAuthnCredential {
+		ceremony := begin(t, "/api/auth/passkeys/register/begin", token)
+		w := do("POST", "/api/auth/passkeys/register/finish", token, domain.PasskeyRegistrationRequest{
+			CeremonyID: ceremony.CeremonyID,
+			Name:       name,
+			Credential: authenticator.Create(t, ceremony.Options),
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var passkey domain.WebAuthnCredential
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &passkey))
+		return passkey
+	}
+
+	login := func(t *testing.T, authenticator *shared.SoftAuthenticator) *httptest.ResponseRecorder {
+		ceremony := begin(t, "/api/auth/login/passkey/begin", "")
+		return do("POST", "/api/auth/login/passkey/finish", "", domain.PasskeyLoginRequest{
+			CeremonyID: ceremony.CeremonyID,
+			Credential: authenticator.Get(t, ceremony.Options),
+		})
+	}
+
+	t.Run("Register And Login", func(t *testing.T) {
+		email := "passkey@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Passkey User", userDomain.RoleUser)
+		authenticator := shared.NewSoftAuthenticator()
+
+		passkey := register(t, authenticator, accessToken, "Laptop")
+		assert.Equal(t, "Laptop", passkey.Name)
+		assert.Equal(t, "internal", passkey.Transports)
+		assert.Nil(t, passkey.LastUsedAt)
+
+		w := login(t, authenticator)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var loginResp domain.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loginResp))
+		assert.Equal(t, email, loginResp.User.Email)
+		assert.NotEmpty(t, loginResp.RefreshToken)
+
+		// The passkey login issues a regular session
+		assert.Equal(t, http.StatusOK, do("GET", "/api/users/me", loginResp.Token, nil).Code)
+
+		w = do("GET", "/api/auth/passkeys", accessToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var passkeys []domain.WebAuthnCredential
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &passkeys))
+		require.Len(t, passkeys, 1)
+		assert.Equal(t, passkey.ID, passkeys[0].ID)
+		assert.Equal(t, int64(authenticator.SignCount), passkeys[0].SignCount)
+		assert.NotNil(t, passkeys[0].LastUsedAt)
+	})
+
+	t.Run("Ceremony Is Single Use", func(t *testing.T) {
+		accessToken := shared.CreateAndLoginUser(
+			t, deps, "single-use@example.com", "password123", "Single Use", userDomain.RoleUser,
+		)
+		authenticator := shared.NewSoftAuthenticator()
+		register(t, authenticator, accessToken, "")
+
+		ceremony := begin(t, "/api/auth/login/passkey/begin", "")
+		request := domain.PasskeyLoginRequest{
+			CeremonyID: ceremony.CeremonyID,
+			Credential: authenticator.Get(t, ceremony.Options),
+		}
+		require.Equal(t, http.StatusOK, do("POST", "/api/auth/login/passkey/finish", "", request).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/api/auth/login/passkey/finish", "", request).Code)
+
+		// A registration ceremony cannot be answered as a login
+		registration := begin(t, "/api/auth/passkeys/register/begin", accessToken)
+		w := do("POST", "/api/auth/login/passkey/finish", "", domain.PasskeyLoginRequest{
+			CeremonyID: registration.CeremonyID,
+			Credential: authenticator.Get(t, ceremony.Options),
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Sign Count Regression", func(t *testing.T) {
+		accessToken := shared.CreateAndLoginUser(t, deps, "clone@example.com", "password123", "Clone", userDomain.RoleUser)
+		authenticator := shared.NewSoftAuthenticator()
+		register(t, authenticator, accessToken, "")
+
+		require.Equal(t, http.StatusOK, login(t, authenticator).Code)
+		require.Equal(t, http.StatusOK, login(t, authenticator).Code)
+
+		// A clone replaying from an older counter is refused
+		authenticator.SignCount = 0
+		assert.Equal(t, http.StatusUnauthorized, login(t, authenticator).Code)
+	})
+
+	t.Run("Wrong Origin", func(t *testing.T) {
+		accessToken := shared.CreateAndLoginUser(t, deps, "phish@example.com", "password123", "Phish", userDomain.RoleUser)
+		authenticator := shared.NewSoftAuthenticator()
+		register(t, authenticator, accessToken, "")
+
+		authenticator.Origin = "https://evil.example.com"
+		assert.Equal(t, http.StatusUnauthorized, login(t, authenticator).Code)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		accessToken := shared.CreateAndLoginUser(t, deps, "remove@example.com", "password123", "Remove", userDomain.RoleUser)
+		authenticator := shared.NewSoftAuthenticator()
+		passkey := register(t, authenticator, accessToken, "")
+
+		// Other users cannot remove it
+		otherToken := shared.CreateAndLoginUser(t, deps, "other@example.com", "password123", "Other", userDomain.RoleUser)
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/auth/passkeys/"+passkey.ID.String(), otherToken, nil).Code)
+
+		assert.Equal(t, http.StatusOK, do("DELETE", "/api/auth/passkeys/"+passkey.ID.String(), accessToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/auth/passkeys/"+passkey.ID.String(), accessToken, nil).Code)
+
+		// A removed passkey no longer logs in
+		assert.Equal(t, http.StatusUnauthorized, login(t, authenticator).Code)
+	})
+}
@@ -0,0 +1,174 @@
+package auth_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestPasswordResetIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupAuthRoutes()
+
+	forgot := func(t *testing.T, email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(domain.ForgotPasswordRequest{Email: email})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/password/forgot", body))
+		return w
+	}
+
+	reset := func(t *testing.T, token, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(domain.ResetPasswordRequest{Token: token, Password: password})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/password/reset", body))
+		return w
+	}
+
+	login := func(t *testing.T, email, password string) int {
+		body, _ := json.Marshal(domain.LoginRequest{Email: email, Password: password})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/login", body))
+		return w.Code
+	}
+
+	t.Run("Reset Sets New Password And Revokes Sessions", func(t *testing.T) {
+		email := "reset@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "oldpassword", "Reset User", userDomain.RoleUser)
+
+		w := forgot(t, email)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		token := shared.LastMailToken(t, deps, email)
+
+		// Only the digest is stored
+		var stored domain.PasswordResetToken
+		require.NoError(t, deps.TestDB.Database.DB.Where("token_hash = ?", domain.HashToken(token)).First(&stored).Error)
+		assert.NotEqual(t, token, stored.TokenHash)
+		assert.Nil(t, stored.UsedAt)
+
+		w = reset(t, token, "newpassword")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, login(t, email, "oldpassword"))
+		assert.Equal(t, http.StatusOK, login(t, email, "newpassword"))
+
+		// The session from before the reset is gone
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest("GET", "/api/users/me", accessToken, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Token Is Single Use", func(t *testing.T) {
+		email := "single-use@example.com"
+		shared.CreateAndLoginUser(t, deps, email, "password123", "Single Use", userDomain.RoleUser)
+
+		require.Equal(t, http.StatusAccepted, forgot(t, email).Code)
+		token := shared.LastMailToken(t, deps, email)
+
+		require.Equal(t, http.StatusOK, reset(t, token, "newpassword1").Code)
+		assert.Equal(t, http.StatusBadRequest, reset(t, token, "newpassword2").Code)
+		assert.Equal(t, http.StatusOK, login(t, email, "newpassword1"))
+	})
+
+	t.Run("Concurrent Redemptions Succeed Once", func(t *testing.T) {
+		email := "concurrent-reset@example.com"
+		shared.CreateAndLoginUser(t, deps, email, "password123", "Concurrent", userDomain.RoleUser)
+
+		require.Equal(t, http.StatusAccepted, forgot(t, email).Code)
+		token := shared.LastMailToken(t, deps, email)
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			successes int
+		)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := deps.ResetService.ResetPassword(ctx, token, "racepassword"); err == nil {
+					mu.Lock()
+					successes++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, successes)
+	})
+
+	t.Run("Expired Token Is Rejected", func(t *testing.T) {
+		email := "expired-reset@example.com"
+		shared.CreateAndLoginUser(t, deps, email, "password123", "Expired", userDomain.RoleUser)
+
+		require.Equal(t, http.StatusAccepted, forgot(t, email).Code)
+		token := shared.LastMailToken(t, deps, email)
+
+		err := deps.TestDB.Database.DB.Model(&domain.PasswordResetToken{}).
+			Where("token_hash = ?", domain.HashToken(token)).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, reset(t, token, "newpassword").Code)
+		assert.Equal(t, http.StatusOK, login(t, email, "password123"))
+	})
+
+	t.Run("New Request Invalidates Earlier Token", func(t *testing.T) {
+		email := "reissue@example.com"
+		shared.CreateAndLoginUser(t, deps, email, "password123", "Reissue", userDomain.RoleUser)
+
+		require.Equal(t, http.StatusAccepted, forgot(t, email).Code)
+		first := shared.LastMailToken(t, deps, email)
+		require.Equal(t, http.StatusAccepted, forgot(t, email).Code)
+		second := shared.LastMailToken(t, deps, email)
+		require.NotEqual(t, first, second)
+
+		assert.Equal(t, http.StatusBadRequest, reset(t, first, "newpassword").Code)
+		assert.Equal(t, http.StatusOK, reset(t, second, "newpassword").Code)
+	})
+
+	t.Run("Unknown Email Gets Same Response Without Mail", func(t *testing.T) {
+		w := forgot(t, "nobody@example.com")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		paths, err := deps.Mailer.Messages("nobody@example.com")
+		require.NoError(t, err)
+		assert.Empty(t, paths)
+	})
+
+	t.Run("Reset Clears Lockout", func(t *testing.T) {
+		email := "locked-reset@example.com"
+		shared.CreateAndLoginUser(t, deps, email, "password123", "Locked", userDomain.RoleUser)
+
+		for i := 0; i < deps.Config.LoginMaxFailures; i++ {
+			login(t, email, "wrongpassword")
+		}
+		require.Equal(t, http.StatusTooManyRequests, login(t, email, "password123"))
+
+		require.Equal(t, http.StatusAccepted, forgot(t, email).Code)
+		require.Equal(t, http.StatusOK, reset(t, shared.LastMailToken(t, deps, email), "newpassword").Code)
+
+		assert.Equal(t, http.StatusOK, login(t, email, "newpassword"))
+	})
+
+	t.Run("Invalid Requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, forgot(t, "not-an-email").Code)
+		assert.Equal(t, http.StatusBadRequest, reset(t, "unknown-token", "newpassword").Code)
+		assert.Equal(t, http.StatusBadRequest, reset(t, "", "newpassword").Code)
+	})
+}
@@ -0,0 +1,219 @@
+package auth_integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestPersonalAccessTokenIntegration(t *testing.T) {
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupAccessTokenRoutes()
+
+	do := func(method, url, token string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if payload != nil {
+			body, _ = json.Marshal(payload)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(method, url, token, body))
+		return w
+	}
+
+	signUp := func(t *testing.T, email string) string {
+		return shared.CreateAndLoginUser(t, deps, email, "password123", "PAT User", userDomain.RoleUser)
+	}
+
+	create := func(
+		t *testing.T, sessionToken string, req domain.CreatePersonalAccessTokenRequest,
+	) domain.CreatedPersonalAccessToken {
+		w := do("POST", "/api/auth/tokens", sessionToken, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var created domain.CreatedPersonalAccessToken
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+
+	list := func(t *testing.T, sessionToken string) []domain.PersonalAccessToken {
+		w := do("GET", "/api/auth/tokens", sessionToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var accessTokens []domain.PersonalAccessToken
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accessTokens))
+		return accessTokens
+	}
+
+	t.Run("Create List And Use", func(t *testing.T) {
+		email := "pat-user@example.com"
+		sessionToken := signUp(t, email)
+
+		created := create(t, sessionToken, domain.CreatePersonalAccessTokenRequest{
+			Name:   "CI",
+			Scopes: []string{domain.ScopeUsersRead, domain.ScopeUsersRead},
+		})
+		assert.True(t, strings.HasPrefix(created.Token, domain.PersonalAccessTokenPrefix))
+		assert.Equal(t, created.Token[:12], created.Prefix)
+		assert.Equal(t, "CI", created.Name)
+		assert.Equal(t, []string{domain.ScopeUsersRead}, created.Scopes)
+		assert.Nil(t, created.ExpiresAt)
+		assert.Nil(t, created.LastUsedAt)
+
+		// Only the digest is stored
+		var stored domain.PersonalAccessToken
+		require.NoError(t, deps.TestDB.Database.DB.Where("id = ?", created.ID).First(&stored).Error)
+		assert.Equal(t, domain.HashToken(created.Token), stored.TokenHash)
+
+		// The token works as a bearer token and in the X-API-Key header
+		w := do("GET", "/api/users/me", created.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var me userDomain.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &me))
+		assert.Equal(t, email, me.Email)
+
+		req := httptest.NewRequest("GET", "/api/users/me", nil)
+		req.Header.Set("X-API-Key", created.Token)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Listings show use, but never the token
+		w = do("GET", "/api/auth/tokens", sessionToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), created.Token)
+
+		accessTokens := list(t, sessionToken)
+		require.Len(t, accessTokens, 1)
+		assert.Equal(t, created.ID, accessTokens[0].ID)
+		require.NotNil(t, accessTokens[0].LastUsedAt)
+		assert.NotEmpty(t, accessTokens[0].LastUsedIP)
+	})
+
+	t.Run("Scopes Are Enforced", func(t *testing.T) {
+		sessionToken := shared.CreateAndLoginUser(
+			t, deps, "pat-admin@example.com", "password123", "PAT Admin", userDomain.RoleAdmin,
+		)
+		readOnly := create(t, sessionToken, domain.CreatePersonalAccessTokenRequest{
+			Name:   "Read only",
+			Scopes: []string{domain.ScopeUsersRead},
+		})
+		readWrite := create(t, sessionToken, domain.CreatePersonalAccessTokenRequest{
+			Name:   "Provisioning",
+			Scopes: []string{domain.ScopeUsersWrite},
+		})
+
+		newUser := map[string]string{
+			"email":    "provisioned@example.com",
+			"password": "password123",
+			"name":     "Provisioned",
+		}
+		w := do("POST", "/api/users", readOnly.Token, newUser)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), domain.ScopeUsersWrite)
+
+		w = do("POST", "/api/users", readWrite.Token, newUser)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		// Write does not imply read
+		w = do("GET", "/api/users/me", readWrite.Token, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do("GET", "/api/auth/sessions", readOnly.Token, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Cannot Manage Tokens", func(t *testing.T) {
+		sessionToken := signUp(t, "pat-escalate@example.com")
+		created := create(t, sessionToken, domain.CreatePersonalAccessTokenRequest{
+			Name:   "Everything",
+			Scopes: domain.TokenScopes,
+		})
+
+		w := do("POST", "/api/auth/tokens", created.Token, domain.CreatePersonalAccessTokenRequest{
+			Name:   "Another",
+			Scopes: []string{domain.ScopeUsersRead},
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do("GET", "/api/auth/tokens", created.Token, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Invalid Requests", func(t *testing.T) {
+		sessionToken := signUp(t, "pat-invalid@example.com")
+		past := time.Now().Add(-time.Hour)
+
+		for name, req := range map[string]domain.CreatePersonalAccessTokenRequest{
+			"unknown scope": {Name: "x", Scopes: []string{"admin"}},
+			"no scopes":     {Name: "x", Scopes: []string{}},
+			"no name":       {Scopes: []string{domain.ScopeUsersRead}},
+			"past expiry":   {Name: "x", Scopes: []string{domain.ScopeUsersRead}, ExpiresAt: &past},
+		} {
+			w := do("POST", "/api/auth/tokens", sessionToken, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, name)
+		}
+		assert.Empty(t, list(t, sessionToken))
+
+		w := do("GET", "/api/users/me", domain.PersonalAccessTokenPrefix+"unknown", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Expired Token", func(t *testing.T) {
+		sessionToken := signUp(t, "pat-expiry@example.com")
+		expiresAt := time.Now().Add(time.Hour)
+		created := create(t, sessionToken, domain.CreatePersonalAccessTokenRequest{
+			Name:      "Short lived",
+			Scopes:    []string{domain.ScopeUsersRead},
+			ExpiresAt: &expiresAt,
+		})
+		require.NotNil(t, created.ExpiresAt)
+
+		w := do("GET", "/api/users/me", created.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		err := deps.TestDB.Database.DB.Model(&domain.PersonalAccessToken{}).
+			Where("id = ?", created.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error
+		require.NoError(t, err)
+
+		w = do("GET", "/api/users/me", created.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// Expired tokens stay listed until revoked
+		assert.Len(t, list(t, sessionToken), 1)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		sessionToken := signUp(t, "pat-revoke@example.com")
+		otherToken := signUp(t, "pat-other@example.com")
+		created := create(t, sessionToken, domain.CreatePersonalAccessTokenRequest{
+			Name:   "Revoked",
+			Scopes: []string{domain.ScopeUsersRead},
+		})
+
+		// Only the owner can revoke a token
+		w := do("DELETE", "/api/auth/tokens/"+created.ID.String(), otherToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = do("DELETE", "/api/auth/tokens/"+created.ID.String(), sessionToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = do("GET", "/api/users/me", created.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = do("DELETE", "/api/auth/tokens/"+created.ID.String(), sessionToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, list(t, sessionToken))
+	})
+}
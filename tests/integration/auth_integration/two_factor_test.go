@@ -0,0 +1,358 @@
+package auth_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/auth/totp"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestTwoFactorIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupAuthRoutes()
+	deps.Router.DELETE("/api/users/:id/2fa",
+		deps.AuthMiddleware.Authenticate, deps.PolicyMiddleware.Authorize("users:write", deps.PolicyMiddleware.UserFromPath),
+		deps.TwoFactorHandler.ResetUserTwoFactor)
+
+	do := func(method, url, token string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if payload != nil {
+			body, _ = json.Marshal(payload)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(method, url, token, body))
+		return w
+	}
+
+	// code returns the code offset steps from now. Each accepted code must be
+	// for a later step than the previous one, so callers use increasing offsets.
+	code := func(t *testing.T, secret string, offset int64) string {
+		c, err := totp.Code(secret, totp.Step(time.Now())+offset)
+		require.NoError(t, err)
+		return c
+	}
+
+	login := func(t *testing.T, email, password string) *httptest.ResponseRecorder {
+		return do("POST", "/api/auth/login", "", domain.LoginRequest{Email: email, Password: password})
+	}
+
+	challenge := func(t *testing.T, email, password string) domain.TwoFactorChallenge {
+		w := login(t, email, password)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp domain.TwoFactorChallenge
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.True(t, resp.TwoFactorRequired)
+		require.NotEmpty(t, resp.ChallengeToken)
+		return resp
+	}
+
+	// enroll enables 2FA for a logged-in user, confirming with the code of the previous step
+	enroll := func(t *testing.T, accessToken string) (string, []string) {
+		w := do("POST", "/api/auth/2fa/enroll", accessToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var enrollment domain.TwoFactorEnrollment
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+		require.NotEmpty(t, enrollment.Secret)
+
+		w = do("POST", "/api/auth/2fa/confirm", accessToken, domain.TwoFactorCodeRequest{
+			Code: code(t, enrollment.Secret, -1),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var codes domain.RecoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &codes))
+		return enrollment.Secret, codes.RecoveryCodes
+	}
+
+	t.Run("Enrollment", func(t *testing.T) {
+		email := "enroll@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Enroll User", userDomain.RoleUser)
+
+		w := do("POST", "/api/auth/2fa/enroll", accessToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var enrollment domain.TwoFactorEnrollment
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+		assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/test-api:enroll@example.com?")
+		assert.Contains(t, enrollment.OTPAuthURI, "secret="+enrollment.Secret)
+
+		// Not enabled until confirmed, so login still needs only the password
+		assert.Equal(t, http.StatusOK, login(t, email, "password123").Code)
+		var loginResp domain.LoginResponse
+		require.NoError(t, json.Unmarshal(login(t, email, "password123").Body.Bytes(), &loginResp))
+		assert.NotEmpty(t, loginResp.Token)
+
+		// A wrong first code does not confirm
+		w = do("POST", "/api/auth/2fa/confirm", accessToken, domain.TwoFactorCodeRequest{Code: "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = do("POST", "/api/auth/2fa/confirm", accessToken, domain.TwoFactorCodeRequest{
+			Code: code(t, enrollment.Secret, 0),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		var codes domain.RecoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &codes))
+		assert.Len(t, codes.RecoveryCodes, 10)
+
+		w = do("GET", "/api/auth/2fa", accessToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var status domain.TwoFactorStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		assert.True(t, status.Enabled)
+		assert.Equal(t, int64(10), status.RecoveryCodesRemaining)
+
+		// Enrolling again would silently replace the working secret
+		assert.Equal(t, http.StatusConflict, do("POST", "/api/auth/2fa/enroll", accessToken, nil).Code)
+
+		// The secret is encrypted at rest
+		user, err := deps.UserRepo.GetByEmail(ctx, email)
+		require.NoError(t, err)
+		credential, err := deps.TwoFactorRepo.GetCredential(ctx, user.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, credential.Secret, enrollment.Secret)
+	})
+
+	t.Run("Two Step Login", func(t *testing.T) {
+		email := "two-step@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Two Step", userDomain.RoleUser)
+		secret, _ := enroll(t, accessToken)
+
+		resp := challenge(t, email, "password123")
+		assert.False(t, resp.EnrollmentRequired)
+		assert.WithinDuration(t, time.Now().Add(5*time.Minute), resp.ExpiresAt, 5*time.Second)
+
+		// The challenge is not an access token
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/users/me", resp.ChallengeToken, nil).Code)
+
+		current := code(t, secret, 0)
+		w := do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			Code:           current,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		var loginResp domain.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loginResp))
+		assert.NotEmpty(t, loginResp.Token)
+		assert.NotEmpty(t, loginResp.RefreshToken)
+		assert.Empty(t, loginResp.RecoveryCodes)
+		assert.Equal(t, http.StatusOK, do("GET", "/api/users/me", loginResp.Token, nil).Code)
+
+		// A code works only once
+		resp = challenge(t, email, "password123")
+		w = do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			Code:           current,
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// A wrong password never reaches the second step
+		assert.Equal(t, http.StatusUnauthorized, login(t, email, "wrongpassword").Code)
+	})
+
+	t.Run("Recovery Codes", func(t *testing.T) {
+		email := "recovery@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Recovery", userDomain.RoleUser)
+		secret, codes := enroll(t, accessToken)
+
+		resp := challenge(t, email, "password123")
+		w := do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			RecoveryCode:   codes[0],
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// Each recovery code is single use
+		resp = challenge(t, email, "password123")
+		w = do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			RecoveryCode:   codes[0],
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		status, err := deps.AuthService.TwoFactorStatus(ctx, mustUserID(t, deps, email))
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), status.RecoveryCodesRemaining)
+
+		// Regenerating invalidates the old codes
+		w = do("POST", "/api/auth/2fa/recovery-codes", accessToken, domain.TwoFactorCodeRequest{Code: code(t, secret, 0)})
+		require.Equal(t, http.StatusOK, w.Code)
+		var regenerated domain.RecoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &regenerated))
+		require.Len(t, regenerated.RecoveryCodes, 10)
+
+		resp = challenge(t, email, "password123")
+		w = do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			RecoveryCode:   codes[1],
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// Recovery codes are accepted regardless of case and separators
+		w = do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			RecoveryCode:   " " + toUpperNoDash(regenerated.RecoveryCodes[0]),
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Wrong Codes Are Throttled", func(t *testing.T) {
+		email := "guess@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Guess", userDomain.RoleUser)
+		secret, _ := enroll(t, accessToken)
+
+		lastCode := ""
+		for i := 0; i <= deps.Config.LoginFreeAttempts; i++ {
+			// Going back through the password step must not reset the count
+			resp := challenge(t, email, "password123")
+			w := do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+				ChallengeToken: resp.ChallengeToken,
+				Code:           "000000",
+			})
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			lastCode = resp.ChallengeToken
+		}
+
+		w := do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: lastCode,
+			Code:           code(t, secret, 0),
+		})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		email := "disable@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Disable", userDomain.RoleUser)
+		secret, _ := enroll(t, accessToken)
+
+		w := do("POST", "/api/auth/2fa/disable", accessToken, domain.TwoFactorCodeRequest{Code: "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = do("POST", "/api/auth/2fa/disable", accessToken, domain.TwoFactorCodeRequest{Code: code(t, secret, 0)})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var loginResp domain.LoginResponse
+		w = login(t, email, "password123")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loginResp))
+		assert.NotEmpty(t, loginResp.Token)
+	})
+
+	t.Run("Required For Role", func(t *testing.T) {
+		deps.Config.TwoFactorRequiredRoles = []string{string(userDomain.RoleAdmin)}
+		defer func() { deps.Config.TwoFactorRequiredRoles = nil }()
+
+		email := "mfa-admin@example.com"
+		_, err := deps.UserService.Create(ctx, email, "password123", "MFA Admin", userDomain.RoleAdmin)
+		require.NoError(t, err)
+
+		resp := challenge(t, email, "password123")
+		require.True(t, resp.EnrollmentRequired)
+
+		// An enrollment challenge cannot be completed without enrolling
+		w := do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			Code:           "123456",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = do("POST", "/api/auth/login/2fa/enroll", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		var enrollment domain.TwoFactorEnrollment
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+
+		w = do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: resp.ChallengeToken,
+			Code:           code(t, enrollment.Secret, 0),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		var loginResp domain.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loginResp))
+		assert.NotEmpty(t, loginResp.Token)
+		assert.Len(t, loginResp.RecoveryCodes, 10)
+
+		// The next login is a regular challenge
+		next := challenge(t, email, "password123")
+		assert.False(t, next.EnrollmentRequired)
+
+		// Only enrollment challenges can start an enrollment
+		w = do("POST", "/api/auth/login/2fa/enroll", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: next.ChallengeToken,
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// The requirement cannot be switched off by the user
+		w = do("POST", "/api/auth/2fa/disable", loginResp.Token, domain.TwoFactorCodeRequest{
+			Code: code(t, enrollment.Secret, 1),
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Users without the role are unaffected
+		shared.CreateAndLoginUser(t, deps, "mfa-user@example.com", "password123", "MFA User", userDomain.RoleUser)
+	})
+
+	t.Run("Admin Reset", func(t *testing.T) {
+		email := "lost-device@example.com"
+		accessToken := shared.CreateAndLoginUser(t, deps, email, "password123", "Lost Device", userDomain.RoleUser)
+		enroll(t, accessToken)
+		challenge(t, email, "password123")
+
+		userID := mustUserID(t, deps, email)
+		assert.Equal(t, http.StatusForbidden, do("DELETE", "/api/users/"+userID.String()+"/2fa", accessToken, nil).Code)
+
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "reset-admin@example.com", "password123", "Admin", userDomain.RoleAdmin,
+		)
+		w := do("DELETE", "/api/users/"+userID.String()+"/2fa", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = login(t, email, "password123")
+		require.Equal(t, http.StatusOK, w.Code)
+		var loginResp domain.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loginResp))
+		assert.NotEmpty(t, loginResp.Token)
+	})
+
+	t.Run("Invalid Challenge", func(t *testing.T) {
+		loginResp := shared.LoginUser(t, deps, "reset-admin@example.com", "password123")
+
+		w := do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{
+			ChallengeToken: loginResp.Token,
+			Code:           "123456",
+		})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = do("POST", "/api/auth/login/2fa", "", domain.TwoFactorChallengeRequest{Code: "123456"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func mustUserID(t *testing.T, deps *shared.TestDependencies, email string) uuid.UUID {
+	ctx := context.Background()
+	user, err := deps.UserRepo.GetByEmail(ctx, email)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	return user.ID
+}
+
+func toUpperNoDash(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+}
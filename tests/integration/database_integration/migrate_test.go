@@ -0,0 +1,213 @@
+package database_integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	rbacDomain "github.com/acheevo/test/internal/rbac/domain"
+	"github.com/acheevo/test/internal/shared/database"
+	"github.com/acheevo/test/internal/shared/testutil"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+func TestMigrationsIntegration(t *testing.T) {
+	// The test database is migrated on setup
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	ctx := context.Background()
+	db := testDB.Database
+	migrator, err := database.NewMigrator(db)
+	require.NoError(t, err)
+
+	t.Run("Everything Is Applied", func(t *testing.T) {
+		require.NoError(t, migrator.Check(ctx))
+
+		statuses, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, statuses)
+		for _, status := range statuses {
+			assert.NotNil(t, status.AppliedAt, status.Migration.String())
+			assert.False(t, status.Unknown)
+		}
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("Seeds The Built-in Roles", func(t *testing.T) {
+		for _, builtin := range rbacDomain.BuiltinRoles() {
+			var role rbacDomain.Role
+			require.NoError(t, db.DB.Where("name = ?", builtin.Name).First(&role).Error)
+			assert.True(t, role.Builtin)
+			assert.Equal(t, builtin.Description, role.Description)
+			assert.ElementsMatch(t, builtin.Permissions, role.Permissions)
+		}
+	})
+
+	t.Run("Down And Up Again", func(t *testing.T) {
+		reverted, err := migrator.Down(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, reverted, 1)
+		assert.ErrorIs(t, migrator.Check(ctx), database.ErrSchemaOutOfDate)
+
+		pending, err := migrator.Pending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, reverted, pending)
+
+		reverted, err = migrator.Down(ctx, 100)
+		require.NoError(t, err)
+		assert.NotEmpty(t, reverted)
+		assert.False(t, db.DB.Migrator().HasTable("users"))
+		assert.False(t, db.DB.Migrator().HasTable("roles"))
+
+		reverted, err = migrator.Down(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, reverted)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, applied)
+		assert.True(t, db.DB.Migrator().HasTable("users"))
+		require.NoError(t, migrator.Check(ctx))
+	})
+
+	t.Run("Concurrent Migrators Apply Each Migration Once", func(t *testing.T) {
+		_, err := migrator.Down(ctx, 100)
+		require.NoError(t, err)
+
+		results := make([][]database.Migration, 4)
+		errs := make([]error, len(results))
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				m, err := database.NewMigrator(db)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				results[i], errs[i] = m.Up(ctx)
+			}(i)
+		}
+		wg.Wait()
+
+		total := 0
+		for i := range results {
+			require.NoError(t, errs[i])
+			total += len(results[i])
+		}
+		statuses, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, len(statuses), total)
+	})
+
+	t.Run("Adopts An Existing Schema", func(t *testing.T) {
+		// Databases from before versioned migrations have the tables but no
+		// schema_migrations rows
+		require.NoError(t, db.DB.Exec("DROP TABLE schema_migrations").Error)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, applied)
+		require.NoError(t, migrator.Check(ctx))
+	})
+
+	t.Run("Upgrades The Baseline Schema", func(t *testing.T) {
+		resetToSchema(t, db, migrator, baselineSchema)
+
+		createdAt := time.Now().Add(-24 * time.Hour).Truncate(time.Microsecond)
+		require.NoError(t, db.DB.Exec(
+			"INSERT INTO users (id, email, password, name, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			uuid.New(), "legacy@example.com", "hash", "Legacy User", "user", createdAt, createdAt,
+		).Error)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, applied)
+		require.NoError(t, migrator.Check(ctx))
+
+		for _, column := range []string{"token_hash", "ip_address", "last_seen_at", "absolute_expires_at"} {
+			assert.True(t, db.DB.Migrator().HasColumn("sessions", column), column)
+		}
+		assert.False(t, db.DB.Migrator().HasColumn("sessions", "token"))
+
+		user, err := userRepository.NewUserRepository(db).GetByEmail(ctx, "legacy@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.True(t, user.EmailVerified, "accounts that predate email verification count as verified")
+		require.NotNil(t, user.VerifiedAt)
+		assert.True(t, user.VerifiedAt.Equal(createdAt))
+	})
+
+	t.Run("Rehashes Legacy Plaintext Tokens", func(t *testing.T) {
+		resetToSchema(t, db, migrator, baselineSchema+refreshTokensSchema)
+
+		sessionID := uuid.New()
+		expiresAt := time.Now().Add(time.Hour)
+		require.NoError(t, db.DB.Exec(
+			"INSERT INTO sessions (id, user_id, token, expires_at, created_at, updated_at) VALUES (?, ?, ?, ?, now(), now())",
+			sessionID, uuid.New(), "legacy-session-token", expiresAt,
+		).Error)
+		require.NoError(t, db.DB.Exec(
+			"INSERT INTO refresh_tokens (id, session_id, token, rotated_at, expires_at) VALUES (?, ?, ?, now(), ?)",
+			uuid.New(), sessionID, "legacy-refresh-token", expiresAt,
+		).Error)
+
+		_, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.False(t, db.DB.Migrator().HasColumn("sessions", "token"))
+		assert.False(t, db.DB.Migrator().HasColumn("refresh_tokens", "token"))
+
+		sessions := authRepository.NewSessionRepository(db)
+		session, err := sessions.GetByToken(ctx, "legacy-session-token")
+		require.NoError(t, err)
+		require.NotNil(t, session, "the session is found by the digest of its plaintext token")
+		assert.Equal(t, sessionID, session.ID)
+
+		spent, err := sessions.GetRotatedToken(ctx, "legacy-refresh-token")
+		require.NoError(t, err)
+		require.NotNil(t, spent)
+		assert.Equal(t, sessionID, spent.SessionID)
+	})
+}
+
+// refreshTokensSchema is the table AutoMigrate added for spent refresh tokens,
+// before tokens were stored as digests
+const refreshTokensSchema = `
+CREATE TABLE refresh_tokens (
+    id uuid, session_id uuid NOT NULL, token text, rotated_at timestamptz, expires_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX idx_refresh_tokens_token ON refresh_tokens (token);
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens (session_id);`
+
+// baselineSchema is the schema AutoMigrate created for the first release
+const baselineSchema = `
+CREATE TABLE users (
+    id uuid, email text, password text, name text, role text, created_at timestamptz, updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+CREATE TABLE sessions (
+    id uuid, user_id uuid NOT NULL, token text, expires_at timestamptz, created_at timestamptz, updated_at timestamptz,
+    PRIMARY KEY (id)
+);`
+
+// resetToSchema reverts every migration, forgets them and creates schema in
+// their place, as found in a database from before versioned migrations
+func resetToSchema(t *testing.T, db *database.Database, migrator *database.Migrator, schema string) {
+	_, err := migrator.Down(context.Background(), 100)
+	require.NoError(t, err)
+	require.NoError(t, db.DB.Exec("DROP TABLE schema_migrations").Error)
+	require.NoError(t, db.DB.Exec(schema).Error)
+}
@@ -0,0 +1,194 @@
+package maintenance_integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/maintenance"
+	oauthDomain "github.com/acheevo/test/internal/oauth/domain"
+	oauthRepository "github.com/acheevo/test/internal/oauth/repository"
+	serviceAccountDomain "github.com/acheevo/test/internal/serviceaccount/domain"
+	serviceAccountRepository "github.com/acheevo/test/internal/serviceaccount/repository"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestSessionReaperIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupAuthRoutes()
+
+	db := deps.TestDB.Database
+	reaper := maintenance.NewSessionReaper(db, deps.SessionRepo, deps.Logger, time.Hour, 2)
+
+	expireAllSessions := func(t *testing.T) {
+		err := db.DB.Model(&domain.Session{}).Where("1 = 1").
+			Update("expires_at", time.Now().Add(-time.Minute)).Error
+		require.NoError(t, err)
+	}
+
+	countSessions := func(t *testing.T) int64 {
+		var count int64
+		require.NoError(t, db.DB.Model(&domain.Session{}).Count(&count).Error)
+		return count
+	}
+
+	t.Run("Purges Expired Sessions In Batches", func(t *testing.T) {
+		shared.CreateAndLoginUser(t, deps, "reaper@example.com", "password123", "Reaper User", userDomain.RoleUser)
+		for i := 0; i < 4; i++ {
+			shared.LoginUser(t, deps, "reaper@example.com", "password123")
+		}
+		expireAllSessions(t)
+
+		// A live session must survive the purge
+		live := shared.LoginUser(t, deps, "reaper@example.com", "password123")
+		require.Equal(t, int64(6), countSessions(t))
+
+		reaper.RunOnce(context.Background())
+
+		assert.Equal(t, int64(1), countSessions(t))
+		session, err := deps.SessionRepo.GetByToken(ctx, live.RefreshToken)
+		require.NoError(t, err)
+		assert.NotNil(t, session)
+
+		stats := reaper.Stats()
+		assert.Equal(t, int64(1), stats.Runs)
+		assert.Equal(t, int64(5), stats.SessionsDeleted)
+		assert.Empty(t, stats.LastError)
+	})
+
+	t.Run("Purges Forgotten Login Attempts", func(t *testing.T) {
+		purger := maintenance.NewSessionReaper(db, deps.SessionRepo, deps.Logger, time.Hour, 2)
+		purger.Purge("login_attempts", func(ctx context.Context, limit int) (int64, error) {
+			return deps.AttemptRepo.DeleteExpired(ctx, time.Now().Add(-deps.Config.LoginFailureWindow), limit)
+		})
+
+		// Sprayed emails leave one record each behind
+		forgotten := time.Now().Add(-2 * deps.Config.LoginFailureWindow)
+		keys := []string{"account:recent@example.com"}
+		for i := 0; i < 3; i++ {
+			key := fmt.Sprintf("account:sprayed-%d@example.com", i)
+			_, err := deps.AttemptRepo.RecordFailure(ctx, key, forgotten, forgotten.Add(-time.Hour))
+			require.NoError(t, err)
+			keys = append(keys, key)
+		}
+		_, err := deps.AttemptRepo.RecordFailure(ctx, keys[0], time.Now(), time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+
+		purger.RunOnce(ctx)
+
+		assert.Equal(t, int64(3), purger.Stats().RowsDeleted["login_attempts"])
+		found, err := deps.AttemptRepo.GetByKeys(ctx, keys)
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.Equal(t, keys[0], found[0].Key)
+	})
+
+	t.Run("Purges Expired Ceremonies, Login States, Grants And Client Credentials Tokens", func(t *testing.T) {
+		grantRepo := oauthRepository.NewGrantRepository(db)
+		serviceAccountRepo := serviceAccountRepository.NewServiceAccountRepository(db)
+		purger := maintenance.NewSessionReaper(db, deps.SessionRepo, deps.Logger, time.Hour, 2)
+		purger.Purge("webauthn_ceremonies", deps.PasskeyRepo.DeleteExpired)
+		purger.Purge("oidc_login_states", deps.IdentityRepo.DeleteExpiredLoginStates)
+		purger.Purge("oauth_authorization_codes", grantRepo.DeleteExpiredCodes)
+		purger.Purge("oauth_access_tokens", grantRepo.DeleteExpiredAccessTokens)
+		purger.Purge("service_account_keys", serviceAccountRepo.DeleteExpiredClientCredentialsTokens)
+
+		// Each table gets three expired rows and one live row
+		for i, expiresAt := range []time.Time{
+			time.Now().Add(-time.Minute), time.Now().Add(-time.Minute), time.Now().Add(-time.Minute),
+			time.Now().Add(time.Hour),
+		} {
+			require.NoError(t, deps.PasskeyRepo.CreateCeremony(ctx, &domain.WebAuthnCeremony{
+				Kind: "login", Data: []byte("{}"), ExpiresAt: expiresAt,
+			}))
+			require.NoError(t, deps.IdentityRepo.CreateLoginState(ctx, &domain.OIDCLoginState{
+				StateHash: fmt.Sprintf("state-%d", i), Provider: "test", Nonce: "nonce", CodeVerifier: "verifier",
+				ExpiresAt: expiresAt,
+			}))
+			require.NoError(t, grantRepo.CreateCode(ctx, &oauthDomain.AuthorizationCode{
+				CodeHash: fmt.Sprintf("code-%d", i), ClientID: uuid.New(), UserID: uuid.New(),
+				RedirectURI: "https://client.example.com/callback", Scope: "openid", ExpiresAt: expiresAt,
+			}))
+			require.NoError(t, grantRepo.CreateAccessToken(ctx, &oauthDomain.AccessToken{
+				TokenHash: fmt.Sprintf("token-%d", i), ClientID: uuid.New(), UserID: uuid.New(),
+				Scope: "openid", ExpiresAt: expiresAt,
+			}))
+			require.NoError(t, serviceAccountRepo.CreateKey(ctx, &serviceAccountDomain.APIKey{
+				ServiceAccountID: uuid.New(), Name: "client credentials", Prefix: "cc",
+				KeyHash: fmt.Sprintf("cc-key-%d", i), Scopes: []string{}, ClientCredentials: true, ExpiresAt: &expiresAt,
+			}))
+		}
+		// Expired API keys stay listed for their owners
+		expiredAt := time.Now().Add(-time.Minute)
+		require.NoError(t, serviceAccountRepo.CreateKey(ctx, &serviceAccountDomain.APIKey{
+			ServiceAccountID: uuid.New(), Name: "expired", Prefix: "ex",
+			KeyHash: "expired-api-key", Scopes: []string{}, ExpiresAt: &expiredAt,
+		}))
+
+		purger.RunOnce(ctx)
+
+		stats := purger.Stats()
+		assert.Empty(t, stats.LastError)
+		for table, model := range map[string]interface{}{
+			"webauthn_ceremonies":       &domain.WebAuthnCeremony{},
+			"oidc_login_states":         &domain.OIDCLoginState{},
+			"oauth_authorization_codes": &oauthDomain.AuthorizationCode{},
+			"oauth_access_tokens":       &oauthDomain.AccessToken{},
+		} {
+			assert.Equal(t, int64(3), stats.RowsDeleted[table], table)
+			var count int64
+			require.NoError(t, db.DB.Model(model).Count(&count).Error)
+			assert.Equal(t, int64(1), count, table)
+		}
+		assert.Equal(t, int64(3), stats.RowsDeleted["service_account_keys"])
+		var keys []serviceAccountDomain.APIKey
+		require.NoError(t, db.DB.Order("key_hash").Find(&keys).Error)
+		require.Len(t, keys, 2)
+		assert.Equal(t, "cc-key-3", keys[0].KeyHash)
+		assert.Equal(t, "expired-api-key", keys[1].KeyHash)
+	})
+
+	t.Run("Logs At Info Only When Rows Were Purged", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		quiet := maintenance.NewSessionReaper(db, deps.SessionRepo, zap.New(core), time.Hour, 2)
+
+		quiet.RunOnce(ctx)
+		assert.Zero(t, logs.Len(), "an idle run logs at debug")
+
+		shared.LoginUser(t, deps, "reaper@example.com", "password123")
+		expireAllSessions(t)
+		quiet.RunOnce(ctx)
+		require.Equal(t, 1, logs.Len())
+		assert.Equal(t, "Session reaper purged expired rows", logs.All()[0].Message)
+	})
+
+	t.Run("Skips When Another Replica Holds The Lock", func(t *testing.T) {
+		shared.LoginUser(t, deps, "reaper@example.com", "password123")
+		expireAllSessions(t)
+		before := countSessions(t)
+
+		// Hold the reaper's lock on another connection, as another replica would
+		other := maintenance.NewSessionReaper(db, deps.SessionRepo, deps.Logger, time.Hour, 2)
+		acquired, err := db.WithAdvisoryLock(context.Background(), maintenance.SessionReaperLockKey, func() error {
+			other.RunOnce(context.Background())
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		assert.Equal(t, int64(1), other.Stats().SkippedRuns)
+		assert.Equal(t, before, countSessions(t))
+	})
+}
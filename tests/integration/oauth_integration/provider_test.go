@@ -0,0 +1,343 @@
+package oauth_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/acheevo/test/internal/oauth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+const (
+	appRedirectURI = "https://app.example.com/callback"
+	spaRedirectURI = "http://localhost:5173/callback"
+)
+
+func TestOIDCProviderIntegration(t *testing.T) {
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+	deps.SetupOAuthRoutes()
+
+	// Relying parties talk to the provider over HTTP, so the issuer must be the server's URL
+	server := httptest.NewServer(deps.Router)
+	defer server.Close()
+	deps.Config.OAuthIssuer = server.URL
+
+	ctx := context.Background()
+	adminToken := shared.CreateAndLoginUser(t, deps, "admin@example.com", "password123", "Admin", userDomain.RoleAdmin)
+	userToken := shared.CreateAndLoginUser(t, deps, "user@example.com", "password123", "Test User", userDomain.RoleUser)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	registerClient := func(t *testing.T, public bool, redirectURI string) domain.ClientRegistration {
+		body, _ := json.Marshal(domain.CreateClientRequest{
+			Name: "Internal App", RedirectURIs: []string{redirectURI}, Public: public,
+		})
+		w := serve(shared.MakeAuthenticatedRequest("POST", "/api/oauth/clients", adminToken, body))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var registration domain.ClientRegistration
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &registration))
+		assert.Equal(t, public, registration.ClientSecret == "")
+		return registration
+	}
+
+	provider, err := oidc.NewProvider(ctx, server.URL)
+	require.NoError(t, err)
+
+	relyingParty := func(registration domain.ClientRegistration, redirectURI string) *oauth2.Config {
+		return &oauth2.Config{
+			ClientID:     registration.ID.String(),
+			ClientSecret: registration.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURI,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		}
+	}
+
+	// authorize follows an authorization URL to the consent page and posts the
+	// request back with the user's decision, as the consent page would
+	authorize := func(t *testing.T, authorizationURL, token string, approve *bool) domain.AuthorizationResult {
+		parsed, err := url.Parse(authorizationURL)
+		require.NoError(t, err)
+
+		w := serve(shared.MakeRequest("GET", parsed.RequestURI(), nil))
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		consentPage, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, "/oauth/consent", consentPage.Path)
+
+		query := consentPage.Query()
+		body, _ := json.Marshal(domain.AuthorizationDecision{
+			AuthorizationRequest: domain.AuthorizationRequest{
+				ResponseType:        query.Get("response_type"),
+				ClientID:            query.Get("client_id"),
+				RedirectURI:         query.Get("redirect_uri"),
+				Scope:               query.Get("scope"),
+				State:               query.Get("state"),
+				Nonce:               query.Get("nonce"),
+				CodeChallenge:       query.Get("code_challenge"),
+				CodeChallengeMethod: query.Get("code_challenge_method"),
+			},
+			Approve: approve,
+		})
+		w = serve(shared.MakeAuthenticatedRequest("POST", "/oauth/authorize", token, body))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var result domain.AuthorizationResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+
+	// callback returns the query the client's redirect URI receives
+	callback := func(t *testing.T, result domain.AuthorizationResult, redirectURI string) url.Values {
+		require.True(t, strings.HasPrefix(result.RedirectTo, redirectURI+"?"), result.RedirectTo)
+		parsed, err := url.Parse(result.RedirectTo)
+		require.NoError(t, err)
+		return parsed.Query()
+	}
+
+	approve, deny := true, false
+
+	t.Run("Discovery", func(t *testing.T) {
+		w := serve(shared.MakeRequest("GET", "/.well-known/openid-configuration", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var metadata domain.ProviderMetadata
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+		assert.Equal(t, server.URL, metadata.Issuer)
+		assert.Equal(t, server.URL+"/oauth/jwks", metadata.JWKSURI)
+		assert.Equal(t, []string{"S256"}, metadata.CodeChallengeMethodsSupported)
+	})
+
+	var confidential domain.ClientRegistration
+
+	t.Run("Authorization Code Flow", func(t *testing.T) {
+		confidential = registerClient(t, false, appRedirectURI)
+		config := relyingParty(confidential, appRedirectURI)
+		verifier := oauth2.GenerateVerifier()
+		authorizationURL := config.AuthCodeURL("app-state", oidc.Nonce("app-nonce"), oauth2.S256ChallengeOption(verifier))
+
+		// The first authorization asks for consent
+		result := authorize(t, authorizationURL, userToken, nil)
+		assert.True(t, result.ConsentRequired)
+		assert.Equal(t, "Internal App", result.ClientName)
+		assert.Equal(t, []string{"openid", "profile", "email"}, result.Scopes)
+
+		query := callback(t, authorize(t, authorizationURL, userToken, &approve), appRedirectURI)
+		assert.Equal(t, "app-state", query.Get("state"))
+		code := query.Get("code")
+		require.NotEmpty(t, code)
+
+		token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+		require.NoError(t, err)
+		rawIDToken, ok := token.Extra("id_token").(string)
+		require.True(t, ok)
+
+		idToken, err := provider.Verifier(&oidc.Config{ClientID: config.ClientID}).Verify(ctx, rawIDToken)
+		require.NoError(t, err)
+		assert.Equal(t, "app-nonce", idToken.Nonce)
+
+		var claims struct {
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"email_verified"`
+			Name          string `json:"name"`
+		}
+		require.NoError(t, idToken.Claims(&claims))
+		assert.Equal(t, "user@example.com", claims.Email)
+		assert.Equal(t, "Test User", claims.Name)
+
+		userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		require.NoError(t, err)
+		assert.Equal(t, idToken.Subject, userInfo.Subject)
+		assert.Equal(t, "user@example.com", userInfo.Email)
+
+		// A code is exchanged once
+		_, err = config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+		assert.Error(t, err)
+
+		// Consent is remembered, so the next authorization redirects straight back
+		query = callback(t, authorize(t, authorizationURL, userToken, nil), appRedirectURI)
+		assert.NotEmpty(t, query.Get("code"))
+
+		// The client secret is required
+		config.ClientSecret = "wrong-secret"
+		query = callback(t, authorize(t, authorizationURL, userToken, nil), appRedirectURI)
+		_, err = config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+		assert.Error(t, err)
+	})
+
+	t.Run("Narrower Scopes Release Fewer Claims", func(t *testing.T) {
+		config := relyingParty(confidential, appRedirectURI)
+		config.Scopes = []string{oidc.ScopeOpenID, "unknown"}
+
+		query := callback(t, authorize(t, config.AuthCodeURL("state"), userToken, nil), appRedirectURI)
+		token, err := config.Exchange(ctx, query.Get("code"))
+		require.NoError(t, err)
+		assert.Equal(t, "openid", token.Extra("scope"))
+
+		req := shared.MakeAuthenticatedRequest("GET", "/oauth/userinfo", token.AccessToken, nil)
+		w := serve(req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var userInfo map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &userInfo))
+		assert.Contains(t, userInfo, "sub")
+		assert.NotContains(t, userInfo, "email")
+		assert.NotContains(t, userInfo, "name")
+	})
+
+	t.Run("Public Client Requires PKCE", func(t *testing.T) {
+		public := registerClient(t, true, spaRedirectURI)
+		config := relyingParty(public, spaRedirectURI)
+
+		// Without a code challenge the error goes back to the client
+		parsed, err := url.Parse(config.AuthCodeURL("spa-state"))
+		require.NoError(t, err)
+		w := serve(shared.MakeRequest("GET", parsed.RequestURI(), nil))
+		require.Equal(t, http.StatusFound, w.Code)
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "invalid_request", location.Query().Get("error"))
+		assert.Equal(t, "spa-state", location.Query().Get("state"))
+
+		verifier := oauth2.GenerateVerifier()
+		authorizationURL := config.AuthCodeURL("spa-state", oauth2.S256ChallengeOption(verifier))
+
+		// A wrong verifier is refused
+		query := callback(t, authorize(t, authorizationURL, userToken, &approve), spaRedirectURI)
+		_, err = config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(oauth2.GenerateVerifier()))
+		assert.Error(t, err)
+
+		query = callback(t, authorize(t, authorizationURL, userToken, nil), spaRedirectURI)
+		token, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+		require.NoError(t, err)
+		assert.NotEmpty(t, token.Extra("id_token"))
+	})
+
+	t.Run("Unregistered Redirect URI Is Not Followed", func(t *testing.T) {
+		config := relyingParty(confidential, "https://attacker.example.com/callback")
+		parsed, err := url.Parse(config.AuthCodeURL("state"))
+		require.NoError(t, err)
+
+		w := serve(shared.MakeRequest("GET", parsed.RequestURI(), nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+	})
+
+	t.Run("Denied Consent", func(t *testing.T) {
+		otherToken := shared.CreateAndLoginUser(t, deps, "other@example.com", "password123", "Other", userDomain.RoleUser)
+		config := relyingParty(confidential, appRedirectURI)
+
+		query := callback(t, authorize(t, config.AuthCodeURL("deny-state"), otherToken, &deny), appRedirectURI)
+		assert.Equal(t, "access_denied", query.Get("error"))
+		assert.Equal(t, "deny-state", query.Get("state"))
+		assert.Empty(t, query.Get("code"))
+	})
+
+	t.Run("Key Rotation", func(t *testing.T) {
+		config := relyingParty(confidential, appRedirectURI)
+		verifier := provider.Verifier(&oidc.Config{ClientID: config.ClientID})
+
+		issue := func() string {
+			query := callback(t, authorize(t, config.AuthCodeURL("state"), userToken, nil), appRedirectURI)
+			token, err := config.Exchange(ctx, query.Get("code"))
+			require.NoError(t, err)
+			rawIDToken, ok := token.Extra("id_token").(string)
+			require.True(t, ok)
+			return rawIDToken
+		}
+		keyID := func(rawIDToken string) string {
+			parsed, _, err := jwt.NewParser().ParseUnverified(rawIDToken, jwt.MapClaims{})
+			require.NoError(t, err)
+			kid, _ := parsed.Header["kid"].(string)
+			return kid
+		}
+
+		before := issue()
+
+		w := serve(shared.MakeAuthenticatedRequest("POST", "/api/oauth/keys/rotate", userToken, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = serve(shared.MakeAuthenticatedRequest("POST", "/api/oauth/keys/rotate", adminToken, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		after := issue()
+		assert.NotEqual(t, keyID(before), keyID(after))
+
+		// Both keys are published, so tokens signed before the rotation still verify
+		w = serve(shared.MakeRequest("GET", "/oauth/jwks", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var jwks domain.JSONWebKeySet
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+		assert.Len(t, jwks.Keys, 2)
+
+		_, err := verifier.Verify(ctx, before)
+		assert.NoError(t, err)
+		_, err = verifier.Verify(ctx, after)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Consent Revocation", func(t *testing.T) {
+		config := relyingParty(confidential, appRedirectURI)
+		query := callback(t, authorize(t, config.AuthCodeURL("state"), userToken, nil), appRedirectURI)
+		token, err := config.Exchange(ctx, query.Get("code"))
+		require.NoError(t, err)
+
+		w := serve(shared.MakeAuthenticatedRequest("GET", "/api/oauth/consents", userToken, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var consents []domain.ConsentResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &consents))
+		require.Len(t, consents, 2)
+		assert.Equal(t, "Internal App", consents[0].ClientName)
+
+		w = serve(shared.MakeAuthenticatedRequest("DELETE", "/api/oauth/consents/"+confidential.ID.String(), userToken, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// Tokens the client holds for the user stop working, and consent is asked for again
+		w = serve(shared.MakeAuthenticatedRequest("GET", "/oauth/userinfo", token.AccessToken, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+		assert.True(t, authorize(t, config.AuthCodeURL("state"), userToken, nil).ConsentRequired)
+
+		w = serve(shared.MakeAuthenticatedRequest("DELETE", "/api/oauth/consents/"+confidential.ID.String(), userToken, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Client Administration", func(t *testing.T) {
+		body, _ := json.Marshal(domain.CreateClientRequest{Name: "App", RedirectURIs: []string{appRedirectURI}})
+		w := serve(shared.MakeAuthenticatedRequest("POST", "/api/oauth/clients", userToken, body))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		body, _ = json.Marshal(domain.CreateClientRequest{Name: "App", RedirectURIs: []string{"http://app.example.com/cb"}})
+		w = serve(shared.MakeAuthenticatedRequest("POST", "/api/oauth/clients", adminToken, body))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = serve(shared.MakeAuthenticatedRequest("GET", "/api/oauth/clients", adminToken, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "secret")
+
+		w = serve(shared.MakeAuthenticatedRequest("DELETE", "/api/oauth/clients/"+confidential.ID.String(), adminToken, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// A deleted client can no longer start authorizations
+		parsed, err := url.Parse(relyingParty(confidential, appRedirectURI).AuthCodeURL("state"))
+		require.NoError(t, err)
+		w = serve(shared.MakeRequest("GET", parsed.RequestURI(), nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
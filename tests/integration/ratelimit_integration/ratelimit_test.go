@@ -0,0 +1,129 @@
+package ratelimit_integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	"github.com/acheevo/test/internal/middleware"
+	"github.com/acheevo/test/internal/ratelimit"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestRateLimitIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	store := ratelimit.NewPostgresStore(deps.TestDB.Database)
+	limiter := middleware.NewRateLimitMiddleware(store, deps.Logger)
+
+	limit := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 3, Window: time.Hour}
+
+	api := deps.Router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		auth.Use(limiter.Limit("auth", limit, middleware.ByIP))
+		{
+			auth.POST("/login", deps.AuthHandler.Login)
+		}
+
+		users := api.Group("/users")
+		users.Use(deps.AuthMiddleware.Authenticate, limiter.Limit("api", limit, middleware.ByAPIKey, middleware.ByUserID))
+		{
+			users.GET("/me", deps.UserHandler.GetCurrentUser)
+		}
+	}
+
+	t.Run("Postgres Store Enforces Limit With Headers", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/login", []byte(`{}`)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, "3;w=3600", w.Header().Get("RateLimit-Policy"))
+			assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, []string{"2", "1", "0"}[i], w.Header().Get("RateLimit-Remaining"))
+		}
+
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest("POST", "/api/auth/login", []byte(`{}`)))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	})
+
+	t.Run("Authenticated Requests Are Keyed By User", func(t *testing.T) {
+		// Both users share the test client IP but get their own budgets
+		// Log in through the service, as the rate limited login route is already exhausted
+		login := func(email string) string {
+			_, err := deps.UserService.Create(ctx, email, "password123", "Limited User", userDomain.RoleUser)
+			require.NoError(t, err)
+			resp, err := deps.AuthService.Login(ctx, email, "password123", authDomain.ClientInfo{IPAddress: "192.0.2.1"})
+			require.NoError(t, err)
+			return resp.Token
+		}
+		tokenA := login("limit-a@example.com")
+		tokenB := login("limit-b@example.com")
+
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest("GET", "/api/users/me", tokenA, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest("GET", "/api/users/me", tokenA, nil))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest("GET", "/api/users/me", tokenB, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Concurrent Updates Are Serialized", func(t *testing.T) {
+		bucket := ratelimit.Limit{Algorithm: ratelimit.TokenBucket, Requests: 10, Window: time.Hour}
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			allowed int
+		)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := ratelimit.Allow(ctx, store, "concurrent", bucket)
+				assert.NoError(t, err)
+				if result.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 10, allowed)
+	})
+
+	t.Run("Disabled Limit Passes Through", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/open", limiter.Limit("open", ratelimit.Limit{}), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, shared.MakeRequest("GET", "/open", nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+}
@@ -0,0 +1,221 @@
+package rbac_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/rbac/domain"
+	serviceAccountDomain "github.com/acheevo/test/internal/serviceaccount/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestRoleIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupRoleRoutes()
+
+	adminToken := shared.CreateAndLoginUser(t, deps, "admin@example.com", "password123", "Admin", userDomain.RoleAdmin)
+	userToken := shared.CreateAndLoginUser(t, deps, "user@example.com", "password123", "Test User", userDomain.RoleUser)
+	user, err := deps.UserRepo.GetByEmail(ctx, "user@example.com")
+	require.NoError(t, err)
+	userRoles := "/api/users/" + user.ID.String() + "/roles"
+	shared.CreateAndLoginUser(t, deps, "peer@example.com", "password123", "Peer", userDomain.RoleUser)
+	peer, err := deps.UserRepo.GetByEmail(ctx, "peer@example.com")
+	require.NoError(t, err)
+	peerSessions := "/api/users/" + peer.ID.String() + "/sessions"
+
+	do := func(method, url, token string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if payload != nil {
+			body, _ = json.Marshal(payload)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(method, url, token, body))
+		return w
+	}
+
+	createRole := func(t *testing.T, name string, permissions ...string) domain.Role {
+		w := do("POST", "/api/roles", adminToken, domain.CreateRoleRequest{Name: name, Permissions: permissions})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var role domain.Role
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &role))
+		return role
+	}
+
+	listRoles := func(t *testing.T, url string) []domain.Role {
+		w := do("GET", url, adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var roles []domain.Role
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &roles))
+		return roles
+	}
+
+	newUser := func(email string, role userDomain.UserRole) map[string]string {
+		return map[string]string{"email": email, "password": "password123", "name": "New User", "role": string(role)}
+	}
+
+	t.Run("Built-in Roles Are Seeded", func(t *testing.T) {
+		roles := listRoles(t, "/api/roles")
+		require.Len(t, roles, 2)
+		assert.Equal(t, "admin", roles[0].Name)
+		assert.True(t, roles[0].Builtin)
+		assert.ElementsMatch(t, domain.Permissions, roles[0].Permissions)
+		assert.Equal(t, "user", roles[1].Name)
+		assert.Empty(t, roles[1].Permissions)
+
+		// Users have the built-in role named by their role
+		roles = listRoles(t, userRoles)
+		require.Len(t, roles, 1)
+		assert.Equal(t, "user", roles[0].Name)
+
+		// Built-in roles cannot be changed
+		w := do("PUT", "/api/roles/"+roles[0].ID.String(), adminToken, domain.UpdateRoleRequest{
+			Permissions: []string{domain.PermissionUsersRead},
+		})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = do("DELETE", "/api/roles/"+roles[0].ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = do("PUT", userRoles+"/"+roles[0].ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Users Need Permissions", func(t *testing.T) {
+		w := do("GET", "/api/roles", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("POST", "/api/roles", userToken, domain.CreateRoleRequest{Name: "mine"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("GET", "/api/users", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("GET", "/api/users", adminToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Invalid Roles", func(t *testing.T) {
+		w := do("POST", "/api/roles", adminToken, domain.CreateRoleRequest{Name: "Support Team"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = do("POST", "/api/roles", adminToken, domain.CreateRoleRequest{
+			Name: "support", Permissions: []string{"users:delete"},
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = do("POST", "/api/roles", adminToken, domain.CreateRoleRequest{Name: "admin"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Custom Roles Grant Permissions", func(t *testing.T) {
+		role := createRole(t, "support",
+			domain.PermissionUsersRead, domain.PermissionSessionsRead, domain.PermissionUsersRead)
+		assert.False(t, role.Builtin)
+		assert.Equal(t, []string{domain.PermissionUsersRead, domain.PermissionSessionsRead}, role.Permissions)
+
+		w := do("PUT", userRoles+"/"+role.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		// Assigning again changes nothing
+		w = do("PUT", userRoles+"/"+role.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		roles := listRoles(t, userRoles)
+		require.Len(t, roles, 2)
+		assert.Equal(t, "user", roles[0].Name)
+		assert.Equal(t, "support", roles[1].Name)
+
+		w = do("GET", "/api/users", userToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = do("GET", peerSessions, userToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = do("POST", "/api/users", userToken, newUser("support-made@example.com", userDomain.RoleUser))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Changes to a role apply at once
+		w = do("PUT", "/api/roles/"+role.ID.String(), adminToken, domain.UpdateRoleRequest{
+			Description: "Read-only session support", Permissions: []string{domain.PermissionSessionsRead},
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = do("GET", "/api/users", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do("DELETE", userRoles+"/"+role.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = do("GET", peerSessions, userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("DELETE", userRoles+"/"+role.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Permissions Cannot Be Escalated", func(t *testing.T) {
+		role := createRole(t, "provisioner", domain.PermissionUsersWrite, domain.PermissionServiceAccountsWrite)
+		w := do("PUT", userRoles+"/"+role.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = do("POST", "/api/users", userToken, newUser("new-user@example.com", userDomain.RoleUser))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		w = do("POST", "/api/users", userToken, newUser("new-admin@example.com", userDomain.RoleAdmin))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do("POST", "/api/service-accounts", userToken, serviceAccountDomain.CreateServiceAccountRequest{
+			Name: "Escalation", Role: userDomain.RoleAdmin,
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("POST", "/api/service-accounts", userToken, serviceAccountDomain.CreateServiceAccountRequest{
+			Name: "Harmless", Role: userDomain.RoleUser,
+		})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		// Deleting a role takes it away from its users
+		w = do("DELETE", "/api/roles/"+role.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = do("POST", "/api/users", userToken, newUser("late-user@example.com", userDomain.RoleUser))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Len(t, listRoles(t, userRoles), 1)
+
+		w = do("GET", "/api/roles/"+role.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Roles Cannot Grant More Than The Caller Has", func(t *testing.T) {
+		manager := createRole(t, "role-manager", domain.PermissionRolesRead, domain.PermissionRolesWrite)
+		w := do("PUT", userRoles+"/"+manager.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = do("POST", "/api/roles", userToken, domain.CreateRoleRequest{
+			Name: "escalation", Permissions: []string{domain.PermissionUsersWrite},
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("POST", "/api/roles", userToken, domain.CreateRoleRequest{
+			Name: "reader", Permissions: []string{domain.PermissionRolesRead},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var reader domain.Role
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reader))
+
+		w = do("PUT", "/api/roles/"+reader.ID.String(), userToken, domain.UpdateRoleRequest{
+			Permissions: []string{domain.PermissionRolesRead, domain.PermissionUsersWrite},
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("PUT", "/api/roles/"+manager.ID.String(), userToken, domain.UpdateRoleRequest{
+			Permissions: domain.Permissions,
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		provisioner := createRole(t, "user-provisioner", domain.PermissionUsersWrite)
+		w = do("PUT", userRoles+"/"+provisioner.ID.String(), userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("PUT", userRoles+"/"+reader.ID.String(), userToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		roles := listRoles(t, userRoles)
+		require.Len(t, roles, 3)
+		assert.Equal(t, []string{"user", "reader", "role-manager"},
+			[]string{roles[0].Name, roles[1].Name, roles[2].Name})
+	})
+}
@@ -0,0 +1,223 @@
+package serviceaccount_integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	oauthDomain "github.com/acheevo/test/internal/oauth/domain"
+	"github.com/acheevo/test/internal/serviceaccount/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestServiceAccountIntegration(t *testing.T) {
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupServiceAccountRoutes()
+
+	adminToken := shared.CreateAndLoginUser(t, deps, "admin@example.com", "password123", "Admin", userDomain.RoleAdmin)
+	userToken := shared.CreateAndLoginUser(t, deps, "user@example.com", "password123", "Test User", userDomain.RoleUser)
+
+	do := func(method, url, token string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if payload != nil {
+			body, _ = json.Marshal(payload)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(method, url, token, body))
+		return w
+	}
+
+	createAccount := func(t *testing.T, name string, role userDomain.UserRole) domain.ServiceAccount {
+		w := do("POST", "/api/service-accounts", adminToken, domain.CreateServiceAccountRequest{
+			Name: name, Description: "Nightly sync", Role: role,
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var account domain.ServiceAccount
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &account))
+		return account
+	}
+
+	createKey := func(t *testing.T, accountID string, scopes ...string) domain.CreatedAPIKey {
+		w := do("POST", "/api/service-accounts/"+accountID+"/keys", adminToken, domain.CreateAPIKeyRequest{
+			Name: "Deploy", Scopes: scopes,
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var created domain.CreatedAPIKey
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+
+	requestToken := func(clientID, clientSecret, scope string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"client_credentials"}, "scope": {scope}}
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Create And List", func(t *testing.T) {
+		account := createAccount(t, "Reporting", userDomain.RoleUser)
+		assert.Equal(t, "Reporting", account.Name)
+		assert.Equal(t, userDomain.RoleUser, account.Role)
+
+		w := do("GET", "/api/service-accounts", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var accounts []domain.ServiceAccount
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accounts))
+		require.NotEmpty(t, accounts)
+		assert.Equal(t, account.ID, accounts[0].ID)
+
+		w = do("GET", "/api/service-accounts/"+account.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "client_secret")
+	})
+
+	t.Run("Admin Only", func(t *testing.T) {
+		w := do("GET", "/api/service-accounts", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do("POST", "/api/service-accounts", userToken, domain.CreateServiceAccountRequest{
+			Name: "Sneaky", Role: userDomain.RoleAdmin,
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do("POST", "/api/service-accounts", adminToken, map[string]string{"name": "No role"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("API Keys Authenticate With Their Scopes", func(t *testing.T) {
+		account := createAccount(t, "Provisioner", userDomain.RoleAdmin)
+		readOnly := createKey(t, account.ID.String(), authDomain.ScopeUsersRead)
+		assert.True(t, strings.HasPrefix(readOnly.Key, domain.APIKeyPrefix))
+		assert.Equal(t, readOnly.Key[:12], readOnly.Prefix)
+
+		w := do("GET", "/api/users", readOnly.Key, nil)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-API-Key", readOnly.Key)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		newUser := map[string]string{"email": "provisioned@example.com", "password": "password123", "name": "New"}
+		w = do("POST", "/api/users", readOnly.Key, newUser)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		readWrite := createKey(t, account.ID.String(), authDomain.ScopeUsersWrite)
+		w = do("POST", "/api/users", readWrite.Key, newUser)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		// A service account is not a user
+		w = do("GET", "/api/users/me", readOnly.Key, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = do("GET", "/api/auth/sessions", readOnly.Key, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Nor can it manage service accounts
+		w = do("GET", "/api/service-accounts", readOnly.Key, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Listings show use, but never the key
+		w = do("GET", "/api/service-accounts/"+account.ID.String()+"/keys", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), readOnly.Key)
+		var keys []domain.APIKey
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+		require.Len(t, keys, 2)
+		require.NotNil(t, keys[0].LastUsedAt)
+	})
+
+	t.Run("Non Admin Service Accounts", func(t *testing.T) {
+		account := createAccount(t, "Reader", userDomain.RoleUser)
+		key := createKey(t, account.ID.String(), authDomain.ScopeUsersRead)
+
+		w := do("GET", "/api/users", key.Key, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Client Credentials Grant", func(t *testing.T) {
+		account := createAccount(t, "Batch", userDomain.RoleAdmin)
+		clientID := account.ID.String()
+
+		// No secret has been issued yet
+		w := requestToken(clientID, "anything", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = do("POST", "/api/service-accounts/"+clientID+"/secret", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var credentials domain.ClientCredentials
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &credentials))
+		assert.Equal(t, account.ID, credentials.ClientID)
+
+		w = requestToken(clientID, credentials.ClientSecret, authDomain.ScopeUsersRead)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var token oauthDomain.TokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+		assert.Equal(t, "Bearer", token.TokenType)
+		assert.Equal(t, authDomain.ScopeUsersRead, token.Scope)
+		assert.Empty(t, token.IDToken)
+		assert.Positive(t, token.ExpiresIn)
+
+		w = do("GET", "/api/users", token.AccessToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = do("POST", "/api/users", token.AccessToken, map[string]string{})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Issued tokens are not listed as keys
+		w = do("GET", "/api/service-accounts/"+clientID+"/keys", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "[]", w.Body.String())
+
+		w = requestToken(clientID, "wrong-secret", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = requestToken(clientID, credentials.ClientSecret, "admin:everything")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_scope")
+
+		// Rotating the secret revokes the tokens issued with the old one
+		w = do("POST", "/api/service-accounts/"+clientID+"/secret", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = do("GET", "/api/users", token.AccessToken, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = requestToken(clientID, credentials.ClientSecret, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Revoke And Delete", func(t *testing.T) {
+		account := createAccount(t, "Temporary", userDomain.RoleAdmin)
+		first := createKey(t, account.ID.String(), authDomain.ScopeUsersRead)
+		second := createKey(t, account.ID.String(), authDomain.ScopeUsersRead)
+
+		w := do("DELETE", "/api/service-accounts/"+account.ID.String()+"/keys/"+first.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = do("GET", "/api/users", first.Key, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = do("GET", "/api/users", second.Key, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = do("DELETE", "/api/service-accounts/"+account.ID.String()+"/keys/"+first.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = do("DELETE", "/api/service-accounts/"+account.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = do("GET", "/api/users", second.Key, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = do("GET", "/api/service-accounts/"+account.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
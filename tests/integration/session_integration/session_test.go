@@ -0,0 +1,249 @@
+package session_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestSessionIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupSessionRoutes()
+
+	listSessions := func(t *testing.T, url, token string) []domain.SessionResponse {
+		req := shared.MakeAuthenticatedRequest(http.MethodGet, url, token, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var sessions []domain.SessionResponse
+		err := json.Unmarshal(w.Body.Bytes(), &sessions)
+		require.NoError(t, err)
+		return sessions
+	}
+
+	t.Run("List My Sessions", func(t *testing.T) {
+		firstToken := shared.CreateAndLoginUser(
+			t, deps, "list@example.com", "password123", "List User", userDomain.RoleUser,
+		)
+		shared.LoginUser(t, deps, "list@example.com", "password123")
+
+		sessions := listSessions(t, "/api/auth/sessions", firstToken)
+		require.Len(t, sessions, 2)
+
+		current := 0
+		for _, session := range sessions {
+			if session.Current {
+				current++
+			}
+		}
+		assert.Equal(t, 1, current)
+
+		// Session tokens are never exposed
+		assert.NotContains(t, string(mustMarshal(t, sessions)), "token")
+	})
+
+	t.Run("Revoke One Of My Sessions", func(t *testing.T) {
+		token := shared.CreateAndLoginUser(
+			t, deps, "revoke@example.com", "password123", "Revoke User", userDomain.RoleUser,
+		)
+		other := shared.LoginUser(t, deps, "revoke@example.com", "password123")
+
+		var otherID string
+		for _, session := range listSessions(t, "/api/auth/sessions", token) {
+			if !session.Current {
+				otherID = session.ID.String()
+			}
+		}
+		require.NotEmpty(t, otherID)
+
+		req := shared.MakeAuthenticatedRequest(http.MethodDelete, "/api/auth/sessions/"+otherID, token, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		req = shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", other.Token, nil)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		assert.Len(t, listSessions(t, "/api/auth/sessions", token), 1)
+	})
+
+	t.Run("Cannot Revoke Another User's Session", func(t *testing.T) {
+		victim := shared.CreateAndLoginUser(
+			t, deps, "victim@example.com", "password123", "Victim User", userDomain.RoleUser,
+		)
+		attacker := shared.CreateAndLoginUser(
+			t, deps, "attacker@example.com", "password123", "Attacker User", userDomain.RoleUser,
+		)
+
+		victimSessions := listSessions(t, "/api/auth/sessions", victim)
+		require.Len(t, victimSessions, 1)
+
+		url := "/api/auth/sessions/" + victimSessions[0].ID.String()
+		req := shared.MakeAuthenticatedRequest(http.MethodDelete, url, attacker, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Logout All", func(t *testing.T) {
+		token := shared.CreateAndLoginUser(
+			t, deps, "logoutall@example.com", "password123", "Logout All User", userDomain.RoleUser,
+		)
+		other := shared.LoginUser(t, deps, "logoutall@example.com", "password123")
+
+		req := shared.MakeAuthenticatedRequest(http.MethodPost, "/api/auth/logout-all", token, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		for _, accessToken := range []string{token, other.Token} {
+			req = shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", accessToken, nil)
+			w = httptest.NewRecorder()
+			deps.Router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("Sessions Record Client Metadata", func(t *testing.T) {
+		shared.CreateAndLoginUser(t, deps, "metadata@example.com", "password123", "Metadata User", userDomain.RoleUser)
+
+		reqBody, _ := json.Marshal(domain.LoginRequest{Email: "metadata@example.com", Password: "password123"})
+		req := shared.MakeRequest(http.MethodPost, "/api/auth/login", reqBody)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) "+
+			"AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1")
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var loginResp domain.LoginResponse
+		err := json.Unmarshal(w.Body.Bytes(), &loginResp)
+		require.NoError(t, err)
+
+		var current *domain.SessionResponse
+		for _, session := range listSessions(t, "/api/auth/sessions", loginResp.Token) {
+			if session.Current {
+				current = &session
+			}
+		}
+		require.NotNil(t, current)
+
+		assert.Equal(t, "192.0.2.1", current.IPAddress) // httptest's default remote address
+		assert.Equal(t, "iPhone", current.Device)
+		assert.Equal(t, "Safari", current.Browser)
+		assert.False(t, current.LastSeenAt.IsZero())
+	})
+
+	t.Run("Activity Slides Expiry Up To Absolute Lifetime", func(t *testing.T) {
+		token := shared.CreateAndLoginUser(
+			t, deps, "sliding@example.com", "password123", "Sliding User", userDomain.RoleUser,
+		)
+		claims, err := deps.TokenManager.Verify(token)
+		require.NoError(t, err)
+
+		setSession := func(expiresAt, absoluteExpiresAt time.Time) {
+			err := deps.TestDB.Database.DB.Model(&domain.Session{}).
+				Where("id = ?", claims.SessionID).
+				Updates(map[string]interface{}{
+					"expires_at":          expiresAt,
+					"absolute_expires_at": absoluteExpiresAt,
+					"last_seen_at":        time.Now().Add(-time.Hour),
+				}).Error
+			require.NoError(t, err)
+		}
+
+		getExpiry := func() time.Time {
+			req := shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", token, nil)
+			w := httptest.NewRecorder()
+			deps.Router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			session, err := deps.SessionRepo.GetByID(ctx, claims.SessionID)
+			require.NoError(t, err)
+			require.NotNil(t, session)
+			return session.ExpiresAt
+		}
+
+		// Activity pushes the idle deadline a full idle TTL ahead
+		setSession(time.Now().Add(time.Minute), time.Now().Add(24*time.Hour))
+		assert.WithinDuration(t, time.Now().Add(deps.Config.SessionIdleTTL), getExpiry(), 5*time.Second)
+
+		// But never past the absolute lifetime
+		absolute := time.Now().Add(10 * time.Minute)
+		setSession(time.Now().Add(time.Minute), absolute)
+		assert.WithinDuration(t, absolute, getExpiry(), time.Second)
+	})
+
+	t.Run("Role Overrides Session Lifetime", func(t *testing.T) {
+		deps.Config.SessionRoleMaxTTL = map[string]time.Duration{string(userDomain.RoleAdmin): 2 * time.Hour}
+		defer func() { deps.Config.SessionRoleMaxTTL = nil }()
+
+		token := shared.CreateAndLoginUser(
+			t, deps, "shortadmin@example.com", "password123", "Short Admin", userDomain.RoleAdmin,
+		)
+		claims, err := deps.TokenManager.Verify(token)
+		require.NoError(t, err)
+
+		session, err := deps.SessionRepo.GetByID(ctx, claims.SessionID)
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.WithinDuration(t, time.Now().Add(2*time.Hour), session.AbsoluteExpiresAt, 5*time.Second)
+	})
+
+	t.Run("Admin Manages User Sessions", func(t *testing.T) {
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "sessionadmin@example.com", "password123", "Session Admin", userDomain.RoleAdmin,
+		)
+		userToken := shared.CreateAndLoginUser(
+			t, deps, "managed@example.com", "password123", "Managed User", userDomain.RoleUser,
+		)
+
+		user, err := deps.UserService.GetByEmail(ctx, "managed@example.com")
+		require.NoError(t, err)
+		url := "/api/users/" + user.ID.String() + "/sessions"
+
+		sessions := listSessions(t, url, adminToken)
+		require.Len(t, sessions, 1)
+		assert.False(t, sessions[0].Current)
+
+		// Regular users can only see their own sessions
+		assert.Len(t, listSessions(t, url, userToken), 1)
+		admin, err := deps.UserService.GetByEmail(ctx, "sessionadmin@example.com")
+		require.NoError(t, err)
+		req := shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/"+admin.ID.String()+"/sessions", userToken, nil)
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		req = shared.MakeAuthenticatedRequest(http.MethodDelete, url, adminToken, nil)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		req = shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", userToken, nil)
+		w = httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,211 @@
+package shared
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/acheevo/test/internal/shared/config"
+)
+
+const (
+	mockIdPClientID     = "test-client"
+	mockIdPClientSecret = "test-client-secret"
+	mockIdPKeyID        = "mock-key"
+)
+
+// MockIdPUser is the account a MockIdP signs in
+type MockIdPUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// mockGrant is an issued authorization code waiting to be exchanged
+type mockGrant struct {
+	user          MockIdPUser
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// MockIdP is a minimal OpenID Connect provider for tests. It serves
+// discovery, JWKS and token endpoints; the browser's visit to the
+// authorization endpoint is simulated by Authorize.
+type MockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+// NewMockIdP starts a mock provider that is stopped when the test ends
+func NewMockIdP(t *testing.T) *MockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &MockIdP{key: key, grants: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// Issuer returns the provider's issuer URL
+func (m *MockIdP) Issuer() string {
+	return m.server.URL
+}
+
+// Register adds the provider to a test's configuration under name
+func (m *MockIdP) Register(deps *TestDependencies, name string) {
+	deps.Config.OIDCProviders[name] = config.OIDCProvider{
+		Issuer:       m.Issuer(),
+		ClientID:     mockIdPClientID,
+		ClientSecret: mockIdPClientSecret,
+	}
+}
+
+// Authorize plays the provider's authorization endpoint for an authorization
+// URL the API redirected to, signing in user. It returns the callback URL the
+// provider would redirect the browser back to.
+func (m *MockIdP) Authorize(t *testing.T, authorizationURL string, user MockIdPUser) *url.URL {
+	parsed, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+
+	require.Equal(t, m.Issuer()+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, mockIdPClientID, query.Get("client_id"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.NotEmpty(t, query.Get("code_challenge"))
+	require.NotEmpty(t, query.Get("state"))
+
+	code := randomString()
+	m.mu.Lock()
+	m.grants[code] = mockGrant{
+		user:          user,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+	m.mu.Unlock()
+
+	callback, err := url.Parse(query.Get("redirect_uri"))
+	require.NoError(t, err)
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	return callback
+}
+
+func (m *MockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer(),
+		"authorization_endpoint":                m.Issuer() + "/authorize",
+		"token_endpoint":                        m.Issuer() + "/token",
+		"jwks_uri":                              m.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *MockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": mockIdPKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges an authorization code, checking the client and the PKCE verifier
+func (m *MockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != mockIdPClientID || clientSecret != mockIdPClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	grant, ok := m.grants[code]
+	delete(m.grants, code)
+	m.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != grant.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.Issuer(),
+		"sub":            grant.user.Subject,
+		"aud":            mockIdPClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.user.Email,
+		"email_verified": grant.user.EmailVerified,
+		"name":           grant.user.Name,
+	})
+	idToken.Header["kid"] = mockIdPKeyID
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
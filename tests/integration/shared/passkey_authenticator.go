@@ -0,0 +1,184 @@
+package shared
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// PasskeyRPID is the relying party ID passkeys are registered under in tests
+	PasskeyRPID = "localhost"
+	// PasskeyOrigin is the origin the software authenticator claims to run on
+	PasskeyOrigin = "http://localhost:3000"
+)
+
+// Authenticator data flags, see WebAuthn §6.1
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softCredential is a discoverable credential held by a SoftAuthenticator
+type softCredential struct {
+	id         []byte
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+}
+
+// SoftAuthenticator is a software WebAuthn authenticator. It answers the
+// options returned by the passkey begin endpoints the way a browser and
+// platform authenticator would, with ES256 keys and "none" attestation.
+type SoftAuthenticator struct {
+	// Origin is reported in the client data of every response
+	Origin string
+	// SignCount is the signature counter; it is incremented before each assertion
+	SignCount uint32
+
+	credentials []*softCredential
+}
+
+// NewSoftAuthenticator creates an authenticator without credentials
+func NewSoftAuthenticator() *SoftAuthenticator {
+	return &SoftAuthenticator{Origin: PasskeyOrigin}
+}
+
+// creationOptions is the part of PublicKeyCredentialCreationOptions the authenticator uses
+type creationOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+// requestOptions is the part of PublicKeyCredentialRequestOptions the authenticator uses
+type requestOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+	} `json:"publicKey"`
+}
+
+// Create answers registration options with a new credential, returning the
+// PublicKeyCredential JSON that navigator.credentials.create() would resolve to
+func (a *SoftAuthenticator) Create(t *testing.T, options json.RawMessage) json.RawMessage {
+	var opts creationOptions
+	require.NoError(t, json.Unmarshal(options, &opts))
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(opts.PublicKey.User.ID)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credential := &softCredential{id: make([]byte, 32), userHandle: userHandle, key: key}
+	_, err = rand.Read(credential.id)
+	require.NoError(t, err)
+
+	// COSE_Key for an EC2 P-256 key used with ES256, RFC 9053 §7.1.1
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.X.FillBytes(make([]byte, 32)),
+		-3: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	// Attested credential data: AAGUID, credential ID length and ID, public key
+	attested := make([]byte, 16, 16+2+len(credential.id)+len(publicKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(credential.id))) //nolint:gosec // 32 bytes
+	attested = append(attested, credential.id...)
+	attested = append(attested, publicKey...)
+
+	authData := a.authenticatorData(opts.PublicKey.RP.ID, flagUserPresent|flagUserVerified|flagAttested, attested)
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	a.credentials = append(a.credentials, credential)
+
+	return a.marshalCredential(t, credential, map[string]interface{}{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", opts.PublicKey.Challenge),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		"transports":        []string{"internal"},
+	})
+}
+
+// Get answers login options with an assertion from the most recently created
+// credential, returning the PublicKeyCredential JSON that
+// navigator.credentials.get() would resolve to
+func (a *SoftAuthenticator) Get(t *testing.T, options json.RawMessage) json.RawMessage {
+	var opts requestOptions
+	require.NoError(t, json.Unmarshal(options, &opts))
+	require.NotEmpty(t, a.credentials, "authenticator has no credentials")
+	credential := a.credentials[len(a.credentials)-1]
+
+	a.SignCount++
+	authData := a.authenticatorData(opts.PublicKey.RPID, flagUserPresent|flagUserVerified, nil)
+	clientData := a.clientData(t, "webauthn.get", opts.PublicKey.Challenge)
+
+	clientDataJSON, err := base64.RawURLEncoding.DecodeString(clientData)
+	require.NoError(t, err)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, credential.key, digest[:])
+	require.NoError(t, err)
+
+	return a.marshalCredential(t, credential, map[string]interface{}{
+		"clientDataJSON":    clientData,
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(credential.userHandle),
+	})
+}
+
+// authenticatorData builds authenticator data for the relying party, see WebAuthn §6.1
+func (a *SoftAuthenticator) authenticatorData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+	return append(data, attested...)
+}
+
+// clientData returns the base64url encoded client data JSON for a ceremony
+func (a *SoftAuthenticator) clientData(t *testing.T, ceremonyType, challenge string) string {
+	clientData, err := json.Marshal(map[string]interface{}{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(clientData)
+}
+
+func (a *SoftAuthenticator) marshalCredential(
+	t *testing.T, credential *softCredential, response map[string]interface{},
+) json.RawMessage {
+	id := base64.RawURLEncoding.EncodeToString(credential.id)
+	encoded, err := json.Marshal(map[string]interface{}{
+		"id":       id,
+		"rawId":    id,
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(t, err)
+	return encoded
+}
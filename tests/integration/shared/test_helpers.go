@@ -2,9 +2,13 @@ package shared
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,7 +23,7 @@ func CreateAndLoginUser(
 ) string {
 	// Create user directly in database for admin user
 	if role == userDomain.RoleAdmin {
-		_, err := deps.UserService.Create(email, password, name, role)
+		_, err := deps.UserService.Create(context.Background(), email, password, name, role)
 		require.NoError(t, err)
 
 		// Login to get token
@@ -79,6 +83,28 @@ func CreateAndLoginUser(
 	return loginResp.Token
 }
 
+// LoginUser logs in an existing user and returns the full login response
+func LoginUser(t *testing.T, deps *TestDependencies, email, password string) domain.LoginResponse {
+	loginReq := domain.LoginRequest{
+		Email:    email,
+		Password: password,
+	}
+
+	reqBody, _ := json.Marshal(loginReq)
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	deps.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var loginResp domain.LoginResponse
+	err := json.Unmarshal(w.Body.Bytes(), &loginResp)
+	require.NoError(t, err)
+
+	return loginResp
+}
+
 // MakeAuthenticatedRequest is a helper to make HTTP requests with authentication
 func MakeAuthenticatedRequest(method, url, token string, body []byte) *http.Request {
 	var req *http.Request
@@ -100,3 +126,24 @@ func MakeAuthenticatedRequest(method, url, token string, body []byte) *http.Requ
 func MakeRequest(method, url string, body []byte) *http.Request {
 	return MakeAuthenticatedRequest(method, url, "", body)
 }
+
+// LastMailToken returns the "token" query parameter of the link in the most
+// recent message sent to an address, failing the test if there is none. It
+// first waits for password reset and verification links still being sent.
+func LastMailToken(t *testing.T, deps *TestDependencies, to string) string {
+	deps.ResetService.Wait()
+	deps.VerificationService.Wait()
+	paths, err := deps.Mailer.Messages(to)
+	require.NoError(t, err)
+	require.NotEmpty(t, paths, "no mail sent to %s", to)
+
+	content, err := os.ReadFile(paths[len(paths)-1])
+	require.NoError(t, err)
+
+	match := regexp.MustCompile(`[?&]token=([^&\s]+)`).FindStringSubmatch(string(content))
+	require.NotNil(t, match, "no token link in mail to %s", to)
+
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
@@ -2,15 +2,30 @@ package shared
 
 import (
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/acheevo/test/internal/auth/repository"
 	"github.com/acheevo/test/internal/auth/service"
+	"github.com/acheevo/test/internal/auth/token"
 	"github.com/acheevo/test/internal/auth/transport"
+	"github.com/acheevo/test/internal/mailer"
 	"github.com/acheevo/test/internal/middleware"
+	oauthRepository "github.com/acheevo/test/internal/oauth/repository"
+	oauthService "github.com/acheevo/test/internal/oauth/service"
+	oauthTransport "github.com/acheevo/test/internal/oauth/transport"
+	"github.com/acheevo/test/internal/policy"
+	rbacRepository "github.com/acheevo/test/internal/rbac/repository"
+	rbacService "github.com/acheevo/test/internal/rbac/service"
+	rbacTransport "github.com/acheevo/test/internal/rbac/transport"
+	serviceAccountRepository "github.com/acheevo/test/internal/serviceaccount/repository"
+	serviceAccountService "github.com/acheevo/test/internal/serviceaccount/service"
+	serviceAccountTransport "github.com/acheevo/test/internal/serviceaccount/transport"
+	"github.com/acheevo/test/internal/shared/config"
 	"github.com/acheevo/test/internal/shared/testutil"
+	"github.com/acheevo/test/internal/shared/unitofwork"
 	userRepository "github.com/acheevo/test/internal/user/repository"
 	userService "github.com/acheevo/test/internal/user/service"
 	userTransport "github.com/acheevo/test/internal/user/transport"
@@ -18,16 +33,43 @@ import (
 
 // TestDependencies holds all the dependencies needed for integration tests
 type TestDependencies struct {
-	TestDB         *testutil.TestDB
-	UserRepo       *userRepository.UserRepository
-	SessionRepo    *repository.SessionRepository
-	AuthService    *service.AuthService
-	UserService    *userService.UserService
-	AuthHandler    *transport.AuthHandler
-	UserHandler    *userTransport.UserHandler
-	AuthMiddleware *middleware.AuthMiddleware
-	Router         *gin.Engine
-	Logger         *zap.Logger
+	TestDB                *testutil.TestDB
+	Config                *config.Config
+	UserRepo              *userRepository.UserRepository
+	SessionRepo           *repository.SessionRepository
+	AttemptRepo           *repository.LoginAttemptRepository
+	TwoFactorRepo         *repository.TwoFactorRepository
+	ResetRepo             *repository.PasswordResetRepository
+	PasskeyRepo           *repository.PasskeyRepository
+	IdentityRepo          *repository.IdentityRepository
+	AccessTokenRepo       *repository.PersonalAccessTokenRepository
+	TokenManager          *token.Manager
+	Mailer                *mailer.FileMailer
+	AuthService           *service.AuthService
+	UserService           *userService.UserService
+	ResetService          *service.PasswordResetService
+	VerificationService   *service.EmailVerificationService
+	OIDCService           *service.OIDCService
+	AuthHandler           *transport.AuthHandler
+	SessionHandler        *transport.SessionHandler
+	PasswordHandler       *transport.PasswordHandler
+	TwoFactorHandler      *transport.TwoFactorHandler
+	PasskeyHandler        *transport.PasskeyHandler
+	AccessTokenHandler    *transport.PersonalAccessTokenHandler
+	OIDCHandler           *transport.OIDCHandler
+	OAuthClientService    *oauthService.ClientService
+	OAuthKeyService       *oauthService.KeyService
+	ServiceAccounts       *serviceAccountService.ServiceAccountService
+	RoleService           *rbacService.RoleService
+	ProviderHandler       *oauthTransport.ProviderHandler
+	ClientHandler         *oauthTransport.ClientHandler
+	ServiceAccountHandler *serviceAccountTransport.ServiceAccountHandler
+	RoleHandler           *rbacTransport.RoleHandler
+	UserHandler           *userTransport.UserHandler
+	AuthMiddleware        *middleware.AuthMiddleware
+	PolicyMiddleware      *middleware.PolicyMiddleware
+	Router                *gin.Engine
+	Logger                *zap.Logger
 }
 
 // SetupTestDependencies creates and configures all test dependencies
@@ -38,32 +80,156 @@ func SetupTestDependencies(t *testing.T) *TestDependencies {
 	// Setup repositories
 	userRepo := userRepository.NewUserRepository(testDB.Database)
 	sessionRepo := repository.NewSessionRepository(testDB.Database)
+	attemptRepo := repository.NewLoginAttemptRepository(testDB.Database)
+	twoFactorRepo := repository.NewTwoFactorRepository(testDB.Database)
+	resetRepo := repository.NewPasswordResetRepository(testDB.Database)
+	passkeyRepo := repository.NewPasskeyRepository(testDB.Database)
+	accessTokenRepo := repository.NewPersonalAccessTokenRepository(testDB.Database)
+	identityRepo := repository.NewIdentityRepository(testDB.Database)
+	clientRepo := oauthRepository.NewClientRepository(testDB.Database)
+	grantRepo := oauthRepository.NewGrantRepository(testDB.Database)
+	keyRepo := oauthRepository.NewKeyRepository(testDB.Database)
+	serviceAccountRepo := serviceAccountRepository.NewServiceAccountRepository(testDB.Database)
+	roleRepo := rbacRepository.NewRoleRepository(testDB.Database)
+	txManager := unitofwork.NewPostgresManager(testDB.Database, 3)
+
+	// Sent mail is written to a temporary directory for tests to read back
+	mail, err := mailer.NewFileMailer(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
 
 	// Setup services
-	authSvc := service.NewAuthService(userRepo, sessionRepo)
-	userSvc := userService.NewUserService(userRepo)
+	cfg := &config.Config{
+		SessionSecret:  "test-secret",
+		AccessTokenTTL: 15 * time.Minute,
+		SessionIdleTTL: time.Hour,
+		SessionMaxTTL:  24 * time.Hour,
 
-	// Setup handlers
+		LoginFreeAttempts:    3,
+		LoginBackoffBase:     time.Second,
+		LoginBackoffMax:      time.Minute,
+		LoginMaxFailures:     5,
+		LoginMaxIPFailures:   100,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginFailureWindow:   15 * time.Minute,
+
+		PasswordResetTTL: time.Hour,
+		PasswordResetURL: "http://localhost:3000/reset-password",
+		MailFrom:         "no-reply@test.local",
+
+		EmailVerificationTTL: 48 * time.Hour,
+		EmailVerificationURL: "http://localhost:3000/verify-email",
+
+		TwoFactorIssuer:       "test-api",
+		TwoFactorChallengeTTL: 5 * time.Minute,
+
+		WebAuthnRPID:        PasskeyRPID,
+		WebAuthnRPName:      "test-api",
+		WebAuthnOrigins:     []string{PasskeyOrigin},
+		WebAuthnCeremonyTTL: 5 * time.Minute,
+
+		// Tests register providers, such as a MockIdP, before the first login
+		OIDCProviders:   config.OIDCProviders{},
+		OIDCCallbackURL: "http://localhost:8080/api/auth/oidc",
+		OIDCStateTTL:    10 * time.Minute,
+
+		// Tests serving the router over HTTP point the issuer at their server
+		OAuthIssuer:              "http://localhost:8080",
+		OAuthConsentURL:          "http://localhost:3000/oauth/consent",
+		OAuthCodeTTL:             time.Minute,
+		OAuthAccessTokenTTL:      time.Hour,
+		OAuthIDTokenTTL:          time.Hour,
+		OAuthKeyRotationInterval: 720 * time.Hour,
+		OAuthKeyRetention:        24 * time.Hour,
+	}
+	tokenManager := token.NewHMACManager(cfg.SessionSecret, cfg.AccessTokenTTL)
+	relyingParty, err := service.NewRelyingParty(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create relying party: %v", err)
+	}
+	authSvc := service.NewAuthService(
+		userRepo, sessionRepo, attemptRepo, twoFactorRepo, passkeyRepo, accessTokenRepo, tokenManager, relyingParty, cfg,
+	)
+	userSvc := userService.NewUserService(userRepo, txManager)
 	logger := zap.NewNop()
-	authHandler := transport.NewAuthHandler(authSvc, logger)
-	userHandler := userTransport.NewUserHandler(userSvc, logger)
-	authMiddleware := middleware.NewAuthMiddleware(authSvc, logger)
+	resetSvc := service.NewPasswordResetService(userRepo, txManager, mail, cfg, logger)
+	verificationSvc := service.NewEmailVerificationService(userRepo, tokenManager, mail, cfg, logger)
+	oidcSvc := service.NewOIDCService(authSvc, userRepo, identityRepo, cfg, logger)
+	keySvc := oauthService.NewKeyService(keyRepo, cfg, logger)
+	serviceAccountSvc := serviceAccountService.NewServiceAccountService(serviceAccountRepo, userRepo, cfg)
+	providerSvc := oauthService.NewProviderService(
+		clientRepo, grantRepo, userRepo, keySvc, serviceAccountSvc, cfg, logger,
+	)
+	clientSvc := oauthService.NewClientService(clientRepo, grantRepo)
+	roleSvc := rbacService.NewRoleService(roleRepo, userRepo)
+
+	// Setup handlers
+	authHandler := transport.NewAuthHandler(authSvc, verificationSvc, logger)
+	sessionHandler := transport.NewSessionHandler(authSvc, logger)
+	passwordHandler := transport.NewPasswordHandler(resetSvc, logger)
+	twoFactorHandler := transport.NewTwoFactorHandler(authSvc, logger)
+	passkeyHandler := transport.NewPasskeyHandler(authSvc, logger)
+	accessTokenHandler := transport.NewPersonalAccessTokenHandler(authSvc, logger)
+	oidcHandler := transport.NewOIDCHandler(oidcSvc, logger)
+	providerHandler := oauthTransport.NewProviderHandler(providerSvc, keySvc, logger)
+	clientHandler := oauthTransport.NewClientHandler(clientSvc, keySvc, logger)
+	serviceAccountHandler := serviceAccountTransport.NewServiceAccountHandler(serviceAccountSvc, roleSvc, logger)
+	roleHandler := rbacTransport.NewRoleHandler(roleSvc, logger)
+	userHandler := userTransport.NewUserHandler(userSvc, roleSvc, verificationSvc, logger)
+	authMiddleware := middleware.NewAuthMiddleware(authSvc, serviceAccountSvc, roleSvc, logger)
+	accessPolicy, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	policyMiddleware := middleware.NewPolicyMiddleware(policy.NewEngine(accessPolicy, logger), roleSvc, userRepo, logger)
 
 	// Setup router
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	// Like the server, believe no forwarded client IPs
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
 
 	return &TestDependencies{
-		TestDB:         testDB,
-		UserRepo:       userRepo,
-		SessionRepo:    sessionRepo,
-		AuthService:    authSvc,
-		UserService:    userSvc,
-		AuthHandler:    authHandler,
-		UserHandler:    userHandler,
-		AuthMiddleware: authMiddleware,
-		Router:         router,
-		Logger:         logger,
+		TestDB:                testDB,
+		Config:                cfg,
+		UserRepo:              userRepo,
+		SessionRepo:           sessionRepo,
+		AttemptRepo:           attemptRepo,
+		TwoFactorRepo:         twoFactorRepo,
+		ResetRepo:             resetRepo,
+		PasskeyRepo:           passkeyRepo,
+		IdentityRepo:          identityRepo,
+		AccessTokenRepo:       accessTokenRepo,
+		TokenManager:          tokenManager,
+		Mailer:                mail,
+		AuthService:           authSvc,
+		UserService:           userSvc,
+		ResetService:          resetSvc,
+		VerificationService:   verificationSvc,
+		OIDCService:           oidcSvc,
+		AuthHandler:           authHandler,
+		SessionHandler:        sessionHandler,
+		PasswordHandler:       passwordHandler,
+		TwoFactorHandler:      twoFactorHandler,
+		PasskeyHandler:        passkeyHandler,
+		AccessTokenHandler:    accessTokenHandler,
+		OIDCHandler:           oidcHandler,
+		OAuthClientService:    clientSvc,
+		OAuthKeyService:       keySvc,
+		ServiceAccounts:       serviceAccountSvc,
+		RoleService:           roleSvc,
+		ProviderHandler:       providerHandler,
+		ClientHandler:         clientHandler,
+		ServiceAccountHandler: serviceAccountHandler,
+		RoleHandler:           roleHandler,
+		UserHandler:           userHandler,
+		AuthMiddleware:        authMiddleware,
+		PolicyMiddleware:      policyMiddleware,
+		Router:                router,
+		Logger:                logger,
 	}
 }
 
@@ -80,13 +246,157 @@ func (deps *TestDependencies) SetupAuthRoutes() {
 		{
 			auth.POST("/register", deps.AuthHandler.Register)
 			auth.POST("/login", deps.AuthHandler.Login)
+			auth.POST("/login/2fa", deps.TwoFactorHandler.CompleteLogin)
+			auth.POST("/login/2fa/enroll", deps.TwoFactorHandler.EnrollFromChallenge)
+			auth.POST("/login/passkey/begin", deps.PasskeyHandler.BeginLogin)
+			auth.POST("/login/passkey/finish", deps.PasskeyHandler.FinishLogin)
+			auth.GET("/oidc", deps.OIDCHandler.ListProviders)
+			auth.GET("/oidc/:provider/login", deps.OIDCHandler.Login)
+			auth.GET("/oidc/:provider/callback", deps.OIDCHandler.Callback)
+			auth.POST("/refresh", deps.AuthHandler.Refresh)
 			auth.POST("/logout", deps.AuthHandler.Logout)
+			auth.POST("/password/forgot", deps.PasswordHandler.ForgotPassword)
+			auth.POST("/password/reset", deps.PasswordHandler.ResetPassword)
+			auth.POST("/verify-email", deps.AuthHandler.VerifyEmail)
+			auth.POST("/verify-email/resend", deps.AuthHandler.ResendVerification)
+
+			twoFactor := auth.Group("/2fa")
+			twoFactor.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
+			{
+				twoFactor.GET("", deps.TwoFactorHandler.GetStatus)
+				twoFactor.POST("/enroll", deps.TwoFactorHandler.Enroll)
+				twoFactor.POST("/confirm", deps.TwoFactorHandler.Confirm)
+				twoFactor.POST("/recovery-codes", deps.TwoFactorHandler.RegenerateRecoveryCodes)
+				twoFactor.POST("/disable", deps.TwoFactorHandler.Disable)
+			}
+
+			passkeys := auth.Group("/passkeys")
+			passkeys.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
+			{
+				passkeys.GET("", deps.PasskeyHandler.ListPasskeys)
+				passkeys.POST("/register/begin", deps.PasskeyHandler.BeginRegistration)
+				passkeys.POST("/register/finish", deps.PasskeyHandler.FinishRegistration)
+				passkeys.DELETE("/:id", deps.PasskeyHandler.RemovePasskey)
+			}
+		}
+
+		users := api.Group("/users")
+		users.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("users"))
+		{
+			users.GET("/me", deps.PolicyMiddleware.Authorize("users:read", deps.PolicyMiddleware.Self),
+				deps.UserHandler.GetCurrentUser)
+		}
+	}
+}
+
+// SetupOAuthRoutes configures the OpenID Connect provider routes for testing
+func (deps *TestDependencies) SetupOAuthRoutes() {
+	deps.Router.GET("/.well-known/openid-configuration", deps.ProviderHandler.Discovery)
+	deps.Router.GET("/oauth/jwks", deps.ProviderHandler.JWKS)
+	provider := deps.Router.Group("/oauth")
+	{
+		provider.GET("/authorize", deps.ProviderHandler.Authorize)
+		provider.POST(
+			"/authorize", deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession, deps.ProviderHandler.Decide,
+		)
+		provider.POST("/token", deps.ProviderHandler.Token)
+		provider.GET("/userinfo", deps.ProviderHandler.UserInfo)
+		provider.POST("/userinfo", deps.ProviderHandler.UserInfo)
+	}
+
+	api := deps.Router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", deps.AuthHandler.Register)
+			auth.POST("/login", deps.AuthHandler.Login)
+		}
+
+		oauth := api.Group("/oauth")
+		oauth.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
+		{
+			can := deps.AuthMiddleware.RequirePermission
+			oauth.GET("/clients", can("oauth_clients:read"), deps.ClientHandler.ListClients)
+			oauth.POST("/clients", can("oauth_clients:write"), deps.ClientHandler.CreateClient)
+			oauth.DELETE("/clients/:id", can("oauth_clients:write"), deps.ClientHandler.DeleteClient)
+			oauth.POST("/keys/rotate", can("oauth_clients:write"), deps.ClientHandler.RotateKeys)
+			oauth.GET("/consents", deps.ClientHandler.ListConsents)
+			oauth.DELETE("/consents/:clientId", deps.ClientHandler.RevokeConsent)
+		}
+	}
+}
+
+// SetupSessionRoutes configures session management routes for testing
+func (deps *TestDependencies) SetupSessionRoutes() {
+	policies := deps.PolicyMiddleware
+	authorize := policies.Authorize
+
+	api := deps.Router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", deps.AuthHandler.Register)
+			auth.POST("/login", deps.AuthHandler.Login)
+			auth.POST("/refresh", deps.AuthHandler.Refresh)
+			auth.POST("/logout-all",
+				deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("sessions"),
+				authorize("sessions:revoke", policies.OwnSessions), deps.SessionHandler.LogoutAll)
+
+			sessions := auth.Group("/sessions")
+			sessions.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("sessions"))
+			{
+				sessions.GET("", authorize("sessions:read", policies.OwnSessions), deps.SessionHandler.ListSessions)
+				sessions.DELETE("/:id", authorize("sessions:revoke", policies.OwnSessions), deps.SessionHandler.RevokeSession)
+			}
+		}
+
+		sessionScope := deps.AuthMiddleware.RequireScope("sessions")
+		read := authorize("sessions:read", policies.UserSessionsFromPath)
+		revoke := authorize("sessions:revoke", policies.UserSessionsFromPath)
+		users := api.Group("/users")
+		users.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("users"))
+		{
+			users.GET("/me", authorize("users:read", policies.Self), deps.UserHandler.GetCurrentUser)
+			users.GET("/:id/sessions", sessionScope, read, deps.SessionHandler.ListUserSessions)
+			users.DELETE("/:id/sessions", sessionScope, revoke, deps.SessionHandler.RevokeUserSessions)
+			users.DELETE("/:id/sessions/:sessionId", sessionScope, revoke, deps.SessionHandler.RevokeUserSession)
+		}
+	}
+}
+
+// SetupAccessTokenRoutes configures personal access token routes for testing,
+// along with routes to use the tokens on
+func (deps *TestDependencies) SetupAccessTokenRoutes() {
+	policies := deps.PolicyMiddleware
+	authorize := policies.Authorize
+
+	api := deps.Router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", deps.AuthHandler.Register)
+			auth.POST("/login", deps.AuthHandler.Login)
+
+			tokens := auth.Group("/tokens")
+			tokens.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
+			{
+				tokens.GET("", deps.AccessTokenHandler.ListTokens)
+				tokens.POST("", deps.AccessTokenHandler.CreateToken)
+				tokens.DELETE("/:id", deps.AccessTokenHandler.RevokeToken)
+			}
+
+			sessions := auth.Group("/sessions")
+			sessions.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("sessions"))
+			{
+				sessions.GET("", authorize("sessions:read", policies.OwnSessions), deps.SessionHandler.ListSessions)
+			}
 		}
 
 		users := api.Group("/users")
-		users.Use(deps.AuthMiddleware.Authenticate)
+		users.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("users"))
 		{
-			users.GET("/me", deps.UserHandler.GetCurrentUser)
+			users.GET("/me", authorize("users:read", policies.Self), deps.UserHandler.GetCurrentUser)
+			users.POST("", authorize("users:write", policies.Users), deps.UserHandler.CreateUser)
 		}
 	}
 }
@@ -101,13 +411,120 @@ func (deps *TestDependencies) SetupUserRoutes() {
 			auth.POST("/login", deps.AuthHandler.Login)
 		}
 
+		policies := deps.PolicyMiddleware
+		authorize := policies.Authorize
+		users := api.Group("/users")
+		users.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("users"))
+		{
+			users.GET("/me", authorize("users:read", policies.Self), deps.UserHandler.GetCurrentUser)
+			users.GET("", authorize("users:read", policies.Users), deps.UserHandler.GetUsers)
+			users.GET("/:id", authorize("users:read", policies.UserFromPath), deps.UserHandler.GetUserByID)
+			users.POST("", authorize("users:write", policies.Users), deps.UserHandler.CreateUser)
+			users.PUT("/:id", authorize("users:update", policies.UserFromPath), deps.UserHandler.UpdateUser)
+			users.PATCH("/:id", authorize("users:update", policies.UserFromPath), deps.UserHandler.PatchUser)
+			users.DELETE("/:id", authorize("users:delete", policies.UserFromPath), deps.UserHandler.DeleteUser)
+			users.POST("/:id/unlock", authorize("users:write", policies.UserFromPath), deps.AuthHandler.UnlockUser)
+			users.DELETE("/:id/2fa", authorize("users:write", policies.UserFromPath), deps.TwoFactorHandler.ResetUserTwoFactor)
+		}
+	}
+}
+
+// SetupServiceAccountRoutes configures service account administration routes
+// for testing, along with routes service accounts can authenticate to
+func (deps *TestDependencies) SetupServiceAccountRoutes() {
+	policies := deps.PolicyMiddleware
+	authorize := policies.Authorize
+
+	deps.Router.POST("/oauth/token", deps.ProviderHandler.Token)
+
+	api := deps.Router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", deps.AuthHandler.Register)
+			auth.POST("/login", deps.AuthHandler.Login)
+
+			sessions := auth.Group("/sessions")
+			sessions.Use(
+				deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireUser, deps.AuthMiddleware.RequireScope("sessions"),
+			)
+			{
+				sessions.GET("", authorize("sessions:read", policies.OwnSessions), deps.SessionHandler.ListSessions)
+			}
+		}
+
+		can := deps.AuthMiddleware.RequirePermission
+		read, write := can("service_accounts:read"), can("service_accounts:write")
+		serviceAccounts := api.Group("/service-accounts")
+		serviceAccounts.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
+		{
+			serviceAccounts.GET("", read, deps.ServiceAccountHandler.ListServiceAccounts)
+			serviceAccounts.POST("", write, deps.ServiceAccountHandler.CreateServiceAccount)
+			serviceAccounts.GET("/:id", read, deps.ServiceAccountHandler.GetServiceAccount)
+			serviceAccounts.DELETE("/:id", write, deps.ServiceAccountHandler.DeleteServiceAccount)
+			serviceAccounts.GET("/:id/keys", read, deps.ServiceAccountHandler.ListKeys)
+			serviceAccounts.POST("/:id/keys", write, deps.ServiceAccountHandler.CreateKey)
+			serviceAccounts.DELETE("/:id/keys/:keyId", write, deps.ServiceAccountHandler.RevokeKey)
+			serviceAccounts.POST("/:id/secret", write, deps.ServiceAccountHandler.RotateClientSecret)
+		}
+
 		users := api.Group("/users")
-		users.Use(deps.AuthMiddleware.Authenticate)
+		users.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("users"))
+		{
+			users.GET("/me", deps.AuthMiddleware.RequireUser, authorize("users:read", policies.Self),
+				deps.UserHandler.GetCurrentUser)
+			users.GET("", authorize("users:read", policies.Users), deps.UserHandler.GetUsers)
+			users.POST("", authorize("users:write", policies.Users), deps.UserHandler.CreateUser)
+		}
+	}
+}
+
+// SetupRoleRoutes configures role administration routes for testing, along
+// with routes that check permissions
+func (deps *TestDependencies) SetupRoleRoutes() {
+	can := deps.AuthMiddleware.RequirePermission
+	policies := deps.PolicyMiddleware
+	authorize := policies.Authorize
+
+	api := deps.Router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", deps.AuthHandler.Register)
+			auth.POST("/login", deps.AuthHandler.Login)
+		}
+
+		roles := api.Group("/roles")
+		roles.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
+		{
+			roles.GET("", can("roles:read"), deps.RoleHandler.ListRoles)
+			roles.POST("", can("roles:write"), deps.RoleHandler.CreateRole)
+			roles.GET("/:id", can("roles:read"), deps.RoleHandler.GetRole)
+			roles.PUT("/:id", can("roles:write"), deps.RoleHandler.UpdateRole)
+			roles.DELETE("/:id", can("roles:write"), deps.RoleHandler.DeleteRole)
+		}
+
+		users := api.Group("/users")
+		users.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireScope("users"))
+		{
+			users.GET("", authorize("users:read", policies.Users), deps.UserHandler.GetUsers)
+			users.POST("", authorize("users:write", policies.Users), deps.UserHandler.CreateUser)
+			users.GET("/:id/sessions", authorize("sessions:read", policies.UserSessionsFromPath),
+				deps.SessionHandler.ListUserSessions)
+
+			userRoles := users.Group("/:id/roles")
+			userRoles.Use(deps.AuthMiddleware.RequireSession)
+			{
+				userRoles.GET("", can("roles:read"), deps.RoleHandler.ListUserRoles)
+				userRoles.PUT("/:roleId", can("roles:write"), deps.RoleHandler.AssignUserRole)
+				userRoles.DELETE("/:roleId", can("roles:write"), deps.RoleHandler.UnassignUserRole)
+			}
+		}
+
+		serviceAccounts := api.Group("/service-accounts")
+		serviceAccounts.Use(deps.AuthMiddleware.Authenticate, deps.AuthMiddleware.RequireSession)
 		{
-			users.GET("/me", deps.UserHandler.GetCurrentUser)
-			users.GET("", deps.UserHandler.GetUsers)
-			users.GET("/:id", deps.UserHandler.GetUserByID)
-			users.POST("", deps.UserHandler.CreateUser)
+			serviceAccounts.POST("", can("service_accounts:write"), deps.ServiceAccountHandler.CreateServiceAccount)
 		}
 	}
 }
@@ -0,0 +1,36 @@
+package store_integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	authRepository "github.com/acheevo/test/internal/auth/repository"
+	"github.com/acheevo/test/internal/shared/storetest"
+	"github.com/acheevo/test/internal/shared/testutil"
+	"github.com/acheevo/test/internal/shared/unitofwork"
+	userRepository "github.com/acheevo/test/internal/user/repository"
+)
+
+func TestPostgresStoresIntegration(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	db := testDB.Database
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		err := db.DB.Exec("TRUNCATE users, sessions, refresh_tokens, user_roles, password_reset_tokens, " +
+			"login_attempts, totp_credentials, recovery_codes, webauthn_credentials, webauthn_ceremonies, " +
+			"personal_access_tokens").Error
+		require.NoError(t, err)
+		return storetest.Stores{
+			Users:          userRepository.NewUserRepository(db),
+			Sessions:       authRepository.NewSessionRepository(db),
+			PasswordResets: authRepository.NewPasswordResetRepository(db),
+			LoginAttempts:  authRepository.NewLoginAttemptRepository(db),
+			TwoFactor:      authRepository.NewTwoFactorRepository(db),
+			Passkeys:       authRepository.NewPasskeyRepository(db),
+			AccessTokens:   authRepository.NewPersonalAccessTokenRepository(db),
+			UnitOfWork:     unitofwork.NewPostgresManager(db, 3),
+		}
+	})
+}
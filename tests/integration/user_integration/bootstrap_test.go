@@ -0,0 +1,122 @@
+package user_integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	userDomain "github.com/acheevo/test/internal/user/domain"
+	"github.com/acheevo/test/internal/user/service"
+	"github.com/acheevo/test/tests/integration/shared"
+)
+
+func TestAdminBootstrapIntegration(t *testing.T) {
+	ctx := context.Background()
+	deps := shared.SetupTestDependencies(t)
+	defer deps.Cleanup(t)
+
+	deps.SetupUserRoutes()
+
+	const email = "bootstrap@example.com"
+
+	login := func(password string) int {
+		body, _ := json.Marshal(authDomain.LoginRequest{Email: email, Password: password})
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeRequest(http.MethodPost, "/api/auth/login", body))
+		return w.Code
+	}
+
+	countAdmins := func(t *testing.T) int {
+		users, err := deps.UserService.GetAll(ctx)
+		require.NoError(t, err)
+		admins := 0
+		for _, user := range users {
+			if user.Role == userDomain.RoleAdmin {
+				admins++
+			}
+		}
+		return admins
+	}
+
+	t.Run("Creates The First Admin", func(t *testing.T) {
+		result, err := deps.UserService.BootstrapAdmin(ctx, email, "first-password", "Bootstrap Admin")
+		require.NoError(t, err)
+		assert.Equal(t, service.BootstrapCreated, result)
+
+		user, err := deps.UserService.GetByEmail(ctx, email)
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, userDomain.RoleAdmin, user.Role)
+		assert.Equal(t, "Bootstrap Admin", user.Name)
+		assert.Equal(t, http.StatusOK, login("first-password"))
+	})
+
+	t.Run("Is Idempotent", func(t *testing.T) {
+		result, err := deps.UserService.BootstrapAdmin(ctx, email, "first-password", "Bootstrap Admin")
+		require.NoError(t, err)
+		assert.Equal(t, service.BootstrapUnchanged, result)
+		assert.Equal(t, 1, countAdmins(t))
+	})
+
+	t.Run("Rotates The Password", func(t *testing.T) {
+		token := shared.LoginUser(t, deps, email, "first-password").Token
+
+		result, err := deps.UserService.BootstrapAdmin(ctx, email, "second-password", "Bootstrap Admin")
+		require.NoError(t, err)
+		assert.Equal(t, service.BootstrapRotated, result)
+		assert.Equal(t, 1, countAdmins(t))
+
+		assert.Equal(t, http.StatusUnauthorized, login("first-password"))
+		assert.Equal(t, http.StatusOK, login("second-password"))
+
+		// Sessions from the old password are revoked
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(http.MethodGet, "/api/users/me", token, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Keeps A Password The Admin Changed", func(t *testing.T) {
+		user, err := deps.UserService.GetByEmail(ctx, email)
+		require.NoError(t, err)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("own-password"), bcrypt.DefaultCost)
+		require.NoError(t, err)
+		require.NoError(t, deps.UserRepo.SetPassword(ctx, user.ID, string(hashedPassword)))
+
+		result, err := deps.UserService.BootstrapAdmin(ctx, email, "second-password", "Bootstrap Admin")
+		require.NoError(t, err)
+		assert.Equal(t, service.BootstrapUnchanged, result)
+
+		assert.Equal(t, http.StatusUnauthorized, login("second-password"))
+		assert.Equal(t, http.StatusOK, login("own-password"))
+	})
+
+	t.Run("Leaves Other Admins Alone", func(t *testing.T) {
+		result, err := deps.UserService.BootstrapAdmin(ctx, "another@example.com", "password123", "Another Admin")
+		require.NoError(t, err)
+		assert.Equal(t, service.BootstrapUnchanged, result)
+
+		user, err := deps.UserService.GetByEmail(ctx, "another@example.com")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("Does Not Promote Regular Users", func(t *testing.T) {
+		shared.CreateAndLoginUser(t, deps, "regular@example.com", "password123", "Regular", userDomain.RoleUser)
+
+		result, err := deps.UserService.BootstrapAdmin(ctx, "regular@example.com", "new-password", "Regular")
+		require.NoError(t, err)
+		assert.Equal(t, service.BootstrapNotAdmin, result)
+
+		user, err := deps.UserService.GetByEmail(ctx, "regular@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, userDomain.RoleUser, user.Role)
+		shared.LoginUser(t, deps, "regular@example.com", "password123")
+	})
+}
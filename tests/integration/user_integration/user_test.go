@@ -1,19 +1,27 @@
 package user_integration
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	authDomain "github.com/acheevo/test/internal/auth/domain"
+	rbacDomain "github.com/acheevo/test/internal/rbac/domain"
+	rbacRepository "github.com/acheevo/test/internal/rbac/repository"
+	serviceAccountDomain "github.com/acheevo/test/internal/serviceaccount/domain"
+	serviceAccountRepository "github.com/acheevo/test/internal/serviceaccount/repository"
 	userDomain "github.com/acheevo/test/internal/user/domain"
 	"github.com/acheevo/test/tests/integration/shared"
 )
 
 func TestUserIntegration(t *testing.T) {
+	ctx := context.Background()
 	deps := shared.SetupTestDependencies(t)
 	defer deps.Cleanup(t)
 
@@ -127,4 +135,217 @@ func TestUserIntegration(t *testing.T) {
 
 		assert.Equal(t, http.StatusForbidden, w.Code)
 	})
+
+	t.Run("Get User By ID - Self Or Permission", func(t *testing.T) {
+		ownerToken := shared.CreateAndLoginUser(
+			t, deps, "owner@example.com", "password123", "Owner", userDomain.RoleUser,
+		)
+		otherToken := shared.CreateAndLoginUser(
+			t, deps, "other@example.com", "password123", "Other", userDomain.RoleUser,
+		)
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "byid-admin@example.com", "password123", "Admin", userDomain.RoleAdmin,
+		)
+		owner, err := deps.UserService.GetByEmail(ctx, "owner@example.com")
+		require.NoError(t, err)
+		url := "/api/users/" + owner.ID.String()
+
+		for _, tc := range []struct {
+			token string
+			code  int
+		}{
+			{ownerToken, http.StatusOK},
+			{otherToken, http.StatusForbidden},
+			{adminToken, http.StatusOK},
+		} {
+			w := httptest.NewRecorder()
+			deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(http.MethodGet, url, tc.token, nil))
+			assert.Equal(t, tc.code, w.Code, w.Body.String())
+		}
+	})
+
+	do := func(method, url, token string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		switch v := payload.(type) {
+		case nil:
+		case string:
+			body = []byte(v)
+		default:
+			body, _ = json.Marshal(v)
+		}
+		w := httptest.NewRecorder()
+		deps.Router.ServeHTTP(w, shared.MakeAuthenticatedRequest(method, url, token, body))
+		return w
+	}
+
+	t.Run("Update User - Field Rules", func(t *testing.T) {
+		editorToken := shared.CreateAndLoginUser(
+			t, deps, "editor@example.com", "password123", "Editor", userDomain.RoleUser,
+		)
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "update-admin@example.com", "password123", "Admin", userDomain.RoleAdmin,
+		)
+		editor, err := deps.UserService.GetByEmail(ctx, "editor@example.com")
+		require.NoError(t, err)
+		other, err := deps.UserService.GetByEmail(ctx, "owner@example.com")
+		require.NoError(t, err)
+		url := "/api/users/" + editor.ID.String()
+
+		// Users can change their own name, and nothing else
+		w := do(http.MethodPatch, url, editorToken, `{"name": "Renamed"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var user userDomain.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.Equal(t, "Renamed", user.Name)
+		assert.Equal(t, "editor@example.com", user.Email)
+
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPatch, url, editorToken, `{"role": "admin"}`).Code)
+		assert.Equal(t, http.StatusForbidden,
+			do(http.MethodPatch, url, editorToken, `{"email": "new@example.com"}`).Code)
+		assert.Equal(t, http.StatusForbidden,
+			do(http.MethodPatch, "/api/users/"+other.ID.String(), editorToken, `{"name": "Hijacked"}`).Code)
+		// Unchanged fields need no permission
+		assert.Equal(t, http.StatusOK, do(http.MethodPatch, url, editorToken, `{"role": "user"}`).Code)
+
+		// Fields cannot be removed or invented
+		for _, patch := range []string{`{"name": null}`, `{"password": "hunter22"}`, `["name"]`, `{"name": ""}`} {
+			assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, url, editorToken, patch).Code, patch)
+		}
+
+		// Admins can change everything
+		w = do(http.MethodPut, url, adminToken, userDomain.UpdateUserRequest{
+			Email: "edited@example.com", Name: "Edited", Role: userDomain.RoleUser,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.Equal(t, "edited@example.com", user.Email)
+		assert.Equal(t, "Edited", user.Name)
+
+		// The new address has to be verified again
+		assert.False(t, user.EmailVerified)
+		verified, err := deps.VerificationService.VerifyEmail(ctx, shared.LastMailToken(t, deps, "edited@example.com"))
+		require.NoError(t, err)
+		assert.True(t, verified.EmailVerified)
+
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, url, adminToken, `{"name": "Partial"}`).Code)
+		assert.Equal(t, http.StatusConflict,
+			do(http.MethodPatch, url, adminToken, `{"email": "owner@example.com"}`).Code)
+
+		// Changing the role revokes the user's sessions, as their tokens carry it
+		w = do(http.MethodPatch, url, adminToken, `{"role": "admin"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		sessions, err := deps.SessionRepo.GetByUserID(ctx, editor.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/users/me", editorToken, nil).Code)
+	})
+
+	t.Run("Delete User", func(t *testing.T) {
+		doomedToken := shared.CreateAndLoginUser(
+			t, deps, "doomed@example.com", "password123", "Doomed", userDomain.RoleUser,
+		)
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "delete-admin@example.com", "password123", "Admin", userDomain.RoleAdmin,
+		)
+		doomed, err := deps.UserService.GetByEmail(ctx, "doomed@example.com")
+		require.NoError(t, err)
+		other, err := deps.UserService.GetByEmail(ctx, "owner@example.com")
+		require.NoError(t, err)
+		url := "/api/users/" + doomed.ID.String()
+
+		assert.Equal(t, http.StatusForbidden,
+			do(http.MethodDelete, "/api/users/"+other.ID.String(), doomedToken, nil).Code)
+		assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, url, doomedToken, nil).Code)
+
+		require.Equal(t, http.StatusOK, do(http.MethodDelete, url, adminToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, url, adminToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, url, adminToken, nil).Code)
+
+		sessions, err := deps.SessionRepo.GetByUserID(ctx, doomed.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/users/me", doomedToken, nil).Code)
+	})
+
+	t.Run("Delete User Removes Their Credentials", func(t *testing.T) {
+		user, err := deps.UserService.Create(ctx, "credentials@example.com", "password123", "Owner", userDomain.RoleUser)
+		require.NoError(t, err)
+
+		require.NoError(t, deps.AccessTokenRepo.Create(ctx, &authDomain.PersonalAccessToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			Name:      "ci",
+			Prefix:    "pat_credentials",
+			TokenHash: authDomain.HashToken("pat-credentials-secret"),
+			Scopes:    []string{},
+		}))
+		require.NoError(t, deps.PasskeyRepo.Create(ctx, &authDomain.WebAuthnCredential{
+			ID:           uuid.New(),
+			UserID:       user.ID,
+			Name:         "Laptop",
+			CredentialID: []byte("credentials-passkey"),
+			PublicKey:    []byte("public-key"),
+		}))
+		identity := &authDomain.Identity{
+			ID:       uuid.New(),
+			UserID:   user.ID,
+			Provider: "mock",
+			Subject:  "credentials-subject",
+			Email:    user.Email,
+		}
+		require.NoError(t, deps.IdentityRepo.Create(ctx, identity))
+		roles := rbacRepository.NewRoleRepository(deps.TestDB.Database)
+		reader := &rbacDomain.Role{Name: "credentials-reader", Permissions: []string{"users:read"}}
+		require.NoError(t, roles.Create(ctx, reader))
+		require.NoError(t, roles.Assign(ctx, user.ID, reader.ID))
+		serviceAccounts := serviceAccountRepository.NewServiceAccountRepository(deps.TestDB.Database)
+		account := &serviceAccountDomain.ServiceAccount{
+			ID: uuid.New(), Name: "owned", Role: userDomain.RoleUser, OwnerID: user.ID,
+		}
+		require.NoError(t, serviceAccounts.Create(ctx, account))
+
+		require.NoError(t, deps.UserService.Delete(ctx, user.ID))
+
+		accessTokens, err := deps.AccessTokenRepo.GetByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, accessTokens)
+		passkeys, err := deps.PasskeyRepo.GetByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, passkeys)
+		stored, err := deps.IdentityRepo.GetByProviderSubject(ctx, "mock", "credentials-subject")
+		require.NoError(t, err)
+		assert.Nil(t, stored, "the provider subject can sign in again as a new account")
+		assigned, err := roles.ListForUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, assigned)
+		owned, err := serviceAccounts.GetByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Nil(t, owned)
+	})
+
+	t.Run("The Last Admin Cannot Be Removed", func(t *testing.T) {
+		adminToken := shared.CreateAndLoginUser(
+			t, deps, "last-admin@example.com", "password123", "Last Admin", userDomain.RoleAdmin,
+		)
+		admin, err := deps.UserService.GetByEmail(ctx, "last-admin@example.com")
+		require.NoError(t, err)
+		url := "/api/users/" + admin.ID.String()
+
+		users, err := deps.UserService.GetAll(ctx)
+		require.NoError(t, err)
+		for _, user := range users {
+			if user.Role == userDomain.RoleAdmin && user.ID != admin.ID {
+				w := do(http.MethodDelete, "/api/users/"+user.ID.String(), adminToken, nil)
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			}
+		}
+
+		assert.Equal(t, http.StatusConflict, do(http.MethodPatch, url, adminToken, `{"role": "user"}`).Code)
+		assert.Equal(t, http.StatusConflict, do(http.MethodDelete, url, adminToken, nil).Code)
+
+		user, err := deps.UserService.GetByID(ctx, admin.ID)
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, userDomain.RoleAdmin, user.Role)
+	})
 }